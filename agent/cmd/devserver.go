@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/devserver"
+	"github.com/memlab/agent/internal/logging"
+	"github.com/pkg/errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type devServerCommand struct {
+	Address   string        `short:"a" long:"address" description:"Listen address" default:"127.0.0.1:8000"`
+	Token     string        `short:"t" long:"token" description:"Api token agents must present" default:"dev-token"`
+	Latency   time.Duration `long:"latency" description:"Latency added to agent requests" default:"0s"`
+	ErrorRate float64       `long:"error-rate" description:"Probability of failing agent requests with a 5xx"`
+	DropRate  float64       `long:"drop-rate" description:"Probability of dropping agent connections"`
+}
+
+// Runs an in-memory mock of the dashboard backend, see internal/devserver.
+func (c *devServerCommand) Execute(_ []string) error {
+	devLogger, err := logging.NewLogger("memlab-devserver", options.Debug)
+	if err != nil {
+		return errors.WithMessage(err, "new logger")
+	}
+
+	config := &devserver.Config{
+		Address: c.Address,
+		Token:   c.Token,
+		Faults: &devserver.Faults{
+			Latency:   c.Latency,
+			ErrorRate: c.ErrorRate,
+			DropRate:  c.DropRate,
+		},
+	}
+
+	server, err := devserver.NewServer(devLogger, config)
+	if err != nil {
+		return errors.WithMessage(err, "new dev server")
+	}
+
+	if err := server.Start(); err != nil {
+		return errors.WithMessage(err, "start dev server")
+	}
+	fmt.Printf("Dev server listening on http://%s (token: '%s')\n", c.Address, c.Token)
+
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+	<-stopChan
+
+	if err := server.Stop(); err != nil {
+		return errors.WithMessage(err, "stop dev server")
+	}
+	server.WaitUntilCompletion()
+	return nil
+}
@@ -5,8 +5,23 @@ import (
 	"github.com/jessevdk/go-flags"
 	"github.com/memlab/agent/internal/client"
 	"github.com/memlab/agent/internal/control"
+	"github.com/memlab/agent/internal/customcommand"
 	"github.com/memlab/agent/internal/detection"
+	"github.com/memlab/agent/internal/fds"
+	"github.com/memlab/agent/internal/goruntime"
+	"github.com/memlab/agent/internal/hostsnapshot"
+	"github.com/memlab/agent/internal/jvm"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/kmsg"
+	"github.com/memlab/agent/internal/kubernetes"
 	"github.com/memlab/agent/internal/logging"
+	"github.com/memlab/agent/internal/logtail"
+	"github.com/memlab/agent/internal/memorymap"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/stacktrace"
+	"github.com/memlab/agent/internal/threads"
+	"github.com/memlab/agent/internal/trace"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"os"
@@ -16,15 +31,88 @@ import (
 )
 
 var options struct {
-	MaxConcurrentDetectors int  `short:"m" long:"max-detectors" description:"Max concurrent detectors" default:"5"`
-	Debug                  bool `short:"d" long:"debug" description:"Debug mode"`
+	MaxConcurrentDetectors int    `short:"m" long:"max-detectors" description:"Max concurrent detectors" default:"5"`
+	Debug                  bool   `short:"d" long:"debug" description:"Debug mode"`
+	SimulateKernel         bool   `long:"simulate-kernel" description:"Use an in-memory kernel module simulator"`
+	RecordTrace            string `long:"record-trace" description:"Record detection events to a trace file, for replays"`
 
 	// todo: move below to a config file.
 	HostStatusReportInterval               time.Duration `short:"s" long:"host-status-interval" description:"Host status report interval" default:"1m"`
 	ProcessListReportInterval              time.Duration `short:"p" long:"process-list-interval" description:"Process list report interval" default:"30s"`
 	DetectionConfigurationsPollingInterval time.Duration `short:"c" long:"detection-configs-interval" description:"Detection configurations polling interval" default:"5s"`
 	ApiUrl                                 string        `short:"u" long:"api-url" description:"Api URL"`
-	ApiToken                               string        `short:"t" long:"api-token" description:"Api token"`
+	ApiToken                               string        `short:"t" long:"api-token" env:"MEMLAB_API_TOKEN" description:"Api token"`
+
+	Operators struct {
+		Environment bool `long:"environment" description:"Collect processes' environment (redacted), limits, credentials and namespaces when a signal is caught"`
+
+		MemoryMap                bool `long:"memory-map" description:"Collect the breakdown of processes' memory by mapping when a signal is caught"`
+		MemoryMapMaxTopConsumers int  `long:"memory-map-top" description:"Max top consuming files and mappings to report" default:"10"`
+
+		Fds       bool `long:"fds" description:"Collect the inventory of processes' fds when a signal is caught"`
+		FdsMaxFds int  `long:"fds-max" description:"Max fds to detail, beyond which they're only counted" default:"1024"`
+
+		Threads           bool `long:"threads" description:"Collect the states and scheduler statistics of processes' threads when a signal is caught"`
+		ThreadsMaxThreads int  `long:"threads-max" description:"Max threads to detail, beyond which they're only summarized" default:"1024"`
+
+		StackTraces           bool `long:"stack-traces" description:"Collect threads' stack traces when a signal is caught"`
+		StackTracesMaxThreads int  `long:"stack-traces-max-threads" description:"Max threads to collect stack traces of" default:"256"`
+		StackTracesMaxFrames  int  `long:"stack-traces-max-frames" description:"Max frames per stack trace" default:"64"`
+
+		Logs               bool          `long:"logs" description:"Collect the last lines of processes' log files, journal and container logs (redacted) when a signal is caught"`
+		LogsMaxLines       int           `long:"logs-max-lines" description:"Max lines to collect of each log" default:"200"`
+		LogsMaxAge         time.Duration `long:"logs-max-age" description:"Max age of timestamped lines (of the journal and container logs) to collect, unlimited if 0" default:"5m"`
+		LogsMaxBytes       int64         `long:"logs-max-bytes" description:"Max bytes to read from the end of each log" default:"65536"`
+		LogsMaxFiles       int           `long:"logs-max-files" description:"Max log files written by processes to collect" default:"8"`
+		LogsJournalctlPath string        `long:"logs-journalctl-path" description:"Path of journalctl, used to read the journal (disabled if empty)" default:"journalctl"`
+
+		HostSnapshot               bool          `long:"host-snapshot" description:"Collect the host's CPU, memory, pressure and disks usage, and its top consuming processes, when a signal is caught"`
+		HostSnapshotTopProcesses   int           `long:"host-snapshot-top" description:"Max top CPU and memory consuming processes to report" default:"10"`
+		HostSnapshotSampleInterval time.Duration `long:"host-snapshot-sample-interval" description:"Interval over which CPU usage is sampled" default:"1s"`
+
+		KernelMessages            bool          `long:"kernel-messages" description:"Collect kernel messages about processes (e.g, segfaults, OOM kills and hung tasks) when a signal is caught or they're OOM killed"`
+		KernelMessagesMaxMessages int           `long:"kernel-messages-max" description:"Max kernel messages to collect" default:"100"`
+		KernelMessagesMaxAge      time.Duration `long:"kernel-messages-max-age" description:"Max age of kernel messages to collect, unlimited if 0" default:"1h"`
+
+		GoRuntime             bool          `long:"go-runtime" description:"Collect Go processes' build info, and goroutines from their pprof endpoint"`
+		GoPprofPort           int           `long:"go-pprof-port" description:"Port of Go processes' pprof endpoint, discovered among their listening sockets if 0" default:"0"`
+		GoHeapProfile         bool          `long:"go-heap-profile" description:"Collect Go processes' heap profile"`
+		GoCpuProfileDuration  time.Duration `long:"go-cpu-profile-duration" description:"Duration of Go processes' cpu profile, disabled if 0" default:"0s"`
+		GoMaxResponseSize     int64         `long:"go-max-response-size" description:"Max size of Go processes' goroutines dump and profiles" default:"4194304"`
+		GoPprofRequestTimeout time.Duration `long:"go-pprof-request-timeout" description:"Timeout of requests to Go processes' pprof endpoint" default:"10s"`
+
+		Jvm                bool          `long:"jvm" description:"Collect JVMs' thread dump via the attach mechanism"`
+		JvmClassHistogram  bool          `long:"jvm-class-histogram" description:"Collect JVMs' class histogram"`
+		JvmHeapDump        bool          `long:"jvm-heap-dump" description:"Dump JVMs' heap"`
+		JvmHeapDumpDir     string        `long:"jvm-heap-dump-dir" description:"Dir of heap dumps, in JVMs' mount namespace" default:"/tmp"`
+		JvmAttachTimeout   time.Duration `long:"jvm-attach-timeout" description:"Max time to wait for JVMs' attach listener to start" default:"5s"`
+		JvmCommandTimeout  time.Duration `long:"jvm-command-timeout" description:"Timeout of each command sent to JVMs" default:"30s"`
+		JvmMaxResponseSize int64         `long:"jvm-max-response-size" description:"Max size of JVMs' thread dump and class histogram" default:"4194304"`
+
+		Commands           []string      `long:"command" description:"Absolute path of an executable to run (with the process' pid as its argument, and the detection's details in its environment) on detections, repeatable"`
+		CommandsTimeout    time.Duration `long:"command-timeout" description:"Timeout of each command" default:"30s"`
+		CommandsMaxOutput  int64         `long:"command-max-output" description:"Max size of each command's stdout and stderr" default:"65536"`
+		CommandsUid        int           `long:"command-uid" description:"Uid to run commands as, the agent's if -1" default:"-1"`
+		CommandsGid        int           `long:"command-gid" description:"Gid to run commands as, the agent's if -1" default:"-1"`
+		CommandsHoldSignal bool          `long:"command-hold-signal" description:"Run commands while caught signals are held, cancelling them once released"`
+	} `group:"Operators Options"`
+
+	Redaction struct {
+		Disabled         bool     `long:"no-redaction" description:"Report secrets (e.g, in command lines and environments) as they are"`
+		KeyPatterns      []string `long:"redact-key-pattern" description:"Glob of keys (e.g, flags and environment variables) whose values are redacted, replacing the defaults (repeatable)"`
+		EntropyThreshold float64  `long:"redact-entropy-threshold" description:"Bits per character above which values are redacted as random, 0 disables" default:"4.2"`
+		MinSecretLength  int      `long:"redact-min-secret-length" description:"Min length of values redacted as random" default:"32"`
+	} `group:"Redaction Options"`
+
+	Kubernetes struct {
+		Enabled             bool          `long:"kubernetes" description:"Run as a Kubernetes DaemonSet, scoped to the node's pods"`
+		NodeName            string        `long:"node-name" env:"NODE_NAME" description:"Node's name, identifies the agent's machine"`
+		ApiServerUrl        string        `long:"kube-api-url" description:"Kubernetes API server's url" default:"https://kubernetes.default.svc"`
+		ApiServerTokenFile  string        `long:"kube-api-token-file" description:"Token authorizing Kubernetes API requests" default:"/var/run/secrets/kubernetes.io/serviceaccount/token"`
+		ApiServerCaFile     string        `long:"kube-api-ca-file" description:"CA verifying the Kubernetes API server's certificate" default:"/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"`
+		PodsFile            string        `long:"pods-file" description:"Read the node's pods from a file (in the API server's format) instead of the API server"`
+		PodsRefreshInterval time.Duration `long:"pods-refresh-interval" description:"Node's pods refresh interval" default:"10s"`
+	} `group:"Kubernetes Options"`
 }
 
 const (
@@ -34,16 +122,37 @@ const (
 var (
 	logger       *zap.Logger
 	controlPlane *control.Plane
-	signalsChan  = make(chan os.Signal)
+	signalsChan  = make(chan os.Signal, 1)
 )
 
 // todo: prettify code
 
 func main() {
-	_, err := flags.Parse(&options)
+	parser := flags.NewParser(&options, flags.Default)
+	parser.SubcommandsOptional = true // Run agent when no command is given.
+
+	_, err := parser.AddCommand("devserver", "Run a mock backend server",
+		"Run an in-memory mock of the dashboard backend for local development and integration tests",
+		&devServerCommand{})
+	if err != nil {
+		fmt.Printf("Failed to add command: %v\n", err)
+		os.Exit(exitCodeErr)
+	}
+
+	_, err = parser.AddCommand("replay", "Replay a recorded trace",
+		"Replay a trace recorded with --record-trace against a simulated kernel module, and compare the reports",
+		&replayCommand{})
+	if err != nil {
+		fmt.Printf("Failed to add command: %v\n", err)
+		os.Exit(exitCodeErr)
+	}
+
+	_, err = parser.Parse()
 	if err != nil {
 		fmt.Printf("Failed to parse arguments: %v\n", err)
 		os.Exit(exitCodeErr)
+	} else if parser.Active != nil { // Command was already executed by the parser.
+		return
 	}
 
 	logger, err = logging.NewLogger("memlab-agent", options.Debug)
@@ -72,7 +181,39 @@ func setupSignalHandling() {
 }
 
 func startAgent() error {
-	detectionController, err := detection.NewController(logger, options.MaxConcurrentDetectors)
+	dialKernelChannel := kernelComm.DialKernelModule
+	if options.SimulateKernel {
+		logger.Warn("Using a simulated kernel module, no signals will be caught")
+		simulator := kernelComm.NewSimulator(logger)
+		dialKernelChannel = func(*zap.Logger) (kernelComm.KernelChannel, error) {
+			return simulator, nil
+		}
+	}
+
+	var recorder *trace.Recorder // Nil unless recording.
+	if options.RecordTrace != "" {
+		var err error
+		recorder, err = trace.NewRecorder(logger, options.RecordTrace)
+		if err != nil {
+			return errors.WithMessage(err, "new trace recorder")
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				logger.Error("Failed to close trace recorder", zap.Error(err))
+			}
+		}()
+
+		dialUnrecordedKernelChannel := dialKernelChannel
+		dialKernelChannel = func(rootLogger *zap.Logger) (kernelComm.KernelChannel, error) {
+			kernelChannel, err := dialUnrecordedKernelChannel(rootLogger)
+			if err != nil {
+				return nil, err
+			}
+			return trace.NewRecordingChannel(kernelChannel, recorder), nil
+		}
+	}
+
+	detectionController, err := detection.NewController(logger, options.MaxConcurrentDetectors, dialKernelChannel)
 	if err != nil {
 		return errors.WithMessage(err, "new detection controller")
 	}
@@ -82,14 +223,102 @@ func startAgent() error {
 		Token: options.ApiToken,
 	}
 
+	operatorsConfig := &operators.Config{
+		Environment: options.Operators.Environment,
+	}
+	if options.Operators.MemoryMap {
+		operatorsConfig.MemoryMap = &memorymap.Config{
+			MaxTopConsumers: options.Operators.MemoryMapMaxTopConsumers,
+		}
+	}
+	if options.Operators.Fds {
+		operatorsConfig.Fds = &fds.Config{
+			MaxFds: options.Operators.FdsMaxFds,
+		}
+	}
+	if options.Operators.Threads {
+		operatorsConfig.Threads = &threads.Config{
+			MaxThreads: options.Operators.ThreadsMaxThreads,
+		}
+	}
+	if options.Operators.StackTraces {
+		operatorsConfig.StackTraces = &stacktrace.Config{
+			MaxThreads: options.Operators.StackTracesMaxThreads,
+			MaxFrames:  options.Operators.StackTracesMaxFrames,
+		}
+	}
+	if options.Operators.Logs {
+		operatorsConfig.Logs = &logtail.Config{
+			MaxLines:       options.Operators.LogsMaxLines,
+			MaxAge:         options.Operators.LogsMaxAge,
+			MaxBytes:       options.Operators.LogsMaxBytes,
+			MaxFiles:       options.Operators.LogsMaxFiles,
+			JournalctlPath: options.Operators.LogsJournalctlPath,
+		}
+	}
+	if options.Operators.HostSnapshot {
+		operatorsConfig.HostSnapshot = &hostsnapshot.Config{
+			TopProcesses:   options.Operators.HostSnapshotTopProcesses,
+			SampleInterval: options.Operators.HostSnapshotSampleInterval,
+		}
+	}
+	if options.Operators.KernelMessages {
+		operatorsConfig.KernelMessages = &kmsg.Config{
+			MaxMessages: options.Operators.KernelMessagesMaxMessages,
+			MaxAge:      options.Operators.KernelMessagesMaxAge,
+		}
+	}
+	if options.Operators.GoRuntime {
+		operatorsConfig.GoRuntime = &goruntime.Config{
+			PprofPort:          options.Operators.GoPprofPort,
+			HeapProfile:        options.Operators.GoHeapProfile,
+			CpuProfileDuration: options.Operators.GoCpuProfileDuration,
+			MaxResponseSize:    options.Operators.GoMaxResponseSize,
+			RequestTimeout:     options.Operators.GoPprofRequestTimeout,
+		}
+	}
+	if options.Operators.Jvm {
+		operatorsConfig.Jvm = &jvm.Config{
+			ClassHistogram:  options.Operators.JvmClassHistogram,
+			HeapDump:        options.Operators.JvmHeapDump,
+			HeapDumpDir:     options.Operators.JvmHeapDumpDir,
+			AttachTimeout:   options.Operators.JvmAttachTimeout,
+			CommandTimeout:  options.Operators.JvmCommandTimeout,
+			MaxResponseSize: options.Operators.JvmMaxResponseSize,
+		}
+	}
+	if len(options.Operators.Commands) > 0 {
+		operatorsConfig.CustomCommands = &customcommand.Config{
+			Paths:         options.Operators.Commands,
+			Timeout:       options.Operators.CommandsTimeout,
+			MaxOutputSize: options.Operators.CommandsMaxOutput,
+			Uid:           options.Operators.CommandsUid,
+			Gid:           options.Operators.CommandsGid,
+			HoldSignal:    options.Operators.CommandsHoldSignal,
+		}
+	}
+
 	controlPlaneConfig := &control.PlaneConfig{
 		ApiConfig:                              apiConfig,
 		HostStatusReportInterval:               options.HostStatusReportInterval,
 		ProcessListReportInterval:              options.ProcessListReportInterval,
 		DetectionConfigurationsPollingInterval: options.DetectionConfigurationsPollingInterval,
+		Operators:                              operatorsConfig,
+		Redaction:                              redactionConfig(),
 	}
 
-	controlPlane, err = control.NewPlane(logger, controlPlaneConfig, detectionController)
+	if options.Kubernetes.Enabled {
+		controlPlaneConfig.Kubernetes = &kubernetes.Config{
+			NodeName:            options.Kubernetes.NodeName,
+			ApiServerUrl:        options.Kubernetes.ApiServerUrl,
+			ApiServerTokenFile:  options.Kubernetes.ApiServerTokenFile,
+			ApiServerCaFile:     options.Kubernetes.ApiServerCaFile,
+			PodsFile:            options.Kubernetes.PodsFile,
+			PodsRefreshInterval: options.Kubernetes.PodsRefreshInterval,
+		}
+	}
+
+	controlPlane, err = control.NewPlane(logger, controlPlaneConfig, detectionController, recorder)
 	if err != nil {
 		return errors.WithMessage(err, "new control plane")
 	}
@@ -112,3 +341,20 @@ func stopAgent() error {
 
 	return nil
 }
+
+// Returns nil if redaction is disabled.
+func redactionConfig() *redaction.Config {
+	if options.Redaction.Disabled {
+		return nil
+	}
+
+	config := &redaction.Config{
+		KeyPatterns:      redaction.DefaultKeyPatterns,
+		EntropyThreshold: options.Redaction.EntropyThreshold,
+		MinSecretLength:  options.Redaction.MinSecretLength,
+	}
+	if len(options.Redaction.KeyPatterns) > 0 {
+		config.KeyPatterns = options.Redaction.KeyPatterns
+	}
+	return config
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/logging"
+	"github.com/memlab/agent/internal/trace"
+	"github.com/memlab/agent/internal/trace/replay"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+type replayCommand struct {
+	Trace        string        `short:"f" long:"trace" description:"Trace file to replay" required:"true"`
+	Output       string        `short:"o" long:"output" description:"Write replayed reports to a trace file"`
+	Speed        float64       `long:"speed" description:"Replay speed relative to the recording, 0 skips gaps between events" default:"0"`
+	EventTimeout time.Duration `long:"event-timeout" description:"Max time to wait for a replayed event's outcome" default:"15s"`
+}
+
+// Replays a recorded trace, failing if replayed reports don't match the recorded ones.
+func (c *replayCommand) Execute(_ []string) error {
+	replayLogger, err := logging.NewLogger("memlab-replay", options.Debug)
+	if err != nil {
+		return errors.WithMessage(err, "new logger")
+	}
+
+	events, err := trace.ReadEvents(c.Trace)
+	if err != nil {
+		return errors.WithMessage(err, "read trace")
+	}
+
+	config := &replay.Config{
+		Speed:                  c.Speed,
+		MaxConcurrentDetectors: options.MaxConcurrentDetectors,
+		EventTimeout:           c.EventTimeout,
+	}
+
+	replayer, err := replay.NewReplayer(replayLogger, config, events)
+	if err != nil {
+		return errors.WithMessage(err, "new replayer")
+	}
+
+	result, err := replayer.Run()
+	if err != nil {
+		return errors.WithMessage(err, "replay trace")
+	}
+
+	if c.Output != "" {
+		if err := writeReplayedReports(replayLogger, c.Output, result); err != nil {
+			return errors.WithMessage(err, "write replayed reports")
+		}
+	}
+
+	fmt.Printf("Replayed %d events, got %d reports\n", len(events), len(result.Reports))
+	if !result.Matches() {
+		for _, mismatch := range result.Mismatches {
+			fmt.Printf("Mismatch: %s\n", mismatch)
+		}
+		return errors.Errorf("%d mismatches between recorded and replayed reports", len(result.Mismatches))
+	}
+	return nil
+}
+
+func writeReplayedReports(rootLogger *zap.Logger, path string, result *replay.Result) error {
+	recorder, err := trace.NewRecorder(rootLogger, path)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range result.Reports {
+		recorder.RecordReport(report)
+	}
+	return recorder.Close()
+}
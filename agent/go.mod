@@ -1,13 +1,11 @@
 module github.com/memlab/agent
 
-go 1.13
+go 1.18
 
 require (
-	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
 	github.com/cenkalti/backoff/v4 v4.0.2
 	github.com/denisbrodbeck/machineid v1.0.1
 	github.com/glendc/go-external-ip v0.0.0-20200601212049-c872357d968e
-	github.com/go-ole/go-ole v1.2.4 // indirect
 	github.com/hashicorp/go-multierror v1.1.0
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/mdlayher/genetlink v1.0.0
@@ -15,5 +13,15 @@ require (
 	github.com/pkg/errors v0.8.1
 	github.com/shirou/gopsutil v2.20.7+incompatible
 	go.uber.org/zap v1.15.0
+	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5
 	gopkg.in/guregu/null.v3 v3.5.0
 )
+
+require (
+	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
+	github.com/go-ole/go-ole v1.2.4 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
+)
@@ -0,0 +1,15 @@
+package models
+
+// Container a process runs in. Kubernetes fields are only set for containers of pods.
+type Container struct {
+	Runtime      string `json:"runtime"`
+	ID           string `json:"id"`
+	Name         string `json:"name,omitempty"` // Kubernetes container name, for containers of pods.
+	Image        string `json:"image,omitempty"`
+	PodName      string `json:"pod_name,omitempty"`
+	PodNamespace string `json:"pod_namespace,omitempty"`
+	PodUid       string `json:"pod_uid,omitempty"`
+
+	// Only known when pods are discovered via the API server (see internal/kubernetes).
+	PodLabels map[string]string `json:"pod_labels,omitempty"`
+}
@@ -2,24 +2,63 @@ package models
 
 import (
 	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
 	"gopkg.in/guregu/null.v3"
+	"time"
 )
 
+// Signal hold budgets must leave the kernel module's own hold timeout (see wait_timeout_seconds in
+// kernel/ml_crash_detector.h) some slack, so the agent is the one releasing held signals.
+const MaxSignalHoldBudget = time.Second * 50
+
 type DetectionConfiguration struct {
-	ID                       string    `json:"id,omitempty"`
-	Pid                      types.Pid `json:"pid"`
-	CreatedAt                null.Time `json:"created_at"`
-	ModifiedAt               null.Time `json:"modified_at"`
-	DetectSignals            bool      `json:"detect_signals"`
-	DetectThresholds         bool      `json:"detect_thresholds"`
-	DetectSuspectedHangs     bool      `json:"detect_suspected_hangs"`
-	CpuThreshold             int       `json:"cpu_threshold"`
-	MemoryThreshold          int       `json:"memory_threshold"`
-	SuspectedHangDuration    uint64    `json:"suspected_hang_duration"`
-	RestartOnSignal          bool      `json:"restart_on_signal"`
-	RestartOnCpuThreshold    bool      `json:"restart_on_cpu_threshold"`
-	RestartOnMemoryThreshold bool      `json:"restart_on_memory_threshold"`
-	RestartOnSuspectedHang   bool      `json:"restart_on_suspected_hang"`
-	IsRelevant               bool      `json:"is_relevant,omitempty"`
-	ProcessCreateTime        null.Time `json:"process_create_time,omitempty"`
+	ID                       string           `json:"id,omitempty"`
+	Pid                      types.Pid        `json:"pid"`
+	Selector                 *ProcessSelector `json:"selector,omitempty"` // Targets processes instead of a pid.
+	CreatedAt                null.Time        `json:"created_at"`
+	ModifiedAt               null.Time        `json:"modified_at"`
+	DetectSignals            bool             `json:"detect_signals"`
+	Signals                  []int            `json:"signals,omitempty"`
+	SignalHoldBudget         uint64           `json:"signal_hold_budget,omitempty"` // Milliseconds, 0 for default.
+	DetectThresholds         bool             `json:"detect_thresholds"`
+	DetectSuspectedHangs     bool             `json:"detect_suspected_hangs"`
+	DetectOomKills           bool             `json:"detect_oom_kills"`
+	CpuThreshold             int              `json:"cpu_threshold"`
+	MemoryThreshold          int              `json:"memory_threshold"`
+	SuspectedHangDuration    uint64           `json:"suspected_hang_duration"`
+	RestartOnSignal          bool             `json:"restart_on_signal"`
+	RestartOnCpuThreshold    bool             `json:"restart_on_cpu_threshold"`
+	RestartOnMemoryThreshold bool             `json:"restart_on_memory_threshold"`
+	RestartOnSuspectedHang   bool             `json:"restart_on_suspected_hang"`
+	IsRelevant               bool             `json:"is_relevant,omitempty"`
+	ProcessCreateTime        null.Time        `json:"process_create_time,omitempty"`
+}
+
+// Whether config targets processes by selector. Agents expand such configs into a config per matching process, which
+// keeps the selector.
+func (dc *DetectionConfiguration) SelectsProcesses() bool {
+	return dc.Selector != nil
+}
+
+// An empty signal list results in an empty mask, meaning the kernel module's default mask is used. Hence, holding no
+// signals at all isn't expressible by the list, but by turning signal detection off.
+func (dc *DetectionConfiguration) SignalMask() (types.SignalMask, error) {
+	return types.NewSignalMask(dc.Signals...)
+}
+
+// Zero stands for the agent's default budget.
+func (dc *DetectionConfiguration) SignalHoldBudgetDuration() (time.Duration, error) {
+	budget := time.Duration(dc.SignalHoldBudget) * time.Millisecond
+	if dc.SignalHoldBudget > uint64(MaxSignalHoldBudget/time.Millisecond) {
+		return 0, errors.Errorf("signal hold budget '%s' exceeds max '%s'", budget, MaxSignalHoldBudget)
+	}
+	return budget, nil
+}
+
+// Sent along when marking a detection config irrelevant since its process exited. Exit code or signal are only set
+// when known.
+type ProcessExit struct {
+	ExitCode   null.Int  `json:"process_exit_code"`
+	ExitSignal null.Int  `json:"process_exit_signal"`
+	ExitedAt   null.Time `json:"process_exited_at"`
 }
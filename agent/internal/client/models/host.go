@@ -16,4 +16,6 @@ type Host struct {
 	KernelArch           string    `json:"kernel_architecture"`
 	VirtualizationSystem string    `json:"virtualization_system"`
 	VirtualizationRole   string    `json:"virtualization_role"`
+	KernelModuleVersion  string    `json:"kernel_module_version,omitempty"`
+	KernelModuleProtocol uint32    `json:"kernel_module_protocol_version,omitempty"`
 }
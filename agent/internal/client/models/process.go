@@ -7,15 +7,21 @@ import (
 )
 
 type Process struct {
-	ID             string    `json:"id,omitempty"`
-	Pid            types.Pid `json:"pid"`
-	Executable     string    `json:"executable"`
-	CommandLine    string    `json:"command_line"`
-	CreateTime     null.Time `json:"create_time"`
-	LastSeenAt     null.Time `json:"last_seen_at"`
-	Monitored      bool      `json:"monitored,omitempty"`
-	MonitoredSince null.Time `json:"monitored_since,omitempty"`
-	Status         string    `json:"status"`
+	ID             string     `json:"id,omitempty"`
+	Pid            types.Pid  `json:"pid"`
+	Executable     string     `json:"executable"`
+	CommandLine    string     `json:"command_line"`
+	CreateTime     null.Time  `json:"create_time"`
+	LastSeenAt     null.Time  `json:"last_seen_at"`
+	Monitored      bool       `json:"monitored,omitempty"`
+	MonitoredSince null.Time  `json:"monitored_since,omitempty"`
+	Status         string     `json:"status"`
+	Uid            null.Int   `json:"uid"` // Effective uid.
+	CgroupPath     string     `json:"cgroup_path,omitempty"`
+	SystemdUnit    string     `json:"systemd_unit,omitempty"`
+	ContainerId    string     `json:"container_id,omitempty"`
+	Container      *Container `json:"container,omitempty"`
+	NamespacedPid  types.Pid  `json:"namespaced_pid,omitempty"` // Pid in its own pid namespace, if not the host's.
 }
 
 func (p *Process) LiveProcess() (*psUtil.Process, error) {
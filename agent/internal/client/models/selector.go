@@ -0,0 +1,54 @@
+package models
+
+import (
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+	"path"
+	"regexp"
+)
+
+// ProcessSelector targets all processes matching every criterion which is set.
+type ProcessSelector struct {
+	ExecutableGlob string   `json:"executable_glob,omitempty"` // Matched against the base name if it has no '/'.
+	CmdlineRegex   string   `json:"cmdline_regex,omitempty"`
+	Uid            null.Int `json:"uid"`                   // Effective uid.
+	CgroupPath     string   `json:"cgroup_path,omitempty"` // Matches the cgroup itself and its descendants.
+	SystemdUnit    string   `json:"systemd_unit,omitempty"`
+	ContainerId    string   `json:"container_id,omitempty"` // Full or short (prefix) id.
+
+	// Kubernetes label selector (e.g "app=web,tier in (api,worker)"), matched against the labels of processes' pods.
+	PodLabelSelector string `json:"pod_label_selector,omitempty"`
+	PodNamespace     string `json:"pod_namespace,omitempty"`
+}
+
+func (ps *ProcessSelector) Valid() (bool, error) {
+	if ps.ExecutableGlob == "" && ps.CmdlineRegex == "" && !ps.Uid.Valid && ps.CgroupPath == "" &&
+		ps.SystemdUnit == "" && ps.ContainerId == "" && ps.PodLabelSelector == "" && ps.PodNamespace == "" {
+		return false, errors.New("empty selector")
+	}
+
+	if ps.ExecutableGlob != "" {
+		if _, err := path.Match(ps.ExecutableGlob, ""); err != nil {
+			return false, errors.WithMessagef(err, "invalid executable glob '%s'", ps.ExecutableGlob)
+		}
+	}
+
+	if ps.CmdlineRegex != "" {
+		if _, err := regexp.Compile(ps.CmdlineRegex); err != nil {
+			return false, errors.WithMessagef(err, "invalid cmdline regex '%s'", ps.CmdlineRegex)
+		}
+	}
+
+	if ps.PodLabelSelector != "" {
+		if _, err := types.ParseLabelSelector(ps.PodLabelSelector); err != nil {
+			return false, errors.WithMessagef(err, "invalid pod label selector '%s'", ps.PodLabelSelector)
+		}
+	}
+
+	if ps.Uid.Valid && ps.Uid.Int64 < 0 {
+		return false, errors.New("negative uid")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,66 @@
+package containers
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+type Runtime string
+
+const (
+	RuntimeDocker     Runtime = "docker"
+	RuntimeContainerd Runtime = "containerd"
+	RuntimeCrio       Runtime = "cri-o"
+	RuntimePodman     Runtime = "podman"
+)
+
+var (
+	// Matches container ids in cgroup path segments of common runtimes, e.g "<id>" (as in "/docker/<id>" or
+	// "/kubepods/burstable/pod<uid>/<id>"), "docker-<id>.scope", "cri-containerd-<id>.scope", "crio-<id>.scope" or
+	// "libpod-<id>.scope".
+	containerIdPattern = regexp.MustCompile(`^(?:([a-z-]+)-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+	// Matches pod uids in cgroup path segments of either cgroup driver, e.g "pod<uid>" or
+	// "kubepods-burstable-pod<uid with underscores>.slice".
+	podUidPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+	runtimePrefixes = map[string]Runtime{
+		"docker":         RuntimeDocker,
+		"cri-containerd": RuntimeContainerd,
+		"crio":           RuntimeCrio,
+		"libpod":         RuntimePodman,
+	}
+)
+
+// Identifies the container a cgroup path belongs to. Runtime is empty when the path doesn't tell (e.g, with the
+// cgroupfs driver), in which case it's found by looking the container up in each runtime's state directory.
+type cgroupContainer struct {
+	runtime Runtime
+	id      string
+	podUid  string
+}
+
+func parseCgroupPath(cgroupPath string) (*cgroupContainer, bool) {
+	segments := strings.Split(strings.Trim(cgroupPath, "/"), "/")
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		match := containerIdPattern.FindStringSubmatch(segments[i])
+		if match == nil {
+			continue
+		}
+
+		container := &cgroupContainer{
+			runtime: runtimePrefixes[match[1]],
+			id:      match[2],
+		}
+		if match[1] == "" && i > 0 && segments[i-1] == "docker" {
+			container.runtime = RuntimeDocker
+		}
+		if podMatch := podUidPattern.FindStringSubmatch(path.Join(segments[:i]...)); podMatch != nil {
+			container.podUid = strings.Replace(podMatch[1], "_", "-", -1)
+		}
+		return container, true
+	}
+	return nil, false
+}
@@ -0,0 +1,94 @@
+package containers
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns a process' pid in each of the pid namespaces it's in, from the host's down to its own (see NSpid in
+// proc(5)). Kernels older than 4.1 don't report NSpid, in which case only the host pid is returned.
+func NamespacedPids(pid types.Pid) ([]types.Pid, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open status of pid '%d'", pid)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		pids := make([]types.Pid, 0, len(fields))
+		for _, field := range fields {
+			namespacedPid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "parse NSpid of pid '%d'", pid)
+			}
+			pids = append(pids, types.Pid(namespacedPid))
+		}
+		return pids, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read status of pid '%d'", pid)
+	}
+	return []types.Pid{pid}, nil
+}
+
+// Returns a process' pid in its own pid namespace, which is its host pid unless it runs in a container.
+func NamespacedPid(pid types.Pid) (types.Pid, error) {
+	pids, err := NamespacedPids(pid)
+	if err != nil {
+		return 0, err
+	}
+	return pids[len(pids)-1], nil
+}
+
+// Translates a pid as seen from within the pid namespace of a reference process (e.g, a pid found in a container's
+// logs) into a host pid.
+func HostPid(referencePid types.Pid, namespacedPid types.Pid) (types.Pid, error) {
+	referenceNamespace, err := pidNamespace(referencePid)
+	if err != nil {
+		return 0, err
+	}
+
+	procEntries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, errors.WithMessage(err, "list processes")
+	}
+
+	for _, procEntry := range procEntries {
+		hostPid, err := strconv.ParseUint(procEntry.Name(), 10, 32)
+		if err != nil {
+			continue // Not a process.
+		}
+
+		// Processes might exit while iterating, so errors only mean they're not the one.
+		if namespace, err := pidNamespace(types.Pid(hostPid)); err != nil || namespace != referenceNamespace {
+			continue
+		}
+		if pid, err := NamespacedPid(types.Pid(hostPid)); err == nil && pid == namespacedPid {
+			return types.Pid(hostPid), nil
+		}
+	}
+
+	return 0, errors.Errorf("no process with pid '%d' in the pid namespace of pid '%d'", namespacedPid, referencePid)
+}
+
+func pidNamespace(pid types.Pid) (string, error) {
+	namespace, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", pid))
+	if err != nil {
+		return "", errors.WithMessagef(err, "read pid namespace of pid '%d'", pid)
+	}
+	return namespace, nil
+}
@@ -0,0 +1,122 @@
+package containers
+
+import (
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/host"
+	"github.com/memlab/agent/internal/types"
+	"sync"
+)
+
+// Containers outlive many process list reports, so their (immutable) details are only read once. The cache is reset
+// when full, rather than tracking which containers are gone.
+const maxCachedContainers = 1024
+
+var defaultResolver = NewResolver("/")
+
+// PodMetadataSource provides the Kubernetes details of pods' containers, e.g from the API server (see
+// internal/kubernetes). They take precedence over the ones read from runtimes' state directories.
+type PodMetadataSource interface {
+	PodContainer(containerId string) (*models.Container, bool)
+}
+
+func SetPodMetadataSource(source PodMetadataSource) {
+	defaultResolver.SetPodMetadataSource(source)
+}
+
+// Returns the container a process runs in, or nil if it doesn't run in one.
+func ProcessContainer(pid types.Pid) (*models.Container, error) {
+	return defaultResolver.ProcessContainer(pid)
+}
+
+// Returns the container a cgroup path belongs to, or nil if it doesn't belong to one.
+func CgroupContainer(cgroupPath string) (*models.Container, error) {
+	return defaultResolver.CgroupContainer(cgroupPath)
+}
+
+// Resolver maps processes to the containers they run in, based on their cgroups and runtimes' state directories.
+type Resolver struct {
+	root              string // Host's root, where runtimes' state directories are found.
+	lock              sync.Mutex
+	cache             map[string]*models.Container
+	podMetadataSource PodMetadataSource
+}
+
+func NewResolver(root string) *Resolver {
+	return &Resolver{
+		root:  root,
+		cache: make(map[string]*models.Container, 0),
+	}
+}
+
+func (r *Resolver) SetPodMetadataSource(source PodMetadataSource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.podMetadataSource = source
+}
+
+func (r *Resolver) ProcessContainer(pid types.Pid) (*models.Container, error) {
+	cgroupPath, err := host.ProcessCgroup(pid)
+	if err != nil {
+		return nil, err
+	}
+	return r.CgroupContainer(cgroupPath)
+}
+
+// Returns the container a cgroup path belongs to, or nil if it doesn't belong to one.
+func (r *Resolver) CgroupContainer(cgroupPath string) (*models.Container, error) {
+	cgroupContainer, found := parseCgroupPath(cgroupPath)
+	if !found {
+		return nil, nil
+	}
+
+	r.lock.Lock()
+	container, cached := r.cache[cgroupContainer.id]
+	podMetadataSource := r.podMetadataSource
+	r.lock.Unlock()
+	if cached {
+		return withPodMetadata(container, podMetadataSource), nil
+	}
+
+	container, err := inspectContainer(r.root, cgroupContainer)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.cache) >= maxCachedContainers {
+		r.cache = make(map[string]*models.Container, 0)
+	}
+	r.cache[cgroupContainer.id] = container
+	return withPodMetadata(container, podMetadataSource), nil
+}
+
+// Pods' details (labels especially) may change, so they're merged into a copy rather than cached.
+func withPodMetadata(container *models.Container, source PodMetadataSource) *models.Container {
+	if source == nil {
+		return container
+	}
+
+	podContainer, found := source.PodContainer(container.ID)
+	if !found {
+		return container
+	}
+
+	merged := *container
+	if merged.Runtime == "" {
+		merged.Runtime = podContainer.Runtime
+	}
+	if podContainer.Name != "" {
+		merged.Name = podContainer.Name
+	}
+	if merged.Image == "" {
+		merged.Image = podContainer.Image
+	}
+	merged.PodName = podContainer.PodName
+	merged.PodNamespace = podContainer.PodNamespace
+	merged.PodUid = podContainer.PodUid
+	merged.PodLabels = podContainer.PodLabels
+	return &merged
+}
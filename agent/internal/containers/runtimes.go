@@ -0,0 +1,192 @@
+package containers
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Runtimes' state directories, relative to the host's root.
+const (
+	dockerContainersDir       = "/var/lib/docker/containers"
+	containerdTasksDir        = "/run/containerd/io.containerd.runtime.v2.task"
+	crioContainersDir         = "/run/containers/storage/overlay-containers"
+	containersStorageDir      = "/var/lib/containers/storage/overlay-containers" // Shared by cri-o and podman.
+	containersStorageListFile = "containers.json"
+)
+
+// Kubernetes annotations set on OCI specs by CRI runtimes.
+var (
+	containerNameAnnotations = []string{"io.kubernetes.cri.container-name", "io.kubernetes.container.name"}
+	podNameAnnotations       = []string{"io.kubernetes.cri.sandbox-name", "io.kubernetes.pod.name"}
+	podNamespaceAnnotations  = []string{"io.kubernetes.cri.sandbox-namespace", "io.kubernetes.pod.namespace"}
+	podUidAnnotations        = []string{"io.kubernetes.cri.sandbox-uid", "io.kubernetes.pod.uid"}
+	imageAnnotations         = []string{"io.kubernetes.cri.image-name", "io.kubernetes.cri-o.ImageName"}
+)
+
+var errContainerNotFound = errors.New("container not found")
+
+// Looks a container up in its runtime's state directory, or in each runtime's when the runtime is unknown.
+func inspectContainer(root string, cgroupContainer *cgroupContainer) (*models.Container, error) {
+	inspectors := map[Runtime]func(root string, id string) (*models.Container, error){
+		RuntimeDocker:     inspectDockerContainer,
+		RuntimeContainerd: inspectContainerdContainer,
+		RuntimeCrio:       inspectCrioContainer,
+		RuntimePodman:     inspectPodmanContainer,
+	}
+
+	runtimes := []Runtime{RuntimeDocker, RuntimeContainerd, RuntimeCrio, RuntimePodman}
+	if cgroupContainer.runtime != "" {
+		runtimes = []Runtime{cgroupContainer.runtime}
+	}
+
+	for _, runtime := range runtimes {
+		container, err := inspectors[runtime](root, cgroupContainer.id)
+		if err == errContainerNotFound {
+			continue
+		} else if err != nil {
+			return nil, errors.WithMessagef(err, "inspect %s container '%s'", runtime, cgroupContainer.id)
+		}
+
+		if container.PodUid == "" {
+			container.PodUid = cgroupContainer.podUid
+		}
+		return container, nil
+	}
+
+	// Still worth reporting, even if the runtime's state can't be read (e.g, an unsupported runtime).
+	return &models.Container{
+		Runtime: string(cgroupContainer.runtime),
+		ID:      cgroupContainer.id,
+		PodUid:  cgroupContainer.podUid,
+	}, nil
+}
+
+func inspectDockerContainer(root string, id string) (*models.Container, error) {
+	var config struct {
+		Name   string
+		Config struct {
+			Image  string
+			Labels map[string]string
+		}
+	}
+	if err := readJson(filepath.Join(root, dockerContainersDir, id, "config.v2.json"), &config); err != nil {
+		return nil, err
+	}
+
+	container := &models.Container{
+		Runtime: string(RuntimeDocker),
+		ID:      id,
+		Name:    strings.TrimPrefix(config.Name, "/"),
+		Image:   config.Config.Image,
+	}
+	addKubernetesMetadata(container, config.Config.Labels) // Set by dockershim.
+	return container, nil
+}
+
+func inspectContainerdContainer(root string, id string) (*models.Container, error) {
+	// Tasks are grouped by containerd namespace (e.g, "k8s.io" for kubernetes, "moby" for docker).
+	specPaths, err := filepath.Glob(filepath.Join(root, containerdTasksDir, "*", id, "config.json"))
+	if err != nil {
+		return nil, err
+	} else if len(specPaths) == 0 {
+		return nil, errContainerNotFound
+	}
+
+	return inspectOciSpec(specPaths[0], RuntimeContainerd, id)
+}
+
+func inspectCrioContainer(root string, id string) (*models.Container, error) {
+	container, err := inspectOciSpec(filepath.Join(root, crioContainersDir, id, "userdata", "config.json"),
+		RuntimeCrio, id)
+	if err == errContainerNotFound {
+		return inspectOciSpec(filepath.Join(root, containersStorageDir, id, "userdata", "config.json"), RuntimeCrio, id)
+	}
+	return container, err
+}
+
+// Podman keeps names and images in containers/storage's container list, rather than in OCI annotations.
+func inspectPodmanContainer(root string, id string) (*models.Container, error) {
+	var storedContainers []struct {
+		ID       string   `json:"id"`
+		Names    []string `json:"names"`
+		Metadata string   `json:"metadata"`
+	}
+	listPath := filepath.Join(root, containersStorageDir, containersStorageListFile)
+	if err := readJson(listPath, &storedContainers); err != nil {
+		return nil, err
+	}
+
+	for _, storedContainer := range storedContainers {
+		if storedContainer.ID != id {
+			continue
+		}
+
+		container := &models.Container{
+			Runtime: string(RuntimePodman),
+			ID:      id,
+		}
+		if len(storedContainer.Names) > 0 {
+			container.Name = storedContainer.Names[0]
+		}
+
+		var metadata struct {
+			ImageName string `json:"image-name"`
+		}
+		if err := json.Unmarshal([]byte(storedContainer.Metadata), &metadata); err == nil {
+			container.Image = metadata.ImageName
+		}
+		return container, nil
+	}
+	return nil, errContainerNotFound
+}
+
+func inspectOciSpec(specPath string, runtime Runtime, id string) (*models.Container, error) {
+	var spec struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := readJson(specPath, &spec); err != nil {
+		return nil, err
+	}
+
+	container := &models.Container{
+		Runtime: string(runtime),
+		ID:      id,
+		Image:   firstAnnotation(spec.Annotations, imageAnnotations),
+	}
+	addKubernetesMetadata(container, spec.Annotations)
+	return container, nil
+}
+
+func addKubernetesMetadata(container *models.Container, annotations map[string]string) {
+	if name := firstAnnotation(annotations, containerNameAnnotations); name != "" {
+		container.Name = name
+	}
+	container.PodName = firstAnnotation(annotations, podNameAnnotations)
+	container.PodNamespace = firstAnnotation(annotations, podNamespaceAnnotations)
+	container.PodUid = firstAnnotation(annotations, podUidAnnotations)
+}
+
+func firstAnnotation(annotations map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := annotations[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func readJson(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errContainerNotFound
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -2,6 +2,9 @@ package control
 
 import (
 	"github.com/memlab/agent/internal/client"
+	"github.com/memlab/agent/internal/kubernetes"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/redaction"
 	"github.com/pkg/errors"
 	"time"
 )
@@ -17,6 +20,9 @@ type PlaneConfig struct {
 	HostStatusReportInterval               time.Duration
 	ProcessListReportInterval              time.Duration
 	DetectionConfigurationsPollingInterval time.Duration
+	Operators                              *operators.Config
+	Kubernetes                             *kubernetes.Config // Nil unless running as a DaemonSet.
+	Redaction                              *redaction.Config  // Nil to report secrets as they are.
 }
 
 func (pc *PlaneConfig) Valid() (bool, error) {
@@ -41,5 +47,23 @@ func (pc *PlaneConfig) Valid() (bool, error) {
 			minDetectionConfigurationsPollingInterval.String())
 	}
 
+	if pc.Operators == nil {
+		return false, errors.New("uninitialized operators config")
+	} else if valid, err := pc.Operators.Valid(); !valid {
+		return false, errors.WithMessage(err, "validate operators config")
+	}
+
+	if pc.Kubernetes != nil {
+		if valid, err := pc.Kubernetes.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate kubernetes config")
+		}
+	}
+
+	if pc.Redaction != nil {
+		if valid, err := pc.Redaction.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate redaction config")
+		}
+	}
+
 	return true, nil
 }
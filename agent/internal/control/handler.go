@@ -2,22 +2,40 @@ package control
 
 import (
 	"context"
+	"github.com/memlab/agent/internal/client/models"
 	"github.com/memlab/agent/internal/detection"
 	"github.com/memlab/agent/internal/detection/requests"
 	operatorsPkg "github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 var errFailedToConvertInterface = errors.New("failed to convert interface to request obj")
 
+// OperatorsProvider returns the operators to run for each type of detection, e.g an operators.Config. Reports are
+// attributed to the given machine id.
+type OperatorsProvider interface {
+	SignalOperators(machineId string, redactor *redaction.Redactor) []operatorsPkg.Operator
+	OomKillOperators(machineId string, redactor *redaction.Redactor) []operatorsPkg.Operator
+}
+
 type DetectionRequestsHandler struct {
 	detectionController *detection.Controller
+	operatorsProvider   OperatorsProvider
+	machineId           string
+	redactor            *redaction.Redactor
 }
 
-func NewDetectionRequestsHandler(detectionController *detection.Controller) *DetectionRequestsHandler {
+// Redactor is optional (may be nil), in which case reports aren't redacted.
+func NewDetectionRequestsHandler(detectionController *detection.Controller, operatorsProvider OperatorsProvider,
+	machineId string, redactor *redaction.Redactor) *DetectionRequestsHandler {
 	return &DetectionRequestsHandler{
 		detectionController: detectionController,
+		operatorsProvider:   operatorsProvider,
+		machineId:           machineId,
+		redactor:            redactor,
 	}
 }
 
@@ -39,10 +57,16 @@ func (d *DetectionRequestsHandler) Handle(ctx context.Context, rootLogger *zap.L
 			return errFailedToConvertInterface
 		}
 
-		detectionOperators = []operatorsPkg.Operator{
-			&operatorsPkg.CollectMetadata{},
-		}
+		detectionOperators = d.operatorsProvider.SignalOperators(d.machineId, d.redactor)
 		addDetector = detectSignalsRequest.TurnedOn
+	case requests.RequestTypeDetectOomKills:
+		detectOomKillsRequest, ok := detectionRequest.(*requests.DetectOomKills)
+		if !ok {
+			return errFailedToConvertInterface
+		}
+
+		detectionOperators = d.operatorsProvider.OomKillOperators(d.machineId, d.redactor)
+		addDetector = detectOomKillsRequest.TurnedOn
 	case requests.RequestTypeDetectThresholds, requests.RequestTypeDetectSuspectedHangs:
 		return nil // todo: currently it's a stub to avoid errors, replace when implementing those detectors.
 	default:
@@ -50,11 +74,23 @@ func (d *DetectionRequestsHandler) Handle(ctx context.Context, rootLogger *zap.L
 	}
 
 	if !addDetector {
-		return d.detectionController.RemoveDetector(detectionRequest, detectionOperators)
+		return d.detectionController.RemoveDetector(detectionRequest)
 	}
 	return d.detectionController.AddDetector(detectionRequest, detectionOperators, true)
 }
 
+// Reconciles the kernel module's watched processes with the processes configured for signal detection, see
+// detection.Controller.ReconcileKernelWatches().
+func (d *DetectionRequestsHandler) ReconcileKernelWatches(
+	detectionConfigs map[types.Pid]*models.DetectionConfiguration) (bool, error) {
+	configuredPids := make(map[types.Pid]bool, len(detectionConfigs))
+	for pid, detectionConfig := range detectionConfigs {
+		configuredPids[pid] = detectionConfig.IsRelevant && detectionConfig.DetectSignals
+	}
+
+	return d.detectionController.ReconcileKernelWatches(configuredPids)
+}
+
 func (d *DetectionRequestsHandler) Stop() error {
 	return d.detectionController.Stop()
 }
@@ -5,16 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff/v4"
+	"github.com/hashicorp/go-multierror"
 	"github.com/memlab/agent/internal/client"
 	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/containers"
 	"github.com/memlab/agent/internal/detection"
 	"github.com/memlab/agent/internal/host"
+	"github.com/memlab/agent/internal/kubernetes"
+	"github.com/memlab/agent/internal/procwatch"
+	"github.com/memlab/agent/internal/redaction"
 	"github.com/memlab/agent/internal/reports"
 	generalReports "github.com/memlab/agent/internal/reports/general"
+	"github.com/memlab/agent/internal/selection"
 	statePkg "github.com/memlab/agent/internal/state"
+	"github.com/memlab/agent/internal/trace"
 	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"gopkg.in/guregu/null.v3"
 	"io/ioutil"
 	"net/http"
 	"sync"
@@ -37,12 +45,19 @@ type Plane struct {
 	client                    *client.RestfulClient
 	config                    *PlaneConfig
 	state                     *statePkg.State
+	exitWatcher               *procwatch.ExitWatcher
+	podDiscovery              *kubernetes.PodDiscovery // Nil unless running as a DaemonSet.
+	redactor                  *redaction.Redactor      // Nil unless redacting.
 	detectionRequestsHandler  *DetectionRequestsHandler
+	detectionConfigsSyncer    *DetectionConfigsSyncer
 	machineId                 string
 	initialHostStatusReported chan struct{}
+	recorder                  *trace.Recorder
 }
 
-func NewPlane(rootLogger *zap.Logger, config *PlaneConfig, detectionController *detection.Controller) (*Plane, error) {
+// Recorder is optional (may be nil), see internal/trace.
+func NewPlane(rootLogger *zap.Logger, config *PlaneConfig, detectionController *detection.Controller,
+	recorder *trace.Recorder) (*Plane, error) {
 	if valid, err := config.Valid(); !valid {
 		return nil, errors.WithMessage(err, "validate control plane config")
 	}
@@ -52,16 +67,45 @@ func NewPlane(rootLogger *zap.Logger, config *PlaneConfig, detectionController *
 
 	restfulClient, err := client.NewRestfulClient(ctx, logger, config.ApiConfig)
 	if err != nil {
+		cancel()
 		return nil, errors.WithMessage(err, "new restful client")
 	}
 
-	machineId, err := host.MachineId()
+	var (
+		machineId    string
+		podDiscovery *kubernetes.PodDiscovery
+	)
+	if config.Kubernetes != nil {
+		// Host's machine id is shared by nodes cloned from the same image, and is meaningless to cluster operators.
+		podDiscovery, err = kubernetes.NewPodDiscovery(logger, config.Kubernetes)
+		if err != nil {
+			cancel()
+			return nil, errors.WithMessage(err, "new pod discovery")
+		}
+		machineId = podDiscovery.NodeName()
+		containers.SetPodMetadataSource(podDiscovery)
+	} else {
+		machineId, err = host.MachineId()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	exitWatcher, err := procwatch.NewExitWatcher(logger)
 	if err != nil {
-		return nil, err
+		cancel()
+		return nil, errors.WithMessage(err, "new exit watcher")
+	}
+
+	var redactor *redaction.Redactor
+	if config.Redaction != nil {
+		redactor = redaction.NewRedactor(config.Redaction)
 	}
 
-	state := statePkg.NewState()
-	detectionRequestsHandler := NewDetectionRequestsHandler(detectionController)
+	state := statePkg.NewState(ctx, logger, exitWatcher)
+	detectionRequestsHandler := NewDetectionRequestsHandler(detectionController, config.Operators, machineId,
+		redactor)
 
 	return &Plane{
 		logger:                    logger,
@@ -70,9 +114,14 @@ func NewPlane(rootLogger *zap.Logger, config *PlaneConfig, detectionController *
 		client:                    restfulClient,
 		config:                    config,
 		state:                     state,
+		exitWatcher:               exitWatcher,
+		podDiscovery:              podDiscovery,
+		redactor:                  redactor,
 		detectionRequestsHandler:  detectionRequestsHandler,
+		detectionConfigsSyncer:    NewDetectionConfigsSyncer(logger, state, detectionRequestsHandler),
 		machineId:                 machineId,
 		initialHostStatusReported: make(chan struct{}, 1),
+		recorder:                  recorder,
 	}, nil
 }
 
@@ -81,6 +130,12 @@ func (p *Plane) Start() error {
 
 	// Note: go routines spawning order is important to avoid races.
 
+	if p.podDiscovery != nil {
+		if err := p.podDiscovery.Start(); err != nil {
+			return errors.WithMessage(err, "start pod discovery")
+		}
+	}
+
 	p.waitGroup.Add(1)
 	go p.reportProcessEvents()
 
@@ -90,6 +145,12 @@ func (p *Plane) Start() error {
 	p.waitGroup.Add(1)
 	go p.handleDetectionRequests()
 
+	p.waitGroup.Add(1)
+	go p.startExitWatcher()
+
+	p.waitGroup.Add(1)
+	go p.handleProcessExits()
+
 	p.waitGroup.Add(1)
 	go p.fetchDetectionConfigs()
 
@@ -118,6 +179,8 @@ func (p *Plane) reportProcessEvents() {
 				return
 			}
 
+			p.recorder.RecordReport(report)
+
 			data, err := json.Marshal(report)
 			if err != nil {
 				p.logger.Error("Failed to marshal report", zap.Error(err), zap.Any("Report", report))
@@ -142,6 +205,44 @@ func (p *Plane) startDetectionRequestsHandler() {
 	p.detectionRequestsHandler.WaitUntilCompletion()
 }
 
+func (p *Plane) startExitWatcher() {
+	defer p.waitGroup.Done()
+
+	if err := p.exitWatcher.Start(); err != nil {
+		p.logger.Error("Failed to start exit watcher", zap.Error(err))
+		p.cancel()
+	}
+	p.exitWatcher.WaitUntilCompletion()
+}
+
+// Expires configs of exited processes right away, rather than on the next poll (which only happens if the backend
+// still sends them). Stopping their detectors un-watches them in the kernel module as well.
+func (p *Plane) handleProcessExits() {
+	defer p.waitGroup.Done()
+
+	for {
+		select {
+		case <-p.context.Done():
+			return
+		case exit := <-p.exitWatcher.ExitsChan():
+			detectionConfig := p.state.ExpireDetectionConfig(exit.Pid)
+			if detectionConfig == nil || detectionConfig.SelectsProcesses() {
+				continue
+			}
+
+			p.logger.Info("Monitored process exited", zap.Int32("Pid", int32(exit.Pid)),
+				zap.Any("ExitCode", exit.ExitCode), zap.Any("ExitSignal", exit.ExitSignal))
+			p.recorder.RecordProcessExit(exit.ExitedAt, exit.Pid)
+
+			p.markDetectionConfigIrrelevant(detectionConfig, &models.ProcessExit{
+				ExitCode:   exit.ExitCode,
+				ExitSignal: exit.ExitSignal,
+				ExitedAt:   null.TimeFrom(exit.ExitedAt),
+			})
+		}
+	}
+}
+
 func (p *Plane) startHostStatusReporter() {
 	defer p.waitGroup.Done()
 
@@ -170,6 +271,12 @@ func (p *Plane) reportHostStatus() {
 		return
 	}
 
+	// Only known once a detector connected to the kernel module, as it's only required by some of the detectors.
+	if moduleInfo := p.detectionRequestsHandler.detectionController.KernelModuleInfo(); moduleInfo != nil {
+		report.KernelModuleVersion = moduleInfo.ModuleVersion
+		report.KernelModuleProtocol = moduleInfo.ProtocolVersion
+	}
+
 	if err := p.sendReport(endpointHosts, report); err != nil {
 		p.logger.Error("Failed to post report", zap.Error(err))
 	}
@@ -197,9 +304,15 @@ func (p *Plane) startProcessListReporter() {
 }
 
 func (p *Plane) reportProcessList() {
-	report, err := generalReports.NewProcessListReport(p.machineId)
+	report, err := p.newProcessListReport()
 	if err != nil {
 		p.logger.Error("Failed to create process list report", zap.Error(err))
+		return
+	}
+
+	// Only redacted once reported, as selectors match the command lines as they are.
+	for _, process := range report.List {
+		process.CommandLine = p.redactor.RedactCommandLine(process.CommandLine)
 	}
 
 	if err := p.sendReport(endpointProcesses, report); err != nil {
@@ -207,6 +320,19 @@ func (p *Plane) reportProcessList() {
 	}
 }
 
+// As a DaemonSet, only the node's pods' processes are reported (and selected), as host processes are out of scope.
+func (p *Plane) newProcessListReport() (*generalReports.ProcessListReport, error) {
+	report, err := generalReports.NewProcessListReport(p.machineId)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.podDiscovery != nil {
+		report.List = p.podDiscovery.PodProcesses(report.List)
+	}
+	return report, nil
+}
+
 func (p *Plane) fetchDetectionConfigs() {
 	defer p.waitGroup.Done()
 
@@ -219,29 +345,46 @@ func (p *Plane) fetchDetectionConfigs() {
 			ticker.Stop()
 			return
 		case <-ticker.C:
-			detectionConfigs, success := p.fetchDetectionConfigsFromBackend()
+			fetchedAt := time.Now().UTC()
+			fetchedConfigs, success := p.fetchDetectionConfigsFromBackend()
+			if !success {
+				continue
+			}
+
+			detectionConfigs, success := p.expandDetectionConfigs(fetchedConfigs)
 			if !success {
 				continue
 			}
 
-			for _, detectionConfig := range detectionConfigs {
-				if err := p.state.PutDetectionConfig(detectionConfig); err != nil {
-					if err == statePkg.ErrExpiredDetectionConfig {
-						p.markDetectionConfigIrrelevant(detectionConfig)
-					} else {
-						p.logger.Error("Failed to put detection config", zap.Error(err))
-					}
-					continue
+			diff := p.detectionConfigsSyncer.Sync(detectionConfigs)
+
+			expiredPids := make([]types.Pid, 0, len(diff.Expired))
+			for _, detectionConfig := range diff.Expired {
+				expiredPids = append(expiredPids, detectionConfig.Pid)
+				if !detectionConfig.SelectsProcesses() { // Selectors stay relevant when one of their processes exits.
+					p.markDetectionConfigIrrelevant(detectionConfig, nil)
 				}
 			}
+
+			p.recorder.RecordDetectionConfigs(fetchedAt, detectionConfigs, expiredPids)
 		}
 	}
 }
 
-func (p *Plane) markDetectionConfigIrrelevant(detectionConfig *models.DetectionConfiguration) {
+// Process exit is optional (may be nil), as it's unknown for configs which expired while the agent wasn't watching.
+func (p *Plane) markDetectionConfigIrrelevant(detectionConfig *models.DetectionConfiguration,
+	processExit *models.ProcessExit) {
 	endpoint := fmt.Sprintf("%s/mark_irrelevant/%s", endpointDetectionConfigs, detectionConfig.ID)
 
-	if err := p.post(endpoint, nil); err != nil {
+	var data []byte
+	if processExit != nil {
+		var err error
+		if data, err = json.Marshal(processExit); err != nil {
+			p.logger.Error("Failed to marshal process exit", zap.Error(err))
+		}
+	}
+
+	if err := p.post(endpoint, data); err != nil {
 		p.logger.Error("Failed to mark detection config as irrelevant", zap.Error(err))
 	}
 }
@@ -269,7 +412,29 @@ func (p *Plane) handleDetectionRequests() {
 	}
 }
 
-func (p *Plane) fetchDetectionConfigsFromBackend() (map[types.Pid]*models.DetectionConfiguration, bool) {
+// Selector configs are evaluated against the live process list, so processes which started matching are configured,
+// while ones which stopped matching (or exited) are left out.
+func (p *Plane) expandDetectionConfigs(detectionConfigs []*models.DetectionConfiguration) (
+	map[types.Pid]*models.DetectionConfiguration, bool) {
+	var processes []*models.Process
+	if selection.RequiresProcessList(detectionConfigs) {
+		processList, err := p.newProcessListReport()
+		if err != nil {
+			// Otherwise, all selected processes would be considered gone.
+			p.logger.Error("Failed to list processes for selector configs", zap.Error(err))
+			return nil, false
+		}
+		processes = processList.List
+	}
+
+	expandedConfigs, err := selection.ExpandDetectionConfigs(detectionConfigs, processes)
+	if err != nil {
+		p.logger.Error("Failed to expand some selector configs", zap.Error(err))
+	}
+	return expandedConfigs, true
+}
+
+func (p *Plane) fetchDetectionConfigsFromBackend() ([]*models.DetectionConfiguration, bool) {
 	endpoint := fmt.Sprintf("%s/by_machine/%s/", endpointDetectionConfigs, p.machineId)
 	bodyBytes, success := p.fetchFromBackend(endpoint)
 	if !success {
@@ -282,12 +447,7 @@ func (p *Plane) fetchDetectionConfigsFromBackend() (map[types.Pid]*models.Detect
 		return nil, false
 	}
 
-	configs := make(map[types.Pid]*models.DetectionConfiguration, len(configList))
-	for _, detectionConfiguration := range configList {
-		configs[detectionConfiguration.Pid] = detectionConfiguration
-	}
-
-	return configs, true
+	return configList, true
 }
 
 func (p *Plane) fetchFromBackend(endpoint string) ([]byte, bool) {
@@ -323,7 +483,9 @@ func (p *Plane) sendReport(endpoint string, report reports.Report) error {
 }
 
 func (p *Plane) post(endpoint string, data []byte) error {
-	backOffPolicy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxBackoffRetries)
+	// Retries stop along with the plane, as requests are cancelled by then anyway.
+	backOffPolicy := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxBackoffRetries),
+		p.context)
 
 	var (
 		response *http.Response
@@ -357,15 +519,32 @@ func (p *Plane) validateResponse(response *http.Response, desiredStatus int) boo
 
 func (p *Plane) WaitUntilCompletion() {
 	p.waitGroup.Wait()
+
+	if p.podDiscovery != nil {
+		p.podDiscovery.WaitUntilCompletion()
+	}
 }
 
+// Stops all components even if some fail to, so the plane's context is always cancelled.
 func (p *Plane) Stop() error {
 	p.logger.Debug("Stop control plane")
 
+	var errs error
+
 	if err := p.detectionRequestsHandler.Stop(); err != nil {
-		return errors.WithMessage(err, "stop detection requests handler")
+		errs = multierror.Append(errs, errors.WithMessage(err, "stop detection requests handler"))
+	}
+
+	if err := p.exitWatcher.Stop(); err != nil {
+		errs = multierror.Append(errs, errors.WithMessage(err, "stop exit watcher"))
+	}
+
+	if p.podDiscovery != nil {
+		if err := p.podDiscovery.Stop(); err != nil {
+			errs = multierror.Append(errs, errors.WithMessage(err, "stop pod discovery"))
+		}
 	}
 
 	p.cancel()
-	return nil
+	return errs
 }
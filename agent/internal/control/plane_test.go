@@ -0,0 +1,182 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/memlab/agent/internal/client"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/detection"
+	"github.com/memlab/agent/internal/devserver"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/types"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const (
+	testToken          = "test-token"
+	testPollingTimeout = time.Second * 10
+	testPollingPeriod  = time.Millisecond * 50
+)
+
+// Talks to the dev server's admin api, as a dashboard user would.
+type testBackend struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+func startTestBackend(t *testing.T) *testBackend {
+	devServer, err := devserver.NewServer(zap.NewNop(), &devserver.Config{Address: "127.0.0.1:0", Token: testToken})
+	if err != nil {
+		t.Fatalf("new dev server: %v", err)
+	}
+
+	server := httptest.NewServer(devServer.Handler())
+	t.Cleanup(server.Close)
+	return &testBackend{t: t, server: server}
+}
+
+func (b *testBackend) do(method, path string, body, response interface{}) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			b.t.Fatalf("marshal %s %s: %v", method, path, err)
+		}
+	}
+
+	request, err := http.NewRequest(method, b.server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		b.t.Fatalf("new request %s %s: %v", method, path, err)
+	}
+	request.Header.Set("Authorization", "Token "+testToken)
+
+	httpResponse, err := b.server.Client().Do(request)
+	if err != nil {
+		b.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK && httpResponse.StatusCode != http.StatusCreated {
+		b.t.Fatalf("%s %s: status %d", method, path, httpResponse.StatusCode)
+	}
+	if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+		b.t.Fatalf("decode %s %s: %v", method, path, err)
+	}
+}
+
+// Fails the test unless the condition is met before the polling timeout.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(testPollingTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(testPollingPeriod)
+	}
+}
+
+// Runs a plane against the dev server, with the kernel module simulated: the config is created once the plane
+// reported the monitored process, and a signal caught by it ends up as a process event on the dev server.
+func TestPlaneReportsCaughtSignal(t *testing.T) {
+	backend := startTestBackend(t)
+
+	// Agent's own process is never reported, so a child is monitored instead.
+	monitored := exec.Command("sleep", "60")
+	if err := monitored.Start(); err != nil {
+		t.Fatalf("start monitored process: %v", err)
+	}
+	defer func() {
+		_ = monitored.Process.Kill()
+		_ = monitored.Wait()
+	}()
+	simulator := kernelComm.NewSimulator(zap.NewNop())
+
+	detectionController, err := detection.NewController(zap.NewNop(), 4,
+		func(*zap.Logger) (kernelComm.KernelChannel, error) {
+			return simulator, nil
+		})
+	if err != nil {
+		t.Fatalf("new detection controller: %v", err)
+	}
+
+	config := &PlaneConfig{
+		ApiConfig:                              &client.ApiConfig{Url: backend.server.URL, Token: testToken},
+		HostStatusReportInterval:               minHostStatusReportInterval,
+		ProcessListReportInterval:              minProcessListReportInterval,
+		DetectionConfigurationsPollingInterval: minDetectionConfigurationsPollingInterval,
+		Operators:                              &operators.Config{},
+	}
+	plane, err := NewPlane(zap.NewNop(), config, detectionController, nil)
+	if err != nil {
+		t.Fatalf("new plane: %v", err)
+	}
+	// Config was validated, so the minimal interval can be shortened to keep the test fast.
+	config.DetectionConfigurationsPollingInterval = testPollingPeriod
+
+	if err := plane.Start(); err != nil {
+		t.Fatalf("start plane: %v", err)
+	}
+	defer func() {
+		if err := plane.Stop(); err != nil {
+			t.Errorf("stop plane: %v", err)
+		}
+		plane.WaitUntilCompletion()
+	}()
+
+	pid := types.Pid(monitored.Process.Pid)
+	waitFor(t, "the monitored process to be reported", func() bool {
+		processes := make([]*models.Process, 0)
+		backend.do(http.MethodGet, "/_admin/processes/?machine_id="+plane.machineId, nil, &processes)
+		for _, process := range processes {
+			if process.Pid == pid {
+				return true
+			}
+		}
+		return false
+	})
+
+	record := &devserver.DetectionConfigRecord{
+		MachineId: plane.machineId,
+		DetectionConfiguration: &models.DetectionConfiguration{
+			Pid:              pid,
+			DetectSignals:    true,
+			Signals:          []int{6},
+			SignalHoldBudget: 50,
+		},
+	}
+	backend.do(http.MethodPost, "/_admin/detection_configs/", record, record)
+
+	waitFor(t, "the monitored process to be watched", func() bool {
+		watchedPids, err := simulator.ListWatchedProcesses()
+		return err == nil && len(watchedPids) == 1 && watchedPids[0] == uint32(pid)
+	})
+
+	if _, err := simulator.InjectCaughtSignal(&kernelComm.PayloadCaughtSignal{Pid: uint32(pid), Signal: 6,
+		Tid: uint32(pid)}); err != nil {
+		t.Fatalf("inject caught signal: %v", err)
+	}
+
+	var events []map[string]interface{}
+	waitFor(t, "the caught signal to be reported", func() bool {
+		backend.do(http.MethodGet, "/_admin/process_events/", nil, &events)
+		return len(events) > 0
+	})
+
+	if len(events) != 1 {
+		t.Fatalf("got %d process events, expected 1: %v", len(events), events)
+	}
+	event := events[0]
+	if event["pid"] != float64(pid) || event["machine_id"] != plane.machineId || event["cmd_line"] != "sleep 60" {
+		t.Errorf("process event = %v, expected it to be of pid %d (sleep 60) on machine '%s'", event, pid,
+			plane.machineId)
+	}
+	if event["signal"] != 6.0 || event["signal_hold_budget_ms"] != 50.0 {
+		t.Errorf("process event = %v, expected signal 6 held with a 50ms budget", event)
+	}
+}
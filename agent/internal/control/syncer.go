@@ -0,0 +1,51 @@
+package control
+
+import (
+	"github.com/memlab/agent/internal/client/models"
+	statePkg "github.com/memlab/agent/internal/state"
+	"github.com/memlab/agent/internal/types"
+	"go.uber.org/zap"
+)
+
+// DetectionConfigsSyncer applies expanded detection configs to the agent, as the control plane does after each fetch
+// and as replays do for each recorded one, so both drive the kernel module and detectors the same way.
+type DetectionConfigsSyncer struct {
+	logger                   *zap.Logger
+	state                    *statePkg.State
+	detectionRequestsHandler *DetectionRequestsHandler
+	reconciled               bool
+}
+
+func NewDetectionConfigsSyncer(logger *zap.Logger, state *statePkg.State,
+	detectionRequestsHandler *DetectionRequestsHandler) *DetectionConfigsSyncer {
+	return &DetectionConfigsSyncer{
+		logger:                   logger,
+		state:                    state,
+		detectionRequestsHandler: detectionRequestsHandler,
+	}
+}
+
+// Kernel module state can only be reconciled once we know what's configured, so it's reconciled on the first sync
+// configuring some process for signal detection. Configs which failed to sync are logged, and the diff is of the rest.
+func (s *DetectionConfigsSyncer) Sync(
+	detectionConfigs map[types.Pid]*models.DetectionConfiguration) *statePkg.DetectionConfigsDiff {
+	if !s.reconciled {
+		reconciled, err := s.detectionRequestsHandler.ReconcileKernelWatches(detectionConfigs)
+		if err != nil {
+			s.logger.Warn("Failed to reconcile kernel watched processes", zap.Error(err))
+		}
+		s.reconciled = reconciled
+	}
+
+	diff, err := s.state.SyncDetectionConfigs(detectionConfigs)
+	if err != nil {
+		s.logger.Error("Failed to sync some detection configs", zap.Error(err))
+	}
+
+	if !diff.Empty() {
+		s.logger.Debug("Synced detection configs", zap.Int("Added", len(diff.Added)),
+			zap.Int("Changed", len(diff.Changed)), zap.Int("Removed", len(diff.Removed)),
+			zap.Int("Expired", len(diff.Expired)))
+	}
+	return diff
+}
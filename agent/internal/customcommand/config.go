@@ -0,0 +1,40 @@
+package customcommand
+
+import (
+	"github.com/pkg/errors"
+	"path/filepath"
+	"time"
+)
+
+// Commands are run as the agent's own user when no uid (or gid) is set.
+const UnchangedId = -1
+
+type Config struct {
+	Paths         []string      // Of executables, which are run in order.
+	Timeout       time.Duration // Of each command, within the operator's deadline.
+	MaxOutputSize int64         // Of each command's stdout and stderr, beyond which they're cut.
+	Uid           int
+	Gid           int
+	HoldSignal    bool // Whether commands run while a caught signal is held, rather than once it's released.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if len(c.Paths) == 0 {
+		return false, errors.New("no commands")
+	}
+	for _, path := range c.Paths {
+		if !filepath.IsAbs(path) {
+			return false, errors.Errorf("command path '%s' isn't absolute", path)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		return false, errors.New("timeout must be positive")
+	} else if c.MaxOutputSize <= 0 {
+		return false, errors.New("max output size must be positive")
+	} else if c.Uid < UnchangedId || c.Gid < UnchangedId {
+		return false, errors.New("invalid uid or gid")
+	}
+
+	return true, nil
+}
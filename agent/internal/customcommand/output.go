@@ -0,0 +1,100 @@
+package customcommand
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Keeps the first bytes written to it, discarding the rest, so commands never block on a full pipe.
+type cappedBuffer struct {
+	data      []byte
+	maxSize   int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if free := c.maxSize - len(c.data); len(p) > free {
+		c.data = append(c.data, p[:free]...)
+		c.truncated = true
+	} else {
+		c.data = append(c.data, p...)
+	}
+	return len(p), nil
+}
+
+// Copies a command's stdout and stderr from pipes of its own, rather than letting exec.Cmd copy them, as Wait() would
+// then block until every process holding the pipes exits.
+type commandOutputs struct {
+	readEnds  []*os.File
+	writeEnds []*os.File
+	copied    chan struct{}
+}
+
+func newCommandOutputs(command *exec.Cmd, stdout io.Writer, stderr io.Writer) (*commandOutputs, error) {
+	outputs := &commandOutputs{
+		copied: make(chan struct{}),
+	}
+
+	writers := []io.Writer{stdout, stderr}
+	for range writers {
+		readEnd, writeEnd, err := os.Pipe()
+		if err != nil {
+			outputs.close()
+			return nil, errors.WithMessage(err, "pipe")
+		}
+		outputs.readEnds = append(outputs.readEnds, readEnd)
+		outputs.writeEnds = append(outputs.writeEnds, writeEnd)
+	}
+	command.Stdout, command.Stderr = outputs.writeEnds[0], outputs.writeEnds[1]
+
+	remaining := make(chan struct{}, len(writers))
+	for i, writer := range writers {
+		go func(readEnd *os.File, writer io.Writer) {
+			_, _ = io.Copy(writer, readEnd)
+			remaining <- struct{}{}
+		}(outputs.readEnds[i], writer)
+	}
+	go func() {
+		for range writers {
+			<-remaining
+		}
+		close(outputs.copied)
+	}()
+	return outputs, nil
+}
+
+// Closes the write ends, which the command holds copies of once started, so copying ends once it (and its children)
+// close theirs.
+func (co *commandOutputs) started() {
+	for _, writeEnd := range co.writeEnds {
+		_ = writeEnd.Close()
+	}
+	co.writeEnds = nil
+}
+
+// Waits for the output to be copied, up to the given delay, and then stops copying regardless. Returns whether the
+// whole output was copied. Outputs may be read once it returns.
+func (co *commandOutputs) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-co.copied:
+		co.close()
+		return true
+	case <-timer.C:
+		co.close()
+		<-co.copied
+		return false
+	}
+}
+
+func (co *commandOutputs) close() {
+	for _, file := range append(co.readEnds, co.writeEnds...) {
+		_ = file.Close()
+	}
+	co.readEnds, co.writeEnds = nil, nil
+}
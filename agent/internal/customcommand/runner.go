@@ -0,0 +1,179 @@
+package customcommand
+
+import (
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/containers"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Commands don't inherit the agent's environment, which holds its api token.
+const defaultPathEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// How long output is still copied once a command exits (or is killed), as children which left its process group (e.g,
+// via setsid) aren't killed along with it, and might keep its stdout and stderr open indefinitely.
+const outputWaitDelay = time.Second
+
+const (
+	DetectionTypeSignal  = "signal"
+	DetectionTypeOomKill = "oom-kill"
+)
+
+type Result struct {
+	Name            string `json:"name"` // Executable's file name.
+	Path            string `json:"path"`
+	ExitCode        *int   `json:"exit_code,omitempty"` // Nil unless the command exited (rather than was killed).
+	Signal          string `json:"signal,omitempty"`    // That killed the command, e.g once it timed out.
+	TimedOut        bool   `json:"timed_out,omitempty"`
+	DurationMs      int64  `json:"duration_ms"`
+	Stdout          string `json:"stdout"`
+	StdoutTruncated bool   `json:"stdout_truncated,omitempty"`
+	Stderr          string `json:"stderr"`
+	StderrTruncated bool   `json:"stderr_truncated,omitempty"`
+	Error           string `json:"error,omitempty"` // e.g, when the command couldn't be started.
+}
+
+// Detection a command is run for, passed to it as environment variables.
+type Detection struct {
+	Type      string // e.g DetectionTypeSignal.
+	Pid       types.Pid
+	StartTime uint64 // Of the process, in clock ticks since boot.
+}
+
+// Runs the configured commands in order, each as "<path> <pid>", and returns their results. Outputs are redacted, as
+// commands might print secrets (e.g, the process' environment).
+func RunCommands(ctx context.Context, detection *Detection, config *Config,
+	redactor *redaction.Redactor) ([]*Result, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate config")
+	}
+
+	env := detectionEnv(ctx, detection)
+	results := make([]*Result, 0, len(config.Paths))
+	for _, path := range config.Paths {
+		if ctx.Err() != nil { // Remaining commands would be killed right away.
+			break
+		}
+
+		result := runCommand(ctx, path, detection.Pid, env, config)
+		result.Stdout = redactor.RedactText(result.Stdout)
+		result.Stderr = redactor.RedactText(result.Stderr)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// e.g "MEMLAB_PID=1234", "MEMLAB_DETECTION=signal" and "MEMLAB_DEADLINE=2020-01-01T00:00:00Z".
+func detectionEnv(ctx context.Context, detection *Detection) []string {
+	env := []string{
+		defaultPathEnv,
+		fmt.Sprintf("MEMLAB_PID=%d", detection.Pid),
+		fmt.Sprintf("MEMLAB_PROCESS_START_TIME=%d", detection.StartTime),
+		"MEMLAB_DETECTION=" + detection.Type,
+	}
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		env = append(env, "MEMLAB_DEADLINE="+deadline.UTC().Format(time.RFC3339))
+	}
+
+	// Best-effort, as the process might be gone (e.g, once OOM killed).
+	if namespacedPid, err := containers.NamespacedPid(detection.Pid); err == nil && namespacedPid != detection.Pid {
+		env = append(env, fmt.Sprintf("MEMLAB_NAMESPACED_PID=%d", namespacedPid))
+	}
+	if container, err := containers.ProcessContainer(detection.Pid); err == nil && container != nil {
+		env = append(env, "MEMLAB_CONTAINER_ID="+container.ID)
+	}
+	return env
+}
+
+func runCommand(ctx context.Context, path string, pid types.Pid, env []string, config *Config) *Result {
+	result := &Result{
+		Name: filepath.Base(path),
+		Path: path,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	command := exec.Command(path, fmt.Sprintf("%d", pid))
+	command.Env, command.Dir = env, "/"
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true, // So the command's children are killed along with it.
+	}
+	if config.Uid != UnchangedId || config.Gid != UnchangedId {
+		command.SysProcAttr.Credential = credential(config)
+	}
+
+	stdout := &cappedBuffer{maxSize: int(config.MaxOutputSize)}
+	stderr := &cappedBuffer{maxSize: int(config.MaxOutputSize)}
+	outputs, err := newCommandOutputs(command, stdout, stderr)
+	if err != nil {
+		result.Error = errors.WithMessage(err, "create output pipes").Error()
+		return result
+	}
+
+	startTime := time.Now()
+	err = command.Start()
+	outputs.started()
+	if err != nil {
+		outputs.close()
+		result.Error = errors.WithMessagef(err, "start '%s'", path).Error()
+		return result
+	}
+
+	// The whole group is killed, so its processes release stdout and stderr as well.
+	waited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = unix.Kill(-command.Process.Pid, unix.SIGKILL)
+		case <-waited:
+		}
+	}()
+	err = command.Wait()
+	close(waited)
+	outputCopied := outputs.wait(outputWaitDelay)
+
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	result.Stdout, result.StdoutTruncated = string(stdout.data), stdout.truncated
+	result.Stderr, result.StderrTruncated = string(stderr.data), stderr.truncated
+	result.TimedOut = ctx.Err() == context.DeadlineExceeded
+
+	if status, isStatus := command.ProcessState.Sys().(syscall.WaitStatus); isStatus {
+		if status.Signaled() {
+			result.Signal = unix.SignalName(status.Signal())
+		} else {
+			exitCode := status.ExitStatus()
+			result.ExitCode = &exitCode
+		}
+	} else if err != nil {
+		result.Error = err.Error()
+	}
+	if !outputCopied {
+		result.Error = "output was kept open by the command's children, which left its process group"
+	}
+	return result
+}
+
+// Supplementary groups are dropped, as they're the agent's.
+func credential(config *Config) *syscall.Credential {
+	uid, gid := config.Uid, config.Gid
+	if uid == UnchangedId {
+		uid = syscall.Geteuid()
+	}
+	if gid == UnchangedId {
+		gid = syscall.Getegid()
+	}
+
+	return &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: []uint32{},
+	}
+}
@@ -2,14 +2,20 @@ package detection
 
 import (
 	"context"
+	"github.com/hashicorp/go-multierror"
 	"github.com/memlab/agent/internal/detection/detectors"
 	"github.com/memlab/agent/internal/detection/requests"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
 	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"sync"
 )
 
+// KernelChannelDialer connects to the kernel module (or a simulation of it).
+type KernelChannelDialer func(rootLogger *zap.Logger) (kernelComm.KernelChannel, error)
+
 type Controller struct {
 	logger               *zap.Logger
 	waitGroup            sync.WaitGroup
@@ -19,9 +25,22 @@ type Controller struct {
 	lock                 sync.RWMutex
 	detectorsSemaphore   chan int
 	detectionReportsChan chan map[string]interface{}
+	dialKernelChannel    KernelChannelDialer
+	kernelChannel        kernelComm.KernelChannel
+	kernelModuleInfo     *kernelComm.PayloadProtocolInfo // Kept once negotiated, even if the channel is closed.
+	kernelChannelLock    sync.Mutex
+	environment          *detectors.Environment
+}
+
+func NewController(rootLogger *zap.Logger, maxConcurrentDetectors int,
+	dialKernelChannel KernelChannelDialer) (*Controller, error) {
+	return NewControllerWithEnvironment(rootLogger, maxConcurrentDetectors, dialKernelChannel,
+		detectors.HostEnvironment())
 }
 
-func NewController(rootLogger *zap.Logger, maxConcurrentDetectors int) (*Controller, error) {
+// Detectors observe the given environment rather than the host's (e.g, when replaying a recorded trace).
+func NewControllerWithEnvironment(rootLogger *zap.Logger, maxConcurrentDetectors int,
+	dialKernelChannel KernelChannelDialer, environment *detectors.Environment) (*Controller, error) {
 	logger := rootLogger.Named("detection-controller")
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -32,9 +51,48 @@ func NewController(rootLogger *zap.Logger, maxConcurrentDetectors int) (*Control
 		requestDetectors:     make(map[string]detectors.Detector, 0),
 		detectorsSemaphore:   make(chan int, maxConcurrentDetectors),
 		detectionReportsChan: make(chan map[string]interface{}, 0),
+		dialKernelChannel:    dialKernelChannel,
+		environment:          environment,
 	}, nil
 }
 
+// Dials the kernel channel upon first use, since it's only required by some of the detectors.
+func (c *Controller) getKernelChannel() (kernelComm.KernelChannel, error) {
+	c.kernelChannelLock.Lock()
+	defer c.kernelChannelLock.Unlock()
+
+	if c.kernelChannel == nil {
+		kernelChannel, err := c.dialKernelChannel(c.logger)
+		if err != nil {
+			return nil, errors.WithMessage(err, "dial kernel channel")
+		}
+		c.kernelChannel = kernelChannel
+		c.kernelModuleInfo = kernelChannel.ProtocolInfo()
+	}
+
+	return c.kernelChannel, nil
+}
+
+func (c *Controller) isKernelChannelOpen() bool {
+	c.kernelChannelLock.Lock()
+	defer c.kernelChannelLock.Unlock()
+
+	return c.kernelChannel != nil
+}
+
+func (c *Controller) closeKernelChannel() error {
+	c.kernelChannelLock.Lock()
+	defer c.kernelChannelLock.Unlock()
+
+	if c.kernelChannel == nil {
+		return nil
+	}
+
+	err := c.kernelChannel.Close()
+	c.kernelChannel = nil
+	return err
+}
+
 func (c *Controller) AddDetector(request requests.DetectionRequest, operators []operators.Operator, start bool) error {
 	detectorType, err := c.detectorType(request)
 	if err != nil {
@@ -63,6 +121,13 @@ func (c *Controller) AddDetector(request requests.DetectionRequest, operators []
 		return errDetectorAlreadyExists(requestName)
 	}
 
+	// Never waits for a running detector to finish while holding the lock, which stopping detectors requires, so
+	// detectors beyond the limit are rejected instead.
+	if start && !c.tryAcquireDetectorsSemaphore() {
+		return errors.Errorf("max concurrent detectors (%d) are running, rejecting request '%s'",
+			cap(c.detectorsSemaphore), requestName)
+	}
+
 	c.requestDetectors[requestName] = detector
 
 	if start {
@@ -72,7 +137,9 @@ func (c *Controller) AddDetector(request requests.DetectionRequest, operators []
 	return nil
 }
 
-func (c *Controller) RemoveDetector(request requests.DetectionRequest, operators []operators.Operator) error {
+// Processes watched by the kernel module on behalf of a previous agent run are not handled here, see
+// ReconcileKernelWatches().
+func (c *Controller) RemoveDetector(request requests.DetectionRequest) error {
 	detectorType, err := c.detectorType(request)
 	if err != nil {
 		return err
@@ -85,29 +152,66 @@ func (c *Controller) RemoveDetector(request requests.DetectionRequest, operators
 	funcLogger.Debug("Remove detector")
 
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
 	detector, exists := c.requestDetectors[requestName]
+	delete(c.requestDetectors, requestName)
+	c.lock.Unlock()
 
-	// In case agent was reloaded after detector was started in previous agent run, but now config has changed
-	// to stop it, create a new detector object.
 	if !exists {
-		detector, err = c.newDetector(request, operators, detectorType)
-		if err != nil {
-			return err
-		}
+		funcLogger.Debug("Detector does not exist, nothing to remove")
+		return nil
 	}
 
+	// Not while holding the lock, as stopping waits for running detections to be reported.
 	funcLogger.Debug("Stopping detector")
 	if err := detector.StopDetection(); err != nil {
 		return errors.WithMessagef(err, "stop detector '%s'", detectorName)
 	}
 
-	delete(c.requestDetectors, detectorName)
-
 	return nil
 }
 
+// Un-watches processes which the kernel module still watches (e.g, from a previous agent run) but aren't
+// configured for signal detection anymore. Configured ones are re-adopted by their detectors once started. Returns
+// whether it reconciled, as the kernel module isn't dialed for it unless some process is configured for signal
+// detection (or it's connected already).
+func (c *Controller) ReconcileKernelWatches(configuredPids map[types.Pid]bool) (bool, error) {
+	if !c.isKernelChannelOpen() && !anyConfigured(configuredPids) {
+		return false, nil
+	}
+
+	kernelChannel, err := c.getKernelChannel()
+	if err != nil {
+		return false, err
+	}
+
+	watchedPids, err := kernelChannel.ListWatchedProcesses()
+	if err != nil {
+		return false, err
+	}
+
+	var errs error
+	for _, watchedPid := range watchedPids {
+		if configuredPids[types.Pid(watchedPid)] {
+			continue
+		}
+
+		c.logger.Debug("Un-watch stale kernel watched process", zap.Uint32("Pid", watchedPid))
+		if err := kernelChannel.UnwatchProcess(watchedPid); err != nil {
+			errs = multierror.Append(errs, errors.WithMessagef(err, "unwatch process '%d'", watchedPid))
+		}
+	}
+	return true, errs
+}
+
+func anyConfigured(configuredPids map[types.Pid]bool) bool {
+	for _, configured := range configuredPids {
+		if configured {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Controller) detectorType(detectionRequest requests.DetectionRequest) (detectors.DetectorType, error) {
 	requestType := detectionRequest.RequestType()
 
@@ -121,7 +225,8 @@ func (c *Controller) detectorType(detectionRequest requests.DetectionRequest) (d
 
 func (c *Controller) newDetector(detectionRequest requests.DetectionRequest, detectionOperators []operators.Operator,
 	detectorType detectors.DetectorType) (detectors.Detector, error) {
-	detector, err := detectors.NewDetector(detectorType, c.context, c.logger, detectionRequest, detectionOperators)
+	detector, err := detectors.NewDetector(detectorType, c.context, c.logger, detectionRequest, detectionOperators,
+		c.getKernelChannel, c.environment)
 	if err != nil {
 		return nil, errors.WithMessage(err, "new detector")
 	}
@@ -134,24 +239,34 @@ func (c *Controller) Start() error {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
-	for _, detector := range c.requestDetectors {
-		c.startDetector(detector) // Note: must not block otherwise RLock() will be blocked as well.
+	for requestName, detector := range c.requestDetectors {
+		if !c.tryAcquireDetectorsSemaphore() {
+			c.logger.Error("Max concurrent detectors are running, not starting detector",
+				zap.String("RequestName", requestName), zap.Int("MaxConcurrentDetectors", cap(c.detectorsSemaphore)))
+			continue
+		}
+		c.startDetector(detector)
 	}
 
 	return nil
 }
 
-// Will block if reached max capacity.
-func (c *Controller) acquireDetectorsSemaphoreBlocking() {
-	c.detectorsSemaphore <- 1
+// Returns false if reached max capacity, rather than blocking.
+func (c *Controller) tryAcquireDetectorsSemaphore() bool {
+	select {
+	case c.detectorsSemaphore <- 1:
+		return true
+	default:
+		return false
+	}
 }
 
 func (c *Controller) releaseDetectorsSemaphore() {
 	<-c.detectorsSemaphore
 }
 
+// Must be called with the detectors semaphore acquired, which is released once the detector is done.
 func (c *Controller) startDetector(detector detectors.Detector) {
-	c.acquireDetectorsSemaphoreBlocking()
 	c.waitGroup.Add(1)
 
 	go func() {
@@ -187,7 +302,12 @@ func (c *Controller) mergeDetectorReportsChan(detector detectors.Detector) {
 			if !ok {
 				return
 			}
-			c.detectionReportsChan <- detectionReport
+
+			select {
+			case <-c.context.Done():
+				return
+			case c.detectionReportsChan <- detectionReport:
+			}
 		}
 	}
 }
@@ -198,9 +318,35 @@ func (c *Controller) WaitUntilCompletion() {
 
 func (c *Controller) Stop() error {
 	c.logger.Debug("Stop detection controller")
-	c.cancel() // Will cancel all child-contexts passed to detectors.
 
-	return nil
+	var errs error
+
+	// Cancels all child-contexts passed to detectors first, so stopping them doesn't wait for running detections.
+	c.cancel()
+
+	c.lock.Lock()
+	for requestName, detector := range c.requestDetectors {
+		if err := detector.StopDetection(); err != nil {
+			errs = multierror.Append(errs, errors.WithMessagef(err, "stop detector for request '%s'", requestName))
+		}
+	}
+	c.lock.Unlock()
+
+	// Un-watches leftovers as well, so the kernel module never holds signals on behalf of a stopped agent.
+	if err := c.closeKernelChannel(); err != nil {
+		errs = multierror.Append(errs, errors.WithMessage(err, "close kernel channel"))
+	}
+
+	return errs
+}
+
+// Returns the protocol info negotiated with the kernel module, or nil if no detector connected to it yet. Never
+// connects on its own, as the kernel module is only required by some of the detectors.
+func (c *Controller) KernelModuleInfo() *kernelComm.PayloadProtocolInfo {
+	c.kernelChannelLock.Lock()
+	defer c.kernelChannelLock.Unlock()
+
+	return c.kernelModuleInfo
 }
 
 func (c *Controller) DetectionReportsChan() <-chan map[string]interface{} {
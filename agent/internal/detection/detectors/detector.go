@@ -5,6 +5,7 @@ import (
 	"github.com/memlab/agent/internal/detection/requests"
 	kernelComm "github.com/memlab/agent/internal/kernel/communication"
 	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -14,27 +15,26 @@ type Detector interface {
 	StopDetection() error
 	WaitUntilCompletion()
 	DetectorName() string
+	MonitoredPid() types.Pid
 	Operators() []operators.Operator
 	ReportsChan() <-chan map[string]interface{}
 }
 
-var kernelCommunicator *kernelComm.Communicator
-
+// Kernel channel is only required by signal detectors, and is dialed lazily via the given getter.
 func NewDetector(detectorType DetectorType, ctx context.Context, rootLogger *zap.Logger,
-	detectionRequest requests.DetectionRequest, detectionOperators []operators.Operator) (Detector, error) {
+	detectionRequest requests.DetectionRequest, detectionOperators []operators.Operator,
+	getKernelChannel func() (kernelComm.KernelChannel, error), environment *Environment) (Detector, error) {
 	switch detectorType {
 	case DetectorTypeSignals:
-		if kernelCommunicator == nil {
-			var err error
-			kernelCommunicator, err = kernelComm.NewCommunicator(rootLogger, NlFamilyNameReceive, NlFamilyNameSend)
-			if err != nil {
-				return nil, errors.WithMessage(err, "new kernel communicator")
-			}
-
-			// todo: need to close it when detection controller stops.
+		kernelChannel, err := getKernelChannel()
+		if err != nil {
+			return nil, err
 		}
 
-		return newSignalDetector(detectorType, ctx, rootLogger, detectionRequest, detectionOperators, kernelCommunicator)
+		return newSignalDetector(detectorType, ctx, rootLogger, detectionRequest, detectionOperators, kernelChannel,
+			environment)
+	case DetectorTypeOomKills:
+		return newOomKillDetector(detectorType, ctx, rootLogger, detectionRequest, detectionOperators, environment)
 	default:
 		return nil, errors.Errorf("unknown detector type '%d'", detectorType)
 	}
@@ -0,0 +1,41 @@
+package detectors
+
+import (
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/types"
+	"time"
+)
+
+// Environment is what detectors observe of the host besides their requests: time, and the processes they monitor.
+// Replays substitute both, so replayed detections never depend on the wall-clock or on live processes.
+type Environment struct {
+	Clock       Clock
+	OpenProcess func(pid types.Pid) (*prochandle.Handle, error)
+}
+
+func HostEnvironment() *Environment {
+	return &Environment{
+		Clock:       hostClock{},
+		OpenProcess: prochandle.Open,
+	}
+}
+
+type Clock interface {
+	Now() time.Time
+	// Calls f in its own goroutine once d elapsed, unless the returned timer is stopped before.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type hostClock struct{}
+
+func (hostClock) Now() time.Time {
+	return time.Now()
+}
+
+func (hostClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,188 @@
+package detectors
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/detection/requests"
+	"github.com/memlab/agent/internal/kmsg"
+	"github.com/memlab/agent/internal/operations"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// OomKillDetector follows kernel messages for OOM kills of its process. Each detector reads /dev/kmsg on its own, as
+// every reader has its own position.
+type OomKillDetector struct {
+	detectorType       DetectorType
+	logger             *zap.Logger
+	context            context.Context // Of the detection loop, cancelled once detection is stopped.
+	cancel             context.CancelFunc
+	detectionContext   context.Context // Of the detected OOM kill's detection, which outlives the detection loop.
+	waitGroup          sync.WaitGroup
+	detectionOperators []operators.Operator
+	reportsChan        chan map[string]interface{}
+	environment        *Environment
+	monitorPid         types.Pid
+}
+
+func newOomKillDetector(detectorType DetectorType, ctx context.Context, rootLogger *zap.Logger,
+	detectionRequest requests.DetectionRequest, detectionOperators []operators.Operator,
+	environment *Environment) (*OomKillDetector, error) {
+	detectOomKillsRequest, ok := detectionRequest.(*requests.DetectOomKills)
+	if !ok {
+		return nil, errors.New("failed to convert interface to detection request object")
+	}
+
+	logger := rootLogger.Named("oom-kill-detector")
+
+	loopContext, cancel := context.WithCancel(ctx)
+
+	return &OomKillDetector{
+		detectorType:       detectorType,
+		logger:             logger,
+		context:            loopContext,
+		cancel:             cancel,
+		detectionContext:   ctx,
+		detectionOperators: detectionOperators,
+		reportsChan:        make(chan map[string]interface{}),
+		environment:        environment,
+		monitorPid:         detectOomKillsRequest.Pid,
+	}, nil
+}
+
+func (od *OomKillDetector) StartDetectionLoop() error {
+	// Opened while the process runs, so a process which reused its pid is never mistaken for it once it's killed.
+	process, err := od.environment.OpenProcess(od.monitorPid)
+	if err != nil {
+		od.logger.Error("Failed to open process handle", zap.Error(err))
+		return err
+	}
+
+	// Only kills from now on are detected, rather than ones already in the kernel's ring buffer.
+	reader, err := kmsg.OpenReader(true)
+	if err != nil {
+		od.logger.Error("Failed to open kernel messages reader", zap.Error(err))
+		if err := process.Close(); err != nil {
+			od.logger.Warn("Failed to close process handle", zap.Error(err))
+		}
+		return err
+	}
+
+	od.waitGroup.Add(1)
+	go od.handleKernelMessages(reader, process)
+
+	return nil
+}
+
+func (od *OomKillDetector) handleKernelMessages(reader *kmsg.Reader, process *prochandle.Handle) {
+	defer od.waitGroup.Done()
+	defer func() {
+		if err := reader.Close(); err != nil {
+			od.logger.Warn("Failed to close kernel messages reader", zap.Error(err))
+		}
+		if err := process.Close(); err != nil {
+			od.logger.Warn("Failed to close process handle", zap.Error(err))
+		}
+	}()
+
+	// Detection is stopped once the process exits, which might be noticed before its OOM kill is read, so messages which
+	// were already logged by then are still read.
+	draining := false
+
+	parser := kmsg.NewParser()
+	for {
+		message, err := reader.Next()
+		if err != nil {
+			od.logger.Error("Failed to read kernel message", zap.Error(err))
+			return
+		}
+
+		if message == nil {
+			if draining {
+				od.logger.Debug("Done handling kernel messages")
+				return
+			}
+
+			if err := reader.Wait(od.context); err != nil {
+				if od.context.Err() == nil {
+					od.logger.Error("Failed to wait for kernel messages", zap.Error(err))
+					return
+				}
+				draining = true
+			}
+			continue
+		}
+
+		event := parser.Parse(message)
+		if event == nil || event.OomKill == nil || event.OomKill.Pid != od.monitorPid {
+			continue
+		}
+
+		// A process which reused the pid was killed, so the monitored one is long gone.
+		if err := process.Verify(); errors.Cause(err) == prochandle.ErrProcessReplaced {
+			od.logger.Debug("Ignore OOM kill of process which reused pid", zap.Error(err))
+			return
+		}
+
+		od.logger.Debug("Detected OOM kill", zap.Any("OomKill", event.OomKill))
+		od.handleOomKill(event.OomKill, process)
+		return // Nothing is left to detect once the process is killed.
+	}
+}
+
+func (od *OomKillDetector) handleOomKill(oomKill *kmsg.OomKill, process *prochandle.Handle) {
+	funcLogger := od.logger.With(zap.Int32("Pid", int32(od.monitorPid)))
+
+	operatorsPipeline := operations.NewPipeline(od.detectionContext, od.logger, od.detectionOperators)
+	report, err := operatorsPipeline.Run(process)
+	if err != nil {
+		funcLogger.Error("Failed to run operators pipeline", zap.Error(err))
+		return
+	}
+
+	oomKillReport := &postdetection.OomKillReport{
+		Pid:     od.monitorPid,
+		OomKill: oomKill,
+	}
+	if err := reports.MergeReportsInto(report, oomKillReport); err != nil {
+		funcLogger.Error("Failed to merge OOM kill report", zap.Error(err))
+	}
+
+	select {
+	case <-od.detectionContext.Done():
+	case od.reportsChan <- report:
+	}
+}
+
+func (od *OomKillDetector) WaitUntilCompletion() {
+	od.waitGroup.Wait() // Block until detection goroutines are done.
+}
+
+// Waits for a detected OOM kill to be reported, as detection is turned off once the killed process' exit is noticed.
+func (od *OomKillDetector) StopDetection() error {
+	od.cancel()
+	od.waitGroup.Wait()
+
+	return nil
+}
+
+func (od *OomKillDetector) DetectorName() string {
+	return od.detectorType.Name()
+}
+
+func (od *OomKillDetector) MonitoredPid() types.Pid {
+	return od.monitorPid
+}
+
+func (od *OomKillDetector) Operators() []operators.Operator {
+	return od.detectionOperators
+}
+
+func (od *OomKillDetector) ReportsChan() <-chan map[string]interface{} {
+	return od.reportsChan
+}
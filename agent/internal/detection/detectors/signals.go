@@ -6,15 +6,20 @@ import (
 	kernelComm "github.com/memlab/agent/internal/kernel/communication"
 	"github.com/memlab/agent/internal/operations"
 	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
 	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"gopkg.in/guregu/null.v3"
 	"sync"
+	"time"
 )
 
 const (
-	NlFamilyNameReceive = "memlab-ktu"
-	NlFamilyNameSend    = "memlab-utk"
+	// How long operators may run while the kernel module holds the caught signal, unless the detection request sets
+	// its own budget. Well below the module's own timeout (see wait_timeout_seconds in kernel/ml_crash_detector.h).
+	defaultSignalHoldBudget = time.Second * 10
 )
 
 // todo: collect process exit code
@@ -22,20 +27,23 @@ const (
 type SignalDetector struct {
 	detectorType         DetectorType
 	logger               *zap.Logger
-	context              context.Context
+	context              context.Context // Of the detection loop, cancelled once detection is stopped.
 	cancel               context.CancelFunc
+	detectionContext     context.Context // Of caught signals' detections, which outlive the detection loop.
 	waitGroup            sync.WaitGroup
 	detectionOperators   []operators.Operator
 	reportsChan          chan map[string]interface{}
-	kernelCommunicator   *kernelComm.Communicator
+	kernelChannel        kernelComm.KernelChannel
+	environment          *Environment
 	detectSignalsRequest *requests.DetectSignals
+	holdBudget           time.Duration
 	monitorPid           types.Pid
 	monitorPidRaw        uint32
 }
 
 func newSignalDetector(detectorType DetectorType, ctx context.Context, rootLogger *zap.Logger,
 	detectionRequest requests.DetectionRequest, detectionOperators []operators.Operator,
-	kernelCommunicator *kernelComm.Communicator) (*SignalDetector, error) {
+	kernelChannel kernelComm.KernelChannel, environment *Environment) (*SignalDetector, error) {
 	detectSignalsRequest, ok := detectionRequest.(*requests.DetectSignals)
 	if !ok {
 		return nil, errors.New("failed to convert interface to detection request object")
@@ -43,45 +51,47 @@ func newSignalDetector(detectorType DetectorType, ctx context.Context, rootLogge
 
 	logger := rootLogger.Named("signal-detector")
 
-	ctx, cancel := context.WithCancel(ctx)
+	loopContext, cancel := context.WithCancel(ctx)
+
+	holdBudget := detectSignalsRequest.HoldBudget
+	if holdBudget == 0 {
+		holdBudget = defaultSignalHoldBudget
+	}
 
 	return &SignalDetector{
 		detectorType:         detectorType,
 		logger:               logger,
-		context:              ctx,
+		context:              loopContext,
 		cancel:               cancel,
+		detectionContext:     ctx,
 		detectionOperators:   detectionOperators,
 		reportsChan:          make(chan map[string]interface{}),
-		kernelCommunicator:   kernelCommunicator,
+		kernelChannel:        kernelChannel,
+		environment:          environment,
 		detectSignalsRequest: detectSignalsRequest,
+		holdBudget:           holdBudget,
 		monitorPid:           detectSignalsRequest.Pid,
 		monitorPidRaw:        detectSignalsRequest.Pid.Uint32(),
 	}, nil
 }
 
 func (sd *SignalDetector) StartDetectionLoop() error {
-	sd.waitGroup.Add(1)
-	go sd.handleCaughtSignals()
-
-	err := sd.listenForCaughtSignals()
-	if err != nil { // Spawns a go-routine internally.
+	// Subscribe before watching the process, so no caught signal is missed.
+	caughtSignalsChan, err := sd.kernelChannel.Subscribe(sd.monitorPidRaw)
+	if err != nil {
+		sd.logger.Error("Failed to subscribe for caught-signals", zap.Error(err))
 		return err
 	}
 
-	sd.startKernelSignalDetection()
+	sd.waitGroup.Add(1)
+	go sd.handleCaughtSignals(caughtSignalsChan)
 
-	return nil
-}
+	sd.startKernelSignalDetection()
 
-func (sd *SignalDetector) listenForCaughtSignals() error {
-	if err := sd.kernelCommunicator.ListenForCaughtSignals(); err != nil {
-		sd.logger.Error("Failed to listen for caught-signals", zap.Error(err))
-		return err
-	}
 	return nil
 }
 
-func (sd *SignalDetector) handleCaughtSignals() {
+func (sd *SignalDetector) handleCaughtSignals(caughtSignalsChan <-chan *kernelComm.PayloadCaughtSignal) {
 	defer sd.waitGroup.Done()
 
 	for {
@@ -89,7 +99,7 @@ func (sd *SignalDetector) handleCaughtSignals() {
 		case <-sd.context.Done():
 			sd.logger.Debug("Done handling caught signals")
 			return
-		case caughtSignal, ok := <-sd.kernelCommunicator.CaughtSignalsChan():
+		case caughtSignal, ok := <-caughtSignalsChan:
 			if !ok {
 				sd.logger.Error("Caught-signals channel was closed unexpectedly")
 				return
@@ -101,33 +111,103 @@ func (sd *SignalDetector) handleCaughtSignals() {
 	}
 }
 
+// Returns once the caught signal is released, while operators which run after the release (if released early) carry on
+// asynchronously, and report once done.
 func (sd *SignalDetector) handleCaughtSignal(caughtSignal *kernelComm.PayloadCaughtSignal) {
-	defer sd.waitGroup.Done()
-
 	funcLogger := sd.logger.With(zap.Uint32("Pid", caughtSignal.Pid))
 
-	defer func() {
-		if err := sd.kernelCommunicator.NotifyHandledSignal(sd.monitorPidRaw); err != nil {
+	// Held signals are released by pid rather than via the process handle, since no signal is delivered by the agent:
+	// the kernel module keeps the process blocked in its signal path until released, so its pid can't be reused by
+	// then (hold budgets are capped below the module's own timeout, see models.MaxSignalHoldBudget).
+	hold := newSignalHold(sd.environment.Clock, func() {
+		if err := sd.kernelChannel.NotifyHandledSignal(sd.monitorPidRaw); err != nil {
 			funcLogger.Error("Failed to notify handled signal", zap.Error(err),
 				zap.Any("Signal", caughtSignal))
-			return
 		}
+	})
+
+	// Release the process if operators take too long, letting slower ones carry on without it.
+	budgetTimer := sd.environment.Clock.AfterFunc(sd.holdBudget, func() {
+		funcLogger.Warn("Signal hold budget elapsed, releasing signal early",
+			zap.Duration("Budget", sd.holdBudget))
+		hold.release(true)
+	})
+
+	sd.waitGroup.Add(1)
+	go func() {
+		defer sd.waitGroup.Done()
+
+		report, err := sd.runOperators(funcLogger, hold.released)
+
+		budgetTimer.Stop()
+		hold.release(false) // No-op if already released early.
+
+		sd.reportCaughtSignal(funcLogger, caughtSignal, hold, report, err)
 	}()
 
-	operatorsPipeline := operations.NewPipeline(sd.context, sd.logger, sd.detectionOperators)
+	<-hold.released
+}
 
-	report, err := operatorsPipeline.Run(sd.monitorPid)
+func (sd *SignalDetector) reportCaughtSignal(funcLogger *zap.Logger, caughtSignal *kernelComm.PayloadCaughtSignal,
+	hold *signalHold, report map[string]interface{}, err error) {
 	if err != nil {
 		funcLogger.Error("Failed to run operators pipeline", zap.Error(err))
 		return
 	}
 
-	sd.reportsChan <- report
+	caughtSignalReport := &postdetection.CaughtSignalReport{
+		Signal:            caughtSignal.Signal,
+		SignalCode:        caughtSignal.Code,
+		Tid:               caughtSignal.Tid,
+		SenderPid:         caughtSignal.SenderPid,
+		SenderUid:         caughtSignal.SenderUid,
+		FaultAddress:      caughtSignal.FaultAddress,
+		HoldBudget:        sd.holdBudget.Milliseconds(),
+		HeldFor:           hold.heldFor.Milliseconds(),
+		HoldReleasedEarly: hold.releasedEarly,
+	}
+	if caughtAt := caughtSignal.Time(); !caughtAt.IsZero() {
+		caughtSignalReport.CaughtAt = null.TimeFrom(caughtAt)
+	}
+
+	if err := reports.MergeReportsInto(report, caughtSignalReport); err != nil {
+		funcLogger.Error("Failed to merge caught-signal report", zap.Error(err))
+	}
+
+	select {
+	case <-sd.detectionContext.Done():
+	case sd.reportsChan <- report:
+	}
+}
+
+// The process handle is opened while the kernel module holds the caught signal, so it refers to the process which
+// caught it. If it can't be opened, the caught signal is still reported, without any operators' reports.
+func (sd *SignalDetector) runOperators(funcLogger *zap.Logger, holdReleased <-chan struct{}) (map[string]interface{},
+	error) {
+	process, err := sd.environment.OpenProcess(sd.monitorPid)
+	if err != nil {
+		funcLogger.Warn("Failed to open process handle, skipping operators", zap.Error(err))
+		return make(map[string]interface{}, 0), nil
+	}
+	defer func() {
+		if err := process.Close(); err != nil {
+			funcLogger.Warn("Failed to close process handle", zap.Error(err))
+		}
+	}()
+
+	operatorsPipeline := operations.NewPipeline(sd.detectionContext, sd.logger, sd.detectionOperators)
+	return operatorsPipeline.RunHeld(process, holdReleased)
 }
 
 func (sd *SignalDetector) startKernelSignalDetection() {
 	sd.logger.Debug("Start kernel signal detection for process", zap.Uint32("Pid", sd.monitorPidRaw))
-	if err := sd.kernelCommunicator.WatchProcess(sd.monitorPidRaw); err != nil {
+	signalMask := sd.detectSignalsRequest.Signals.Uint32()
+	if err := sd.kernelChannel.WatchProcess(sd.monitorPidRaw, signalMask); err != nil {
+		if err == kernelComm.ErrProcessAlreadyWatched {
+			sd.logger.Debug("Re-adopted process watched by a previous agent run", zap.Uint32("Pid", sd.monitorPidRaw),
+				zap.Uint32("SignalMask", signalMask))
+			return
+		}
 		sd.logger.Error("Failed to watch process", zap.Error(err), zap.Uint32("Pid", sd.monitorPidRaw))
 		return
 	}
@@ -135,7 +215,7 @@ func (sd *SignalDetector) startKernelSignalDetection() {
 
 func (sd *SignalDetector) stopKernelSignalDetection() {
 	sd.logger.Debug("Stop kernel signal detection for process", zap.Uint32("Pid", sd.monitorPidRaw))
-	if err := sd.kernelCommunicator.UnwatchProcess(sd.monitorPidRaw); err != nil {
+	if err := sd.kernelChannel.UnwatchProcess(sd.monitorPidRaw); err != nil {
 		sd.logger.Error("Failed to unwatch process", zap.Error(err), zap.Uint32("Pid", sd.monitorPidRaw))
 		return
 	}
@@ -145,10 +225,14 @@ func (sd *SignalDetector) WaitUntilCompletion() {
 	sd.waitGroup.Wait() // Block until detection goroutines are done.
 }
 
+// Waits for detections of signals caught so far to be reported, e.g when detection is turned off since the process
+// exited right after catching a fatal signal.
 func (sd *SignalDetector) StopDetection() error {
 	sd.stopKernelSignalDetection()
+	sd.kernelChannel.Unsubscribe(sd.monitorPidRaw)
 
 	sd.cancel()
+	sd.waitGroup.Wait()
 
 	return nil
 }
@@ -157,12 +241,45 @@ func (sd *SignalDetector) DetectorName() string {
 	return sd.detectorType.Name()
 }
 
+func (sd *SignalDetector) MonitoredPid() types.Pid {
+	return sd.monitorPid
+}
+
 func (sd *SignalDetector) Operators() []operators.Operator {
-	return []operators.Operator{
-		&operators.CollectMetadata{},
-	}
+	return sd.detectionOperators
 }
 
 func (sd *SignalDetector) ReportsChan() <-chan map[string]interface{} {
 	return sd.reportsChan
 }
+
+// Releases a signal held by the kernel module exactly once, either when operators are done or when the hold budget
+// elapses, whichever comes first.
+type signalHold struct {
+	once          sync.Once
+	clock         Clock
+	notify        func()
+	heldSince     time.Time
+	released      chan struct{}
+	releasedEarly bool
+	heldFor       time.Duration
+}
+
+func newSignalHold(clock Clock, notify func()) *signalHold {
+	return &signalHold{
+		clock:     clock,
+		notify:    notify,
+		heldSince: clock.Now(),
+		released:  make(chan struct{}),
+	}
+}
+
+// Fields are safe to read once release() returned, since sync.Once waits for the first call to complete.
+func (sh *signalHold) release(early bool) {
+	sh.once.Do(func() {
+		sh.releasedEarly = early
+		sh.heldFor = sh.clock.Now().Sub(sh.heldSince)
+		sh.notify()
+		close(sh.released)
+	})
+}
@@ -0,0 +1,167 @@
+package detectors
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/detection/requests"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/types"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+type sleepReport struct{}
+
+func (r *sleepReport) ReportName() string {
+	return "sleep-report"
+}
+
+func (r *sleepReport) DumpReport() ([]byte, error) {
+	return []byte(`{"slept": true}`), nil
+}
+
+// Sleeps before reporting, and keeps running once the held signal is released.
+type sleepOperator struct {
+	duration time.Duration
+}
+
+func (o *sleepOperator) OperatorName() string {
+	return "sleep-operator"
+}
+
+func (o *sleepOperator) Operate(ctx context.Context, _ *prochandle.Handle) (reports.Report, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(o.duration):
+		return &sleepReport{}, nil
+	}
+}
+
+func (o *sleepOperator) FailPipelineOnError() bool {
+	return false
+}
+
+func (o *sleepOperator) RunsAfterSignalRelease() bool {
+	return true
+}
+
+// Monitors the test's own process, as operators only run against live processes.
+func startTestSignalDetector(t *testing.T, simulator *kernelComm.Simulator, holdBudget time.Duration,
+	detectionOperators ...operators.Operator) *SignalDetector {
+	request := &requests.DetectSignals{
+		Pid:        types.Pid(os.Getpid()),
+		HoldBudget: holdBudget,
+		TurnedOn:   true,
+	}
+
+	detector, err := newSignalDetector(DetectorTypeSignals, context.Background(), zap.NewNop(), request,
+		detectionOperators, simulator, HostEnvironment())
+	if err != nil {
+		t.Fatalf("new signal detector: %v", err)
+	} else if err := detector.StartDetectionLoop(); err != nil {
+		t.Fatalf("start detection loop: %v", err)
+	}
+	return detector
+}
+
+func stopTestSignalDetector(t *testing.T, detector *SignalDetector) {
+	if err := detector.StopDetection(); err != nil {
+		t.Errorf("stop detection: %v", err)
+	}
+	detector.WaitUntilCompletion()
+}
+
+func receiveReport(t *testing.T, detector *SignalDetector) map[string]interface{} {
+	select {
+	case report := <-detector.ReportsChan():
+		return report
+	case <-time.After(time.Second * 5):
+		t.Fatal("no report received")
+		return nil
+	}
+}
+
+func TestSignalDetectorReportsCaughtSignal(t *testing.T) {
+	simulator := kernelComm.NewSimulator(zap.NewNop())
+	defer simulator.Close()
+
+	detector := startTestSignalDetector(t, simulator, time.Second*5, &sleepOperator{})
+	defer stopTestSignalDetector(t, detector)
+
+	released, err := simulator.InjectCaughtSignal(&kernelComm.PayloadCaughtSignal{
+		Pid:       uint32(os.Getpid()),
+		Signal:    11,
+		Code:      1,
+		SenderPid: 1,
+	})
+	if err != nil {
+		t.Fatalf("inject caught signal: %v", err)
+	}
+
+	report := receiveReport(t, detector)
+	if !isClosed(released) {
+		t.Error("signal still held once reported")
+	}
+
+	expected := map[string]interface{}{
+		"signal":                     float64(11),
+		"signal_code":                float64(1),
+		"signal_sender_pid":          float64(1),
+		"signal_hold_budget_ms":      float64(5000),
+		"signal_hold_released_early": false,
+		"slept":                      true,
+	}
+	for key, value := range expected {
+		if report[key] != value {
+			t.Errorf("report['%s'] = %v, expected %v", key, report[key], value)
+		}
+	}
+}
+
+func TestSignalDetectorReleasesSignalOnceHoldBudgetElapses(t *testing.T) {
+	simulator := kernelComm.NewSimulator(zap.NewNop())
+	defer simulator.Close()
+
+	holdBudget := time.Millisecond * 100
+	detector := startTestSignalDetector(t, simulator, holdBudget, &sleepOperator{duration: holdBudget * 5})
+	defer stopTestSignalDetector(t, detector)
+
+	injectedAt := time.Now()
+	released, err := simulator.InjectCaughtSignal(&kernelComm.PayloadCaughtSignal{
+		Pid:    uint32(os.Getpid()),
+		Signal: 6,
+	})
+	if err != nil {
+		t.Fatalf("inject caught signal: %v", err)
+	}
+
+	select {
+	case <-released:
+	case <-time.After(holdBudget * 4):
+		t.Fatal("signal not released once hold budget elapsed")
+	}
+	releasedAfter := time.Since(injectedAt)
+
+	// Operators which run after the release carry on, and are reported once done.
+	report := receiveReport(t, detector)
+	if report["signal_hold_released_early"] != true {
+		t.Errorf("hold not reported as released early, held for %vms (released after %s)",
+			report["signal_held_for_ms"], releasedAfter)
+	} else if report["slept"] != true {
+		t.Error("operator which runs after the release was not reported")
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -4,10 +4,12 @@ type DetectorType int
 
 const (
 	DetectorTypeSignals DetectorType = iota
+	DetectorTypeOomKills
 )
 
 var detectorNames = map[DetectorType]string{
-	DetectorTypeSignals: "signal-detector",
+	DetectorTypeSignals:  "signal-detector",
+	DetectorTypeOomKills: "oom-kill-detector",
 }
 
 func (dt DetectorType) Name() string {
@@ -0,0 +1,19 @@
+package requests
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+)
+
+type DetectOomKills struct {
+	Pid      types.Pid
+	TurnedOn bool
+}
+
+func (n *DetectOomKills) RequestType() RequestType {
+	return RequestTypeDetectOomKills
+}
+
+func (n *DetectOomKills) Name() string {
+	return fmt.Sprintf("%d.%d", n.RequestType(), n.Pid)
+}
@@ -6,6 +6,7 @@ const (
 	RequestTypeDetectSignals RequestType = iota + 1
 	RequestTypeDetectThresholds
 	RequestTypeDetectSuspectedHangs
+	RequestTypeDetectOomKills
 )
 
 func (rt RequestType) Int() int {
@@ -3,12 +3,15 @@ package requests
 import (
 	"fmt"
 	"github.com/memlab/agent/internal/types"
+	"time"
 )
 
 type DetectSignals struct {
-	Pid      types.Pid
-	Restart  bool
-	TurnedOn bool
+	Pid        types.Pid
+	Signals    types.SignalMask
+	HoldBudget time.Duration // Zero for the detector's default.
+	Restart    bool          // Not implemented yet, restarts must signal processes via their handle (see prochandle).
+	TurnedOn   bool
 }
 
 func (n *DetectSignals) RequestType() RequestType {
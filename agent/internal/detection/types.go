@@ -6,5 +6,6 @@ import (
 )
 
 var requestTypeToDetectorType = map[requests.RequestType]detectors.DetectorType{
-	requests.RequestTypeDetectSignals: detectors.DetectorTypeSignals,
+	requests.RequestTypeDetectSignals:  detectors.DetectorTypeSignals,
+	requests.RequestTypeDetectOomKills: detectors.DetectorTypeOomKills,
 }
@@ -0,0 +1,119 @@
+package devserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Admin api is used to set up detection configs and inspect what agents reported. Faults are never injected into it.
+
+func (s *Server) handleAdminHosts(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	s.writeJson(w, http.StatusOK, s.store.listHosts())
+}
+
+// Expects a "machine_id" query parameter.
+func (s *Server) handleAdminProcesses(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	s.writeJson(w, http.StatusOK, s.store.listProcesses(r.URL.Query().Get("machine_id")))
+}
+
+func (s *Server) handleAdminProcessEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	s.writeJson(w, http.StatusOK, s.store.listProcessEvents())
+}
+
+// Collection endpoint supports GET and POST, whereas "<endpoint>/<id>/" supports PUT and DELETE.
+func (s *Server) handleAdminDetectionConfigs(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, endpointAdminDetectionConfigs), "/") == "" {
+		s.handleAdminDetectionConfigsCollection(w, r)
+		return
+	}
+
+	id, found := pathParameter(r, endpointAdminDetectionConfigs)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		record := &DetectionConfigRecord{}
+		if !s.decodeBody(w, r, record) {
+			return
+		}
+
+		if err := s.store.updateDetectionConfig(id, record); err != nil {
+			s.writeStoreError(w, err)
+			return
+		}
+		s.writeJson(w, http.StatusOK, record)
+	case http.MethodDelete:
+		if err := s.store.deleteDetectionConfig(id); err != nil {
+			s.writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		allowMethods(w, r, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) handleAdminDetectionConfigsCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJson(w, http.StatusOK, s.store.listDetectionConfigs())
+	case http.MethodPost:
+		record := &DetectionConfigRecord{}
+		if !s.decodeBody(w, r, record) {
+			return
+		}
+
+		if err := s.store.createDetectionConfig(record); err != nil {
+			s.writeStoreError(w, err)
+			return
+		}
+		s.writeJson(w, http.StatusCreated, record)
+	default:
+		allowMethods(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) handleAdminFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJson(w, http.StatusOK, s.currentFaults())
+	case http.MethodPut:
+		faults := &Faults{}
+		if !s.decodeBody(w, r, faults) {
+			return
+		}
+
+		if valid, err := faults.Valid(); !valid {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.faultsLock.Lock()
+		s.faults = *faults
+		s.faultsLock.Unlock()
+
+		s.writeJson(w, http.StatusOK, faults)
+	default:
+		allowMethods(w, r, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (s *Server) writeStoreError(w http.ResponseWriter, err error) {
+	if err == errNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
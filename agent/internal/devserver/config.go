@@ -0,0 +1,47 @@
+package devserver
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	Address string
+	Token   string
+	Faults  *Faults
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.Address == "" {
+		return false, errors.New("empty address")
+	} else if c.Token == "" {
+		return false, errors.New("empty token")
+	}
+
+	if c.Faults != nil {
+		if valid, err := c.Faults.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate faults")
+		}
+	}
+
+	return true, nil
+}
+
+// Faults are injected into agent-facing endpoints only, never into the admin api.
+type Faults struct {
+	Latency   time.Duration `json:"latency"`    // Added to every request (nanoseconds, when encoded as json).
+	ErrorRate float64       `json:"error_rate"` // Probability of responding with a 5xx status code.
+	DropRate  float64       `json:"drop_rate"`  // Probability of closing the connection without responding.
+}
+
+func (f *Faults) Valid() (bool, error) {
+	if f.Latency < 0 {
+		return false, errors.New("negative latency")
+	} else if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return false, errors.New("error rate must be between 0 and 1")
+	} else if f.DropRate < 0 || f.DropRate > 1 {
+		return false, errors.New("drop rate must be between 0 and 1")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,336 @@
+package devserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mirrors the endpoints used by control.Plane (see dashboard/backend/memlab_backend/hosts/urls.py).
+const (
+	endpointHosts                     = "/hosts/"
+	endpointProcesses                 = "/processes/"
+	endpointProcessEvents             = "/process_events/"
+	endpointDetectionConfigsByMachine = "/detection_configs/by_machine/"
+	endpointMarkIrrelevant            = "/detection_configs/mark_irrelevant/"
+
+	adminPrefix                   = "/_admin"
+	endpointAdminHosts            = adminPrefix + endpointHosts
+	endpointAdminProcesses        = adminPrefix + endpointProcesses
+	endpointAdminProcessEvents    = adminPrefix + endpointProcessEvents
+	endpointAdminDetectionConfigs = adminPrefix + "/detection_configs/"
+	endpointAdminFaults           = adminPrefix + "/faults/"
+
+	shutdownTimeout = time.Second * 5
+)
+
+// Server is an in-memory stand-in for the dashboard backend, for local development and integration tests.
+type Server struct {
+	logger     *zap.Logger
+	waitGroup  sync.WaitGroup
+	config     *Config
+	httpServer *http.Server
+	store      *store
+	faults     Faults
+	faultsLock sync.RWMutex
+	random     *rand.Rand
+	randomLock sync.Mutex
+}
+
+func NewServer(rootLogger *zap.Logger, config *Config) (*Server, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate dev server config")
+	}
+
+	logger := rootLogger.Named("dev-server")
+
+	server := &Server{
+		logger: logger,
+		config: config,
+		store:  newStore(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if config.Faults != nil {
+		server.faults = *config.Faults
+	}
+
+	server.httpServer = &http.Server{
+		Addr:    config.Address,
+		Handler: server.Handler(),
+	}
+
+	return server, nil
+}
+
+// Handler can be served directly (e.g, by httptest) without calling Start().
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle(endpointHosts, s.withFaults(s.handleHosts))
+	mux.Handle(endpointProcesses, s.withFaults(s.handleProcesses))
+	mux.Handle(endpointProcessEvents, s.withFaults(s.handleProcessEvents))
+	mux.Handle(endpointDetectionConfigsByMachine, s.withFaults(s.handleDetectionConfigsByMachine))
+	mux.Handle(endpointMarkIrrelevant, s.withFaults(s.handleMarkIrrelevant))
+
+	mux.HandleFunc(endpointAdminHosts, s.handleAdminHosts)
+	mux.HandleFunc(endpointAdminProcesses, s.handleAdminProcesses)
+	mux.HandleFunc(endpointAdminProcessEvents, s.handleAdminProcessEvents)
+	mux.HandleFunc(endpointAdminDetectionConfigs, s.handleAdminDetectionConfigs)
+	mux.HandleFunc(endpointAdminFaults, s.handleAdminFaults)
+
+	return s.withAuthentication(mux)
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return errors.WithMessagef(err, "listen on '%s'", s.config.Address)
+	}
+
+	s.logger.Info("Start dev server", zap.String("Address", listener.Addr().String()))
+
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Dev server failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) WaitUntilCompletion() {
+	s.waitGroup.Wait()
+}
+
+func (s *Server) Stop() error {
+	s.logger.Debug("Stop dev server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) withAuthentication(next http.Handler) http.Handler {
+	expected := fmt.Sprintf("Token %s", s.config.Token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != expected {
+			s.logger.Debug("Unauthorized request", zap.String("Path", r.URL.Path))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) withFaults(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		faults := s.currentFaults()
+
+		if faults.Latency > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(faults.Latency):
+			}
+		}
+
+		if s.roll(faults.DropRate) {
+			s.logger.Debug("Inject dropped connection", zap.String("Path", r.URL.Path))
+			s.dropConnection(w)
+			return
+		}
+
+		if s.roll(faults.ErrorRate) {
+			s.logger.Debug("Inject server error", zap.String("Path", r.URL.Path))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
+func (s *Server) dropConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		s.logger.Error("Failed to hijack connection", zap.Error(err))
+		return
+	}
+	_ = conn.Close()
+}
+
+func (s *Server) roll(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	s.randomLock.Lock()
+	defer s.randomLock.Unlock()
+	return s.random.Float64() < probability
+}
+
+func (s *Server) currentFaults() Faults {
+	s.faultsLock.RLock()
+	defer s.faultsLock.RUnlock()
+	return s.faults
+}
+
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	host := &models.Host{}
+	if !s.decodeBody(w, r, host) {
+		return
+	} else if host.MachineId == "" {
+		http.Error(w, "empty machine id", http.StatusBadRequest)
+		return
+	}
+
+	s.store.putHost(host)
+	s.writeJson(w, http.StatusOK, host)
+}
+
+func (s *Server) handleProcesses(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	list := &processList{}
+	if !s.decodeBody(w, r, list) {
+		return
+	}
+
+	if err := s.store.putProcesses(list); err != nil {
+		w.WriteHeader(http.StatusNotFound) // Unknown host.
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleProcessEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	event := make(map[string]interface{}, 0)
+	if !s.decodeBody(w, r, &event) {
+		return
+	}
+
+	s.store.addProcessEvent(event)
+	s.writeJson(w, http.StatusOK, event)
+}
+
+func (s *Server) handleDetectionConfigsByMachine(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	machineId, found := pathParameter(r, endpointDetectionConfigsByMachine)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, s.store.detectionConfigsByMachine(machineId))
+}
+
+func (s *Server) handleMarkIrrelevant(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	id, found := pathParameter(r, endpointMarkIrrelevant)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var processExit *models.ProcessExit
+	if r.ContentLength != 0 { // Body is only sent when the process' exit is known.
+		processExit = &models.ProcessExit{}
+		if !s.decodeBody(w, r, processExit) {
+			return
+		}
+	}
+
+	if err := s.store.markDetectionConfigIrrelevant(id, processExit); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.logger.Error("Failed to read request body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) writeJson(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error("Failed to marshal response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		s.logger.Debug("Failed to write response", zap.Error(err))
+	}
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	return false
+}
+
+// Returns the path segment following the given prefix, e.g "<id>" for "/prefix/<id>/".
+func pathParameter(r *http.Request, prefix string) (string, bool) {
+	parameter := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if parameter == "" || strings.Contains(parameter, "/") {
+		return "", false
+	}
+	return parameter, true
+}
@@ -0,0 +1,246 @@
+package devserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+	"sync"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// DetectionConfigRecord is a detection config as stored by the dev server. Unlike the dashboard backend, where
+// configs are bound to a process record, configs are bound to a machine id directly.
+type DetectionConfigRecord struct {
+	MachineId string `json:"machine_id"`
+	*models.DetectionConfiguration
+	*models.ProcessExit // Set once marked irrelevant due to its process' exit.
+}
+
+type processList struct {
+	MachineId string            `json:"machine_id"`
+	Processes []*models.Process `json:"processes"`
+}
+
+type store struct {
+	lock             sync.RWMutex
+	hosts            map[string]*models.Host
+	processes        map[string]map[types.Pid]*models.Process
+	processEvents    []map[string]interface{}
+	detectionConfigs map[string]*DetectionConfigRecord
+}
+
+func newStore() *store {
+	return &store{
+		hosts:            make(map[string]*models.Host, 0),
+		processes:        make(map[string]map[types.Pid]*models.Process, 0),
+		processEvents:    make([]map[string]interface{}, 0),
+		detectionConfigs: make(map[string]*DetectionConfigRecord, 0),
+	}
+}
+
+func (s *store) putHost(host *models.Host) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if existing, found := s.hosts[host.MachineId]; found {
+		host.ID = existing.ID
+	} else {
+		host.ID = newId()
+	}
+	s.hosts[host.MachineId] = host
+}
+
+func (s *store) listHosts() []*models.Host {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	hosts := make([]*models.Host, 0, len(s.hosts))
+	for _, host := range s.hosts {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Processes can only be reported for known hosts, same as the dashboard backend.
+func (s *store) putProcesses(list *processList) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.hosts[list.MachineId]; !found {
+		return errNotFound
+	}
+
+	machineProcesses, found := s.processes[list.MachineId]
+	if !found {
+		machineProcesses = make(map[types.Pid]*models.Process, len(list.Processes))
+		s.processes[list.MachineId] = machineProcesses
+	}
+
+	for _, process := range list.Processes {
+		machineProcesses[process.Pid] = process
+	}
+	return nil
+}
+
+func (s *store) listProcesses(machineId string) []*models.Process {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	processes := make([]*models.Process, 0, len(s.processes[machineId]))
+	for _, process := range s.processes[machineId] {
+		processes = append(processes, process)
+	}
+	return processes
+}
+
+func (s *store) addProcessEvent(event map[string]interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.processEvents = append(s.processEvents, event)
+}
+
+func (s *store) listProcessEvents() []map[string]interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	events := make([]map[string]interface{}, len(s.processEvents))
+	copy(events, s.processEvents)
+	return events
+}
+
+func (s *store) createDetectionConfig(record *DetectionConfigRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.completeDetectionConfig(record); err != nil {
+		return err
+	}
+
+	record.ID = newId()
+	record.CreatedAt = record.ModifiedAt
+	record.IsRelevant = true
+
+	s.detectionConfigs[record.ID] = record
+	return nil
+}
+
+// Relevance is kept as is, since only agents mark configs as irrelevant.
+func (s *store) updateDetectionConfig(id string, record *DetectionConfigRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existing, found := s.detectionConfigs[id]
+	if !found {
+		return errNotFound
+	}
+
+	if err := s.completeDetectionConfig(record); err != nil {
+		return err
+	}
+
+	record.ID = id
+	record.CreatedAt = existing.CreatedAt
+	record.IsRelevant = existing.IsRelevant
+
+	s.detectionConfigs[id] = record
+	return nil
+}
+
+// Process create time is filled from the reported process list when omitted, so configs can be created by pid alone.
+// Selector configs have neither.
+// Must be called while holding the lock.
+func (s *store) completeDetectionConfig(record *DetectionConfigRecord) error {
+	if record.MachineId == "" {
+		return errors.New("empty machine id")
+	} else if record.DetectionConfiguration == nil {
+		return errors.New("empty detection config")
+	}
+
+	if _, err := record.SignalMask(); err != nil {
+		return err
+	} else if _, err := record.SignalHoldBudgetDuration(); err != nil {
+		return err
+	}
+
+	if record.SelectsProcesses() { // Expanded by agents, per matching process.
+		if valid, err := record.Selector.Valid(); !valid {
+			return err
+		} else if record.Pid != 0 {
+			return errors.New("either a pid or a selector must be set, not both")
+		}
+	} else if !record.ProcessCreateTime.Valid {
+		process, found := s.processes[record.MachineId][record.Pid]
+		if !found {
+			return errors.Errorf("unknown pid '%d' for machine '%s', process create time must be set",
+				record.Pid, record.MachineId)
+		}
+		record.ProcessCreateTime = process.CreateTime
+	}
+
+	record.ModifiedAt = null.TimeFrom(time.Now().UTC())
+	return nil
+}
+
+func (s *store) deleteDetectionConfig(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.detectionConfigs[id]; !found {
+		return errNotFound
+	}
+	delete(s.detectionConfigs, id)
+	return nil
+}
+
+func (s *store) listDetectionConfigs() []*DetectionConfigRecord {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	records := make([]*DetectionConfigRecord, 0, len(s.detectionConfigs))
+	for _, record := range s.detectionConfigs {
+		records = append(records, record)
+	}
+	return records
+}
+
+// Only relevant configs are listed, same as the dashboard backend.
+func (s *store) detectionConfigsByMachine(machineId string) []*models.DetectionConfiguration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	configs := make([]*models.DetectionConfiguration, 0)
+	for _, record := range s.detectionConfigs {
+		if record.MachineId == machineId && record.IsRelevant {
+			configs = append(configs, record.DetectionConfiguration)
+		}
+	}
+	return configs
+}
+
+// Process exit is optional (may be nil).
+func (s *store) markDetectionConfigIrrelevant(id string, processExit *models.ProcessExit) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record, found := s.detectionConfigs[id]
+	if !found {
+		return errNotFound
+	}
+	record.IsRelevant = false
+	record.ProcessExit = processExit
+	return nil
+}
+
+func newId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4.
+	b[8] = (b[8] & 0x3f) | 0x80 // Variant 10.
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
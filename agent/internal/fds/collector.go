@@ -0,0 +1,104 @@
+package fds
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/procenv"
+	"github.com/memlab/agent/internal/sockets"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Inventory of the process' fds, the first of which (up to the max) are detailed.
+type Inventory struct {
+	Fds        []*Fd    `json:"fds"`
+	OmittedFds int      `json:"omitted_fds,omitempty"`
+	Summary    *Summary `json:"fds_summary"`
+	Errors     []string `json:"fds_errors,omitempty"` // E.g, failures to resolve sockets.
+}
+
+type Summary struct {
+	Open                  int            `json:"open"`
+	ByType                map[FdType]int `json:"by_type"`
+	SoftLimit             *uint64        `json:"soft_limit,omitempty"` // Nil if unlimited.
+	HardLimit             *uint64        `json:"hard_limit,omitempty"`
+	SoftLimitUsagePercent float64        `json:"soft_limit_usage_percent,omitempty"`
+}
+
+func CollectInventory(pid types.Pid, config *Config) (*Inventory, error) {
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list fds")
+	}
+
+	fdNumbers := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if fd, err := strconv.Atoi(entry.Name()); err == nil {
+			fdNumbers = append(fdNumbers, fd)
+		}
+	}
+	sort.Ints(fdNumbers)
+
+	inventory := &Inventory{
+		Fds: make([]*Fd, 0),
+		Summary: &Summary{
+			ByType: make(map[FdType]int, 0),
+		},
+	}
+
+	var socketsByInode map[uint64]*Socket
+	for _, fdNumber := range fdNumbers {
+		target, err := os.Readlink(fmt.Sprintf("%s/%d", fdDir, fdNumber))
+		if err != nil { // Closed meanwhile.
+			continue
+		}
+
+		fd := &Fd{
+			Fd:     fdNumber,
+			Type:   classifyTarget(target),
+			Target: target,
+		}
+		inventory.Summary.Open++
+		inventory.Summary.ByType[fd.Type]++
+
+		if len(inventory.Fds) == config.MaxFds {
+			inventory.OmittedFds++
+			continue
+		}
+
+		position, flags, err := readFdInfo(pid, fdNumber)
+		if err != nil {
+			continue // Closed meanwhile.
+		}
+		fd.Position, fd.Flags = position, formatFlags(flags)
+
+		if fd.Type == FdTypeSocket {
+			if socketsByInode == nil { // Read once there's a socket to resolve.
+				socketsByInode, err = readSockets(pid)
+				if err != nil {
+					inventory.Errors = append(inventory.Errors, errors.WithMessage(err, "read sockets").Error())
+				}
+			}
+			if inode, isSocket := sockets.ParseSocketLink(target); isSocket {
+				fd.Socket = socketsByInode[inode]
+			}
+		}
+		inventory.Fds = append(inventory.Fds, fd)
+	}
+
+	limit, err := procenv.ReadLimit(pid, procenv.LimitOpenFiles)
+	if err != nil {
+		inventory.Errors = append(inventory.Errors, err.Error())
+	} else {
+		inventory.Summary.SoftLimit, inventory.Summary.HardLimit = limit.Soft, limit.Hard
+		if limit.Soft != nil && *limit.Soft > 0 {
+			inventory.Summary.SoftLimitUsagePercent = float64(inventory.Summary.Open) * 100 / float64(*limit.Soft)
+		}
+	}
+
+	return inventory, nil
+}
@@ -0,0 +1,17 @@
+package fds
+
+import (
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	MaxFds int // Fds beyond are only counted, e.g of processes leaking them.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxFds <= 0 {
+		return false, errors.New("max fds must be positive")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,43 @@
+package fds
+
+import (
+	"strings"
+)
+
+type FdType string
+
+const (
+	FdTypeFile      FdType = "file"
+	FdTypeDevice    FdType = "device"
+	FdTypeSocket    FdType = "socket"
+	FdTypePipe      FdType = "pipe"
+	FdTypeEventFd   FdType = "eventfd"
+	FdTypeAnonInode FdType = "anon_inode" // e.g epoll, timerfd, signalfd, inotify and pidfd.
+)
+
+type Fd struct {
+	Fd       int     `json:"fd"`
+	Type     FdType  `json:"type"`
+	Target   string  `json:"target"` // e.g "/var/log/app.log", "socket:[12345]" or "anon_inode:[eventpoll]".
+	Flags    string  `json:"flags,omitempty"`
+	Position int64   `json:"position"`
+	Socket   *Socket `json:"socket,omitempty"` // Unless the socket's protocol isn't resolved, e.g netlink.
+}
+
+// Types are told by the fd's link target alone, as stat(2)ing targets might block (e.g, on network filesystems).
+func classifyTarget(target string) FdType {
+	switch {
+	case strings.HasPrefix(target, "socket:["):
+		return FdTypeSocket
+	case strings.HasPrefix(target, "pipe:["):
+		return FdTypePipe
+	case target == "anon_inode:[eventfd]":
+		return FdTypeEventFd
+	case strings.HasPrefix(target, "anon_inode:"):
+		return FdTypeAnonInode
+	case strings.HasPrefix(target, "/dev/") && !strings.HasPrefix(target, "/dev/shm/"):
+		return FdTypeDevice
+	default:
+		return FdTypeFile
+	}
+}
@@ -0,0 +1,92 @@
+package fds
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Flags besides the access mode, in the order they're listed.
+var openFlags = []struct {
+	flag int
+	name string
+}{
+	{unix.O_CREAT, "O_CREAT"},
+	{unix.O_EXCL, "O_EXCL"},
+	{unix.O_NOCTTY, "O_NOCTTY"},
+	{unix.O_TRUNC, "O_TRUNC"},
+	{unix.O_APPEND, "O_APPEND"},
+	{unix.O_NONBLOCK, "O_NONBLOCK"},
+	{unix.O_DSYNC, "O_DSYNC"},
+	{unix.O_ASYNC, "O_ASYNC"},
+	{unix.O_DIRECT, "O_DIRECT"},
+	{unix.O_DIRECTORY, "O_DIRECTORY"},
+	{unix.O_NOFOLLOW, "O_NOFOLLOW"},
+	{unix.O_NOATIME, "O_NOATIME"},
+	{unix.O_CLOEXEC, "O_CLOEXEC"},
+	{unix.O_SYNC &^ unix.O_DSYNC, "O_SYNC"}, // O_SYNC includes O_DSYNC's bit.
+	{unix.O_PATH, "O_PATH"},
+	{unix.O_TMPFILE &^ unix.O_DIRECTORY, "O_TMPFILE"}, // O_TMPFILE includes O_DIRECTORY's bit.
+}
+
+// e.g "pos:	0\nflags:	02100002\nmnt_id:	25\n...", where flags are octal.
+func readFdInfo(pid types.Pid, fd int) (int64, int, error) {
+	path := fmt.Sprintf("/proc/%d/fdinfo/%d", pid, fd)
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	var (
+		position int64
+		flags    int64
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "pos:":
+			position, err = strconv.ParseInt(fields[1], 10, 64)
+		case "flags:":
+			flags, err = strconv.ParseInt(fields[1], 8, 64)
+		}
+		if err != nil {
+			return 0, 0, errors.WithMessagef(err, "parse '%s' line '%s'", path, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return position, int(flags), nil
+}
+
+// e.g "O_RDWR|O_APPEND|O_CLOEXEC".
+func formatFlags(flags int) string {
+	names := make([]string, 0)
+	switch flags & unix.O_ACCMODE {
+	case unix.O_RDONLY:
+		names = append(names, "O_RDONLY")
+	case unix.O_WRONLY:
+		names = append(names, "O_WRONLY")
+	case unix.O_RDWR:
+		names = append(names, "O_RDWR")
+	}
+
+	for _, openFlag := range openFlags {
+		if flags&openFlag.flag != 0 {
+			names = append(names, openFlag.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,55 @@
+package fds
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"github.com/memlab/agent/internal/sockets"
+	"github.com/memlab/agent/internal/types"
+	"net"
+	"strconv"
+)
+
+type Socket struct {
+	Protocol      sockets.Protocol `json:"protocol"`
+	Type          string           `json:"type,omitempty"` // Of unix sockets, e.g stream.
+	LocalAddress  string           `json:"local_address,omitempty"`
+	RemoteAddress string           `json:"remote_address,omitempty"`
+	State         string           `json:"state,omitempty"`
+}
+
+// Returns the sockets of the process' network namespace by inode, along with errors reading any of its protocols.
+func readSockets(pid types.Pid) (map[uint64]*Socket, error) {
+	socketsByInode := make(map[uint64]*Socket, 0)
+
+	var readErrors error
+	for _, protocol := range sockets.InetProtocols {
+		inetSockets, err := sockets.ReadInetSockets(pid, protocol)
+		if err != nil {
+			readErrors = multierror.Append(readErrors, err)
+			continue
+		}
+
+		for _, inetSocket := range inetSockets {
+			socketsByInode[inetSocket.Inode] = &Socket{
+				Protocol:      inetSocket.Protocol,
+				LocalAddress:  net.JoinHostPort(inetSocket.LocalAddress.String(), strconv.Itoa(inetSocket.LocalPort)),
+				RemoteAddress: net.JoinHostPort(inetSocket.RemoteAddress.String(), strconv.Itoa(inetSocket.RemotePort)),
+				State:         inetSocket.State,
+			}
+		}
+	}
+
+	unixSockets, err := sockets.ReadUnixSockets(pid)
+	if err != nil {
+		readErrors = multierror.Append(readErrors, err)
+	}
+	for _, unixSocket := range unixSockets {
+		socketsByInode[unixSocket.Inode] = &Socket{
+			Protocol:     sockets.ProtocolUnix,
+			Type:         unixSocket.Type,
+			LocalAddress: unixSocket.Path,
+			State:        unixSocket.State,
+		}
+	}
+
+	return socketsByInode, readErrors
+}
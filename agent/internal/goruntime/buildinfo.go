@@ -0,0 +1,37 @@
+package goruntime
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	runtimeDebug "runtime/debug"
+)
+
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// Returns the build info embedded in the process' executable, or false if it isn't a Go executable.
+func readBuildInfo(pid types.Pid) (*runtimeDebug.BuildInfo, bool) {
+	info, err := buildinfo.ReadFile(fmt.Sprintf("/proc/%d/exe", pid)) // Reachable across mount namespaces.
+	if err != nil {
+		return nil, false
+	}
+	return info, true
+}
+
+func newModule(module *runtimeDebug.Module) *Module {
+	if module == nil {
+		return nil
+	}
+
+	return &Module{
+		Path:    module.Path,
+		Version: module.Version,
+		Sum:     module.Sum,
+		Replace: newModule(module.Replace),
+	}
+}
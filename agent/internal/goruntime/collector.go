@@ -0,0 +1,139 @@
+package goruntime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+type Runtime struct {
+	GoVersion           string            `json:"go_version"`
+	Path                string            `json:"path"` // Of the main package.
+	MainModule          *Module           `json:"main_module"`
+	Modules             []*Module         `json:"modules"`
+	BuildSettings       map[string]string `json:"build_settings,omitempty"`
+	PprofUrl            string            `json:"pprof_url,omitempty"`
+	GoroutineCount      int               `json:"goroutine_count,omitempty"` // Unless the dump was truncated.
+	Goroutines          string            `json:"goroutines,omitempty"`
+	GoroutinesTruncated bool              `json:"goroutines_truncated,omitempty"`
+	HeapProfile         []byte            `json:"heap_profile,omitempty"` // Gzipped pprof protobufs.
+	CpuProfile          []byte            `json:"cpu_profile,omitempty"`
+	Errors              []string          `json:"errors,omitempty"`
+}
+
+// Collects the Go runtime of the process, or nil if it isn't a Go process. Its build info is read from its
+// executable, while its goroutines and profiles are collected from its net/http/pprof endpoint, if it serves one.
+// Failures to collect the latter are reported in the runtime.
+func Collect(ctx context.Context, pid types.Pid, config *Config) (*Runtime, error) {
+	buildInfo, isGo := readBuildInfo(pid)
+	if !isGo {
+		return nil, nil
+	}
+
+	goRuntime := &Runtime{
+		GoVersion:  buildInfo.GoVersion,
+		Path:       buildInfo.Path,
+		MainModule: newModule(&buildInfo.Main),
+		Modules:    make([]*Module, 0, len(buildInfo.Deps)),
+	}
+	for _, dependency := range buildInfo.Deps {
+		goRuntime.Modules = append(goRuntime.Modules, newModule(dependency))
+	}
+	if len(buildInfo.Settings) > 0 {
+		goRuntime.BuildSettings = make(map[string]string, len(buildInfo.Settings))
+		for _, setting := range buildInfo.Settings {
+			goRuntime.BuildSettings[setting.Key] = setting.Value
+		}
+	}
+
+	dial, err := newNamespacedDial(pid)
+	if err != nil {
+		goRuntime.Errors = append(goRuntime.Errors, err.Error())
+		return goRuntime, nil
+	}
+	transport := &http.Transport{DialContext: dial, DisableKeepAlives: true}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	goRuntime.PprofUrl, err = discoverPprofUrl(ctx, client, pid, config.PprofPort)
+	if err != nil {
+		goRuntime.Errors = append(goRuntime.Errors, errors.WithMessage(err, "discover pprof endpoint").Error())
+		return goRuntime, nil
+	} else if goRuntime.PprofUrl == "" {
+		goRuntime.Errors = append(goRuntime.Errors, "no pprof endpoint found")
+		return goRuntime, nil
+	}
+
+	if err := collectGoroutines(ctx, client, goRuntime, config); err != nil {
+		goRuntime.Errors = append(goRuntime.Errors, errors.WithMessage(err, "collect goroutines").Error())
+	}
+	if config.HeapProfile {
+		profile, err := collectProfile(ctx, client, goRuntime.PprofUrl+"heap", config.RequestTimeout, config)
+		if err != nil {
+			goRuntime.Errors = append(goRuntime.Errors, errors.WithMessage(err, "collect heap profile").Error())
+		}
+		goRuntime.HeapProfile = profile
+	}
+	if config.CpuProfileDuration > 0 {
+		profile, err := collectCpuProfile(ctx, client, goRuntime.PprofUrl, config)
+		if err != nil {
+			goRuntime.Errors = append(goRuntime.Errors, errors.WithMessage(err, "collect cpu profile").Error())
+		}
+		goRuntime.CpuProfile = profile
+	}
+
+	return goRuntime, nil
+}
+
+func collectGoroutines(ctx context.Context, client *http.Client, goRuntime *Runtime, config *Config) error {
+	requestCtx, cancel := context.WithTimeout(ctx, config.RequestTimeout)
+	defer cancel()
+
+	dump, truncated, err := fetch(requestCtx, client, goRuntime.PprofUrl+"goroutine?debug=2", config.MaxResponseSize)
+	if err != nil {
+		return err
+	}
+
+	goRuntime.Goroutines = string(dump)
+	goRuntime.GoroutinesTruncated = truncated
+	if !truncated {
+		goRuntime.GoroutineCount = bytes.Count(append([]byte("\n"), dump...), []byte("\ngoroutine "))
+	}
+	return nil
+}
+
+// Truncated profiles can't be decompressed, so they're left out.
+func collectProfile(ctx context.Context, client *http.Client, url string, timeout time.Duration, config *Config) ([]byte, error) {
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	profile, truncated, err := fetch(requestCtx, client, url, config.MaxResponseSize)
+	if err != nil {
+		return nil, err
+	} else if truncated {
+		return nil, errors.Errorf("profile exceeds the max response size of %d bytes", config.MaxResponseSize)
+	}
+	return profile, nil
+}
+
+// The profiling duration is shortened to fit the context's deadline, if it has one.
+func collectCpuProfile(ctx context.Context, client *http.Client, pprofUrl string, config *Config) ([]byte, error) {
+	duration := config.CpuProfileDuration
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		if remaining := time.Until(deadline) - config.RequestTimeout; remaining < duration {
+			duration = remaining
+		}
+	}
+
+	seconds := int(duration / time.Second)
+	if seconds < 1 {
+		return nil, errors.New("too little time left to profile")
+	}
+
+	url := fmt.Sprintf("%sprofile?seconds=%d", pprofUrl, seconds)
+	return collectProfile(ctx, client, url, time.Duration(seconds)*time.Second+config.RequestTimeout, config)
+}
@@ -0,0 +1,30 @@
+package goruntime
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	PprofPort          int           // Discovered among the process' listening sockets when 0.
+	HeapProfile        bool          //
+	CpuProfileDuration time.Duration // Disabled when 0, and bounded by the operator's deadline.
+	MaxResponseSize    int64         // Of each of the dump and profiles, beyond which they're truncated.
+	RequestTimeout     time.Duration // Of each request, besides the CPU profile's duration.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.PprofPort < 0 || c.PprofPort > 65535 {
+		return false, errors.Errorf("invalid pprof port '%d'", c.PprofPort)
+	} else if c.CpuProfileDuration < 0 {
+		return false, errors.New("negative cpu profile duration")
+	} else if c.CpuProfileDuration > 0 && c.CpuProfileDuration < time.Second {
+		return false, errors.New("cpu profile duration is below a second")
+	} else if c.MaxResponseSize <= 0 {
+		return false, errors.New("max response size must be positive")
+	} else if c.RequestTimeout <= 0 {
+		return false, errors.New("uninitialized request timeout")
+	}
+
+	return true, nil
+}
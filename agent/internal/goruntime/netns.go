@@ -0,0 +1,84 @@
+package goruntime
+
+import (
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"runtime"
+)
+
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// Returns a dial function connecting from the process' network namespace, so endpoints listening on its loopback
+// (e.g, in containers) are reachable.
+func newNamespacedDial(pid types.Pid) (dialFunc, error) {
+	dialer := &net.Dialer{}
+
+	processNamespace, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "read process' network namespace")
+	}
+	ownNamespace, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return nil, errors.WithMessage(err, "read own network namespace")
+	}
+	if processNamespace == ownNamespace {
+		return dialer.DialContext, nil
+	}
+
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		type dialResult struct {
+			conn net.Conn
+			err  error
+		}
+
+		// The namespace is entered by a dedicated thread, as it's a per-thread attribute.
+		results := make(chan dialResult, 1)
+		go func() {
+			runtime.LockOSThread()
+			conn, err := dialInNamespace(ctx, pid, dialer, network, address)
+			results <- dialResult{conn: conn, err: err}
+		}()
+
+		result := <-results
+		return result.conn, result.err
+	}, nil
+}
+
+// Must be called on a locked thread, which is unlocked unless it's left in the process' namespace, in which case
+// it's terminated along with its goroutine rather than reused.
+func dialInNamespace(ctx context.Context, pid types.Pid, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	ownNamespace, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, errors.WithMessage(err, "open own network namespace")
+	}
+	defer ownNamespace.Close()
+
+	processNamespace, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, errors.WithMessage(err, "open process' network namespace")
+	}
+	defer processNamespace.Close()
+
+	if err := unix.Setns(int(processNamespace.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return nil, errors.WithMessage(err, "enter process' network namespace")
+	}
+
+	conn, dialErr := dialer.DialContext(ctx, network, address)
+	if err := unix.Setns(int(ownNamespace.Fd()), unix.CLONE_NEWNET); err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, errors.WithMessage(err, "restore network namespace")
+	}
+
+	runtime.UnlockOSThread()
+	return conn, dialErr
+}
@@ -0,0 +1,112 @@
+package goruntime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/sockets"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	pprofIndexPath = "/debug/pprof/"
+	maxProbedPorts = 16 // Of the process' listening sockets, lowest first.
+	probeTimeout   = time.Second
+)
+
+// The index page lists the available profiles, among which the goroutine one is always present.
+var pprofIndexMarker = []byte("goroutine")
+
+// Returns the url of the process' pprof index, or an empty one if none of its listening sockets serve it.
+func discoverPprofUrl(ctx context.Context, client *http.Client, pid types.Pid, port int) (string, error) {
+	listening, err := sockets.ListeningTcpSockets(pid)
+	if err != nil {
+		return "", errors.WithMessage(err, "list listening sockets")
+	}
+	sort.SliceStable(listening, func(i, j int) bool {
+		return listening[i].LocalPort < listening[j].LocalPort
+	})
+
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, listeningSocket := range listening {
+		if port != 0 && listeningSocket.LocalPort != port {
+			continue
+		}
+		host := reachableHost(listeningSocket.LocalAddress, listeningSocket.LocalPort)
+		if !seen[host] {
+			seen[host] = true
+			candidates = append(candidates, host)
+		}
+	}
+	if port != 0 && len(candidates) == 0 { // E.g, the socket is owned by a child process.
+		candidates = append(candidates, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	}
+	if len(candidates) > maxProbedPorts {
+		candidates = candidates[:maxProbedPorts]
+	}
+
+	for _, candidate := range candidates {
+		url := fmt.Sprintf("http://%s%s", candidate, pprofIndexPath)
+		if probePprofIndex(ctx, client, url) {
+			return url, nil
+		}
+	}
+	return "", nil
+}
+
+// Wildcard addresses are reached through the loopback of the same family.
+func reachableHost(address net.IP, port int) string {
+	if address.IsUnspecified() {
+		if address.To4() != nil {
+			address = net.IPv4(127, 0, 0, 1)
+		} else {
+			address = net.IPv6loopback
+		}
+	}
+	return net.JoinHostPort(address.String(), strconv.Itoa(port))
+}
+
+func probePprofIndex(ctx context.Context, client *http.Client, url string) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	body, _, err := fetch(probeCtx, client, url, 1<<16)
+	return err == nil && bytes.Contains(body, pprofIndexMarker)
+}
+
+// Returns the response's body, truncated to the max size, and whether it was.
+func fetch(ctx context.Context, client *http.Client, url string, maxSize int64) ([]byte, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "create request to '%s'", url)
+	}
+
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "request '%s'", url)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(response.Body, 1<<16))
+		return nil, false, errors.Errorf("request '%s' failed with status '%s'", url, response.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "read response of '%s'", url)
+	}
+	if int64(len(body)) > maxSize {
+		return body[:maxSize], true, nil
+	}
+	return body, false, nil
+}
@@ -0,0 +1,60 @@
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Returns a process' cgroup path, preferring the unified (v2) hierarchy, and falling back to systemd's named v1
+// hierarchy, or to the first one listed.
+func ProcessCgroup(pid types.Pid) (string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", errors.WithMessagef(err, "read cgroups of pid '%d'", pid)
+	}
+	return parseCgroup(data), nil
+}
+
+func parseCgroup(data []byte) string {
+	var systemdPath, firstPath string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// Format is "hierarchy-id:controllers:path", see cgroups(7).
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			return fields[2]
+		case fields[1] == "name=systemd":
+			systemdPath = fields[2]
+		case firstPath == "":
+			firstPath = fields[2]
+		}
+	}
+
+	if systemdPath != "" {
+		return systemdPath
+	}
+	return firstPath
+}
+
+// Returns the systemd unit (service or scope) a cgroup path belongs to, if any.
+func SystemdUnitFromCgroup(cgroupPath string) string {
+	for dir := cgroupPath; dir != "/" && dir != "." && dir != ""; dir = path.Dir(dir) {
+		unit := path.Base(dir)
+		if strings.HasSuffix(unit, ".service") || strings.HasSuffix(unit, ".scope") {
+			return unit
+		}
+	}
+	return ""
+}
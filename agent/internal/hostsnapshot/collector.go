@@ -0,0 +1,83 @@
+package hostsnapshot
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// The host's state at the time of detection, telling whether the process was starved by others.
+type Snapshot struct {
+	Cpu             *CpuUsage            `json:"cpu"`
+	Memory          *MemoryUsage         `json:"memory"`
+	Pressure        map[string]*Pressure `json:"pressure,omitempty"` // By resource (cpu, memory and io).
+	Disks           []*DiskUsage         `json:"disks"`
+	TopCpuProcesses []*ProcessUsage      `json:"top_cpu_processes"`
+	TopRssProcesses []*ProcessUsage      `json:"top_rss_processes"`
+	Process         *ProcessUsage        `json:"process,omitempty"` // Of the detected process, unless it exited.
+}
+
+func Collect(ctx context.Context, pid types.Pid, config *Config) (*Snapshot, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate config")
+	}
+
+	memory, err := readMemoryUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pressure, err := readPressure()
+	if err != nil {
+		return nil, err
+	}
+
+	disks, err := readDiskUsages(pid)
+	if os.IsNotExist(errors.Cause(err)) { // Exited, e.g after a fatal signal was released.
+		disks, err = readDiskUsages(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Host and processes CPU usage are sampled over the same interval.
+	cpuTimesBefore, err := readCpuTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	processes, err := sampleProcesses(ctx, config.SampleInterval, memory.TotalBytes)
+	if err != nil {
+		return nil, err
+	}
+	cpuTimesAfter, err := readCpuTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu, err := cpuUsage(ctx, cpuTimesBefore, cpuTimesAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Cpu:      cpu,
+		Memory:   memory,
+		Pressure: pressure,
+		Disks:    disks,
+	}
+	for _, process := range processes {
+		if process.Pid == pid {
+			process.Detected = true
+			snapshot.Process = process
+		}
+	}
+	snapshot.TopCpuProcesses = topUsages(processes, config.TopProcesses, func(usage *ProcessUsage) float64 {
+		return usage.CpuPercent
+	})
+	snapshot.TopRssProcesses = topUsages(processes, config.TopProcesses, func(usage *ProcessUsage) float64 {
+		return float64(usage.RssBytes)
+	})
+
+	return snapshot, nil
+}
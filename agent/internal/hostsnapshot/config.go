@@ -0,0 +1,21 @@
+package hostsnapshot
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	TopProcesses   int           // Of each of the top CPU and memory consumers.
+	SampleInterval time.Duration // Over which CPU usage is measured.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.TopProcesses <= 0 {
+		return false, errors.New("top processes must be positive")
+	} else if c.SampleInterval <= 0 {
+		return false, errors.New("uninitialized sample interval")
+	}
+
+	return true, nil
+}
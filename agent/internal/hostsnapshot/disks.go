@@ -0,0 +1,169 @@
+package hostsnapshot
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"strings"
+)
+
+// Filesystems which aren't backed by storage, or whose usage isn't the host's concern (network filesystems, which
+// might also block when their server is unreachable).
+var ignoredFilesystemTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devpts": true, "mqueue": true, "debugfs": true, "tracefs": true,
+	"securityfs": true, "pstore": true, "bpf": true, "configfs": true, "fusectl": true, "hugetlbfs": true,
+	"autofs": true, "binfmt_misc": true, "nsfs": true, "rpc_pipefs": true, "cgroup": true, "cgroup2": true,
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "ceph": true, "glusterfs": true,
+}
+
+type DiskUsage struct {
+	MountPoint        string  `json:"mount_point"`
+	FilesystemType    string  `json:"filesystem_type"`
+	Source            string  `json:"source"`
+	TotalBytes        uint64  `json:"total_bytes"`
+	UsedBytes         uint64  `json:"used_bytes"`
+	FreeBytes         uint64  `json:"free_bytes"` // Available to unprivileged users.
+	UsedPercent       float64 `json:"used_percent"`
+	TotalInodes       uint64  `json:"total_inodes,omitempty"` // Not reported by some filesystems, e.g btrfs.
+	UsedInodes        uint64  `json:"used_inodes,omitempty"`
+	InodesUsedPercent float64 `json:"inodes_used_percent,omitempty"`
+}
+
+type mount struct {
+	mountPoint     string
+	filesystemType string
+	source         string
+}
+
+// Returns the usage of the filesystems mounted in the process' mount namespace, which are the ones it might have
+// run out of.
+func readDiskUsages(pid types.Pid) ([]*DiskUsage, error) {
+	mounts, err := readMounts(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]*DiskUsage, 0, len(mounts))
+	seenDevices := make(map[string]bool, len(mounts))
+	// Stacked mounts are statted through the topmost one, which is listed last, so only it is reported.
+	topmostMounts := make(map[string]int, len(mounts))
+	for i, m := range mounts {
+		topmostMounts[m.mountPoint] = i
+	}
+
+	for i, m := range mounts {
+		if ignoredFilesystemTypes[m.filesystemType] || topmostMounts[m.mountPoint] != i {
+			continue
+		}
+
+		// The same device is often mounted more than once (e.g, bind mounts into a container).
+		if strings.HasPrefix(m.source, "/") {
+			if seenDevices[m.source] {
+				continue
+			}
+			seenDevices[m.source] = true
+		}
+
+		usage, err := readDiskUsage(pid, m)
+		if err != nil {
+			continue // e.g, unmounted meanwhile.
+		}
+		usages = append(usages, usage)
+	}
+
+	return usages, nil
+}
+
+// e.g "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue", see proc(5).
+func readMounts(pid types.Pid) ([]*mount, error) {
+	path := fmt.Sprintf("/proc/%d/mountinfo", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	mounts := make([]*mount, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 5 || len(fields) < separator+3 {
+			return nil, errors.Errorf("invalid '%s' line '%s'", path, scanner.Text())
+		}
+
+		mounts = append(mounts, &mount{
+			mountPoint:     unescapeMountField(fields[4]),
+			filesystemType: fields[separator+1],
+			source:         unescapeMountField(fields[separator+2]),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return mounts, nil
+}
+
+// Spaces, tabs, newlines and backslashes are octal escaped, e.g "\040".
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) && isOctal(field[i+1]) && isOctal(field[i+2]) &&
+			isOctal(field[i+3]) {
+			unescaped.WriteByte((field[i+1]-'0')<<6 | (field[i+2]-'0')<<3 | (field[i+3] - '0'))
+			i += 3
+			continue
+		}
+		unescaped.WriteByte(field[i])
+	}
+	return unescaped.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+// Stats the mount point through the process' root, so it's resolved in its mount namespace.
+func readDiskUsage(pid types.Pid, m *mount) (*DiskUsage, error) {
+	path := fmt.Sprintf("/proc/%d/root%s", pid, m.mountPoint)
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return nil, errors.WithMessagef(err, "statfs '%s'", path)
+	}
+
+	blockSize := uint64(stat.Bsize)
+	usage := &DiskUsage{
+		MountPoint:     m.mountPoint,
+		FilesystemType: m.filesystemType,
+		Source:         m.source,
+		TotalBytes:     stat.Blocks * blockSize,
+		UsedBytes:      (stat.Blocks - stat.Bfree) * blockSize,
+		FreeBytes:      stat.Bavail * blockSize,
+	}
+	// Like df(1), relative to the space available to unprivileged users.
+	if usable := usage.UsedBytes + usage.FreeBytes; usable > 0 {
+		usage.UsedPercent = float64(usage.UsedBytes) * 100 / float64(usable)
+	}
+	if stat.Files > 0 {
+		usage.TotalInodes = stat.Files
+		usage.UsedInodes = stat.Files - stat.Ffree
+		usage.InodesUsedPercent = float64(usage.UsedInodes) * 100 / float64(stat.Files)
+	}
+
+	return usage, nil
+}
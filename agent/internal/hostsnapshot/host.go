@@ -0,0 +1,92 @@
+package hostsnapshot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+)
+
+type CpuUsage struct {
+	Count         int     `json:"count"`
+	UsedPercent   float64 `json:"used_percent"`
+	IowaitPercent float64 `json:"iowait_percent"`
+	StealPercent  float64 `json:"steal_percent"` // Taken by the hypervisor for other guests.
+	Load1         float64 `json:"load1"`
+	Load5         float64 `json:"load5"`
+	Load15        float64 `json:"load15"`
+}
+
+type MemoryUsage struct {
+	TotalBytes      uint64  `json:"total_bytes"`
+	AvailableBytes  uint64  `json:"available_bytes"`
+	UsedBytes       uint64  `json:"used_bytes"`
+	UsedPercent     float64 `json:"used_percent"`
+	SwapTotalBytes  uint64  `json:"swap_total_bytes"`
+	SwapUsedBytes   uint64  `json:"swap_used_bytes"`
+	SwapUsedPercent float64 `json:"swap_used_percent"`
+}
+
+func readCpuTimes(ctx context.Context) (*cpu.TimesStat, error) {
+	times, err := cpu.TimesWithContext(ctx, false)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get cpu times")
+	} else if len(times) == 0 {
+		return nil, errors.New("no cpu times")
+	}
+
+	return &times[0], nil
+}
+
+// Returns the host's CPU usage between the given times of all CPUs.
+func cpuUsage(ctx context.Context, before *cpu.TimesStat, after *cpu.TimesStat) (*CpuUsage, error) {
+	count, err := cpu.CountsWithContext(ctx, true)
+	if err != nil {
+		return nil, errors.WithMessage(err, "count cpus")
+	}
+
+	loadAverage, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get load average")
+	}
+
+	usage := &CpuUsage{
+		Count:  count,
+		Load1:  loadAverage.Load1,
+		Load5:  loadAverage.Load5,
+		Load15: loadAverage.Load15,
+	}
+
+	total := after.Total() - before.Total()
+	if total > 0 {
+		idle := (after.Idle + after.Iowait) - (before.Idle + before.Iowait)
+		usage.UsedPercent = (total - idle) / total * 100
+		usage.IowaitPercent = (after.Iowait - before.Iowait) / total * 100
+		usage.StealPercent = (after.Steal - before.Steal) / total * 100
+	}
+
+	return usage, nil
+}
+
+func readMemoryUsage(ctx context.Context) (*MemoryUsage, error) {
+	virtualMemory, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get virtual memory")
+	}
+
+	swapMemory, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get swap memory")
+	}
+
+	return &MemoryUsage{
+		TotalBytes:      virtualMemory.Total,
+		AvailableBytes:  virtualMemory.Available,
+		UsedBytes:       virtualMemory.Used,
+		UsedPercent:     virtualMemory.UsedPercent,
+		SwapTotalBytes:  swapMemory.Total,
+		SwapUsedBytes:   swapMemory.Used,
+		SwapUsedPercent: swapMemory.UsedPercent,
+	}, nil
+}
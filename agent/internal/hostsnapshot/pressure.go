@@ -0,0 +1,112 @@
+package hostsnapshot
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const pressureDir = "/proc/pressure"
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// Pressure stall information (see Documentation/accounting/psi.rst), of some or all non-idle tasks stalling.
+type Pressure struct {
+	Some *PressureStall `json:"some"`
+	Full *PressureStall `json:"full,omitempty"` // Not reported for cpu by kernels preceding 5.13.
+}
+
+// Percents of time stalled over the last 10, 60 and 300 seconds.
+type PressureStall struct {
+	Avg10        float64 `json:"avg10"`
+	Avg60        float64 `json:"avg60"`
+	Avg300       float64 `json:"avg300"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+// Returns the host's pressure by resource, or nil if the kernel doesn't expose it (e.g, preceding 4.20, or when
+// booted without psi).
+func readPressure() (map[string]*Pressure, error) {
+	pressures := make(map[string]*Pressure, len(pressureResources))
+	for _, resource := range pressureResources {
+		pressure, err := readResourcePressure(filepath.Join(pressureDir, resource))
+		if err != nil {
+			if pressureUnsupported(err) {
+				continue
+			}
+			return nil, err
+		}
+		pressures[resource] = pressure
+	}
+
+	if len(pressures) == 0 {
+		return nil, nil
+	}
+	return pressures, nil
+}
+
+// Pressure files are missing on older kernels, and can't be read when psi is disabled.
+func pressureUnsupported(err error) bool {
+	cause := errors.Cause(err)
+	if pathErr, isPathErr := cause.(*os.PathError); isPathErr {
+		cause = pathErr.Err
+	}
+	return os.IsNotExist(cause) || cause == unix.EOPNOTSUPP
+}
+
+// e.g "some avg10=0.00 avg60=0.00 avg300=0.00 total=12345", where totals are in microseconds.
+func readResourcePressure(path string) (*Pressure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	pressure := &Pressure{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 {
+			return nil, errors.Errorf("invalid '%s' line '%s'", path, scanner.Text())
+		}
+
+		stall := &PressureStall{}
+		for _, field := range fields[1:] {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("invalid '%s' field '%s'", path, field)
+			}
+
+			value, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "parse '%s' field '%s'", path, field)
+			}
+			switch parts[0] {
+			case "avg10":
+				stall.Avg10 = value
+			case "avg60":
+				stall.Avg60 = value
+			case "avg300":
+				stall.Avg300 = value
+			case "total":
+				stall.TotalSeconds = value / 1e6
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			pressure.Some = stall
+		case "full":
+			pressure.Full = stall
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return pressure, nil
+}
@@ -0,0 +1,132 @@
+package hostsnapshot
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/procenv"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ProcessUsage struct {
+	Pid           types.Pid `json:"pid"`
+	Name          string    `json:"name"`
+	CpuPercent    float64   `json:"cpu_percent"` // Of a single CPU, like top(1).
+	RssBytes      uint64    `json:"rss_bytes"`
+	MemoryPercent float64   `json:"memory_percent"`
+	Detected      bool      `json:"detected,omitempty"` // Whether it's the process the detection fired for.
+}
+
+type processSample struct {
+	name     string
+	cpuTicks uint64
+	rssPages uint64
+}
+
+// Samples the CPU time of all processes over the interval, and returns their usage.
+func sampleProcesses(ctx context.Context, interval time.Duration, totalMemory uint64) ([]*ProcessUsage, error) {
+	before, err := readProcessSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(interval):
+	}
+
+	after, err := readProcessSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	usages := make([]*ProcessUsage, 0, len(after))
+	for pid, sample := range after {
+		usage := &ProcessUsage{
+			Pid:      pid,
+			Name:     sample.name,
+			RssBytes: sample.rssPages * pageSize,
+		}
+		// Processes which started meanwhile aren't attributed the CPU time they used before.
+		if previous, exists := before[pid]; exists && sample.cpuTicks >= previous.cpuTicks {
+			usage.CpuPercent = float64(sample.cpuTicks-previous.cpuTicks) / procenv.UserHz / interval.Seconds() * 100
+		}
+		if totalMemory > 0 {
+			usage.MemoryPercent = float64(usage.RssBytes) * 100 / float64(totalMemory)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// Returns the top usages by the given measure, ordered by pid on ties.
+func topUsages(usages []*ProcessUsage, count int, measure func(*ProcessUsage) float64) []*ProcessUsage {
+	sorted := make([]*ProcessUsage, len(usages))
+	copy(sorted, usages)
+	sort.Slice(sorted, func(i, j int) bool {
+		if measure(sorted[i]) != measure(sorted[j]) {
+			return measure(sorted[i]) > measure(sorted[j])
+		}
+		return sorted[i].Pid < sorted[j].Pid
+	})
+
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+	return sorted
+}
+
+func readProcessSamples() (map[types.Pid]*processSample, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, errors.WithMessage(err, "list processes")
+	}
+
+	samples := make(map[types.Pid]*processSample, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if sample, err := readProcessSample(types.Pid(pid)); err == nil { // Exited meanwhile otherwise.
+			samples[types.Pid(pid)] = sample
+		}
+	}
+	return samples, nil
+}
+
+func readProcessSample(pid types.Pid) (*processSample, error) {
+	stat, err := procenv.ReadStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	userTicks, err := stat.Field(14)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse user time")
+	}
+	systemTicks, err := stat.Field(15)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse system time")
+	}
+	rssPages, err := stat.SignedField(24)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse rss")
+	}
+	if rssPages < 0 {
+		rssPages = 0
+	}
+
+	return &processSample{
+		name:     stat.Name,
+		cpuTicks: userTicks + systemTicks,
+		rssPages: uint64(rssPages),
+	}, nil
+}
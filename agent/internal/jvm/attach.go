@@ -0,0 +1,198 @@
+package jvm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/memlab/agent/internal/containers"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	jvmTempDir                = "/tmp" // Hard-coded by HotSpot on Linux, regardless of java.io.tmpdir.
+	jvmLibrarySuffix          = "/libjvm.so"
+	attachPollInitialInterval = 20 * time.Millisecond
+	attachPollMaxInterval     = 500 * time.Millisecond
+)
+
+var ErrAttachTimeout = errors.New("timed out waiting for the attach listener")
+
+// A JVM as seen from the host, whose paths are resolved within its mount namespace and pid namespace.
+type target struct {
+	pid           types.Pid
+	namespacedPid types.Pid
+	uid           int // Effective ids, which the JVM expects its attach files and clients to have.
+	gid           int
+}
+
+func newTarget(pid types.Pid) (*target, error) {
+	namespacedPid, err := containers.NamespacedPid(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid, err := readEffectiveIds(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &target{
+		pid:           pid,
+		namespacedPid: namespacedPid,
+		uid:           uid,
+		gid:           gid,
+	}, nil
+}
+
+// Resolves a path of the process' mount namespace.
+func (t *target) hostPath(path string) string {
+	return fmt.Sprintf("/proc/%d/root%s", t.pid, path)
+}
+
+func (t *target) socketPath() string {
+	return t.hostPath(filepath.Join(jvmTempDir, fmt.Sprintf(".java_pid%d", t.namespacedPid)))
+}
+
+// The JVM looks for the attach file in its working directory first, then in its temp dir.
+func (t *target) attachFilePaths() []string {
+	name := fmt.Sprintf(".attach_pid%d", t.namespacedPid)
+	return []string{
+		filepath.Join(fmt.Sprintf("/proc/%d/cwd", t.pid), name),
+		t.hostPath(filepath.Join(jvmTempDir, name)),
+	}
+}
+
+// Whether the attach listener's socket exists and is owned by the JVM (or root), as anyone may create it otherwise.
+func (t *target) listenerStarted() bool {
+	info, err := os.Stat(t.socketPath())
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && (int(stat.Uid) == t.uid || stat.Uid == 0)
+}
+
+// e.g "Uid:	1000	1000	1000	1000", listing the real, effective, saved and filesystem ids.
+func readEffectiveIds(pid types.Pid) (int, int, error) {
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	ids := make(map[string]int, 2)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || (fields[0] != "Uid:" && fields[0] != "Gid:") {
+			continue
+		}
+
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, 0, errors.WithMessagef(err, "parse '%s' of '%s'", fields[0], path)
+		}
+		ids[fields[0]] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	uid, hasUid := ids["Uid:"]
+	gid, hasGid := ids["Gid:"]
+	if !hasUid || !hasGid {
+		return 0, 0, errors.Errorf("missing ids in '%s'", path)
+	}
+	return uid, gid, nil
+}
+
+// Only HotSpot JVMs are sent SIGQUIT, as it terminates most other processes.
+func isHotSpot(pid types.Pid) (bool, error) {
+	path := fmt.Sprintf("/proc/%d/maps", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return false, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.HasSuffix(scanner.Text(), jvmLibrarySuffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, errors.WithMessagef(err, "read '%s'", path)
+	}
+	return false, nil
+}
+
+// Starts the JVM's attach listener, unless it's already started, by creating an attach file and sending it SIGQUIT,
+// upon which the JVM starts listening rather than printing a thread dump.
+func startAttachListener(ctx context.Context, handle *prochandle.Handle, t *target, timeout time.Duration) error {
+	if t.listenerStarted() {
+		return nil
+	}
+
+	attachFile, err := createAttachFile(t)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(attachFile)
+
+	if err := handle.SendSignal(unix.SIGQUIT); err != nil {
+		return errors.WithMessage(err, "trigger attach listener")
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	interval := attachPollInitialInterval
+	for !t.listenerStarted() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrAttachTimeout
+		case <-time.After(interval):
+		}
+
+		if interval *= 2; interval > attachPollMaxInterval {
+			interval = attachPollMaxInterval
+		}
+	}
+	return nil
+}
+
+// Returns the path of the created attach file, owned by the JVM's effective ids.
+func createAttachFile(t *target) (string, error) {
+	var createErrors error
+	for _, path := range t.attachFilePaths() {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0660)
+		if err != nil {
+			createErrors = multierror.Append(createErrors, err)
+			continue
+		}
+		file.Close()
+
+		if err := os.Lchown(path, t.uid, t.gid); err != nil {
+			os.Remove(path)
+			createErrors = multierror.Append(createErrors, errors.WithMessagef(err, "chown '%s'", path))
+			continue
+		}
+		return path, nil
+	}
+	return "", errors.WithMessage(createErrors, "create attach file")
+}
@@ -0,0 +1,118 @@
+package jvm
+
+import (
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const heapDumpCreatedOutput = "Heap dump file created"
+
+type Diagnostics struct {
+	NamespacedPid           types.Pid `json:"jvm_namespaced_pid"` // As known to the JVM, e.g in its attach files.
+	ThreadDump              string    `json:"thread_dump,omitempty"`
+	ThreadDumpTruncated     bool      `json:"thread_dump_truncated,omitempty"`
+	ClassHistogram          string    `json:"class_histogram,omitempty"`
+	ClassHistogramTruncated bool      `json:"class_histogram_truncated,omitempty"`
+	HeapDump                *HeapDump `json:"heap_dump,omitempty"`
+	Errors                  []string  `json:"errors,omitempty"`
+}
+
+type HeapDump struct {
+	Path     string `json:"path"`      // In the process' mount namespace.
+	HostPath string `json:"host_path"` // Valid while the process is alive.
+	Size     int64  `json:"size"`
+}
+
+// Collects diagnostics of the JVM via HotSpot's attach mechanism, or nil if the process isn't a JVM. Failures to run
+// commands are reported in the diagnostics.
+func Collect(ctx context.Context, handle *prochandle.Handle, config *Config) (*Diagnostics, error) {
+	t, err := newTarget(handle.Pid())
+	if err != nil {
+		return nil, err
+	}
+
+	// A listener may have been started by a previous attach, even if the JVM isn't HotSpot (e.g, OpenJ9 emulates it).
+	if !t.listenerStarted() {
+		if isJvm, err := isHotSpot(handle.Pid()); err != nil {
+			return nil, err
+		} else if !isJvm {
+			return nil, nil
+		}
+	}
+
+	diagnostics := &Diagnostics{NamespacedPid: t.namespacedPid}
+	if err := startAttachListener(ctx, handle, t, config.AttachTimeout); err != nil {
+		diagnostics.Errors = append(diagnostics.Errors, errors.WithMessage(err, "start attach listener").Error())
+		return diagnostics, nil
+	}
+
+	// The thread dump lists locked ownable synchronizers too, like jstack -l.
+	diagnostics.ThreadDump, diagnostics.ThreadDumpTruncated, err = execute(ctx, t, config, commandThreadDump, "-l")
+	if err != nil {
+		diagnostics.Errors = append(diagnostics.Errors, errors.WithMessage(err, "collect thread dump").Error())
+	}
+
+	if config.ClassHistogram {
+		// All objects are counted, rather than forcing a full GC to count the live ones only.
+		diagnostics.ClassHistogram, diagnostics.ClassHistogramTruncated, err = execute(ctx, t, config,
+			commandInspectHeap, "-all")
+		if err != nil {
+			diagnostics.Errors = append(diagnostics.Errors, errors.WithMessage(err, "collect class histogram").Error())
+		}
+	}
+
+	if config.HeapDump {
+		diagnostics.HeapDump, err = dumpHeap(ctx, t, config)
+		if err != nil {
+			diagnostics.Errors = append(diagnostics.Errors, errors.WithMessage(err, "dump heap").Error())
+		}
+	}
+
+	return diagnostics, nil
+}
+
+// The JVM closes the connection after each command.
+func execute(ctx context.Context, t *target, config *Config, command string, args ...string) (string, bool, error) {
+	commandCtx, cancel := context.WithTimeout(ctx, config.CommandTimeout)
+	defer cancel()
+
+	conn, err := dialAttachListener(commandCtx, t)
+	if err != nil {
+		return "", false, errors.WithMessage(err, "connect to attach listener")
+	}
+	defer conn.Close()
+
+	return executeCommand(commandCtx, conn, config.MaxResponseSize, command, args...)
+}
+
+// The heap is dumped by the JVM into the heap dumps dir of its mount namespace, and left there.
+func dumpHeap(ctx context.Context, t *target, config *Config) (*HeapDump, error) {
+	path := filepath.Join(config.HeapDumpDir, fmt.Sprintf("memlab-heap-%d-%d.hprof", t.namespacedPid,
+		time.Now().UnixNano()))
+
+	// Failed dumps are reported in the output, rather than by the status.
+	output, _, err := execute(ctx, t, config, commandDumpHeap, path, "-all")
+	if err != nil {
+		return nil, err
+	} else if !strings.HasPrefix(output, heapDumpCreatedOutput) {
+		return nil, errors.Errorf("heap dump failed: %s", strings.TrimSpace(output))
+	}
+
+	heapDump := &HeapDump{
+		Path:     path,
+		HostPath: t.hostPath(path),
+	}
+	info, err := os.Stat(heapDump.HostPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "stat heap dump")
+	}
+	heapDump.Size = info.Size()
+	return heapDump, nil
+}
@@ -0,0 +1,93 @@
+package jvm
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/types"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Collects the diagnostics of the test process, whose attach listener is the fake one, so it's attached to without
+// being signaled.
+func collectFromFakeJvm(t *testing.T, config *Config) *Diagnostics {
+	listener := newFakeAttachListener(zap.NewNop())
+	if err := listener.Start(); err != nil {
+		t.Fatalf("start fake attach listener: %v", err)
+	}
+	defer func() {
+		listener.Stop()
+		listener.WaitUntilCompletion()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	diagnostics, err := Collect(ctx, prochandle.Detached(types.Pid(os.Getpid()), 0), config)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	} else if diagnostics == nil {
+		t.Fatal("collect: no diagnostics, as if the process isn't a JVM")
+	}
+	return diagnostics
+}
+
+func TestCollect(t *testing.T) {
+	config := &Config{
+		ClassHistogram:  true,
+		HeapDump:        true,
+		HeapDumpDir:     t.TempDir(),
+		AttachTimeout:   time.Second,
+		CommandTimeout:  time.Second,
+		MaxResponseSize: 1 << 20,
+	}
+
+	diagnostics := collectFromFakeJvm(t, config)
+
+	if len(diagnostics.Errors) != 0 {
+		t.Errorf("errors = %v, expected none", diagnostics.Errors)
+	}
+	if diagnostics.NamespacedPid != types.Pid(os.Getpid()) {
+		t.Errorf("namespaced pid = %d, expected %d", diagnostics.NamespacedPid, os.Getpid())
+	}
+	if !strings.Contains(diagnostics.ThreadDump, "Full thread dump") || diagnostics.ThreadDumpTruncated {
+		t.Errorf("thread dump = '%s' (truncated: %t), expected a whole thread dump", diagnostics.ThreadDump,
+			diagnostics.ThreadDumpTruncated)
+	}
+	if diagnostics.ClassHistogram != fakeClassHistogram || diagnostics.ClassHistogramTruncated {
+		t.Errorf("class histogram = '%s' (truncated: %t), expected '%s'", diagnostics.ClassHistogram,
+			diagnostics.ClassHistogramTruncated, fakeClassHistogram)
+	}
+
+	if heapDump := diagnostics.HeapDump; heapDump == nil {
+		t.Error("no heap dump")
+	} else if filepath.Dir(heapDump.Path) != config.HeapDumpDir || heapDump.Size != int64(len(fakeHeapDumpHeader)) {
+		t.Errorf("heap dump = %+v, expected a %d bytes dump in '%s'", heapDump, len(fakeHeapDumpHeader),
+			config.HeapDumpDir)
+	}
+}
+
+func TestCollectTruncatesResponses(t *testing.T) {
+	config := &Config{
+		AttachTimeout:   time.Second,
+		CommandTimeout:  time.Second,
+		MaxResponseSize: 64,
+	}
+
+	diagnostics := collectFromFakeJvm(t, config)
+
+	if len(diagnostics.Errors) != 0 {
+		t.Errorf("errors = %v, expected none", diagnostics.Errors)
+	}
+	if len(diagnostics.ThreadDump) > 64 || !diagnostics.ThreadDumpTruncated {
+		t.Errorf("thread dump of %d bytes (truncated: %t), expected at most 64 truncated ones",
+			len(diagnostics.ThreadDump), diagnostics.ThreadDumpTruncated)
+	}
+	if diagnostics.ClassHistogram != "" || diagnostics.HeapDump != nil {
+		t.Error("class histogram or heap dump collected, even though they're disabled")
+	}
+}
@@ -0,0 +1,30 @@
+package jvm
+
+import (
+	"github.com/pkg/errors"
+	"path/filepath"
+	"time"
+)
+
+type Config struct {
+	ClassHistogram  bool          //
+	HeapDump        bool          //
+	HeapDumpDir     string        // In the process' mount namespace, where the JVM writes heap dumps.
+	AttachTimeout   time.Duration // Max time to wait for the JVM to start its attach listener.
+	CommandTimeout  time.Duration // Of each command, e.g a heap dump might take a while.
+	MaxResponseSize int64         // Of each command's output, beyond which it's truncated.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.HeapDump && !filepath.IsAbs(c.HeapDumpDir) {
+		return false, errors.Errorf("heap dump dir '%s' isn't absolute", c.HeapDumpDir)
+	} else if c.AttachTimeout <= 0 {
+		return false, errors.New("uninitialized attach timeout")
+	} else if c.CommandTimeout <= 0 {
+		return false, errors.New("uninitialized command timeout")
+	} else if c.MaxResponseSize <= 0 {
+		return false, errors.New("max response size must be positive")
+	}
+
+	return true, nil
+}
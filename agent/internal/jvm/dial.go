@@ -0,0 +1,66 @@
+package jvm
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"runtime"
+)
+
+const unchangedId = ^uintptr(0) // -1, leaving an id unchanged by setres{u,g}id(2).
+
+// Connects to the JVM's attach listener. Older JVMs only accept clients with their own effective ids (rather than
+// root's too), so the connection is made with them when running as root.
+func dialAttachListener(ctx context.Context, t *target) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if os.Geteuid() != 0 || (t.uid == 0 && t.gid == 0) {
+		return dialer.DialContext(ctx, "unix", t.socketPath())
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	// Ids are switched by a dedicated thread, as raw setres{u,g}id(2) only affect the calling thread.
+	results := make(chan dialResult, 1)
+	go func() {
+		runtime.LockOSThread()
+		conn, err := dialWithIds(ctx, dialer, t.socketPath(), t.uid, t.gid)
+		results <- dialResult{conn: conn, err: err}
+	}()
+
+	result := <-results
+	return result.conn, result.err
+}
+
+// Must be called on a locked thread, which is unlocked unless it's left with the JVM's ids, in which case it's
+// terminated along with its goroutine rather than reused.
+func dialWithIds(ctx context.Context, dialer *net.Dialer, path string, uid int, gid int) (net.Conn, error) {
+	ownUid, ownGid := uintptr(os.Geteuid()), uintptr(os.Getegid())
+
+	if _, _, errno := unix.RawSyscall(unix.SYS_SETRESGID, unchangedId, uintptr(gid), unchangedId); errno != 0 {
+		runtime.UnlockOSThread()
+		return nil, errors.WithMessage(errno, "set effective gid")
+	}
+	if _, _, errno := unix.RawSyscall(unix.SYS_SETRESUID, unchangedId, uintptr(uid), unchangedId); errno != 0 {
+		if _, _, errno := unix.RawSyscall(unix.SYS_SETRESGID, unchangedId, ownGid, unchangedId); errno == 0 {
+			runtime.UnlockOSThread()
+		}
+		return nil, errors.WithMessage(errno, "set effective uid")
+	}
+
+	conn, dialErr := dialer.DialContext(ctx, "unix", path)
+
+	// The uid is restored first, as restoring the gid requires root's capabilities.
+	_, _, uidErrno := unix.RawSyscall(unix.SYS_SETRESUID, unchangedId, ownUid, unchangedId)
+	if uidErrno == 0 {
+		if _, _, gidErrno := unix.RawSyscall(unix.SYS_SETRESGID, unchangedId, ownGid, unchangedId); gidErrno == 0 {
+			runtime.UnlockOSThread()
+		}
+	}
+
+	return conn, dialErr
+}
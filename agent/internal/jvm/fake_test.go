@@ -0,0 +1,167 @@
+package jvm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Header of HPROF heap dumps, followed by the identifiers' size and the dump's timestamp.
+const fakeHeapDumpHeader = "JAVA PROFILE 1.0.2\x00"
+
+const fakeClassHistogram = ` num     #instances         #bytes  class name (module)
+-------------------------------------------------------
+   1:          4096        1048576  [B (java.base@17)
+   2:          2048          49152  java.lang.String (java.base@17)
+   3:           512          16384  java.util.HashMap$Node (java.base@17)
+Total          6656        1114112
+`
+
+// Serves HotSpot's attach protocol for the test process, replying to commands with canned output, so that attaching
+// (past the listener's startup) is exercised without a JVM. Heap dumps are written as headers of HPROF files.
+type fakeAttachListener struct {
+	logger     *zap.Logger
+	socketPath string
+	listener   net.Listener
+	waitGroup  sync.WaitGroup
+}
+
+func newFakeAttachListener(rootLogger *zap.Logger) *fakeAttachListener {
+	return &fakeAttachListener{
+		logger:     rootLogger.Named("fake-attach-listener"),
+		socketPath: filepath.Join(jvmTempDir, fmt.Sprintf(".java_pid%d", os.Getpid())),
+	}
+}
+
+func (f *fakeAttachListener) Start() error {
+	if err := os.Remove(f.socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.WithMessage(err, "remove stale socket")
+	}
+
+	listener, err := net.Listen("unix", f.socketPath)
+	if err != nil {
+		return errors.WithMessage(err, "listen")
+	}
+	if err := os.Chmod(f.socketPath, 0600); err != nil { // As the JVM does.
+		listener.Close()
+		return errors.WithMessage(err, "chmod socket")
+	}
+	f.listener = listener
+
+	f.waitGroup.Add(1)
+	go func() {
+		defer f.waitGroup.Done()
+		f.serve()
+	}()
+	return nil
+}
+
+func (f *fakeAttachListener) Stop() {
+	if f.listener != nil {
+		f.listener.Close()
+	}
+	os.Remove(f.socketPath)
+}
+
+func (f *fakeAttachListener) WaitUntilCompletion() {
+	f.waitGroup.Wait()
+}
+
+func (f *fakeAttachListener) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			f.logger.Debug("Stop serving", zap.Error(err))
+			return
+		}
+
+		f.waitGroup.Add(1)
+		go func() {
+			defer f.waitGroup.Done()
+			defer conn.Close()
+
+			if err := f.handle(conn); err != nil {
+				f.logger.Warn("Failed handling connection", zap.Error(err))
+			}
+		}()
+	}
+}
+
+func (f *fakeAttachListener) handle(conn net.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(time.Minute)); err != nil {
+		return errors.WithMessage(err, "set deadline")
+	}
+
+	reader := bufio.NewReader(conn)
+	fields := make([]string, 0, 2+commandArgs)
+	for len(fields) < cap(fields) {
+		field, err := reader.ReadString(0)
+		if err != nil {
+			return errors.WithMessage(err, "read request")
+		}
+		fields = append(fields, field[:len(field)-1])
+	}
+	version, command, args := fields[0], fields[1], fields[2:]
+	f.logger.Info("Command received", zap.String("Command", command), zap.Strings("Args", args))
+
+	var status int
+	var output string
+	if version != protocolVersion {
+		status, output = 1, fmt.Sprintf("Invalid protocol version '%s'\n", version)
+	} else {
+		status, output = f.execute(command, args)
+	}
+
+	_, err := fmt.Fprintf(conn, "%d\n%s", status, output)
+	return errors.WithMessage(err, "write response")
+}
+
+// Mirrors the JVM's statuses and messages.
+func (f *fakeAttachListener) execute(command string, args []string) (int, string) {
+	switch command {
+	case commandThreadDump:
+		return statusOk, f.threadDump()
+	case commandInspectHeap:
+		if args[0] != "" && args[0] != "-live" && args[0] != "-all" {
+			return 1, fmt.Sprintf("Invalid argument to inspectheap operation: %s\n", args[0])
+		}
+		return statusOk, fakeClassHistogram
+	case commandDumpHeap:
+		if args[0] == "" {
+			return 1, "No dump file specified\n"
+		} else if err := ioutil.WriteFile(args[0], []byte(fakeHeapDumpHeader), 0600); err != nil {
+			return statusOk, fmt.Sprintf("Dump failed: %v\n", err) // The JVM reports failed dumps successfully.
+		}
+		return statusOk, heapDumpCreatedOutput + "\n"
+	default:
+		return 1, fmt.Sprintf("Operation %s not recognized!\n", command)
+	}
+}
+
+func (f *fakeAttachListener) threadDump() string {
+	return fmt.Sprintf(`%s
+Full thread dump Fake HotSpot VM (attach listener of pid %d):
+
+"main" #1 prio=5 os_prio=0 cpu=10.00ms elapsed=1.00s tid=0x0000000000000001 nid=0x%x waiting on condition
+   java.lang.Thread.State: TIMED_WAITING (sleeping)
+	at java.lang.Thread.sleep(java.base@17/Native Method)
+	at Main.main(Main.java:5)
+
+   Locked ownable synchronizers:
+	- None
+
+"Attach Listener" #2 daemon prio=9 os_prio=0 cpu=1.00ms elapsed=1.00s tid=0x0000000000000002 nid=0x%x waiting on condition
+   java.lang.Thread.State: RUNNABLE
+
+   Locked ownable synchronizers:
+	- None
+
+`, time.Now().Format("2006-01-02 15:04:05"), os.Getpid(), os.Getpid(), os.Getpid()+1)
+}
@@ -0,0 +1,106 @@
+package jvm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HotSpot's attach protocol: the client sends the protocol version, the command and exactly three arguments, each
+// null terminated. The JVM replies with the command's status code on the first line, followed by its output (or error
+// message), and closes the connection.
+const (
+	protocolVersion     = "1"
+	commandArgs         = 3
+	statusOk            = 0
+	statusLineMaxLength = 16
+)
+
+const (
+	commandThreadDump  = "threaddump"
+	commandInspectHeap = "inspectheap" // Class histogram.
+	commandDumpHeap    = "dumpheap"
+)
+
+var ErrCommandFailed = errors.New("attach command failed")
+
+func encodeRequest(command string, args ...string) ([]byte, error) {
+	if len(args) > commandArgs {
+		return nil, errors.Errorf("too many arguments for command '%s'", command)
+	}
+
+	var request bytes.Buffer
+	for _, part := range []string{protocolVersion, command} {
+		request.WriteString(part)
+		request.WriteByte(0)
+	}
+	for i := 0; i < commandArgs; i++ {
+		if i < len(args) {
+			request.WriteString(args[i])
+		}
+		request.WriteByte(0)
+	}
+	return request.Bytes(), nil
+}
+
+// Executes a command over a connection to the attach listener, and returns its output (truncated to the max size)
+// along with whether it was truncated.
+func executeCommand(ctx context.Context, conn net.Conn, maxSize int64, command string, args ...string) (string, bool,
+	error) {
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return "", false, errors.WithMessage(err, "set deadline")
+		}
+	}
+
+	// Reads and writes block regardless of the context, so cancellation expires the connection's deadline.
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stopWatching:
+		}
+	}()
+
+	request, err := encodeRequest(command, args...)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return "", false, errors.WithMessagef(err, "send command '%s'", command)
+	}
+
+	reader := bufio.NewReader(io.LimitReader(conn, statusLineMaxLength+maxSize+1))
+	statusLine, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || statusLine == "") {
+		return "", false, errors.WithMessagef(err, "read status of command '%s'", command)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(statusLine))
+	if err != nil {
+		return "", false, errors.Errorf("invalid status line '%s' of command '%s'", strings.TrimSpace(statusLine),
+			command)
+	}
+
+	output, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return "", false, errors.WithMessagef(err, "read output of command '%s'", command)
+	}
+
+	if status != statusOk {
+		return "", false, errors.WithMessagef(ErrCommandFailed, "command '%s' returned status %d: %s", command,
+			status, strings.TrimSpace(string(output)))
+	}
+	if int64(len(output)) > maxSize {
+		return string(output[:maxSize]), true, nil
+	}
+	return string(output), false, nil
+}
@@ -0,0 +1,74 @@
+package communication
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	FamilyNameKernelToUser = "memlab-ktu"
+	FamilyNameUserToKernel = "memlab-utk"
+
+	// Caught signals are buffered per subscriber, so a busy subscriber doesn't delay other ones.
+	subscriptionBufferSize = 8
+)
+
+// KernelChannel is the agent's view of the kernel module: which processes it watches, the signals it caught for
+// them and holds until acknowledged.
+type KernelChannel interface {
+	WatchProcess(pid uint32, signalMask uint32) error
+	UnwatchProcess(pid uint32) error
+	UnwatchAllProcesses() error
+	ListWatchedProcesses() ([]uint32, error)
+
+	// Acknowledges a caught signal, letting the kernel module deliver it to the process.
+	NotifyHandledSignal(pid uint32) error
+
+	// Signals caught for a pid are only delivered to its subscriber. Signals caught for pids without subscribers are
+	// acknowledged right away.
+	Subscribe(pid uint32) (<-chan *PayloadCaughtSignal, error)
+	Unsubscribe(pid uint32)
+
+	ProtocolInfo() *PayloadProtocolInfo
+	Close() error
+}
+
+type subscriptions struct {
+	lock  sync.RWMutex
+	chans map[uint32]chan *PayloadCaughtSignal
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		chans: make(map[uint32]chan *PayloadCaughtSignal, 0),
+	}
+}
+
+func (s *subscriptions) subscribe(pid uint32) (<-chan *PayloadCaughtSignal, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, exists := s.chans[pid]; exists {
+		return nil, errors.Errorf("pid '%d' already has a subscriber", pid)
+	}
+
+	ch := make(chan *PayloadCaughtSignal, subscriptionBufferSize)
+	s.chans[pid] = ch
+	return ch, nil
+}
+
+// Channel is not closed, since a caught signal might be in the midst of being delivered to it.
+func (s *subscriptions) unsubscribe(pid uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.chans, pid)
+}
+
+func (s *subscriptions) subscriber(pid uint32) (chan<- *PayloadCaughtSignal, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ch, found := s.chans[pid]
+	return ch, found
+}
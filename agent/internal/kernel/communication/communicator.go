@@ -2,6 +2,7 @@ package communication
 
 import (
 	stdLibErrors "errors"
+	"github.com/hashicorp/go-multierror"
 	"github.com/mdlayher/genetlink"
 	"github.com/mdlayher/netlink"
 	"github.com/pkg/errors"
@@ -9,20 +10,47 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // todo: find a better way of communicating than creating two separate generic-netlink families
 
+const (
+	// ProtocolVersion is the netlink protocol version this agent speaks (see ML_PROTOCOL_VERSION in
+	// kernel/communication.h).
+	ProtocolVersion uint32 = 2
+
+	// Kernel modules which predate protocol negotiation are assumed to speak this version.
+	legacyProtocolVersion uint32 = 1
+
+	// First protocol version in which the kernel module accepts a per-process signal mask.
+	signalMaskProtocolVersion uint32 = 2
+)
+
+var requiredCommands = []uint8{CommandMonitorProcess, CommandHandledCaughtSignal}
+
+// ErrProcessAlreadyWatched is returned when watching a process which the kernel module already watches, most likely
+// on behalf of a previous agent run. The process is re-adopted nonetheless, with the given signal mask.
+var ErrProcessAlreadyWatched = stdLibErrors.New("process is already watched")
+
+// Communicator is the generic netlink implementation of KernelChannel.
 type Communicator struct {
-	logger            *zap.Logger
-	waitGroup         sync.WaitGroup
-	sendConn          *genetlink.Conn
-	recvConn          *genetlink.Conn
-	sendConnFamily    *genetlink.Family
-	recvConnFamily    *genetlink.Family
-	caughtSignalsChan chan *PayloadCaughtSignal
+	logger         *zap.Logger
+	waitGroup      sync.WaitGroup
+	sendConn       *genetlink.Conn
+	recvConn       *genetlink.Conn
+	sendConnFamily *genetlink.Family
+	recvConnFamily *genetlink.Family
+	subscriptions  *subscriptions
+	protocolInfo   *PayloadProtocolInfo
+	closing        chan struct{}
+	listenOnce     sync.Once
+	watchedPids    map[uint32]bool // Watched (or re-adopted) by this communicator, see UnwatchAllProcesses().
+	watchedLock    sync.Mutex
 }
 
+var _ KernelChannel = (*Communicator)(nil)
+
 func connectToGenericNetlink(familyName string) (*genetlink.Conn, *genetlink.Family, error) {
 	conn, err := genetlink.Dial(&netlink.Config{
 		DisableNSLockThread: true,
@@ -41,6 +69,11 @@ func connectToGenericNetlink(familyName string) (*genetlink.Conn, *genetlink.Fam
 	return conn, &family, nil
 }
 
+// Connects to the kernel module's generic netlink families.
+func DialKernelModule(rootLogger *zap.Logger) (KernelChannel, error) {
+	return NewCommunicator(rootLogger, FamilyNameKernelToUser, FamilyNameUserToKernel)
+}
+
 func NewCommunicator(rootLogger *zap.Logger, recvFamilyName, sendFamilyName string) (*Communicator, error) {
 	recvConn, recvConnFamily, err := connectToGenericNetlink(recvFamilyName)
 	if err != nil {
@@ -49,28 +82,112 @@ func NewCommunicator(rootLogger *zap.Logger, recvFamilyName, sendFamilyName stri
 
 	sendConn, sendConnFamily, err := connectToGenericNetlink(sendFamilyName)
 	if err != nil {
+		_ = recvConn.Close()
 		return nil, err
 	}
 
 	logger := rootLogger.Named("kernel-communicator")
 
-	return &Communicator{
-		logger:            logger,
-		sendConn:          sendConn,
-		sendConnFamily:    sendConnFamily,
-		recvConn:          recvConn,
-		recvConnFamily:    recvConnFamily,
-		caughtSignalsChan: make(chan *PayloadCaughtSignal, 0),
-	}, nil
+	communicator := &Communicator{
+		logger:         logger,
+		sendConn:       sendConn,
+		sendConnFamily: sendConnFamily,
+		recvConn:       recvConn,
+		recvConnFamily: recvConnFamily,
+		subscriptions:  newSubscriptions(),
+		closing:        make(chan struct{}),
+		watchedPids:    make(map[uint32]bool, 0),
+	}
+
+	if err := communicator.negotiateProtocol(); err != nil {
+		_ = sendConn.Close()
+		_ = recvConn.Close()
+		return nil, errors.WithMessage(err, "negotiate protocol")
+	}
+
+	return communicator, nil
 }
 
-func (c *Communicator) WatchProcess(pid uint32) error {
-	c.logger.Debug("Watch process", zap.Uint32("Pid", pid))
+// Asks the kernel module for its protocol version and supported commands. Modules which predate the handshake
+// are treated as speaking the legacy protocol, and are refused features it lacks once they're used (see
+// WatchProcess()), whereas modules speaking a newer protocol than the agent are refused altogether.
+func (c *Communicator) negotiateProtocol() error {
+	message := genetlink.Message{
+		Header: genetlink.Header{
+			Command: CommandGetProtocolInfo,
+		},
+	}
+
+	replies, err := c.sendConn.Execute(message, c.sendConnFamily.ID, netlink.Request)
+	if err != nil {
+		if stdLibErrors.Is(err, syscall.EOPNOTSUPP) {
+			c.logger.Warn("Kernel module does not support protocol negotiation, assuming legacy protocol",
+				zap.Uint32("ProtocolVersion", legacyProtocolVersion))
+			c.protocolInfo = &PayloadProtocolInfo{
+				ProtocolVersion:   legacyProtocolVersion,
+				SupportedCommands: 1<<CommandMonitorProcess | 1<<CommandHandledCaughtSignal,
+			}
+			return nil
+		}
+		return errors.WithMessage(err, "get protocol info")
+	} else if len(replies) == 0 || replies[0].Data == nil {
+		return errors.New("empty protocol info reply")
+	}
+
+	protocolInfo, err := DecodePayloadProtocolInfo(replies[0].Data)
+	if err != nil {
+		return errors.WithMessage(err, "decode protocol info")
+	}
+
+	funcLogger := c.logger.With(zap.Uint32("ModuleProtocolVersion", protocolInfo.ProtocolVersion),
+		zap.Uint32("AgentProtocolVersion", ProtocolVersion), zap.String("ModuleVersion", protocolInfo.ModuleVersion))
+
+	if protocolInfo.ProtocolVersion > ProtocolVersion {
+		return errors.Errorf("kernel module protocol version '%d' is newer than the agent's ('%d')",
+			protocolInfo.ProtocolVersion, ProtocolVersion)
+	} else if protocolInfo.ProtocolVersion <= legacyProtocolVersion {
+		return errors.Errorf("unsupported kernel module protocol version '%d'", protocolInfo.ProtocolVersion)
+	}
+
+	for _, command := range requiredCommands {
+		if !protocolInfo.SupportsCommand(command) {
+			return errors.Errorf("kernel module does not support required command '%d'", command)
+		}
+	}
+
+	funcLogger.Debug("Negotiated protocol with kernel module")
+
+	c.protocolInfo = protocolInfo
+	return nil
+}
+
+func (c *Communicator) ProtocolInfo() *PayloadProtocolInfo {
+	return c.protocolInfo
+}
+
+func (c *Communicator) SupportsCommand(command uint8) bool {
+	return c.protocolInfo.SupportsCommand(command)
+}
+
+func (c *Communicator) WatchProcess(pid uint32, signalMask uint32) error {
+	c.logger.Debug("Watch process", zap.Uint32("Pid", pid), zap.Uint32("SignalMask", signalMask))
+
+	// Legacy kernel modules would watch the process for their default signals instead.
+	if signalMask != 0 && c.protocolInfo.ProtocolVersion < signalMaskProtocolVersion {
+		return errors.Errorf("kernel module protocol version '%d' does not support per-process signal masks "+
+			"(min: '%d')", c.protocolInfo.ProtocolVersion, signalMaskProtocolVersion)
+	}
+
 	payload := &PayloadMonitorProcess{
-		Pid:   pid,
-		Watch: ActionWatchProcess,
+		Pid:        pid,
+		Watch:      ActionWatchProcess,
+		SignalMask: signalMask,
 	}
-	return c.sendMonitorProcessMessage(CommandMonitorProcess, payload)
+	err := c.sendMonitorProcessMessage(CommandMonitorProcess, payload)
+	if err == nil || err == ErrProcessAlreadyWatched {
+		c.setWatched(pid, true)
+	}
+	return err
 }
 
 func (c *Communicator) UnwatchProcess(pid uint32) error {
@@ -79,9 +196,34 @@ func (c *Communicator) UnwatchProcess(pid uint32) error {
 		Pid:   pid,
 		Watch: ActionUnwatchProcess,
 	}
+
+	// Forgotten even if the kernel module failed to un-watch it, which mostly means it isn't watched anymore.
+	c.setWatched(pid, false)
 	return c.sendMonitorProcessMessage(CommandMonitorProcess, payload)
 }
 
+func (c *Communicator) setWatched(pid uint32, watched bool) {
+	c.watchedLock.Lock()
+	defer c.watchedLock.Unlock()
+
+	if watched {
+		c.watchedPids[pid] = true
+	} else {
+		delete(c.watchedPids, pid)
+	}
+}
+
+func (c *Communicator) ownWatchedPids() []uint32 {
+	c.watchedLock.Lock()
+	defer c.watchedLock.Unlock()
+
+	pids := make([]uint32, 0, len(c.watchedPids))
+	for pid := range c.watchedPids {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
 func (c *Communicator) NotifyHandledSignal(pid uint32) error {
 	c.logger.Debug("Notify kernel that signal was handled", zap.Uint32("Pid", pid))
 	payload := &PayloadMonitorProcess{
@@ -90,6 +232,89 @@ func (c *Communicator) NotifyHandledSignal(pid uint32) error {
 	return c.sendMonitorProcessMessage(CommandHandledCaughtSignal, payload)
 }
 
+func (c *Communicator) ListWatchedProcesses() ([]uint32, error) {
+	if !c.SupportsCommand(CommandListWatchedProcesses) {
+		return nil, errors.New("kernel module does not support listing watched processes")
+	}
+
+	pids := make([]uint32, 0)
+	request := &PayloadListWatchedProcesses{}
+	for {
+		page, err := c.listWatchedProcessesPage(request)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, page.Pids...)
+
+		if !page.Truncated {
+			return pids, nil
+		} else if len(page.Pids) == 0 || page.Pids[len(page.Pids)-1] <= request.After {
+			return nil, errors.Errorf("watched processes listing made no progress after pid '%d'", request.After)
+		}
+		request.After = page.Pids[len(page.Pids)-1]
+	}
+}
+
+func (c *Communicator) listWatchedProcessesPage(request *PayloadListWatchedProcesses) (*PayloadWatchedProcesses,
+	error) {
+	data, err := request.Encode()
+	if err != nil {
+		return nil, errors.WithMessage(err, "encode payload")
+	}
+
+	message := genetlink.Message{
+		Header: genetlink.Header{
+			Command: CommandListWatchedProcesses,
+		},
+		Data: data,
+	}
+
+	replies, err := c.sendConn.Execute(message, c.sendConnFamily.ID, netlink.Request)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list watched processes")
+	}
+
+	page := &PayloadWatchedProcesses{Pids: make([]uint32, 0)}
+	for _, reply := range replies {
+		if reply.Data == nil {
+			continue
+		}
+
+		payload, err := DecodePayloadWatchedProcesses(reply.Data)
+		if err != nil {
+			return nil, errors.WithMessage(err, "decode watched processes")
+		}
+		page.Pids = append(page.Pids, payload.Pids...)
+		page.Truncated = page.Truncated || payload.Truncated
+	}
+	return page, nil
+}
+
+// Un-watches every process the kernel module watches, so it never holds signals on behalf of a stopped agent.
+// Kernel modules which can't list watched processes (i.e, legacy ones) only have the processes watched by this
+// communicator un-watched, leaving ones watched by previous agent runs behind.
+func (c *Communicator) UnwatchAllProcesses() error {
+	var pids []uint32
+	if c.SupportsCommand(CommandListWatchedProcesses) {
+		var err error
+		if pids, err = c.ListWatchedProcesses(); err != nil {
+			return err
+		}
+	} else {
+		pids = c.ownWatchedPids()
+	}
+
+	var errs error
+	for _, pid := range pids {
+		if err := c.UnwatchProcess(pid); err != nil {
+			errs = multierror.Append(errs, errors.WithMessagef(err, "unwatch process '%d'", pid))
+		}
+	}
+	return errs
+}
+
+// Messages are acknowledged so that errors returned by the kernel module are surfaced instead of piling up
+// unread in the socket.
 func (c *Communicator) sendMonitorProcessMessage(command uint8, payload *PayloadMonitorProcess) error {
 	data, err := payload.Encode()
 	if err != nil {
@@ -103,14 +328,33 @@ func (c *Communicator) sendMonitorProcessMessage(command uint8, payload *Payload
 		Data: data,
 	}
 
-	_, err = c.sendConn.Send(message, c.sendConnFamily.ID, netlink.Request)
+	_, err = c.sendConn.Execute(message, c.sendConnFamily.ID, netlink.Request|netlink.Acknowledge)
 	if err != nil {
+		if command == CommandMonitorProcess && payload.Watch == ActionWatchProcess &&
+			stdLibErrors.Is(err, syscall.EEXIST) {
+			return ErrProcessAlreadyWatched
+		}
 		return errors.WithMessage(err, "send message")
 	}
 	return nil
 }
 
-func (c *Communicator) ListenForCaughtSignals() error {
+// Spawns the caught-signals listener upon first subscription.
+func (c *Communicator) Subscribe(pid uint32) (<-chan *PayloadCaughtSignal, error) {
+	caughtSignalsChan, err := c.subscriptions.subscribe(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	c.listenOnce.Do(c.listenForCaughtSignals)
+	return caughtSignalsChan, nil
+}
+
+func (c *Communicator) Unsubscribe(pid uint32) {
+	c.subscriptions.unsubscribe(pid)
+}
+
+func (c *Communicator) listenForCaughtSignals() {
 	c.waitGroup.Add(1)
 	go func() {
 		defer c.waitGroup.Done()
@@ -122,28 +366,28 @@ func (c *Communicator) ListenForCaughtSignals() error {
 
 		c.logger.Debug("Listen for netlink messages")
 		defer c.logger.Debug("Done listen for netlink messages")
-		defer close(c.caughtSignalsChan)
 
 		for {
 			messages, _, err := c.recvConn.Receive()
 			if err != nil {
-				// Since there's not way to gracefully close the connection (e.g, via a context cancellation),
-				// a call to close() is used to close it. A syscall.EBADF error is most likely caused by that close,
-				// hence we assume it's ok and do not write any error log.
-				if err == syscall.EBADF {
+				// Close() interrupts a blocking receive by expiring the read deadline, hence errors which occur
+				// while closing are expected and not logged.
+				select {
+				case <-c.closing:
 					return
-				} // todo: make it work
+				default:
+				}
 
 				c.logger.Error("Failed to receive messages", zap.Error(err))
 				continue
 			}
 
 			c.logger.Debug("Received messages", zap.Int("Count", len(messages)))
-			c.handleMessages(messages)
+			if !c.handleMessages(messages) {
+				return
+			}
 		}
 	}()
-
-	return nil
 }
 
 func (c *Communicator) joinFamilyGroups() bool {
@@ -166,7 +410,8 @@ func (c *Communicator) joinFamilyGroups() bool {
 	return true
 }
 
-func (c *Communicator) handleMessages(messages []genetlink.Message) {
+// Returns false if communicator was closed while handling messages.
+func (c *Communicator) handleMessages(messages []genetlink.Message) bool {
 	for _, message := range messages {
 		if message.Data == nil {
 			c.logger.Debug("Message data is empty, continuing...")
@@ -180,26 +425,48 @@ func (c *Communicator) handleMessages(messages []genetlink.Message) {
 			continue
 		}
 
-		c.caughtSignalsChan <- caughtSignalPayload
+		caughtSignalsChan, subscribed := c.subscriptions.subscriber(caughtSignalPayload.Pid)
+		if !subscribed {
+			c.logger.Warn("No subscriber for caught signal, releasing it", zap.Any("Signal", caughtSignalPayload))
+			if err := c.NotifyHandledSignal(caughtSignalPayload.Pid); err != nil {
+				c.logger.Error("Failed to notify handled signal", zap.Error(err))
+			}
+			continue
+		}
+
+		select {
+		case <-c.closing:
+			return false
+		case caughtSignalsChan <- caughtSignalPayload:
+		}
 	}
-}
 
-func (c *Communicator) CaughtSignalsChan() <-chan *PayloadCaughtSignal {
-	return c.caughtSignalsChan
+	return true
 }
 
-// todo: think how to restore/clean state when kernel module keeps running and agent stops and vice-versa
+// Un-watches all processes before closing, see UnwatchAllProcesses().
 func (c *Communicator) Close() error {
+	var errs error
+	if err := c.UnwatchAllProcesses(); err != nil {
+		errs = multierror.Append(errs, errors.WithMessage(err, "unwatch all processes"))
+	}
+
+	close(c.closing)
+
+	// A blocking receive holds the connection's lock, so it must be interrupted before the connection is closed.
+	if err := c.recvConn.SetReadDeadline(time.Now()); err != nil {
+		errs = multierror.Append(errs, errors.WithMessage(err, "interrupt netlink receive"))
+	}
+
+	c.waitGroup.Wait()
+
 	if err := c.sendConn.Close(); err != nil {
-		return errors.WithMessage(err, "close netlink connection")
+		errs = multierror.Append(errs, errors.WithMessage(err, "close netlink connection"))
 	}
 
 	if err := c.recvConn.Close(); err != nil {
-		return errors.WithMessage(err, "close netlink connection")
+		errs = multierror.Append(errs, errors.WithMessage(err, "close netlink connection"))
 	}
 
-	close(c.caughtSignalsChan)
-
-	c.waitGroup.Wait()
-	return nil
+	return errs
 }
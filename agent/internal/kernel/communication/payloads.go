@@ -3,6 +3,7 @@ package communication
 import (
 	"github.com/mdlayher/netlink"
 	"github.com/pkg/errors"
+	"time"
 )
 
 // enum ml_usr_to_kern_commands
@@ -10,6 +11,8 @@ import (
 const (
 	CommandMonitorProcess = iota
 	CommandHandledCaughtSignal
+	CommandGetProtocolInfo
+	CommandListWatchedProcesses
 )
 
 // ml_kern_to_usr_commands
@@ -23,6 +26,17 @@ const (
 	AttributePid uint16 = iota + 1 // Starts from 1
 	AttributeDoWatch
 	AttributeSignalNotificationSignal
+	AttributeSignalNotificationTid
+	AttributeSignalNotificationSenderPid
+	AttributeSignalNotificationSenderUid
+	AttributeSignalNotificationCode
+	AttributeSignalNotificationFaultAddress
+	AttributeSignalNotificationTimestamp
+	AttributeProtocolVersion
+	AttributeModuleVersion
+	AttributeSupportedCommands
+	AttributeSignalMask
+	AttributeListTruncated
 )
 
 const (
@@ -31,29 +45,55 @@ const (
 )
 
 type PayloadMonitorProcess struct {
-	Pid   uint32
-	Watch uint8
+	Pid        uint32
+	Watch      uint8
+	SignalMask uint32 // Omitted when zero, in which case the kernel module's default mask is used.
 }
 
 func (p *PayloadMonitorProcess) Encode() ([]byte, error) {
 	encoder := netlink.NewAttributeEncoder()
 	encoder.Uint32(AttributePid, p.Pid)
 	encoder.Uint8(AttributeDoWatch, p.Watch)
+	if p.SignalMask != 0 {
+		encoder.Uint32(AttributeSignalMask, p.SignalMask)
+	}
 	return encoder.Encode()
 }
 
+// Fields other than Pid and Signal are only sent by newer kernel modules, and are left zeroed otherwise.
 type PayloadCaughtSignal struct {
-	Pid    uint32
-	Signal uint32
+	Pid          uint32 `json:"pid"`
+	Signal       uint32 `json:"signal"`
+	Tid          uint32 `json:"tid"`
+	SenderPid    uint32 `json:"sender_pid"`
+	SenderUid    uint32 `json:"sender_uid"`
+	Code         int32  `json:"code"`
+	FaultAddress uint64 `json:"fault_address"`
+	Timestamp    uint64 `json:"timestamp"` // Nanoseconds since epoch, as measured by the kernel.
+}
+
+func (p *PayloadCaughtSignal) Time() time.Time {
+	if p.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(p.Timestamp)).UTC()
 }
 
 func (p *PayloadCaughtSignal) Encode() ([]byte, error) {
 	encoder := netlink.NewAttributeEncoder()
 	encoder.Uint32(AttributePid, p.Pid)
 	encoder.Uint32(AttributeSignalNotificationSignal, p.Signal)
+	encoder.Uint32(AttributeSignalNotificationTid, p.Tid)
+	encoder.Uint32(AttributeSignalNotificationSenderPid, p.SenderPid)
+	encoder.Uint32(AttributeSignalNotificationSenderUid, p.SenderUid)
+	encoder.Uint32(AttributeSignalNotificationCode, uint32(p.Code))
+	encoder.Uint64(AttributeSignalNotificationFaultAddress, p.FaultAddress)
+	encoder.Uint64(AttributeSignalNotificationTimestamp, p.Timestamp)
 	return encoder.Encode()
 }
 
+// Unknown attributes are skipped rather than rejected, so that older agents keep working against newer kernel
+// modules which send additional fields.
 func DecodePayloadCaughtSignal(data []byte) (*PayloadCaughtSignal, error) {
 	decoder, err := netlink.NewAttributeDecoder(data)
 	if err != nil {
@@ -67,8 +107,113 @@ func DecodePayloadCaughtSignal(data []byte) (*PayloadCaughtSignal, error) {
 			payload.Pid = decoder.Uint32()
 		case AttributeSignalNotificationSignal:
 			payload.Signal = decoder.Uint32()
-		default:
-			return nil, errors.Errorf("invalid attribute type ('%d')", decoder.Type())
+		case AttributeSignalNotificationTid:
+			payload.Tid = decoder.Uint32()
+		case AttributeSignalNotificationSenderPid:
+			payload.SenderPid = decoder.Uint32()
+		case AttributeSignalNotificationSenderUid:
+			payload.SenderUid = decoder.Uint32()
+		case AttributeSignalNotificationCode:
+			payload.Code = int32(decoder.Uint32())
+		case AttributeSignalNotificationFaultAddress:
+			payload.FaultAddress = decoder.Uint64()
+		case AttributeSignalNotificationTimestamp:
+			payload.Timestamp = decoder.Uint64()
+		}
+	}
+
+	if err := decoder.Err(); err != nil {
+		return nil, errors.WithMessage(err, "malformed attributes")
+	}
+	return payload, nil
+}
+
+type PayloadProtocolInfo struct {
+	ProtocolVersion   uint32
+	ModuleVersion     string
+	SupportedCommands uint32 // Bitmask of supported user-to-kernel commands, indexed by command.
+}
+
+func (p *PayloadProtocolInfo) SupportsCommand(command uint8) bool {
+	return p.SupportedCommands&(1<<command) != 0
+}
+
+func (p *PayloadProtocolInfo) Encode() ([]byte, error) {
+	encoder := netlink.NewAttributeEncoder()
+	encoder.Uint32(AttributeProtocolVersion, p.ProtocolVersion)
+	encoder.String(AttributeModuleVersion, p.ModuleVersion)
+	encoder.Uint32(AttributeSupportedCommands, p.SupportedCommands)
+	return encoder.Encode()
+}
+
+func DecodePayloadProtocolInfo(data []byte) (*PayloadProtocolInfo, error) {
+	decoder, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &PayloadProtocolInfo{}
+	for decoder.Next() {
+		switch decoder.Type() {
+		case AttributeProtocolVersion:
+			payload.ProtocolVersion = decoder.Uint32()
+		case AttributeModuleVersion:
+			payload.ModuleVersion = decoder.String()
+		case AttributeSupportedCommands:
+			payload.SupportedCommands = decoder.Uint32()
+		}
+	}
+
+	if err := decoder.Err(); err != nil {
+		return nil, errors.WithMessage(err, "malformed attributes")
+	}
+	return payload, nil
+}
+
+// Lists watched pids following the given one (none for the first page), see PayloadWatchedProcesses.
+type PayloadListWatchedProcesses struct {
+	After uint32
+}
+
+func (p *PayloadListWatchedProcesses) Encode() ([]byte, error) {
+	encoder := netlink.NewAttributeEncoder()
+	if p.After != 0 {
+		encoder.Uint32(AttributePid, p.After)
+	}
+	return encoder.Encode()
+}
+
+// Each watched pid is sent as a separate AttributePid attribute, in ascending order. Truncated replies are followed by
+// another page, listed after their last pid.
+type PayloadWatchedProcesses struct {
+	Pids      []uint32
+	Truncated bool
+}
+
+func (p *PayloadWatchedProcesses) Encode() ([]byte, error) {
+	encoder := netlink.NewAttributeEncoder()
+	for _, pid := range p.Pids {
+		encoder.Uint32(AttributePid, pid)
+	}
+	if p.Truncated {
+		encoder.Uint8(AttributeListTruncated, 1)
+	}
+	return encoder.Encode()
+}
+
+func DecodePayloadWatchedProcesses(data []byte) (*PayloadWatchedProcesses, error) {
+	decoder, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &PayloadWatchedProcesses{Pids: make([]uint32, 0)}
+	for decoder.Next() {
+		switch decoder.Type() {
+		case AttributePid:
+			payload.Pids = append(payload.Pids, decoder.Uint32())
+		case AttributeListTruncated:
+			payload.Truncated = decoder.Uint8() != 0
 		}
 	}
 
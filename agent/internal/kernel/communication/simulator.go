@@ -0,0 +1,201 @@
+package communication
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Mirrors wait_timeout_seconds in kernel/ml_crash_detector.h.
+	simulatedHoldTimeout = time.Second * 60
+
+	simulatedSupportedCommands = 1<<CommandMonitorProcess | 1<<CommandHandledCaughtSignal |
+		1<<CommandGetProtocolInfo | 1<<CommandListWatchedProcesses
+)
+
+// Simulator is an in-memory KernelChannel which behaves like the kernel module, without requiring it to be loaded.
+// Caught signals are injected via InjectCaughtSignal().
+type Simulator struct {
+	logger        *zap.Logger
+	lock          sync.Mutex
+	watched       map[uint32]uint32 // Pid to signal mask.
+	held          map[uint32]*simulatedHold
+	subscriptions *subscriptions
+	holdTimeout   time.Duration
+	closed        bool
+}
+
+var _ KernelChannel = (*Simulator)(nil)
+
+func NewSimulator(rootLogger *zap.Logger) *Simulator {
+	return &Simulator{
+		logger:        rootLogger.Named("kernel-simulator"),
+		watched:       make(map[uint32]uint32, 0),
+		held:          make(map[uint32]*simulatedHold, 0),
+		subscriptions: newSubscriptions(),
+		holdTimeout:   simulatedHoldTimeout,
+	}
+}
+
+func (s *Simulator) WatchProcess(pid uint32, signalMask uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, watched := s.watched[pid]; watched {
+		s.watched[pid] = signalMask // Re-adopted with the given mask, like the kernel module does.
+		return ErrProcessAlreadyWatched
+	}
+
+	s.logger.Debug("Watch process", zap.Uint32("Pid", pid), zap.Uint32("SignalMask", signalMask))
+	s.watched[pid] = signalMask
+	return nil
+}
+
+func (s *Simulator) UnwatchProcess(pid uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, watched := s.watched[pid]; !watched {
+		return errors.Errorf("process '%d' is not watched", pid)
+	}
+
+	s.logger.Debug("Un-watch process", zap.Uint32("Pid", pid))
+	delete(s.watched, pid)
+	return nil
+}
+
+func (s *Simulator) UnwatchAllProcesses() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.watched = make(map[uint32]uint32, 0)
+	return nil
+}
+
+func (s *Simulator) ListWatchedProcesses() ([]uint32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pids := make([]uint32, 0, len(s.watched))
+	for pid := range s.watched {
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func (s *Simulator) NotifyHandledSignal(pid uint32) error {
+	s.logger.Debug("Notify simulated kernel that signal was handled", zap.Uint32("Pid", pid))
+	s.releaseHeldSignal(pid, nil)
+	return nil
+}
+
+func (s *Simulator) Subscribe(pid uint32) (<-chan *PayloadCaughtSignal, error) {
+	return s.subscriptions.subscribe(pid)
+}
+
+func (s *Simulator) Unsubscribe(pid uint32) {
+	s.subscriptions.unsubscribe(pid)
+}
+
+func (s *Simulator) ProtocolInfo() *PayloadProtocolInfo {
+	return &PayloadProtocolInfo{
+		ProtocolVersion:   ProtocolVersion,
+		ModuleVersion:     "simulator",
+		SupportedCommands: simulatedSupportedCommands,
+	}
+}
+
+// InjectCaughtSignal simulates the kernel module catching a signal sent to a watched process. The returned channel is
+// closed once the signal is released, either by an acknowledgement or by the hold timeout, at which point the process
+// is no longer watched (just like the kernel module does).
+func (s *Simulator) InjectCaughtSignal(caughtSignal *PayloadCaughtSignal) (<-chan struct{}, error) {
+	pid := caughtSignal.Pid
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil, errors.New("simulator is closed")
+	}
+
+	signalMask, watched := s.watched[pid]
+	if !watched {
+		s.lock.Unlock()
+		return nil, errors.Errorf("process '%d' is not watched", pid)
+	} else if !signalRelevant(signalMask, caughtSignal.Signal) {
+		s.lock.Unlock()
+		return nil, errors.Errorf("signal '%d' is not relevant for process '%d'", caughtSignal.Signal, pid)
+	} else if _, held := s.held[pid]; held {
+		s.lock.Unlock()
+		return nil, errors.Errorf("a signal is already held for process '%d'", pid)
+	}
+
+	hold := &simulatedHold{released: make(chan struct{})}
+	hold.timeout = time.AfterFunc(s.holdTimeout, func() {
+		s.releaseHeldSignal(pid, hold)
+	})
+	s.held[pid] = hold
+	s.lock.Unlock()
+
+	if caughtSignal.Timestamp == 0 {
+		caughtSignal.Timestamp = uint64(time.Now().UnixNano())
+	}
+
+	caughtSignalsChan, subscribed := s.subscriptions.subscriber(pid)
+	if !subscribed {
+		s.logger.Warn("No subscriber for caught signal, releasing it", zap.Any("Signal", caughtSignal))
+		s.releaseHeldSignal(pid, nil)
+		return hold.released, nil
+	}
+
+	s.logger.Debug("Inject caught signal", zap.Any("Signal", caughtSignal))
+	caughtSignalsChan <- caughtSignal
+	return hold.released, nil
+}
+
+// Releases the signal held for the pid, unless a specific hold is given and it isn't the one held anymore (i.e, a
+// timeout of a hold which was already released, and followed by another one).
+func (s *Simulator) releaseHeldSignal(pid uint32, hold *simulatedHold) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	heldHold, held := s.held[pid]
+	if !held || (hold != nil && hold != heldHold) {
+		return
+	}
+
+	heldHold.timeout.Stop()
+	close(heldHold.released)
+	delete(s.held, pid)
+	delete(s.watched, pid)
+}
+
+func (s *Simulator) Close() error {
+	s.lock.Lock()
+	pids := make([]uint32, 0, len(s.held))
+	for pid := range s.held {
+		pids = append(pids, pid)
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	for _, pid := range pids {
+		s.releaseHeldSignal(pid, nil)
+	}
+	return s.UnwatchAllProcesses()
+}
+
+type simulatedHold struct {
+	released chan struct{}
+	timeout  *time.Timer
+}
+
+// A zero mask stands for the kernel module's default mask, which is approximated by any valid signal.
+func signalRelevant(signalMask uint32, signal uint32) bool {
+	if signal == 0 || signal > uint32(syscall.SIGSYS) {
+		return false
+	}
+	return signalMask == 0 || signalMask&(1<<(signal-1)) != 0
+}
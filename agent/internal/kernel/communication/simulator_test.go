@@ -0,0 +1,115 @@
+package communication
+
+import (
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+const testPid = 4242
+
+func newTestSimulator(holdTimeout time.Duration) *Simulator {
+	simulator := NewSimulator(zap.NewNop())
+	simulator.holdTimeout = holdTimeout
+	return simulator
+}
+
+func injectCaughtSignal(t *testing.T, simulator *Simulator) (<-chan *PayloadCaughtSignal, <-chan struct{}) {
+	if err := simulator.WatchProcess(testPid, 0); err != nil {
+		t.Fatalf("watch process: %v", err)
+	}
+
+	caughtSignalsChan, err := simulator.Subscribe(testPid)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	released, err := simulator.InjectCaughtSignal(&PayloadCaughtSignal{Pid: testPid, Signal: 6})
+	if err != nil {
+		t.Fatalf("inject caught signal: %v", err)
+	}
+	return caughtSignalsChan, released
+}
+
+func isReleased(released <-chan struct{}) bool {
+	select {
+	case <-released:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestSimulatorReleasesHeldSignalOnAcknowledgement(t *testing.T) {
+	simulator := newTestSimulator(time.Minute)
+	defer simulator.Close()
+
+	caughtSignalsChan, released := injectCaughtSignal(t, simulator)
+	caughtSignal := <-caughtSignalsChan
+	if caughtSignal.Pid != testPid || caughtSignal.Signal != 6 || caughtSignal.Timestamp == 0 {
+		t.Fatalf("unexpected caught signal: %+v", caughtSignal)
+	} else if isReleased(released) {
+		t.Fatal("signal released before acknowledgement")
+	}
+
+	if err := simulator.NotifyHandledSignal(testPid); err != nil {
+		t.Fatalf("notify handled signal: %v", err)
+	} else if !isReleased(released) {
+		t.Fatal("signal not released after acknowledgement")
+	}
+
+	// Just like the kernel module, processes are no longer watched once their signal is released.
+	if pids, _ := simulator.ListWatchedProcesses(); len(pids) != 0 {
+		t.Fatalf("process still watched after release: %v", pids)
+	}
+}
+
+func TestSimulatorReleasesHeldSignalOnTimeout(t *testing.T) {
+	simulator := newTestSimulator(time.Millisecond * 50)
+	defer simulator.Close()
+
+	_, released := injectCaughtSignal(t, simulator)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("signal not released after hold timeout")
+	}
+}
+
+func TestSimulatorTimeoutOfReleasedHoldKeepsLaterHold(t *testing.T) {
+	holdTimeout := time.Millisecond * 200
+	simulator := newTestSimulator(holdTimeout)
+	defer simulator.Close()
+
+	caughtSignalsChan, _ := injectCaughtSignal(t, simulator)
+	<-caughtSignalsChan
+	if err := simulator.NotifyHandledSignal(testPid); err != nil {
+		t.Fatalf("notify handled signal: %v", err)
+	}
+	simulator.Unsubscribe(testPid)
+
+	// Held past the first hold's timeout, yet well within its own.
+	time.Sleep(holdTimeout / 2)
+	caughtSignalsChan, released := injectCaughtSignal(t, simulator)
+	<-caughtSignalsChan
+
+	time.Sleep(holdTimeout * 3 / 4)
+	if isReleased(released) {
+		t.Fatal("later hold released by the timeout of an earlier one")
+	}
+}
+
+func TestSimulatorRewatchUpdatesSignalMask(t *testing.T) {
+	simulator := newTestSimulator(time.Minute)
+	defer simulator.Close()
+
+	if err := simulator.WatchProcess(testPid, 1<<(6-1)); err != nil {
+		t.Fatalf("watch process: %v", err)
+	} else if err := simulator.WatchProcess(testPid, 1<<(11-1)); err != ErrProcessAlreadyWatched {
+		t.Fatalf("expected process to be already watched, got: %v", err)
+	}
+
+	if _, err := simulator.InjectCaughtSignal(&PayloadCaughtSignal{Pid: testPid, Signal: 6}); err == nil {
+		t.Fatal("signal outside of re-adopted mask was held")
+	}
+}
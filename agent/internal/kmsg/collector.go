@@ -0,0 +1,70 @@
+package kmsg
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"regexp"
+	"time"
+)
+
+// Kernel messages about a process, and the events they report. Pids are of the host's pid namespace, as are the ones
+// the kernel logs.
+type ProcessMessages struct {
+	Messages  []*Message  `json:"kernel_messages"`
+	Segfaults []*Segfault `json:"kernel_segfaults,omitempty"`
+	OomKills  []*OomKill  `json:"kernel_oom_kills,omitempty"`
+	HungTasks []*HungTask `json:"kernel_hung_tasks,omitempty"`
+}
+
+// Messages mention processes as "comm[pid]", "pid=pid", "process pid" or "task comm:pid".
+func processMentionPattern(pid types.Pid) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?:\[|\bpid=|\b[Pp]rocess |\btask \S+:)%d\b`, pid))
+}
+
+// Threads of the process are mentioned by their own pids, so only messages mentioning the process' pid are found,
+// e.g about its main thread.
+func CollectProcessMessages(pid types.Pid, config *Config) (*ProcessMessages, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate config")
+	}
+
+	messages, err := ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var minTime time.Time
+	if config.MaxAge > 0 {
+		minTime = time.Now().Add(-config.MaxAge)
+	}
+
+	processMessages := &ProcessMessages{Messages: make([]*Message, 0)}
+	mentionPattern := processMentionPattern(pid)
+	parser := NewParser()
+	for _, message := range messages {
+		event := parser.Parse(message) // Fed with all messages, as OOM kills span messages not mentioning the pid.
+		if message.Time.Before(minTime) {
+			continue
+		}
+
+		if event != nil && event.Pid() == pid {
+			switch {
+			case event.Segfault != nil:
+				processMessages.Segfaults = append(processMessages.Segfaults, event.Segfault)
+			case event.OomKill != nil:
+				processMessages.OomKills = append(processMessages.OomKills, event.OomKill)
+			case event.HungTask != nil:
+				processMessages.HungTasks = append(processMessages.HungTasks, event.HungTask)
+			}
+		}
+		if mentionPattern.MatchString(message.Text) {
+			processMessages.Messages = append(processMessages.Messages, message)
+		}
+	}
+
+	if len(processMessages.Messages) > config.MaxMessages {
+		processMessages.Messages = processMessages.Messages[len(processMessages.Messages)-config.MaxMessages:]
+	}
+	return processMessages, nil
+}
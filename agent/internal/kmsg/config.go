@@ -0,0 +1,21 @@
+package kmsg
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	MaxMessages int           // Latest messages about the process to report.
+	MaxAge      time.Duration // Of messages to report, unlimited if 0.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxMessages <= 0 {
+		return false, errors.New("max messages must be positive")
+	} else if c.MaxAge < 0 {
+		return false, errors.New("negative max age")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,231 @@
+package kmsg
+
+import (
+	"github.com/memlab/agent/internal/types"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// e.g "app[1234]: segfault at 0 ip 000055d5e2c4 sp 00007ffd1e10 error 4 in app[55d5e2c00000+1000]", where the
+	// mapping is omitted when the instruction pointer isn't in one, and is preceded by the instruction pointer's
+	// offset in the file since linux 6.1 (see show_signal_msg() in arch/x86/mm/fault.c).
+	segfaultPattern = regexp.MustCompile(`^(.*)\[(\d+)\]: segfault at ([0-9a-f]+) ip ([0-9a-f]+) sp ([0-9a-f]+) ` +
+		`error ([0-9a-f]+)(?: in (.*)\[(?:([0-9a-f]+),)?([0-9a-f]+)\+[0-9a-f]+\])?`)
+
+	// An OOM kill report starts with "app invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=0",
+	// followed by memory statistics (including "memory: usage 102400kB, limit 102400kB, failcnt 12" for memory cgroup
+	// limits), "oom-kill:constraint=CONSTRAINT_MEMCG,...,oom_memcg=/app,task_memcg=/app,task=app,pid=1234,uid=0"
+	// (linux 4.19+), and "Memory cgroup out of memory: Killed process 1234 (app) total-vm:10240kB, anon-rss:1024kB,
+	// file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:64kB oom_score_adj:0", see mm/oom_kill.c.
+	oomInvokerPattern     = regexp.MustCompile(`^(.*) invoked oom-killer: `)
+	oomCgroupUsagePattern = regexp.MustCompile(`^memory: usage (\d+)kB, limit (\d+)kB`)
+	oomKilledPattern      = regexp.MustCompile(`^(.*): Killed process (\d+) \((.*)\) total-vm:(\d+)kB, ` +
+		`anon-rss:(\d+)kB, file-rss:(\d+)kB, shmem-rss:(\d+)kB(?:, UID:(\d+) pgtables:(\d+)kB oom_score_adj:(-?\d+))?`)
+
+	// e.g "INFO: task app:1234 blocked for more than 120 seconds.", see kernel/hung_task.c.
+	hungTaskPattern = regexp.MustCompile(`^INFO: task (.*):(\d+) blocked for more than (\d+) seconds`)
+)
+
+const oomKillPrefix = "oom-kill:"
+
+type Segfault struct {
+	Time           time.Time `json:"time"`
+	Pid            types.Pid `json:"pid"` // Of the faulting thread.
+	Comm           string    `json:"comm"`
+	Address        string    `json:"address"`
+	Ip             string    `json:"ip"`
+	Sp             string    `json:"sp"`
+	ErrorCode      uint64    `json:"error_code"`
+	Access         string    `json:"access"`                    // e.g "read", "write" or "instruction fetch".
+	Reason         string    `json:"reason"`                    // e.g "unmapped page" or "protection violation".
+	Mapping        string    `json:"mapping,omitempty"`         // File mapped at the instruction pointer.
+	MappingAddress string    `json:"mapping_address,omitempty"` // Where that file is mapped.
+	MappingOffset  string    `json:"mapping_offset,omitempty"`  // Of the instruction pointer in that file.
+}
+
+type OomKill struct {
+	Time             time.Time `json:"time"`
+	Pid              types.Pid `json:"pid"` // Of the killed process.
+	Comm             string    `json:"comm"`
+	Uid              *uint32   `json:"uid,omitempty"`
+	Invoker          string    `json:"invoker,omitempty"`       // Comm of the task whose allocation failed.
+	Constraint       string    `json:"constraint,omitempty"`    // e.g "CONSTRAINT_NONE" (host wide) or "CONSTRAINT_MEMCG".
+	MemoryCgroup     string    `json:"memory_cgroup,omitempty"` // Whose limit was hit, for memory cgroup constraints.
+	TaskMemoryCgroup string    `json:"task_memory_cgroup,omitempty"`
+	CgroupUsageBytes uint64    `json:"cgroup_usage_bytes,omitempty"`
+	CgroupLimitBytes uint64    `json:"cgroup_limit_bytes,omitempty"`
+	TotalVmBytes     uint64    `json:"total_vm_bytes"`
+	AnonRssBytes     uint64    `json:"anon_rss_bytes"`
+	FileRssBytes     uint64    `json:"file_rss_bytes"`
+	ShmemRssBytes    uint64    `json:"shmem_rss_bytes"`
+	PageTablesBytes  uint64    `json:"page_tables_bytes,omitempty"`
+	OomScoreAdj      *int      `json:"oom_score_adj,omitempty"`
+	Reason           string    `json:"reason"` // e.g "Out of memory" or "Memory cgroup out of memory".
+}
+
+type HungTask struct {
+	Time           time.Time `json:"time"`
+	Pid            types.Pid `json:"pid"` // Of the blocked thread.
+	Comm           string    `json:"comm"`
+	BlockedSeconds uint64    `json:"blocked_seconds"` // At least, as the threshold is reported.
+}
+
+// Event parsed from kernel messages, of which exactly one field is set.
+type Event struct {
+	Segfault *Segfault
+	OomKill  *OomKill
+	HungTask *HungTask
+}
+
+func (e *Event) Pid() types.Pid {
+	switch {
+	case e.Segfault != nil:
+		return e.Segfault.Pid
+	case e.OomKill != nil:
+		return e.OomKill.Pid
+	default:
+		return e.HungTask.Pid
+	}
+}
+
+// Parser parses events from kernel messages, which are fed in order. OOM kills are reported by several messages, so
+// the parser keeps the details of the kill in progress.
+type Parser struct {
+	oomInvoker       string
+	oomCgroupUsage   uint64
+	oomCgroupLimit   uint64
+	oomKillStatement map[string]string
+}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Returns the event a message completes, or nil if it doesn't complete any.
+func (p *Parser) Parse(message *Message) *Event {
+	text := message.Text
+
+	if match := segfaultPattern.FindStringSubmatch(text); match != nil {
+		return &Event{Segfault: newSegfault(message.Time, match)}
+	}
+	if match := hungTaskPattern.FindStringSubmatch(text); match != nil {
+		return &Event{HungTask: &HungTask{
+			Time:           message.Time,
+			Pid:            parsePid(match[2]),
+			Comm:           match[1],
+			BlockedSeconds: parseUint(match[3]),
+		}}
+	}
+
+	if match := oomInvokerPattern.FindStringSubmatch(text); match != nil {
+		p.oomInvoker, p.oomCgroupUsage, p.oomCgroupLimit, p.oomKillStatement = match[1], 0, 0, nil
+		return nil
+	}
+	if match := oomCgroupUsagePattern.FindStringSubmatch(text); match != nil {
+		p.oomCgroupUsage, p.oomCgroupLimit = parseUint(match[1])*1024, parseUint(match[2])*1024
+		return nil
+	}
+	if strings.HasPrefix(text, oomKillPrefix) {
+		p.oomKillStatement = parseOomKillStatement(strings.TrimPrefix(text, oomKillPrefix))
+		return nil
+	}
+	if match := oomKilledPattern.FindStringSubmatch(text); match != nil {
+		oomKill := p.newOomKill(message.Time, match)
+		p.oomInvoker, p.oomCgroupUsage, p.oomCgroupLimit, p.oomKillStatement = "", 0, 0, nil
+		return &Event{OomKill: oomKill}
+	}
+
+	return nil
+}
+
+func newSegfault(messageTime time.Time, match []string) *Segfault {
+	errorCode, _ := strconv.ParseUint(match[6], 16, 64)
+	segfault := &Segfault{
+		Time:      messageTime,
+		Pid:       parsePid(match[2]),
+		Comm:      match[1],
+		Address:   "0x" + match[3],
+		Ip:        "0x" + match[4],
+		Sp:        "0x" + match[5],
+		ErrorCode: errorCode,
+		Access:    "read",
+		Reason:    "unmapped page",
+		Mapping:   match[7],
+	}
+	if match[8] != "" {
+		segfault.MappingOffset = "0x" + match[8]
+	}
+	if match[9] != "" {
+		segfault.MappingAddress = "0x" + match[9]
+	}
+
+	// Bits of the x86 page fault error code, see enum x86_pf_error_code.
+	if errorCode&0x10 != 0 {
+		segfault.Access = "instruction fetch"
+	} else if errorCode&0x2 != 0 {
+		segfault.Access = "write"
+	}
+	if errorCode&0x8 != 0 {
+		segfault.Reason = "reserved bit set"
+	} else if errorCode&0x20 != 0 {
+		segfault.Reason = "protection keys violation"
+	} else if errorCode&0x1 != 0 {
+		segfault.Reason = "protection violation"
+	}
+	return segfault
+}
+
+func (p *Parser) newOomKill(messageTime time.Time, match []string) *OomKill {
+	oomKill := &OomKill{
+		Time:             messageTime,
+		Pid:              parsePid(match[2]),
+		Comm:             match[3],
+		Invoker:          p.oomInvoker,
+		CgroupUsageBytes: p.oomCgroupUsage,
+		CgroupLimitBytes: p.oomCgroupLimit,
+		TotalVmBytes:     parseUint(match[4]) * 1024,
+		AnonRssBytes:     parseUint(match[5]) * 1024,
+		FileRssBytes:     parseUint(match[6]) * 1024,
+		ShmemRssBytes:    parseUint(match[7]) * 1024,
+		Reason:           match[1],
+	}
+	if match[8] != "" { // Reported since linux 4.20.
+		uid := uint32(parseUint(match[8]))
+		oomScoreAdj, _ := strconv.Atoi(match[10])
+		oomKill.Uid, oomKill.OomScoreAdj = &uid, &oomScoreAdj
+		oomKill.PageTablesBytes = parseUint(match[9]) * 1024
+	}
+
+	// Only if it's about the same process, rather than left from an earlier report.
+	if statement := p.oomKillStatement; statement != nil && parsePid(statement["pid"]) == oomKill.Pid {
+		oomKill.Constraint = statement["constraint"]
+		oomKill.MemoryCgroup = statement["oom_memcg"]
+		oomKill.TaskMemoryCgroup = statement["task_memcg"]
+	}
+	return oomKill
+}
+
+// e.g "constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/app,task_memcg=/app,task=app,
+// pid=1234,uid=0".
+func parseOomKillStatement(statement string) map[string]string {
+	fields := make(map[string]string, 0)
+	for _, field := range strings.Split(statement, ",") {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	return fields
+}
+
+func parsePid(field string) types.Pid {
+	pid, _ := strconv.ParseUint(field, 10, 32)
+	return types.Pid(pid)
+}
+
+func parseUint(field string) uint64 {
+	value, _ := strconv.ParseUint(field, 10, 64)
+	return value
+}
@@ -0,0 +1,77 @@
+package kmsg
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog levels of messages, see syslog(2).
+var levelNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+type Message struct {
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Text     string    `json:"text"`
+}
+
+// e.g "6,1234,5678901,-;text\n SUBSYSTEM=net\n", where fields are the syslog priority, sequence number and
+// microseconds since boot, followed by dictionary lines, see Documentation/ABI/testing/dev-kmsg.
+func parseRecord(record []byte, bootTime time.Time) (*Message, error) {
+	separator := strings.IndexByte(string(record), ';')
+	if separator == -1 {
+		return nil, errors.Errorf("invalid record '%s'", record)
+	}
+
+	fields := strings.Split(string(record[:separator]), ",")
+	if len(fields) < 3 {
+		return nil, errors.Errorf("too few fields in record '%s'", record)
+	}
+
+	priority, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse priority of record '%s'", record)
+	}
+	sequence, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse sequence of record '%s'", record)
+	}
+	microseconds, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse timestamp of record '%s'", record)
+	}
+
+	text := string(record[separator+1:])
+	if newline := strings.IndexByte(text, '\n'); newline != -1 {
+		text = text[:newline] // Dictionary lines follow.
+	}
+
+	return &Message{
+		Sequence: sequence,
+		Time:     bootTime.Add(time.Duration(microseconds) * time.Microsecond),
+		Level:    levelNames[priority&7], // The facility is in the higher bits.
+		Text:     unescape(text),
+	}, nil
+}
+
+// Non-printable characters are escaped as "\xNN", as are backslashes themselves.
+func unescape(text string) string {
+	if !strings.Contains(text, `\x`) {
+		return text
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+3 < len(text) && text[i+1] == 'x' {
+			if value, err := strconv.ParseUint(text[i+2:i+4], 16, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(text[i])
+	}
+	return unescaped.String()
+}
@@ -0,0 +1,127 @@
+package kmsg
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"time"
+)
+
+const (
+	devKmsg = "/dev/kmsg"
+
+	// Records are truncated by the kernel to fit reads, which must be large enough for the longest of them.
+	maxRecordSize = 8192
+
+	// Waiting for messages is interrupted this often to check whether the context is done.
+	pollInterval = time.Second
+)
+
+// Reader reads kernel messages from /dev/kmsg, where each reader has its own position. Reading requires CAP_SYSLOG
+// when dmesg_restrict is set.
+type Reader struct {
+	fd       int
+	bootTime time.Time
+	buffer   []byte
+}
+
+// Opens a reader positioned at the oldest message in the kernel's ring buffer, or past the latest one if tail is set,
+// so only messages logged from now on are read.
+func OpenReader(tail bool) (*Reader, error) {
+	fd, err := unix.Open(devKmsg, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", devKmsg)
+	}
+
+	if tail {
+		if _, err := unix.Seek(fd, 0, io.SeekEnd); err != nil {
+			unix.Close(fd)
+			return nil, errors.WithMessagef(err, "seek to the end of '%s'", devKmsg)
+		}
+	}
+
+	bootTime, err := readBootTime()
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &Reader{
+		fd:       fd,
+		bootTime: bootTime,
+		buffer:   make([]byte, maxRecordSize),
+	}, nil
+}
+
+// Message timestamps are of the monotonic clock, which doesn't count time suspended, like the kernel's log clock.
+func readBootTime() (time.Time, error) {
+	var monotonic unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &monotonic); err != nil {
+		return time.Time{}, errors.WithMessage(err, "get monotonic time")
+	}
+	return time.Now().Add(-time.Duration(monotonic.Nano())), nil
+}
+
+// Returns the next message, or nil once there are no more messages to read for now.
+func (r *Reader) Next() (*Message, error) {
+	for {
+		read, err := unix.Read(r.fd, r.buffer)
+		switch err {
+		case nil:
+			return parseRecord(r.buffer[:read], r.bootTime)
+		case unix.EAGAIN:
+			return nil, nil
+		case unix.EPIPE: // Messages were overwritten before they were read, and are skipped.
+			continue
+		case unix.EINTR:
+			continue
+		default:
+			return nil, errors.WithMessagef(err, "read '%s'", devKmsg)
+		}
+	}
+}
+
+// Blocks until there are messages to read, or the context is done.
+func (r *Reader) Wait(ctx context.Context) error {
+	pollFds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ready, err := unix.Poll(pollFds, int(pollInterval.Milliseconds()))
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return errors.WithMessagef(err, "poll '%s'", devKmsg)
+		}
+		if ready > 0 {
+			return nil
+		}
+	}
+}
+
+// Reads all the messages in the kernel's ring buffer, from the oldest one.
+func ReadAll() ([]*Message, error) {
+	reader, err := OpenReader(false)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	messages := make([]*Message, 0)
+	for {
+		message, err := reader.Next()
+		if err != nil {
+			return nil, err
+		} else if message == nil {
+			return messages, nil
+		}
+		messages = append(messages, message)
+	}
+}
+
+func (r *Reader) Close() error {
+	return unix.Close(r.fd)
+}
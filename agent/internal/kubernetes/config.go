@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+const minPodsRefreshInterval = time.Second * 5
+
+// Config of the DaemonSet mode, where the agent is scoped to its node's pods.
+type Config struct {
+	NodeName string // Identifies the agent's machine, instead of the host's machine id.
+	// API server's base url (e.g "https://kubernetes.default.svc"), whose pod list is authorized with the service
+	// account's token.
+	ApiServerUrl       string
+	ApiServerTokenFile string
+	ApiServerCaFile    string // Verifies the API server's certificate, instead of the system's CAs.
+	// Local stand-in for the API server (e.g, for tests), read on every refresh. Takes precedence over its url.
+	PodsFile            string
+	PodsRefreshInterval time.Duration
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.NodeName == "" {
+		return false, errors.New("empty node name")
+	}
+
+	if c.PodsFile == "" && c.ApiServerUrl == "" {
+		return false, errors.New("neither api server url nor pods file are set")
+	}
+
+	if c.PodsRefreshInterval <= 0 {
+		return false, errors.New("uninitialized pods refresh interval")
+	} else if c.PodsRefreshInterval < minPodsRefreshInterval {
+		return false, errors.Errorf("below minimum allowed pods refresh interval (min: '%s')",
+			minPodsRefreshInterval.String())
+	}
+
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// PodDiscovery periodically lists the node's pods, so processes can be scoped to (and labeled with) the pods they
+// run in. Implements containers.PodMetadataSource.
+type PodDiscovery struct {
+	logger     *zap.Logger
+	context    context.Context
+	cancel     context.CancelFunc
+	waitGroup  sync.WaitGroup
+	config     *Config
+	lister     PodLister
+	lock       sync.RWMutex
+	containers map[string]*models.Container // By container id.
+}
+
+func NewPodDiscovery(rootLogger *zap.Logger, config *Config) (*PodDiscovery, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate kubernetes config")
+	}
+
+	lister, err := newPodLister(config)
+	if err != nil {
+		return nil, errors.WithMessage(err, "new pod lister")
+	}
+
+	logger := rootLogger.Named("pod-discovery")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &PodDiscovery{
+		logger:     logger,
+		context:    ctx,
+		cancel:     cancel,
+		config:     config,
+		lister:     lister,
+		containers: make(map[string]*models.Container, 0),
+	}, nil
+}
+
+func (pd *PodDiscovery) NodeName() string {
+	return pd.config.NodeName
+}
+
+// The initial refresh is done before returning, so processes aren't discarded for lack of a pod list. Its failure
+// isn't fatal, as the API server may be briefly unreachable.
+func (pd *PodDiscovery) Start() error {
+	pd.logger.Debug("Start pod discovery")
+
+	if err := pd.refresh(); err != nil {
+		pd.logger.Error("Failed to list node's pods", zap.Error(err))
+	}
+
+	pd.waitGroup.Add(1)
+	go pd.refreshPeriodically()
+
+	return nil
+}
+
+func (pd *PodDiscovery) refreshPeriodically() {
+	defer pd.waitGroup.Done()
+
+	ticker := time.NewTicker(pd.config.PodsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pd.context.Done():
+			return
+		case <-ticker.C:
+			if err := pd.refresh(); err != nil {
+				pd.logger.Error("Failed to list node's pods", zap.Error(err))
+			}
+		}
+	}
+}
+
+// On failure, the previous pod list is kept.
+func (pd *PodDiscovery) refresh() error {
+	pods, err := pd.lister.ListPods(pd.context)
+	if err != nil {
+		return err
+	}
+
+	containers := make(map[string]*models.Container, 0)
+	var nodePods int
+	for _, pod := range pods {
+		// The API server only lists the node's pods, but a stand-in may not.
+		if pod.Spec.NodeName != "" && pod.Spec.NodeName != pd.config.NodeName {
+			continue
+		}
+
+		nodePods++
+		for id, container := range pod.containers() {
+			containers[id] = container
+		}
+	}
+
+	pd.lock.Lock()
+	pd.containers = containers
+	pd.lock.Unlock()
+
+	pd.logger.Debug("Refreshed node's pods", zap.Int("Pods", nodePods), zap.Int("Containers", len(containers)))
+	return nil
+}
+
+func (pd *PodDiscovery) PodContainer(containerId string) (*models.Container, bool) {
+	pd.lock.RLock()
+	defer pd.lock.RUnlock()
+
+	container, found := pd.containers[containerId]
+	return container, found
+}
+
+// Returns the processes which run in the node's pods, as of the last refresh.
+func (pd *PodDiscovery) PodProcesses(processes []*models.Process) []*models.Process {
+	podProcesses := make([]*models.Process, 0, len(processes))
+	for _, process := range processes {
+		if process.Container == nil {
+			continue
+		}
+
+		if _, found := pd.PodContainer(process.Container.ID); found {
+			podProcesses = append(podProcesses, process)
+		}
+	}
+	return podProcesses
+}
+
+func (pd *PodDiscovery) WaitUntilCompletion() {
+	pd.waitGroup.Wait()
+}
+
+func (pd *PodDiscovery) Stop() error {
+	pd.logger.Debug("Stop pod discovery")
+
+	pd.cancel()
+	return nil
+}
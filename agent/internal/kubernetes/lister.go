@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const apiServerRequestTimeout = time.Second * 10
+
+type PodLister interface {
+	ListPods(ctx context.Context) ([]*Pod, error)
+}
+
+func newPodLister(config *Config) (PodLister, error) {
+	if config.PodsFile != "" {
+		return &filePodLister{path: config.PodsFile}, nil
+	}
+	return newApiServerPodLister(config)
+}
+
+// Lists the pods bound to the node from the API server, selected by their "spec.nodeName" field (requires "list" of
+// "pods" to be authorized).
+type apiServerPodLister struct {
+	url        string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+func newApiServerPodLister(config *Config) (*apiServerPodLister, error) {
+	tlsConfig := &tls.Config{}
+	if config.ApiServerCaFile != "" {
+		caCertificates, err := ioutil.ReadFile(config.ApiServerCaFile)
+		if err != nil {
+			return nil, errors.WithMessage(err, "read api server ca file")
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertificates) {
+			return nil, errors.Errorf("no certificates found in api server ca file '%s'", config.ApiServerCaFile)
+		}
+	}
+
+	query := url.Values{"fieldSelector": []string{"spec.nodeName=" + config.NodeName}}
+	return &apiServerPodLister{
+		url:       strings.TrimSuffix(config.ApiServerUrl, "/") + "/api/v1/pods?" + query.Encode(),
+		tokenFile: config.ApiServerTokenFile,
+		httpClient: &http.Client{
+			Timeout:   apiServerRequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+func (apl *apiServerPodLister) ListPods(ctx context.Context) ([]*Pod, error) {
+	request, err := http.NewRequest(http.MethodGet, apl.url, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "new request")
+	}
+	request = request.WithContext(ctx)
+
+	if apl.tokenFile != "" {
+		// Read on every request, as projected service account tokens are rotated.
+		token, err := ioutil.ReadFile(apl.tokenFile)
+		if err != nil {
+			return nil, errors.WithMessage(err, "read api server token file")
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := apl.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list pods from api server")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected api server response status '%s'", response.Status)
+	}
+
+	var podList PodList
+	if err := json.NewDecoder(response.Body).Decode(&podList); err != nil {
+		return nil, errors.WithMessage(err, "decode pod list")
+	}
+	return podList.Items, nil
+}
+
+// Reads a pod list (in the API server's format) from a file.
+type filePodLister struct {
+	path string
+}
+
+func (fpl *filePodLister) ListPods(_ context.Context) ([]*Pod, error) {
+	data, err := ioutil.ReadFile(fpl.path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read pods file")
+	}
+
+	var podList PodList
+	if err := json.Unmarshal(data, &podList); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal pods file '%s'", fpl.path)
+	}
+	return podList.Items, nil
+}
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"github.com/memlab/agent/internal/client/models"
+	"strings"
+)
+
+// Pod is the subset of Kubernetes' v1.Pod the agent relies on, as listed by the API server.
+type Pod struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Uid       string            `json:"uid"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase                      string             `json:"phase"`
+		InitContainerStatuses      []*ContainerStatus `json:"initContainerStatuses"`
+		ContainerStatuses          []*ContainerStatus `json:"containerStatuses"`
+		EphemeralContainerStatuses []*ContainerStatus `json:"ephemeralContainerStatuses"`
+	} `json:"status"`
+}
+
+type ContainerStatus struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	ContainerId string `json:"containerID"` // "<runtime>://<id>", empty until the container is created.
+}
+
+type PodList struct {
+	Items []*Pod `json:"items"`
+}
+
+func (p *Pod) containerStatuses() []*ContainerStatus {
+	statuses := make([]*ContainerStatus, 0,
+		len(p.Status.InitContainerStatuses)+len(p.Status.ContainerStatuses)+len(p.Status.EphemeralContainerStatuses))
+	statuses = append(statuses, p.Status.InitContainerStatuses...)
+	statuses = append(statuses, p.Status.ContainerStatuses...)
+	return append(statuses, p.Status.EphemeralContainerStatuses...)
+}
+
+// Returns the pod's containers, keyed by their ids. Containers which weren't created yet are skipped.
+func (p *Pod) containers() map[string]*models.Container {
+	containers := make(map[string]*models.Container, 0)
+
+	for _, status := range p.containerStatuses() {
+		runtime, id := parseContainerId(status.ContainerId)
+		if id == "" {
+			continue
+		}
+
+		containers[id] = &models.Container{
+			Runtime:      runtime,
+			ID:           id,
+			Name:         status.Name,
+			Image:        status.Image,
+			PodName:      p.Metadata.Name,
+			PodNamespace: p.Metadata.Namespace,
+			PodUid:       p.Metadata.Uid,
+			PodLabels:    p.Metadata.Labels,
+		}
+	}
+
+	return containers
+}
+
+func parseContainerId(containerId string) (string, string) {
+	separatorIndex := strings.Index(containerId, "://")
+	if separatorIndex == -1 {
+		return "", containerId
+	}
+	return containerId[:separatorIndex], containerId[separatorIndex+len("://"):]
+}
@@ -0,0 +1,79 @@
+package logtail
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/containers"
+	"github.com/memlab/agent/internal/host"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Tails of the logs of the process, from the files it writes to, its journal and its container's log.
+type Tail struct {
+	Sources []*Source `json:"logs"`
+	Errors  []string  `json:"logs_errors,omitempty"` // Of sources which failed to be tailed.
+}
+
+func Collect(ctx context.Context, pid types.Pid, config *Config, redactor *redaction.Redactor) (*Tail, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate config")
+	}
+
+	var minTime time.Time
+	if config.MaxAge > 0 {
+		minTime = time.Now().Add(-config.MaxAge)
+	}
+
+	tail := &Tail{Sources: make([]*Source, 0)}
+	addSource := func(source *Source, err error) {
+		if err != nil {
+			tail.Errors = append(tail.Errors, err.Error())
+		} else if source != nil {
+			tail.Sources = append(tail.Sources, source)
+		}
+	}
+
+	if config.MaxFiles > 0 {
+		files, err := findWrittenFiles(pid)
+		if err != nil {
+			tail.Errors = append(tail.Errors, err.Error())
+		}
+		if len(files) > config.MaxFiles {
+			files = files[:config.MaxFiles]
+		}
+
+		for _, file := range files {
+			source, err := tailWrittenFile(pid, file, config)
+			addSource(source, errors.WithMessagef(err, "tail '%s'", file.target))
+		}
+	}
+
+	// Once the process exited, its cgroup is unknown, yet its own entries are still in the journal.
+	cgroupPath, err := host.ProcessCgroup(pid)
+	if err != nil {
+		tail.Errors = append(tail.Errors, err.Error())
+	}
+
+	container, err := containers.CgroupContainer(cgroupPath)
+	if err != nil {
+		tail.Errors = append(tail.Errors, errors.WithMessage(err, "get container").Error())
+	}
+	if container != nil {
+		if path := containerLogPath(container); path != "" {
+			addSource(tailContainerLog(path, minTime, config))
+		}
+	} else if config.JournalctlPath != "" { // Containers' units are the runtime's scopes, which don't log.
+		source, err := tailJournal(ctx, pid, host.SystemdUnitFromCgroup(cgroupPath), minTime, config)
+		addSource(source, errors.WithMessage(err, "tail journal"))
+	}
+
+	for _, source := range tail.Sources {
+		for _, line := range source.Lines {
+			line.Text = redactor.RedactText(line.Text)
+		}
+	}
+
+	return tail, nil
+}
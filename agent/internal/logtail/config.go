@@ -0,0 +1,28 @@
+package logtail
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	MaxLines       int           // Per source.
+	MaxAge         time.Duration // Of timestamped lines (of the journal and containers' logs), unlimited if 0.
+	MaxBytes       int64         // Read from the end of each source.
+	MaxFiles       int           // Files the process writes to, beyond which they're not tailed.
+	JournalctlPath string        // The journal isn't tailed if empty.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxLines <= 0 {
+		return false, errors.New("max lines must be positive")
+	} else if c.MaxAge < 0 {
+		return false, errors.New("negative max age")
+	} else if c.MaxBytes <= 0 {
+		return false, errors.New("max bytes must be positive")
+	} else if c.MaxFiles < 0 {
+		return false, errors.New("negative max files")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package logtail
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/containers"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Containers' log files, of runtimes' default log drivers, relative to the host's root.
+const (
+	dockerContainersDir  = "/var/lib/docker/containers"
+	podLogsDir           = "/var/log/pods"
+	containersStorageDir = "/var/lib/containers/storage/overlay-containers"
+)
+
+// Returns the log file of a container, or an empty path if it's not found (e.g, the runtime logs elsewhere).
+func containerLogPath(container *models.Container) string {
+	candidates := make([]string, 0)
+	switch {
+	case container.PodUid != "" && container.Name != "":
+		// e.g "/var/log/pods/<namespace>_<name>_<uid>/<container>/<restart count>.log", written by the kubelet's CRI
+		// runtime, of which the latest is of the running container.
+		candidates, _ = filepath.Glob(filepath.Join(podLogsDir, "*_"+container.PodUid, container.Name, "*.log"))
+	case container.Runtime == string(containers.RuntimeDocker):
+		candidates = []string{filepath.Join(dockerContainersDir, container.ID, container.ID+"-json.log")}
+	case container.Runtime == string(containers.RuntimePodman):
+		candidates = []string{filepath.Join(containersStorageDir, container.ID, "userdata", "ctr.log")}
+	}
+
+	var latestPath string
+	var latestModification time.Time
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err == nil && info.ModTime().After(latestModification) {
+			latestPath, latestModification = candidate, info.ModTime()
+		}
+	}
+	return latestPath
+}
+
+func tailContainerLog(path string, minTime time.Time, config *Config) (*Source, error) {
+	entries, truncated, err := readTail(path, config.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := parseCriLogEntry
+	if strings.HasSuffix(path, "-json.log") {
+		parse = parseDockerLogEntry
+	}
+
+	lines := make([]*Line, 0, len(entries))
+	var partialLine *Line
+	for _, entry := range entries {
+		line, partial, err := parse(entry)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse '%s'", path)
+		}
+
+		// Runtimes split long lines into partial entries, which are joined back.
+		if partialLine != nil {
+			partialLine.Text += line.Text
+			line = partialLine
+		}
+		if partial {
+			partialLine = line
+			continue
+		}
+		partialLine = nil
+		lines = append(lines, line)
+	}
+	if partialLine != nil { // Still being written.
+		lines = append(lines, partialLine)
+	}
+
+	lines, linesTruncated := limitLines(lines, config.MaxLines, minTime)
+	return &Source{
+		Type:      SourceTypeContainer,
+		Path:      path,
+		Lines:     lines,
+		Truncated: truncated || linesTruncated,
+	}, nil
+}
+
+// e.g {"log":"text\n","stream":"stdout","time":"2020-01-01T00:00:00.000000000Z"}, where lines without a trailing
+// newline are partial.
+func parseDockerLogEntry(entry string) (*Line, bool, error) {
+	var dockerEntry struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(entry), &dockerEntry); err != nil {
+		return nil, false, err
+	}
+
+	return &Line{
+		Timestamp: dockerEntry.Time,
+		Stream:    dockerEntry.Stream,
+		Text:      strings.TrimSuffix(dockerEntry.Log, "\n"),
+	}, !strings.HasSuffix(dockerEntry.Log, "\n"), nil
+}
+
+// e.g "2020-01-01T00:00:00.000000000Z stdout F text", where the tag is "P" for partial lines and "F" for full ones,
+// see the kubelet's CRI logging format.
+func parseCriLogEntry(entry string) (*Line, bool, error) {
+	fields := strings.SplitN(entry, " ", 4)
+	if len(fields) < 3 {
+		return nil, false, errors.Errorf("invalid entry '%s'", entry)
+	}
+
+	line := &Line{
+		Timestamp: fields[0],
+		Stream:    fields[1],
+	}
+	if len(fields) == 4 {
+		line.Text = fields[3]
+	}
+	return line, strings.HasPrefix(fields[2], "P"), nil
+}
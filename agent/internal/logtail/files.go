@@ -0,0 +1,144 @@
+package logtail
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Targets which are never logs, even if written to.
+var nonLogPrefixes = []string{"/dev/", "/proc/", "/sys/", "/memfd:"}
+
+type writtenFile struct {
+	fd     int
+	target string // e.g "/var/log/app.log", or "/var/log/app.log (deleted)" once rotated.
+}
+
+// Returns the regular files the process has open for writing, once each (e.g, when both stdout and stderr are
+// redirected to the same file), by fd.
+func findWrittenFiles(pid types.Pid) ([]*writtenFile, error) {
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list fds")
+	}
+
+	fdNumbers := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if fd, err := strconv.Atoi(entry.Name()); err == nil {
+			fdNumbers = append(fdNumbers, fd)
+		}
+	}
+	sort.Ints(fdNumbers)
+
+	files := make([]*writtenFile, 0)
+	seenFiles := make(map[[2]uint64]bool, 0)
+	for _, fdNumber := range fdNumbers {
+		fdPath := fmt.Sprintf("%s/%d", fdDir, fdNumber)
+		target, err := os.Readlink(fdPath)
+		if err != nil || !isLogCandidate(target) { // Closed meanwhile if failed.
+			continue
+		}
+
+		if writable, err := isOpenForWriting(pid, fdNumber); err != nil || !writable {
+			continue
+		}
+
+		// Stated through the fd, which resolves in the process' mount namespace, even once deleted.
+		info, err := os.Stat(fdPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		stat, isStat := info.Sys().(*syscall.Stat_t)
+		if !isStat {
+			continue
+		}
+		fileId := [2]uint64{uint64(stat.Dev), stat.Ino}
+		if seenFiles[fileId] {
+			continue
+		}
+		seenFiles[fileId] = true
+
+		files = append(files, &writtenFile{fd: fdNumber, target: target})
+	}
+
+	return files, nil
+}
+
+func isLogCandidate(target string) bool {
+	if !strings.HasPrefix(target, "/") {
+		return false // e.g, sockets, pipes and anonymous inodes.
+	}
+
+	for _, prefix := range nonLogPrefixes {
+		if strings.HasPrefix(target, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// e.g "flags:	02100001" in fdinfo, where flags are octal, see proc(5).
+func isOpenForWriting(pid types.Pid, fd int) (bool, error) {
+	path := fmt.Sprintf("/proc/%d/fdinfo/%d", pid, fd)
+	file, err := os.Open(path)
+	if err != nil {
+		return false, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "flags:" {
+			continue
+		}
+
+		flags, err := strconv.ParseInt(fields[1], 8, 64)
+		if err != nil {
+			return false, errors.WithMessagef(err, "parse flags of '%s'", path)
+		}
+		accessMode := flags & unix.O_ACCMODE
+		return accessMode == unix.O_WRONLY || accessMode == unix.O_RDWR, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return false, errors.Errorf("no flags in '%s'", path)
+}
+
+// Tails a file through the process' fd, so it's found in the process' mount namespace even once rotated. Files which
+// aren't text (e.g, databases) aren't logs, so nil is returned for them.
+func tailWrittenFile(pid types.Pid, file *writtenFile, config *Config) (*Source, error) {
+	textLines, truncated, err := readTail(fmt.Sprintf("/proc/%d/fd/%d", pid, file.fd), config.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]*Line, 0, len(textLines))
+	for _, text := range textLines {
+		if strings.IndexByte(text, 0) != -1 {
+			return nil, nil
+		}
+		lines = append(lines, &Line{Text: text})
+	}
+
+	// Lines of files aren't timestamped in a known format, so they're limited by count alone.
+	lines, linesTruncated := limitLines(lines, config.MaxLines, time.Time{})
+	return &Source{
+		Type:      SourceTypeFile,
+		Path:      file.target,
+		Lines:     lines,
+		Truncated: truncated || linesTruncated,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package logtail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Tails the journal of the process' systemd unit, or of the process itself (e.g, logging via syslog(3)) when it
+// doesn't run in one. Returns nil if journalctl isn't installed.
+func tailJournal(ctx context.Context, pid types.Pid, unit string, minTime time.Time,
+	config *Config) (*Source, error) {
+	args := []string{"--output=json", "--no-pager", "--quiet", fmt.Sprintf("--lines=%d", config.MaxLines)}
+	if !minTime.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", minTime.Unix()))
+	}
+	if unit != "" {
+		args = append(args, "--unit="+unit)
+	} else {
+		args = append(args, fmt.Sprintf("_PID=%d", pid))
+	}
+
+	output := &tailBuffer{maxBytes: int(config.MaxBytes)}
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, config.JournalctlPath, args...)
+	command.Stdout, command.Stderr = output, &stderr
+	if err := command.Run(); err != nil {
+		if execErr, isExecErr := err.(*exec.Error); isExecErr && execErr.Err == exec.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.WithMessagef(err, "run journalctl (stderr: '%s')", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	entries, truncated := splitLines(output.data, output.truncated)
+	lines := make([]*Line, 0, len(entries))
+	for _, entry := range entries {
+		line, err := parseJournalEntry([]byte(entry))
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return &Source{
+		Type:      SourceTypeJournal,
+		Unit:      unit,
+		Lines:     lines,
+		Truncated: truncated,
+	}, nil
+}
+
+// e.g {"__REALTIME_TIMESTAMP":"1600000000000000","MESSAGE":"text",...}, where the timestamp is in microseconds, and
+// messages which aren't valid UTF-8 are arrays of bytes, see systemd.journal-fields(7).
+func parseJournalEntry(data []byte) (*Line, error) {
+	var entry struct {
+		RealtimeTimestamp string          `json:"__REALTIME_TIMESTAMP"`
+		Message           json.RawMessage `json:"MESSAGE"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, errors.WithMessage(err, "parse journal entry")
+	}
+
+	line := &Line{}
+	if microseconds, err := strconv.ParseInt(entry.RealtimeTimestamp, 10, 64); err == nil {
+		line.Timestamp = time.Unix(0, microseconds*int64(time.Microsecond)).UTC().Format(time.RFC3339Nano)
+	}
+
+	if err := json.Unmarshal(entry.Message, &line.Text); err != nil {
+		var messageBytes []byte
+		var messageInts []int
+		if err := json.Unmarshal(entry.Message, &messageInts); err == nil {
+			for _, messageInt := range messageInts {
+				messageBytes = append(messageBytes, byte(messageInt))
+			}
+			line.Text = string(messageBytes)
+		}
+	}
+	return line, nil
+}
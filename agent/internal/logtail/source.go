@@ -0,0 +1,112 @@
+package logtail
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+type SourceType string
+
+const (
+	SourceTypeFile      SourceType = "file"
+	SourceTypeJournal   SourceType = "journal"
+	SourceTypeContainer SourceType = "container"
+)
+
+type Source struct {
+	Type      SourceType `json:"type"`
+	Path      string     `json:"path,omitempty"` // Of files and containers' logs, e.g "/var/log/app.log".
+	Unit      string     `json:"unit,omitempty"` // Of the journal, unless matched by pid.
+	Lines     []*Line    `json:"lines"`
+	Truncated bool       `json:"truncated,omitempty"` // Whether earlier lines were cut by the limits.
+}
+
+type Line struct {
+	Timestamp string `json:"timestamp,omitempty"` // RFC 3339, unless the source isn't timestamped.
+	Stream    string `json:"stream,omitempty"`    // e.g "stdout" or "stderr", of containers' logs.
+	Text      string `json:"text"`
+}
+
+// Reads the last bytes of a file, from the first line starting within them. Returns whether earlier lines were cut.
+func readTail(path string, maxBytes int64) ([]string, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "stat '%s'", path)
+	}
+
+	offset := info.Size() - maxBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	read, err := file.ReadAt(data, offset)
+	if err != nil && err != io.EOF { // Truncated meanwhile (e.g, rotated) if EOF.
+		return nil, false, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	lines, truncated := splitLines(data[:read], offset > 0)
+	return lines, truncated, nil
+}
+
+// Splits data into lines, dropping the first one if it's partial (i.e, data starts mid-file).
+func splitLines(data []byte, partial bool) ([]string, bool) {
+	if partial {
+		newline := bytes.IndexByte(data, '\n')
+		if newline == -1 {
+			return make([]string, 0), true
+		}
+		data = data[newline+1:]
+	}
+
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return make([]string, 0), partial
+	}
+	return strings.Split(text, "\n"), partial
+}
+
+// Keeps the last lines, and those newer than the min time (if set), of lines in chronological order.
+func limitLines(lines []*Line, maxLines int, minTime time.Time) ([]*Line, bool) {
+	truncated := false
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+		truncated = true
+	}
+
+	if minTime.IsZero() {
+		return lines, truncated
+	}
+	for i, line := range lines {
+		lineTime, err := time.Parse(time.RFC3339Nano, line.Timestamp)
+		if err != nil || !lineTime.Before(minTime) {
+			return lines[i:], truncated || i > 0
+		}
+	}
+	return make([]*Line, 0), len(lines) > 0 || truncated
+}
+
+// Keeps the last bytes written to it.
+type tailBuffer struct {
+	data      []byte
+	maxBytes  int
+	truncated bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if excess := len(t.data) - t.maxBytes; excess > 0 {
+		t.data = t.data[excess:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
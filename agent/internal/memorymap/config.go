@@ -0,0 +1,17 @@
+package memorymap
+
+import (
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	MaxTopConsumers int // Of each of the top files and mappings.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxTopConsumers <= 0 {
+		return false, errors.New("max top consumers must be positive")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,34 @@
+package memorymap
+
+import (
+	"strings"
+)
+
+type Region string
+
+const (
+	RegionHeap         Region = "heap" // Of brk(2), which allocators besides malloc's main arena don't use.
+	RegionStack        Region = "stack"
+	RegionAnonymous    Region = "anonymous" // e.g mmap(2)ed heaps, and stacks of threads besides the main one.
+	RegionFile         Region = "file"
+	RegionSharedMemory Region = "shared_memory" // SysV, memfd and /dev/shm segments.
+	RegionKernel       Region = "kernel"        // e.g vdso.
+)
+
+func classifyRegion(path string) Region {
+	switch {
+	case path == "[heap]":
+		return RegionHeap
+	case path == "[stack]" || strings.HasPrefix(path, "[stack:"):
+		return RegionStack
+	case path == "" || strings.HasPrefix(path, "[anon:") || strings.HasPrefix(path, "[anon_shmem:"):
+		return RegionAnonymous
+	case strings.HasPrefix(path, "/SYSV") || strings.HasPrefix(path, "/memfd:") ||
+		strings.HasPrefix(path, "/dev/shm/"):
+		return RegionSharedMemory
+	case strings.HasPrefix(path, "/"):
+		return RegionFile
+	default:
+		return RegionKernel
+	}
+}
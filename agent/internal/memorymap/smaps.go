@@ -0,0 +1,145 @@
+package memorymap
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mapping is a memory mapping of a process, along with its usage.
+type Mapping struct {
+	Addresses string `json:"addresses"` // e.g "7f0a1c000000-7f0a1c021000".
+	Perms     string `json:"perms"`
+	Path      string `json:"path,omitempty"` // Or a pseudo path, e.g "[heap]".
+	Region    Region `json:"region"`
+	Usage
+}
+
+// Reads the usage of each of the process' mappings, from /proc/<pid>/smaps.
+func ReadMappings(pid types.Pid) ([]*Mapping, error) {
+	mappings := make([]*Mapping, 0)
+	err := scanSmaps(fmt.Sprintf("/proc/%d/smaps", pid), func(header string) (*Usage, error) {
+		mapping, err := parseMappingHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+		return &mapping.Usage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// Reads the process' total usage from /proc/<pid>/smaps_rollup, whose Pss is more accurate than the sum of its
+// mappings', or sums the given mappings' on kernels preceding it (4.14).
+func ReadRollup(pid types.Pid, mappings []*Mapping) (*Usage, error) {
+	var rollup *Usage
+	err := scanSmaps(fmt.Sprintf("/proc/%d/smaps_rollup", pid), func(_ string) (*Usage, error) {
+		rollup = &Usage{}
+		return rollup, nil
+	})
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	if rollup == nil {
+		rollup = &Usage{}
+		for _, mapping := range mappings {
+			rollup.Add(&mapping.Usage)
+		}
+		return rollup, nil
+	}
+
+	// The rollup lacks the virtual size.
+	rollup.Size = 0
+	for _, mapping := range mappings {
+		rollup.Size += mapping.Size
+	}
+	return rollup, nil
+}
+
+// Scans an smaps file, where each mapping's header line is followed by its fields, e.g "Rss:   1024 kB". Fields are
+// counted into the usage returned for their header.
+func scanSmaps(path string, onHeader func(header string) (*Usage, error)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	var usage *Usage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if !strings.HasSuffix(fields[0], ":") {
+			if usage != nil {
+				usage.computeFileBacked()
+			}
+			if usage, err = onHeader(line); err != nil {
+				return errors.WithMessagef(err, "parse '%s' line '%s'", path, line)
+			}
+			continue
+		}
+
+		if usage == nil {
+			return errors.Errorf("field preceding a header in '%s'", path)
+		}
+		counter := usage.counter(strings.TrimSuffix(fields[0], ":"))
+		if counter == nil || len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return errors.WithMessagef(err, "parse '%s' line '%s'", path, line)
+		}
+		*counter = value * 1024
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	if usage != nil {
+		usage.computeFileBacked()
+	}
+	return nil
+}
+
+// e.g "7f0a1c000000-7f0a1c021000 rw-p 00000000 00:00 0    [heap]".
+func parseMappingHeader(header string) (*Mapping, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 5 || !strings.Contains(fields[0], "-") {
+		return nil, errors.New("invalid mapping header")
+	}
+
+	// Paths may contain spaces, so the path is everything following the inode.
+	path := header
+	for i := 0; i < 5 && path != ""; i++ {
+		path = strings.TrimLeft(path, " ")
+		if separatorIndex := strings.IndexByte(path, ' '); separatorIndex != -1 {
+			path = path[separatorIndex:]
+		} else {
+			path = ""
+		}
+	}
+	path = strings.TrimSpace(path)
+
+	return &Mapping{
+		Addresses: fields[0],
+		Perms:     fields[1],
+		Path:      path,
+		Region:    classifyRegion(path),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package memorymap
+
+// Usage is the memory usage of mappings, in bytes, as reported by /proc/<pid>/smaps.
+type Usage struct {
+	Size         uint64 `json:"size"` // Virtual.
+	Rss          uint64 `json:"rss"`
+	Pss          uint64 `json:"pss"` // Rss, with shared pages divided among the processes sharing them.
+	SharedClean  uint64 `json:"shared_clean"`
+	SharedDirty  uint64 `json:"shared_dirty"`
+	PrivateClean uint64 `json:"private_clean"`
+	PrivateDirty uint64 `json:"private_dirty"`
+	Anonymous    uint64 `json:"anonymous"`
+	FileBacked   uint64 `json:"file_backed"` // Resident pages which aren't anonymous, e.g page cache.
+	Swap         uint64 `json:"swap"`
+	SwapPss      uint64 `json:"swap_pss"`
+	Locked       uint64 `json:"locked"`
+}
+
+// Footprint is the memory attributed to mappings when ranking them, including what was swapped out.
+func (u *Usage) Footprint() uint64 {
+	return u.Rss + u.Swap
+}
+
+func (u *Usage) Add(other *Usage) {
+	u.Size += other.Size
+	u.Rss += other.Rss
+	u.Pss += other.Pss
+	u.SharedClean += other.SharedClean
+	u.SharedDirty += other.SharedDirty
+	u.PrivateClean += other.PrivateClean
+	u.PrivateDirty += other.PrivateDirty
+	u.Anonymous += other.Anonymous
+	u.FileBacked += other.FileBacked
+	u.Swap += other.Swap
+	u.SwapPss += other.SwapPss
+	u.Locked += other.Locked
+}
+
+// Returns the usage's counter of an smaps field, or nil if it isn't counted.
+func (u *Usage) counter(field string) *uint64 {
+	switch field {
+	case "Size":
+		return &u.Size
+	case "Rss":
+		return &u.Rss
+	case "Pss":
+		return &u.Pss
+	case "Shared_Clean":
+		return &u.SharedClean
+	case "Shared_Dirty":
+		return &u.SharedDirty
+	case "Private_Clean":
+		return &u.PrivateClean
+	case "Private_Dirty":
+		return &u.PrivateDirty
+	case "Anonymous":
+		return &u.Anonymous
+	case "Swap":
+		return &u.Swap
+	case "SwapPss":
+		return &u.SwapPss
+	case "Locked":
+		return &u.Locked
+	default:
+		return nil
+	}
+}
+
+// Anonymous pages may be shared (e.g, after fork), while shmem pages are counted as file backed.
+func (u *Usage) computeFileBacked() {
+	if u.Rss > u.Anonymous {
+		u.FileBacked = u.Rss - u.Anonymous
+	}
+}
@@ -0,0 +1,162 @@
+package operators
+
+import (
+	"github.com/memlab/agent/internal/customcommand"
+	"github.com/memlab/agent/internal/fds"
+	"github.com/memlab/agent/internal/goruntime"
+	"github.com/memlab/agent/internal/hostsnapshot"
+	"github.com/memlab/agent/internal/jvm"
+	"github.com/memlab/agent/internal/kmsg"
+	"github.com/memlab/agent/internal/logtail"
+	"github.com/memlab/agent/internal/memorymap"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/stacktrace"
+	"github.com/memlab/agent/internal/threads"
+	"github.com/pkg/errors"
+)
+
+// Config enables optional operators, which run after the default ones. Nil operator configs are disabled.
+type Config struct {
+	StackTraces    *stacktrace.Config
+	GoRuntime      *goruntime.Config
+	Jvm            *jvm.Config
+	MemoryMap      *memorymap.Config
+	Fds            *fds.Config
+	Threads        *threads.Config
+	HostSnapshot   *hostsnapshot.Config
+	Logs           *logtail.Config
+	KernelMessages *kmsg.Config
+	CustomCommands *customcommand.Config
+	Environment    bool // Has no config of its own.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MemoryMap != nil {
+		if valid, err := c.MemoryMap.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate memory map config")
+		}
+	}
+	if c.Fds != nil {
+		if valid, err := c.Fds.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate fds config")
+		}
+	}
+	if c.Threads != nil {
+		if valid, err := c.Threads.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate threads config")
+		}
+	}
+	if c.StackTraces != nil {
+		if valid, err := c.StackTraces.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate stack traces config")
+		}
+	}
+	if c.Logs != nil {
+		if valid, err := c.Logs.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate logs config")
+		}
+	}
+	if c.HostSnapshot != nil {
+		if valid, err := c.HostSnapshot.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate host snapshot config")
+		}
+	}
+	if c.KernelMessages != nil {
+		if valid, err := c.KernelMessages.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate kernel messages config")
+		}
+	}
+	if c.GoRuntime != nil {
+		if valid, err := c.GoRuntime.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate go runtime config")
+		}
+	}
+	if c.Jvm != nil {
+		if valid, err := c.Jvm.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate jvm config")
+		}
+	}
+	if c.CustomCommands != nil {
+		if valid, err := c.CustomCommands.Valid(); !valid {
+			return false, errors.WithMessage(err, "validate custom commands config")
+		}
+	}
+
+	return true, nil
+}
+
+// Returns the operators to run when a signal is caught, in order. Secrets in their reports are redacted by the given
+// redactor, if any.
+func (c *Config) SignalOperators(machineId string, redactor *redaction.Redactor) []Operator {
+	signalOperators := []Operator{
+		&CollectMetadata{MachineId: machineId, Redactor: redactor},
+	}
+
+	if c.Environment {
+		signalOperators = append(signalOperators, &CollectEnvironment{Redactor: redactor})
+	}
+	if c.MemoryMap != nil {
+		signalOperators = append(signalOperators, &CollectMemoryMap{Config: c.MemoryMap})
+	}
+	if c.Fds != nil {
+		signalOperators = append(signalOperators, &CollectFds{Config: c.Fds})
+	}
+	if c.Threads != nil { // Before stack traces, which stop threads.
+		signalOperators = append(signalOperators, &CollectThreads{Config: c.Threads})
+	}
+	if c.StackTraces != nil {
+		signalOperators = append(signalOperators, &CollectStackTraces{Config: c.StackTraces})
+	}
+	if c.CustomCommands != nil && c.CustomCommands.HoldSignal { // Before slower operators use up the hold budget.
+		signalOperators = append(signalOperators, c.customCommandsOperator(redactor, customcommand.DetectionTypeSignal))
+	}
+	if c.Logs != nil {
+		signalOperators = append(signalOperators, &CollectLogs{Config: c.Logs, Redactor: redactor})
+	}
+	if c.HostSnapshot != nil {
+		signalOperators = append(signalOperators, &CollectHostSnapshot{Config: c.HostSnapshot})
+	}
+	if c.KernelMessages != nil { // Late, giving the kernel time to log about the signal.
+		signalOperators = append(signalOperators, &CollectKernelMessages{Config: c.KernelMessages})
+	}
+	if c.GoRuntime != nil {
+		signalOperators = append(signalOperators, &CollectGoRuntime{Config: c.GoRuntime})
+	}
+	if c.Jvm != nil {
+		signalOperators = append(signalOperators, &CollectJvmDiagnostics{Config: c.Jvm})
+	}
+	if c.CustomCommands != nil && !c.CustomCommands.HoldSignal {
+		signalOperators = append(signalOperators, c.customCommandsOperator(redactor, customcommand.DetectionTypeSignal))
+	}
+
+	return signalOperators
+}
+
+// Returns the operators to run when a process is OOM killed, in order. The process is gone by then, so only operators
+// which describe it from the outside are run.
+func (c *Config) OomKillOperators(_ string, redactor *redaction.Redactor) []Operator {
+	oomKillOperators := make([]Operator, 0)
+
+	if c.KernelMessages != nil {
+		oomKillOperators = append(oomKillOperators, &CollectKernelMessages{Config: c.KernelMessages})
+	}
+	if c.Logs != nil {
+		oomKillOperators = append(oomKillOperators, &CollectLogs{Config: c.Logs, Redactor: redactor})
+	}
+	if c.HostSnapshot != nil {
+		oomKillOperators = append(oomKillOperators, &CollectHostSnapshot{Config: c.HostSnapshot})
+	}
+	if c.CustomCommands != nil {
+		oomKillOperators = append(oomKillOperators, c.customCommandsOperator(redactor, customcommand.DetectionTypeOomKill))
+	}
+
+	return oomKillOperators
+}
+
+func (c *Config) customCommandsOperator(redactor *redaction.Redactor, detectionType string) *RunCustomCommands {
+	return &RunCustomCommands{
+		Config:        c.CustomCommands,
+		Redactor:      redactor,
+		DetectionType: detectionType,
+	}
+}
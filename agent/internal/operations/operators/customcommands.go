@@ -0,0 +1,44 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/customcommand"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type RunCustomCommands struct {
+	Config        *customcommand.Config
+	Redactor      *redaction.Redactor
+	DetectionType string // Passed to commands, e.g customcommand.DetectionTypeSignal.
+}
+
+func (r *RunCustomCommands) OperatorName() string {
+	return "run-custom-commands-operator"
+}
+
+func (r *RunCustomCommands) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	detection := &customcommand.Detection{
+		Type:      r.DetectionType,
+		Pid:       handle.Pid(),
+		StartTime: handle.StartTime(),
+	}
+
+	results, err := customcommand.RunCommands(ctx, detection, r.Config, r.Redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.CustomCommandsReport{Results: results}, nil
+}
+
+func (r *RunCustomCommands) FailPipelineOnError() bool {
+	return false
+}
+
+// Commands which hold the signal are cancelled once it's released, e.g to core dump the process as it was.
+func (r *RunCustomCommands) RunsAfterSignalRelease() bool {
+	return !r.Config.HoldSignal || r.DetectionType != customcommand.DetectionTypeSignal
+}
@@ -0,0 +1,35 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/procenv"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectEnvironment struct {
+	Redactor *redaction.Redactor
+}
+
+func (c *CollectEnvironment) OperatorName() string {
+	return "collect-environment-operator"
+}
+
+func (c *CollectEnvironment) Operate(_ context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	snapshot, err := procenv.TakeSnapshot(handle.Pid(), c.Redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.EnvironmentReport{Snapshot: snapshot}, nil
+}
+
+func (c *CollectEnvironment) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectEnvironment) RunsAfterSignalRelease() bool {
+	return false // Credentials should be the ones the process had when the signal was caught.
+}
@@ -0,0 +1,34 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/fds"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectFds struct {
+	Config *fds.Config
+}
+
+func (c *CollectFds) OperatorName() string {
+	return "collect-fds-operator"
+}
+
+func (c *CollectFds) Operate(_ context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	inventory, err := fds.CollectInventory(handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.FdsReport{Inventory: inventory}, nil
+}
+
+func (c *CollectFds) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectFds) RunsAfterSignalRelease() bool {
+	return false // Fds should be listed as they were when the signal was caught, before handlers close them.
+}
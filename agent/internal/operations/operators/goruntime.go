@@ -0,0 +1,34 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/goruntime"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectGoRuntime struct {
+	Config *goruntime.Config
+}
+
+func (c *CollectGoRuntime) OperatorName() string {
+	return "collect-go-runtime-operator"
+}
+
+func (c *CollectGoRuntime) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	goRuntime, err := goruntime.Collect(ctx, handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.GoRuntimeReport{Runtime: goRuntime}, nil
+}
+
+func (c *CollectGoRuntime) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectGoRuntime) RunsAfterSignalRelease() bool {
+	return true // The runtime serves its endpoint from threads which may be stopped while the signal is held.
+}
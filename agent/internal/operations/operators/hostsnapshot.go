@@ -0,0 +1,34 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/hostsnapshot"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectHostSnapshot struct {
+	Config *hostsnapshot.Config
+}
+
+func (c *CollectHostSnapshot) OperatorName() string {
+	return "collect-host-snapshot-operator"
+}
+
+func (c *CollectHostSnapshot) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	snapshot, err := hostsnapshot.Collect(ctx, handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.HostSnapshotReport{Snapshot: snapshot}, nil
+}
+
+func (c *CollectHostSnapshot) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectHostSnapshot) RunsAfterSignalRelease() bool {
+	return true // Describes the host rather than the process, and CPU usage is sampled over a while.
+}
@@ -0,0 +1,34 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/jvm"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectJvmDiagnostics struct {
+	Config *jvm.Config
+}
+
+func (c *CollectJvmDiagnostics) OperatorName() string {
+	return "collect-jvm-diagnostics-operator"
+}
+
+func (c *CollectJvmDiagnostics) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	diagnostics, err := jvm.Collect(ctx, handle, c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.JvmReport{Diagnostics: diagnostics}, nil
+}
+
+func (c *CollectJvmDiagnostics) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectJvmDiagnostics) RunsAfterSignalRelease() bool {
+	return true // Commands run at safepoints, which the JVM can't reach while a thread's signal is held.
+}
@@ -0,0 +1,34 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/kmsg"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectKernelMessages struct {
+	Config *kmsg.Config
+}
+
+func (c *CollectKernelMessages) OperatorName() string {
+	return "collect-kernel-messages-operator"
+}
+
+func (c *CollectKernelMessages) Operate(_ context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	processMessages, err := kmsg.CollectProcessMessages(handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.KernelMessagesReport{ProcessMessages: processMessages}, nil
+}
+
+func (c *CollectKernelMessages) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectKernelMessages) RunsAfterSignalRelease() bool {
+	return true // Messages are kept by the kernel, and some are only logged once the signal is delivered.
+}
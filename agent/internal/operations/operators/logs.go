@@ -0,0 +1,36 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/logtail"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectLogs struct {
+	Config   *logtail.Config
+	Redactor *redaction.Redactor
+}
+
+func (c *CollectLogs) OperatorName() string {
+	return "collect-logs-operator"
+}
+
+func (c *CollectLogs) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	tail, err := logtail.Collect(ctx, handle.Pid(), c.Config, c.Redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.LogsReport{Tail: tail}, nil
+}
+
+func (c *CollectLogs) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectLogs) RunsAfterSignalRelease() bool {
+	return true // Lines logged once the signal is released (e.g, a crash's trace) are worth as much.
+}
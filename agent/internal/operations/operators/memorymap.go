@@ -0,0 +1,29 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/memorymap"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+)
+
+type CollectMemoryMap struct {
+	Config *memorymap.Config
+}
+
+func (c *CollectMemoryMap) OperatorName() string {
+	return "collect-memory-map-operator"
+}
+
+func (c *CollectMemoryMap) Operate(_ context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	return postdetection.NewMemoryMapReport(handle.Pid(), c.Config)
+}
+
+func (c *CollectMemoryMap) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectMemoryMap) RunsAfterSignalRelease() bool {
+	return false // Memory should be broken down as it was when the signal was caught.
+}
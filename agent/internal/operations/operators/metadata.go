@@ -2,20 +2,26 @@ package operators
 
 import (
 	"context"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/redaction"
 	"github.com/memlab/agent/internal/reports"
 	"github.com/memlab/agent/internal/reports/postdetection"
-	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"github.com/shirou/gopsutil/process"
 )
 
-type CollectMetadata struct{}
+type CollectMetadata struct {
+	MachineId string // As the control plane identifies the host, e.g the node's name in a Kubernetes cluster.
+	Redactor  *redaction.Redactor
+}
 
 func (c *CollectMetadata) OperatorName() string {
 	return "collect-metadata-operator"
 }
 
-func (c *CollectMetadata) Operate(ctx context.Context, pid types.Pid) (reports.Report, error) {
+func (c *CollectMetadata) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	pid := handle.Pid()
+
 	ps, err := process.NewProcess(int32(pid))
 	if err != nil {
 		if errors.Cause(err) == process.ErrorProcessNotRunning {
@@ -25,9 +31,19 @@ func (c *CollectMetadata) Operate(ctx context.Context, pid types.Pid) (reports.R
 		return nil, err
 	}
 
-	return postdetection.NewMetadataReport(ctx, pid, ps)
+	report, err := postdetection.NewMetadataReport(ctx, c.MachineId, pid, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	report.CmdLine = c.Redactor.RedactCommandLine(report.CmdLine)
+	return report, nil
 }
 
 func (c *CollectMetadata) FailPipelineOnError() bool {
 	return false
 }
+
+func (c *CollectMetadata) RunsAfterSignalRelease() bool {
+	return false // Metadata should reflect the process as it was when the signal was caught.
+}
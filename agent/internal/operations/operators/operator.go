@@ -2,12 +2,17 @@ package operators
 
 import (
 	"context"
+	"github.com/memlab/agent/internal/prochandle"
 	"github.com/memlab/agent/internal/reports"
-	"github.com/memlab/agent/internal/types"
 )
 
 type Operator interface {
 	OperatorName() string
-	Operate(ctx context.Context, pid types.Pid) (reports.Report, error)
+	// Process handle is verified by the pipeline before and after operating, see prochandle.Handle.Verify().
+	Operate(ctx context.Context, process *prochandle.Handle) (reports.Report, error)
 	FailPipelineOnError() bool
+
+	// Whether operator may keep running after the kernel module released the held signal, in which case the
+	// process might already be handling it (or be gone).
+	RunsAfterSignalRelease() bool
 }
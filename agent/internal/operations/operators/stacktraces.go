@@ -0,0 +1,37 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+	"github.com/memlab/agent/internal/stacktrace"
+)
+
+type CollectStackTraces struct {
+	Config *stacktrace.Config
+}
+
+func (c *CollectStackTraces) OperatorName() string {
+	return "collect-stack-traces-operator"
+}
+
+func (c *CollectStackTraces) Operate(ctx context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	threadStacks, omittedThreads, err := stacktrace.CollectThreadStacks(ctx, handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.StackTracesReport{
+		Threads:        threadStacks,
+		OmittedThreads: omittedThreads,
+	}, nil
+}
+
+func (c *CollectStackTraces) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectStackTraces) RunsAfterSignalRelease() bool {
+	return false // Stacks should show where threads were when the signal was caught, e.g the faulting instruction.
+}
@@ -0,0 +1,38 @@
+package operators
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/reports"
+	"github.com/memlab/agent/internal/reports/postdetection"
+	"github.com/memlab/agent/internal/threads"
+)
+
+type CollectThreads struct {
+	Config *threads.Config
+}
+
+func (c *CollectThreads) OperatorName() string {
+	return "collect-threads-operator"
+}
+
+func (c *CollectThreads) Operate(_ context.Context, handle *prochandle.Handle) (reports.Report, error) {
+	processThreads, summary, omittedThreads, err := threads.CollectThreads(handle.Pid(), c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postdetection.ThreadsReport{
+		Threads:        processThreads,
+		OmittedThreads: omittedThreads,
+		Summary:        summary,
+	}, nil
+}
+
+func (c *CollectThreads) FailPipelineOnError() bool {
+	return false
+}
+
+func (c *CollectThreads) RunsAfterSignalRelease() bool {
+	return false // Threads should be in the states they were in when the signal was caught.
+}
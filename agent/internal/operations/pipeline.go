@@ -3,8 +3,8 @@ package operations
 import (
 	"context"
 	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/prochandle"
 	"github.com/memlab/agent/internal/reports"
-	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"time"
@@ -37,8 +37,15 @@ func (p *Pipeline) AddOperators(ops ...operators.Operator) {
 	p.operators = append(p.operators, ops...)
 }
 
-func (p *Pipeline) Run(pid types.Pid) (map[string]interface{}, error) {
-	mergedReportsDump, err := p.runOperators(pid)
+func (p *Pipeline) Run(process *prochandle.Handle) (map[string]interface{}, error) {
+	return p.RunHeld(process, nil)
+}
+
+// Runs operators while the kernel module holds a caught signal. Once holdReleased is closed, operators which cannot
+// run after the signal is released are cancelled (if running) or skipped, while the rest keep running.
+func (p *Pipeline) RunHeld(process *prochandle.Handle, holdReleased <-chan struct{}) (map[string]interface{},
+	error) {
+	mergedReportsDump, err := p.runOperators(process, holdReleased)
 	if err != nil {
 		return nil, err
 	}
@@ -46,22 +53,37 @@ func (p *Pipeline) Run(pid types.Pid) (map[string]interface{}, error) {
 	return mergedReportsDump, nil
 }
 
-func (p *Pipeline) runOperators(pid types.Pid) (map[string]interface{}, error) {
+// Operators are only run while the handle still refers to the process the pipeline was started for, and their reports
+// are dropped if it stopped doing so by the time they're done, as they might describe an unrelated process.
+func (p *Pipeline) runOperators(process *prochandle.Handle, holdReleased <-chan struct{}) (map[string]interface{},
+	error) {
 	allReports := make([]reports.Report, 0)
 
 	for _, operator := range p.operators {
-		operatorContext, cancelOperator := context.WithTimeout(p.context, defaultOperatorContextTimeout)
+		funcLogger := p.logger.With(zap.String("OperatorName", operator.OperatorName()))
 
-		report, err := operator.Operate(operatorContext, pid)
-		if err != nil {
-			cancelOperator()
+		if !operator.RunsAfterSignalRelease() && isClosed(holdReleased) {
+			funcLogger.Warn("Skip operator since signal hold was released")
+			continue
+		}
 
-			p.logger.Error("Operator failed", zap.String("OperatorName", operator.OperatorName()),
-				zap.Bool("FailPipelineOnError", operator.FailPipelineOnError()), zap.Error(err))
+		if err := verifyProcess(operator, process); err != nil {
+			funcLogger.Warn("Stop running operators since process is gone", zap.Error(err))
+			break
+		}
+
+		report, err := p.runOperator(operator, process, holdReleased)
+		if err == nil {
+			err = verifyProcess(operator, process)
+		}
+		if err != nil {
+			funcLogger.Error("Operator failed", zap.Bool("FailPipelineOnError", operator.FailPipelineOnError()),
+				zap.Error(err))
 
 			if operator.FailPipelineOnError() {
 				return nil, ErrOperatorFailure
 			}
+			continue
 		}
 
 		allReports = append(allReports, report)
@@ -70,6 +92,47 @@ func (p *Pipeline) runOperators(pid types.Pid) (map[string]interface{}, error) {
 	return reports.MergeReports(allReports...)
 }
 
+func (p *Pipeline) runOperator(operator operators.Operator, process *prochandle.Handle,
+	holdReleased <-chan struct{}) (reports.Report, error) {
+	operatorContext, cancelOperator := context.WithTimeout(p.context, defaultOperatorContextTimeout)
+	defer cancelOperator()
+
+	if !operator.RunsAfterSignalRelease() {
+		go func() {
+			select {
+			case <-holdReleased: // Never fires for a nil channel.
+				cancelOperator()
+			case <-operatorContext.Done():
+			}
+		}()
+	}
+
+	return operator.Operate(operatorContext, process)
+}
+
+// Operators which run after the signal is released may outlive the process (e.g, when the signal is fatal), yet must
+// never look at a process which reused its pid.
+func verifyProcess(operator operators.Operator, process *prochandle.Handle) error {
+	err := process.Verify()
+	if operator.RunsAfterSignalRelease() && errors.Cause(err) == prochandle.ErrProcessExited {
+		return nil
+	}
+	return err
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	if ch == nil {
+		return false
+	}
+
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Pipeline) Abort() error {
 	p.cancel()
 	return nil
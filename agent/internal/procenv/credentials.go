@@ -0,0 +1,166 @@
+package procenv
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Capabilities by bit, as in include/uapi/linux/capability.h.
+var capabilityNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID",
+	"CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN",
+	"CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE", "CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+type Ids struct {
+	Real       int `json:"real"`
+	Effective  int `json:"effective"`
+	Saved      int `json:"saved"`
+	Filesystem int `json:"filesystem"`
+}
+
+// Capability sets, by their names (or bits, for ones newer than the agent).
+type Capabilities struct {
+	Inheritable []string `json:"inheritable"`
+	Permitted   []string `json:"permitted"`
+	Effective   []string `json:"effective"`
+	Bounding    []string `json:"bounding"`
+	Ambient     []string `json:"ambient"`
+}
+
+type Credentials struct {
+	Uids         *Ids          `json:"uids"`
+	Gids         *Ids          `json:"gids"`
+	Groups       []int         `json:"groups"`
+	Capabilities *Capabilities `json:"capabilities"`
+	NoNewPrivs   bool          `json:"no_new_privs"`
+	Seccomp      string        `json:"seccomp,omitempty"` // e.g "filter".
+}
+
+var seccompModes = map[string]string{
+	"0": "disabled",
+	"1": "strict",
+	"2": "filter",
+}
+
+// Reads the process' credentials from /proc/<pid>/status, e.g "Uid:	1000	1000	1000	1000" and
+// "CapEff:	0000000000000000".
+func ReadCredentials(pid types.Pid) (*Credentials, error) {
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	credentials := &Credentials{
+		Groups:       make([]int, 0),
+		Capabilities: &Capabilities{},
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, fields := parts[0], strings.Fields(parts[1])
+
+		switch key {
+		case "Uid":
+			credentials.Uids, err = parseIds(fields)
+		case "Gid":
+			credentials.Gids, err = parseIds(fields)
+		case "Groups":
+			credentials.Groups, err = parseGroups(fields)
+		case "CapInh":
+			credentials.Capabilities.Inheritable, err = parseCapabilities(fields)
+		case "CapPrm":
+			credentials.Capabilities.Permitted, err = parseCapabilities(fields)
+		case "CapEff":
+			credentials.Capabilities.Effective, err = parseCapabilities(fields)
+		case "CapBnd":
+			credentials.Capabilities.Bounding, err = parseCapabilities(fields)
+		case "CapAmb":
+			credentials.Capabilities.Ambient, err = parseCapabilities(fields)
+		case "NoNewPrivs":
+			credentials.NoNewPrivs = len(fields) == 1 && fields[0] == "1"
+		case "Seccomp":
+			if len(fields) == 1 {
+				credentials.Seccomp = seccompModes[fields[0]]
+			}
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse '%s' line '%s'", path, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	if credentials.Uids == nil || credentials.Gids == nil {
+		return nil, errors.Errorf("missing ids in '%s'", path)
+	}
+	return credentials, nil
+}
+
+func parseIds(fields []string) (*Ids, error) {
+	if len(fields) != 4 {
+		return nil, errors.New("expected 4 ids")
+	}
+
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return &Ids{Real: values[0], Effective: values[1], Saved: values[2], Filesystem: values[3]}, nil
+}
+
+func parseGroups(fields []string) ([]int, error) {
+	groups := make([]int, 0, len(fields))
+	for _, field := range fields {
+		group, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func parseCapabilities(fields []string) ([]string, error) {
+	if len(fields) != 1 {
+		return nil, errors.New("expected a capabilities mask")
+	}
+
+	mask, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := make([]string, 0)
+	for bit := uint(0); bit < 64; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+
+		if int(bit) < len(capabilityNames) {
+			capabilities = append(capabilities, capabilityNames[bit])
+		} else {
+			capabilities = append(capabilities, fmt.Sprintf("CAP_%d", bit))
+		}
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,34 @@
+package procenv
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// Returns the process' initial environment, as changes made by the process after it started aren't reflected.
+func ReadEnvironment(pid types.Pid) (map[string]string, error) {
+	path := fmt.Sprintf("/proc/%d/environ", pid)
+	environ, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	environment := make(map[string]string, 0)
+	for _, entry := range bytes.Split(environ, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+
+		// Entries without a separator are kept, as the process may have written them.
+		parts := bytes.SplitN(entry, []byte("="), 2)
+		if len(parts) == 2 {
+			environment[string(parts[0])] = string(parts[1])
+		} else {
+			environment[string(parts[0])] = ""
+		}
+	}
+	return environment, nil
+}
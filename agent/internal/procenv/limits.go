@@ -0,0 +1,84 @@
+package procenv
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+const LimitOpenFiles = "Max open files"
+
+// e.g "Max open files            1024                 524288               files", where units may be missing.
+var limitPattern = regexp.MustCompile(`^(.+?)\s{2,}(\S+)\s+(\S+)\s*(\S*)\s*$`)
+
+type Limit struct {
+	Name  string  `json:"name"`
+	Soft  *uint64 `json:"soft,omitempty"` // Nil if unlimited.
+	Hard  *uint64 `json:"hard,omitempty"`
+	Units string  `json:"units,omitempty"`
+}
+
+// Returns the process' resource limits, as listed in /proc/<pid>/limits.
+func ReadLimits(pid types.Pid) ([]*Limit, error) {
+	path := fmt.Sprintf("/proc/%d/limits", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	limits := make([]*Limit, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Header.
+	for scanner.Scan() {
+		match := limitPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			return nil, errors.Errorf("invalid '%s' line '%s'", path, scanner.Text())
+		}
+
+		limit := &Limit{Name: match[1], Units: match[4]}
+		if limit.Soft, err = parseLimitValue(match[2]); err != nil {
+			return nil, errors.WithMessagef(err, "parse soft limit of '%s'", limit.Name)
+		}
+		if limit.Hard, err = parseLimitValue(match[3]); err != nil {
+			return nil, errors.WithMessagef(err, "parse hard limit of '%s'", limit.Name)
+		}
+		limits = append(limits, limit)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return limits, nil
+}
+
+// Returns the named limit of the process, e.g LimitOpenFiles.
+func ReadLimit(pid types.Pid, name string) (*Limit, error) {
+	limits, err := ReadLimits(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, limit := range limits {
+		if limit.Name == name {
+			return limit, nil
+		}
+	}
+	return nil, errors.Errorf("limit '%s' of pid '%d' not found", name, pid)
+}
+
+func parseLimitValue(value string) (*uint64, error) {
+	if value == "unlimited" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
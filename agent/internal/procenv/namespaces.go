@@ -0,0 +1,40 @@
+package procenv
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Returns the inodes of the process' namespaces by type (e.g "net"), which are equal for processes sharing them.
+func ReadNamespaces(pid types.Pid) (map[string]uint64, error) {
+	nsDir := fmt.Sprintf("/proc/%d/ns", pid)
+	entries, err := ioutil.ReadDir(nsDir)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list namespaces")
+	}
+
+	namespaces := make(map[string]uint64, len(entries))
+	for _, entry := range entries {
+		// e.g "net:[4026531992]", or "pid:[4026531836]" for pid_for_children.
+		target, err := os.Readlink(filepath.Join(nsDir, entry.Name()))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "read namespace '%s'", entry.Name())
+		}
+
+		inodeStart := strings.IndexByte(target, '[')
+		if inodeStart == -1 || !strings.HasSuffix(target, "]") {
+			return nil, errors.Errorf("invalid namespace '%s'", target)
+		}
+		inode := target[inodeStart+1 : len(target)-1]
+		if namespaces[entry.Name()], err = strconv.ParseUint(inode, 10, 64); err != nil {
+			return nil, errors.WithMessagef(err, "parse namespace '%s'", target)
+		}
+	}
+	return namespaces, nil
+}
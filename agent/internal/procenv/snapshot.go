@@ -0,0 +1,45 @@
+package procenv
+
+import (
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+)
+
+// Snapshot of the context a process runs in.
+type Snapshot struct {
+	Environment map[string]string `json:"environment"` // Redacted.
+	Limits      []*Limit          `json:"limits"`
+	Credentials *Credentials      `json:"credentials"`
+	Namespaces  map[string]uint64 `json:"namespaces"`
+}
+
+// Takes a snapshot of the process, whose environment is redacted before being returned.
+func TakeSnapshot(pid types.Pid, redactor *redaction.Redactor) (*Snapshot, error) {
+	environment, err := ReadEnvironment(pid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read environment")
+	}
+
+	limits, err := ReadLimits(pid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read limits")
+	}
+
+	credentials, err := ReadCredentials(pid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read credentials")
+	}
+
+	namespaces, err := ReadNamespaces(pid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read namespaces")
+	}
+
+	return &Snapshot{
+		Environment: redactor.RedactEnvironment(environment),
+		Limits:      limits,
+		Credentials: credentials,
+		Namespaces:  namespaces,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package procenv
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// CPU times in /proc are in USER_HZ, which is fixed regardless of the kernel's tick rate.
+const UserHz = 100
+
+// Stat of a process or thread, e.g "1234 (app) S 1 ...", where the name may contain spaces and parentheses, so fields
+// are counted from the last closing parenthesis. See proc(5) for the fields.
+type Stat struct {
+	Name   string
+	path   string
+	fields []string // Following the name, starting from the 3rd (state).
+}
+
+// Returns the process' stat, as in /proc/<pid>/stat. Errors of processes which are gone have a cause which satisfies
+// os.IsNotExist().
+func ReadStat(pid types.Pid) (*Stat, error) {
+	return readStat(fmt.Sprintf("/proc/%d/stat", pid))
+}
+
+// Returns the thread's stat, as in /proc/<pid>/task/<tid>/stat.
+func ReadThreadStat(pid types.Pid, tid types.Pid) (*Stat, error) {
+	return readStat(fmt.Sprintf("/proc/%d/task/%d/stat", pid, tid))
+}
+
+func readStat(path string) (*Stat, error) {
+	stat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	nameStart, nameEnd := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+	if nameStart == -1 || nameEnd < nameStart {
+		return nil, errors.Errorf("invalid '%s'", path)
+	}
+
+	return &Stat{
+		Name:   string(stat[nameStart+1 : nameEnd]),
+		path:   path,
+		fields: strings.Fields(string(stat[nameEnd+1:])),
+	}, nil
+}
+
+// Returns an unsigned field by its number in proc(5), e.g 14 for utime.
+func (s *Stat) Field(number int) (uint64, error) {
+	field, err := s.field(number)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "parse field %d of '%s'", number, s.path)
+	}
+	return value, nil
+}
+
+// Returns a signed field by its number in proc(5), e.g 19 for nice.
+func (s *Stat) SignedField(number int) (int64, error) {
+	field, err := s.field(number)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "parse field %d of '%s'", number, s.path)
+	}
+	return value, nil
+}
+
+func (s *Stat) field(number int) (string, error) {
+	if number < 3 || number-3 >= len(s.fields) {
+		return "", errors.Errorf("missing field %d in '%s'", number, s.path)
+	}
+	return s.fields[number-3], nil
+}
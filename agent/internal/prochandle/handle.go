@@ -0,0 +1,205 @@
+package prochandle
+
+import (
+	stdLibErrors "errors"
+	"fmt"
+	"github.com/memlab/agent/internal/procenv"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"sync"
+)
+
+// Number of starttime in /proc/<pid>/stat (see proc(5)).
+const statStartTimeField = 22
+
+var (
+	// ErrProcessExited is returned once the process a handle refers to exited, even if it wasn't reaped yet.
+	ErrProcessExited = stdLibErrors.New("process exited")
+
+	// ErrProcessReplaced is returned once a handle's pid refers to a different process than the one it was opened for.
+	ErrProcessReplaced = stdLibErrors.New("pid refers to a different process")
+
+	ErrHandleClosed = stdLibErrors.New("process handle is closed")
+)
+
+// Handle refers to a specific process rather than to whichever process currently has its pid: it's identified by
+// pid and start time, and pinned by a pidfd (linux 5.3+) when the kernel supports it.
+type Handle struct {
+	pid       types.Pid
+	startTime uint64 // Clock ticks since boot.
+	lock      sync.RWMutex
+	pidfd     int // -1 when unsupported.
+	closed    bool
+	detached  bool
+}
+
+func Open(pid types.Pid) (*Handle, error) {
+	pidfd, err := openPidfd(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := &Handle{
+		pid:   pid,
+		pidfd: pidfd,
+	}
+
+	// Start time is read once the pidfd is open, so if the process hasn't exited by the time it was read (i.e, the
+	// pid couldn't have been reused), it belongs to the pidfd's process.
+	handle.startTime, err = readStartTime(pid)
+	if err == nil {
+		err = handle.checkExited()
+	}
+	if err != nil {
+		_ = handle.Close()
+		return nil, err
+	}
+
+	return handle, nil
+}
+
+// Detached returns a handle of a process which isn't looked up on this host (e.g, a recorded one being replayed): it's
+// always verified, yet never signaled, so nothing is ever done to whichever live process has its pid.
+func Detached(pid types.Pid, startTime uint64) *Handle {
+	return &Handle{
+		pid:       pid,
+		startTime: startTime,
+		pidfd:     -1,
+		detached:  true,
+	}
+}
+
+func openPidfd(pid types.Pid) (int, error) {
+	pidfd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	switch errno {
+	case 0:
+		return int(pidfd), nil
+	case unix.ENOSYS:
+		return -1, nil
+	case unix.ESRCH:
+		return -1, errors.WithMessagef(ErrProcessExited, "open pidfd for pid '%d'", pid)
+	default:
+		return -1, errors.WithMessagef(errno, "open pidfd for pid '%d'", pid)
+	}
+}
+
+func readStartTime(pid types.Pid) (uint64, error) {
+	stat, err := procenv.ReadStat(pid)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return 0, errors.WithMessagef(ErrProcessExited, "read stat of pid '%d'", pid)
+		}
+		return 0, err
+	}
+
+	startTime, err := stat.Field(statStartTimeField)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "parse start time of pid '%d'", pid)
+	}
+	return startTime, nil
+}
+
+func (h *Handle) Pid() types.Pid {
+	return h.pid
+}
+
+// Clock ticks since boot, as in /proc/<pid>/stat.
+func (h *Handle) StartTime() uint64 {
+	return h.startTime
+}
+
+// Verify returns nil only if the handle's pid still refers to the process it was opened for, and it's still running.
+// Anything read about the process via its pid (e.g, /proc/<pid>/...) before a successful verification is known to be
+// about the right process.
+func (h *Handle) Verify() error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if h.closed {
+		return ErrHandleClosed
+	} else if h.detached {
+		return nil
+	}
+
+	// Start time is checked first, so a reused pid is told apart from an exited process.
+	startTime, err := readStartTime(h.pid)
+	if err != nil {
+		return err
+	} else if startTime != h.startTime {
+		return errors.WithMessagef(ErrProcessReplaced, "pid '%d'", h.pid)
+	}
+
+	return h.checkExited()
+}
+
+// A pidfd becomes readable once its process exits.
+func (h *Handle) checkExited() error {
+	if h.pidfd < 0 {
+		return nil // Verified by start time alone.
+	}
+
+	pollFds := []unix.PollFd{{Fd: int32(h.pidfd), Events: unix.POLLIN}}
+	ready, err := unix.Poll(pollFds, 0)
+	if err != nil {
+		return errors.WithMessagef(err, "poll pidfd of pid '%d'", h.pid)
+	} else if ready > 0 {
+		return errors.WithMessagef(ErrProcessExited, "pid '%d'", h.pid)
+	}
+	return nil
+}
+
+// Sends a signal to the handle's process, never to a process which reused its pid.
+func (h *Handle) SendSignal(signal unix.Signal) error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if h.closed {
+		return ErrHandleClosed
+	} else if h.detached {
+		return errors.Errorf("send signal '%d' to detached pid '%d'", signal, h.pid)
+	}
+
+	if h.pidfd >= 0 {
+		_, _, errno := unix.Syscall6(unix.SYS_PIDFD_SEND_SIGNAL, uintptr(h.pidfd), uintptr(signal), 0, 0, 0, 0)
+		if errno == unix.ESRCH {
+			return errors.WithMessagef(ErrProcessExited, "pid '%d'", h.pid)
+		} else if errno != 0 {
+			return errors.WithMessagef(errno, "send signal '%d' to pid '%d'", signal, h.pid)
+		}
+		return nil
+	}
+
+	// Without a pidfd, the pid might still be reused between verification and kill(2), but the window is tiny.
+	startTime, err := readStartTime(h.pid)
+	if err != nil {
+		return err
+	} else if startTime != h.startTime {
+		return errors.WithMessagef(ErrProcessReplaced, "pid '%d'", h.pid)
+	}
+
+	if err := unix.Kill(int(h.pid), signal); err != nil {
+		return errors.WithMessagef(err, "send signal '%d' to pid '%d'", signal, h.pid)
+	}
+	return nil
+}
+
+func (h *Handle) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	h.closed = true
+	if h.pidfd >= 0 {
+		return unix.Close(h.pidfd)
+	}
+	return nil
+}
+
+func (h *Handle) String() string {
+	return fmt.Sprintf("%d@%d", h.pid, h.startTime)
+}
@@ -0,0 +1,127 @@
+package procwatch
+
+import (
+	"context"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"time"
+)
+
+// See include/uapi/linux/connector.h and include/uapi/linux/cn_proc.h.
+const (
+	cnIdxProc = 0x1
+	cnValProc = 0x1
+
+	procCnMcastListen = 1
+	procCnMcastIgnore = 2
+
+	procEventExit = 0x80000000
+
+	cnMsgHeaderSize     = 20 // struct cn_msg, without data.
+	procEventHeaderSize = 16 // struct proc_event, up to event_data.
+	exitEventSize       = 24 // struct exit_proc_event.
+)
+
+// Receives exit events of all processes on the host via the proc connector, which requires CAP_NET_ADMIN.
+type procConnector struct {
+	conn *netlink.Conn
+}
+
+func dialProcConnector() (*procConnector, error) {
+	conn, err := netlink.Dial(unix.NETLINK_CONNECTOR, &netlink.Config{
+		Groups:              cnIdxProc,
+		DisableNSLockThread: true,
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "dial netlink connector")
+	}
+
+	if err := sendProcConnectorOperation(conn, procCnMcastListen); err != nil {
+		_ = conn.Close()
+		return nil, errors.WithMessage(err, "subscribe to proc events")
+	}
+
+	return &procConnector{
+		conn: conn,
+	}, nil
+}
+
+func sendProcConnectorOperation(conn *netlink.Conn, operation uint32) error {
+	data := make([]byte, cnMsgHeaderSize+4)
+	nlenc.PutUint32(data[0:4], cnIdxProc)
+	nlenc.PutUint32(data[4:8], cnValProc)
+	nlenc.PutUint16(data[16:18], 4) // Length of the operation which follows the header.
+	nlenc.PutUint32(data[cnMsgHeaderSize:], operation)
+
+	_, err := conn.Send(netlink.Message{
+		Header: netlink.Header{
+			Type: netlink.Done,
+		},
+		Data: data,
+	})
+	return err
+}
+
+// Pids are filtered by the exit watcher, as the proc connector reports all exits anyway.
+func (pc *procConnector) watch(types.Pid) error {
+	return nil
+}
+
+func (pc *procConnector) unwatch(types.Pid) {}
+
+func (pc *procConnector) run(ctx context.Context, onExit func(exit *Exit)) error {
+	defer func() {
+		// The kernel only counts listeners to skip building events when there are none, so this is best-effort.
+		_ = sendProcConnectorOperation(pc.conn, procCnMcastIgnore)
+		_ = pc.conn.Close()
+	}()
+
+	for {
+		messages, err := pc.conn.Receive()
+		if err != nil {
+			if ctx.Err() != nil { // Receive was interrupted by close().
+				return nil
+			}
+			return errors.WithMessage(err, "receive proc events")
+		}
+
+		for _, message := range messages {
+			if exit, ok := parseExitEvent(message.Data); ok {
+				onExit(exit)
+			}
+		}
+	}
+}
+
+// Thread exits are ignored, only thread group leaders' exits count as process exits.
+func parseExitEvent(data []byte) (*Exit, bool) {
+	if len(data) < cnMsgHeaderSize+procEventHeaderSize+exitEventSize {
+		return nil, false
+	}
+
+	event := data[cnMsgHeaderSize:]
+	if nlenc.Uint32(event[0:4]) != procEventExit {
+		return nil, false
+	}
+
+	exitEvent := event[procEventHeaderSize:]
+	pid := nlenc.Int32(exitEvent[0:4])
+	tgid := nlenc.Int32(exitEvent[4:8])
+	if pid != tgid {
+		return nil, false
+	}
+
+	return newExitFromWaitStatus(types.Pid(tgid), nlenc.Uint32(exitEvent[8:12])), true
+}
+
+// The connection itself is closed once run() returns.
+func (pc *procConnector) close() error {
+	// A blocking receive holds the connection's lock, so it must be interrupted before the connection is closed.
+	if err := pc.conn.SetReadDeadline(time.Now()); err != nil {
+		return errors.WithMessage(err, "interrupt netlink receive")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package procwatch
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+const pollingInterval = time.Second
+
+// Polls watched processes for exit, via process handles so a reused pid isn't mistaken for the watched process.
+type pollingSource struct {
+	lock    sync.Mutex
+	handles map[types.Pid]*prochandle.Handle
+}
+
+func newPollingSource() *pollingSource {
+	return &pollingSource{
+		handles: make(map[types.Pid]*prochandle.Handle, 0),
+	}
+}
+
+func (ps *pollingSource) watch(pid types.Pid) error {
+	handle, err := prochandle.Open(pid)
+	if err != nil {
+		return err
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.handles[pid] = handle
+	return nil
+}
+
+func (ps *pollingSource) unwatch(pid types.Pid) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if handle, found := ps.handles[pid]; found {
+		_ = handle.Close()
+		delete(ps.handles, pid)
+	}
+}
+
+func (ps *pollingSource) run(ctx context.Context, onExit func(exit *Exit)) error {
+	ticker := time.NewTicker(pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, pid := range ps.exitedPids() {
+				onExit(&Exit{
+					Pid:      pid,
+					ExitedAt: time.Now().UTC(),
+				})
+			}
+		}
+	}
+}
+
+// Without pidfds, zombies are considered alive until reaped.
+func (ps *pollingSource) exitedPids() []types.Pid {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	exitedPids := make([]types.Pid, 0)
+	for pid, handle := range ps.handles {
+		err := handle.Verify()
+		if cause := errors.Cause(err); cause == prochandle.ErrProcessExited || cause == prochandle.ErrProcessReplaced {
+			exitedPids = append(exitedPids, pid)
+		}
+	}
+	return exitedPids
+}
+
+func (ps *pollingSource) close() error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for pid, handle := range ps.handles {
+		_ = handle.Close()
+		delete(ps.handles, pid)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package procwatch
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/types"
+	"go.uber.org/zap"
+	"gopkg.in/guregu/null.v3"
+	"sync"
+	"time"
+)
+
+// Exits are delivered after the watched pid was already forgotten, so buffer a few in case of bursts.
+const exitsBufferSize = 16
+
+// Exit of a watched process. Exit status is only known when exits are observed via the proc connector.
+type Exit struct {
+	Pid        types.Pid
+	ExitCode   null.Int // Set if the process exited normally.
+	ExitSignal null.Int // Set if the process was terminated by a signal.
+	ExitedAt   time.Time
+}
+
+// Decodes a wait(2) status, as reported by the proc connector.
+func newExitFromWaitStatus(pid types.Pid, waitStatus uint32) *Exit {
+	exit := &Exit{
+		Pid:      pid,
+		ExitedAt: time.Now().UTC(),
+	}
+
+	if terminatingSignal := waitStatus & 0x7f; terminatingSignal != 0 {
+		exit.ExitSignal = null.IntFrom(int64(terminatingSignal))
+	} else {
+		exit.ExitCode = null.IntFrom(int64((waitStatus >> 8) & 0xff))
+	}
+	return exit
+}
+
+// Observes process exits, host-wide or only for the pids it's asked about.
+type exitSource interface {
+	watch(pid types.Pid) error
+	unwatch(pid types.Pid)
+	run(ctx context.Context, onExit func(exit *Exit)) error // Blocks until the context is done or the source fails.
+	close() error
+}
+
+// ExitWatcher notifies about exits of watched processes, so their state can be cleaned up right away rather than
+// when they're next polled.
+type ExitWatcher struct {
+	logger    *zap.Logger
+	context   context.Context
+	cancel    context.CancelFunc
+	waitGroup sync.WaitGroup
+	lock      sync.Mutex
+	watched   map[types.Pid]bool
+	exitsChan chan *Exit
+	source    exitSource
+}
+
+// Prefers the proc connector, which reports exit statuses, and falls back to polling watched processes when it's
+// unavailable (e.g, without CAP_NET_ADMIN).
+func NewExitWatcher(rootLogger *zap.Logger) (*ExitWatcher, error) {
+	logger := rootLogger.Named("exit-watcher")
+
+	var source exitSource
+	procConnector, err := dialProcConnector()
+	if err != nil {
+		logger.Warn("Proc connector is unavailable, polling watched processes instead (exit statuses won't be known)",
+			zap.Error(err))
+		source = newPollingSource()
+	} else {
+		source = procConnector
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExitWatcher{
+		logger:    logger,
+		context:   ctx,
+		cancel:    cancel,
+		watched:   make(map[types.Pid]bool, 0),
+		exitsChan: make(chan *Exit, exitsBufferSize),
+		source:    source,
+	}, nil
+}
+
+func (ew *ExitWatcher) Watch(pid types.Pid) error {
+	ew.lock.Lock()
+	defer ew.lock.Unlock()
+
+	if ew.watched[pid] {
+		return nil
+	}
+
+	if err := ew.source.watch(pid); err != nil {
+		return err
+	}
+
+	ew.logger.Debug("Watch process exit", zap.Int32("Pid", int32(pid)))
+	ew.watched[pid] = true
+	return nil
+}
+
+func (ew *ExitWatcher) Unwatch(pid types.Pid) {
+	ew.lock.Lock()
+	defer ew.lock.Unlock()
+
+	if !ew.watched[pid] {
+		return
+	}
+
+	ew.logger.Debug("Un-watch process exit", zap.Int32("Pid", int32(pid)))
+	ew.source.unwatch(pid)
+	delete(ew.watched, pid)
+}
+
+func (ew *ExitWatcher) ExitsChan() <-chan *Exit {
+	return ew.exitsChan
+}
+
+func (ew *ExitWatcher) Start() error {
+	ew.logger.Debug("Start exit watcher")
+
+	ew.waitGroup.Add(1)
+	go func() {
+		defer ew.waitGroup.Done()
+
+		if err := ew.source.run(ew.context, ew.handleExit); err != nil {
+			ew.logger.Error("Exit watcher failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Watched pids are forgotten once they exit, so a reused pid isn't mistaken for the exited process.
+func (ew *ExitWatcher) handleExit(exit *Exit) {
+	ew.lock.Lock()
+	if !ew.watched[exit.Pid] {
+		ew.lock.Unlock()
+		return
+	}
+	ew.source.unwatch(exit.Pid)
+	delete(ew.watched, exit.Pid)
+	ew.lock.Unlock()
+
+	ew.logger.Debug("Watched process exited", zap.Any("Exit", exit))
+
+	select {
+	case <-ew.context.Done():
+	case ew.exitsChan <- exit:
+	}
+}
+
+func (ew *ExitWatcher) WaitUntilCompletion() {
+	ew.waitGroup.Wait()
+}
+
+func (ew *ExitWatcher) Stop() error {
+	ew.logger.Debug("Stop exit watcher")
+
+	ew.cancel()
+	return ew.source.close()
+}
@@ -0,0 +1,47 @@
+package redaction
+
+import (
+	"github.com/pkg/errors"
+	"path"
+	"strings"
+)
+
+// Matched against keys uppercased, with dashes as underscores (e.g, "--db-password" -> "DB_PASSWORD").
+var DefaultKeyPatterns = []string{
+	"*TOKEN*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*SECRET*",
+	"*CREDENTIAL*",
+	"*API_KEY*",
+	"*APIKEY*",
+	"*ACCESS_KEY*",
+	"*PRIVATE_KEY*",
+	"*AUTH_TOKEN*",
+	"AUTHORIZATION", // Rather than "*AUTH*", which matches keys such as AUTHOR and OAUTH_ENABLED as well.
+	"*COOKIE*",
+	"*SESSION_ID*",
+	"*SESSION_KEY*", // Rather than "*SESSION*", which matches keys such as SESSION_TIMEOUT as well.
+}
+
+type Config struct {
+	KeyPatterns      []string // Shell globs, matched case-insensitively.
+	EntropyThreshold float64  // Bits per character, above which values look random (e.g, generated keys). 0 disables.
+	MinSecretLength  int      // Of values checked for entropy.
+}
+
+func (c *Config) Valid() (bool, error) {
+	for _, pattern := range c.KeyPatterns {
+		if _, err := path.Match(strings.ToUpper(pattern), ""); err != nil {
+			return false, errors.WithMessagef(err, "invalid key pattern '%s'", pattern)
+		}
+	}
+
+	if c.EntropyThreshold < 0 {
+		return false, errors.New("negative entropy threshold")
+	} else if c.EntropyThreshold > 0 && c.MinSecretLength <= 0 {
+		return false, errors.New("min secret length must be positive")
+	}
+
+	return true, nil
+}
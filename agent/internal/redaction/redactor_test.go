@@ -0,0 +1,156 @@
+package redaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 32 distinct characters of a base64 alphabet, i.e 5 bits per character.
+const testSecret = "aB3dE5fG7hJ9kL1mN2pQ4rS6tU8vW0xY"
+
+func newTestRedactor() *Redactor {
+	return NewRedactor(&Config{
+		KeyPatterns:      DefaultKeyPatterns,
+		EntropyThreshold: 4.2,
+		MinSecretLength:  32,
+	})
+}
+
+func TestRedactCommandLine(t *testing.T) {
+	redactor := newTestRedactor()
+
+	tests := []struct {
+		name        string
+		commandLine string
+		expected    string
+	}{
+		{"flag assignment", "app --db-password=hunter2 --port=80", "app --db-password=[REDACTED] --port=80"},
+		{"flag and value", "app --api-key hunter2 --verbose", "app --api-key [REDACTED] --verbose"},
+		{"flag without value", "app --token --verbose", "app --token --verbose"},
+		{"environment assignment", "env AWS_SECRET_ACCESS_KEY=hunter2 app", "env AWS_SECRET_ACCESS_KEY=[REDACTED] app"},
+		{"url credentials", "psql postgres://admin:hunter2@db/app", "psql postgres://admin:[REDACTED]@db/app"},
+		{"random argument", "app " + testSecret, "app [REDACTED]"},
+		{"random flag value", "app --id=" + testSecret, "app --id=[REDACTED]"},
+		{"ordinary flags", "java -Xmx2g -jar /opt/app.jar --port 8080", "java -Xmx2g -jar /opt/app.jar --port 8080"},
+		{"auth-like keys", "app --author=jane --oauth-enabled=true", "app --author=jane --oauth-enabled=true"},
+		{"session-like keys", "app --session-timeout=30s", "app --session-timeout=30s"},
+		{"hex id", "app --commit=3f2a9c1e7b5d4a8f6e0c2b1d9a7f5e3c", "app --commit=3f2a9c1e7b5d4a8f6e0c2b1d9a7f5e3c"},
+		{"uuid", "app 123e4567-e89b-12d3-a456-426614174000", "app 123e4567-e89b-12d3-a456-426614174000"},
+		{"url without credentials", "curl https://example.com/path?q=1", "curl https://example.com/path?q=1"},
+	}
+
+	for _, test := range tests {
+		if redacted := redactor.RedactCommandLine(test.commandLine); redacted != test.expected {
+			t.Errorf("%s: RedactCommandLine('%s') = '%s', expected '%s'", test.name, test.commandLine, redacted,
+				test.expected)
+		}
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	redactor := newTestRedactor()
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"equals assignment", "connecting with password=hunter2 to db", "connecting with password=[REDACTED] to db"},
+		{"colon assignment", "api_key: hunter2", "api_key: [REDACTED]"},
+		{"json field", `{"client_secret": "hunter2", "id": 1}`, `{"client_secret": "[REDACTED]", "id": 1}`},
+		{"bearer header", "Authorization: Bearer hunter2", "Authorization: Bearer [REDACTED]"},
+		{"url credentials", "dialing amqp://guest:hunter2@mq:5672", "dialing amqp://guest:[REDACTED]@mq:5672"},
+		{"random word", "issued " + testSecret + " to client", "issued [REDACTED] to client"},
+		{"ordinary log line", "GET /api/users?page=2 200 12ms", "GET /api/users?page=2 200 12ms"},
+		{"ordinary assignments", "user=jane retries: 3 author=jane", "user=jane retries: 3 author=jane"},
+		{"time", "started at 12:30:45", "started at 12:30:45"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		if redacted := redactor.RedactText(test.text); redacted != test.expected {
+			t.Errorf("%s: RedactText('%s') = '%s', expected '%s'", test.name, test.text, redacted, test.expected)
+		}
+	}
+}
+
+func TestRedactEnvironment(t *testing.T) {
+	redactor := newTestRedactor()
+
+	environment := map[string]string{
+		"DB_PASSWORD":     "hunter2",
+		"GITHUB_TOKEN":    "hunter2",
+		"SESSION_KEY":     "hunter2",
+		"DATABASE_URL":    "postgres://app:hunter2@db/app",
+		"SIGNING":         testSecret,
+		"EMPTY_SECRET":    "",
+		"PATH":            "/usr/local/bin:/usr/bin:/bin",
+		"HOME":            "/home/app",
+		"AUTHOR":          "jane",
+		"SESSION_TIMEOUT": "30s",
+		"GIT_COMMIT":      "3f2a9c1e7b5d4a8f6e0c2b1d9a7f5e3c",
+	}
+	expected := map[string]string{
+		"DB_PASSWORD":     Redacted,
+		"GITHUB_TOKEN":    Redacted,
+		"SESSION_KEY":     Redacted,
+		"DATABASE_URL":    "postgres://app:[REDACTED]@db/app",
+		"SIGNING":         Redacted,
+		"EMPTY_SECRET":    "",
+		"PATH":            "/usr/local/bin:/usr/bin:/bin",
+		"HOME":            "/home/app",
+		"AUTHOR":          "jane",
+		"SESSION_TIMEOUT": "30s",
+		"GIT_COMMIT":      "3f2a9c1e7b5d4a8f6e0c2b1d9a7f5e3c",
+	}
+
+	if redacted := redactor.RedactEnvironment(environment); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("RedactEnvironment() = %v, expected %v", redacted, expected)
+	}
+	if environment["DB_PASSWORD"] != "hunter2" {
+		t.Error("RedactEnvironment() modified its input")
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var redactor *Redactor
+
+	if redacted := redactor.RedactCommandLine("app --password=hunter2"); redacted != "app --password=hunter2" {
+		t.Errorf("RedactCommandLine() = '%s', expected the command line as is", redacted)
+	}
+	if redacted := redactor.RedactText("password=hunter2"); redacted != "password=hunter2" {
+		t.Errorf("RedactText() = '%s', expected the text as is", redacted)
+	}
+}
+
+func TestLooksRandom(t *testing.T) {
+	redactor := newTestRedactor()
+
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{"generated secret", testSecret, true},
+		{"base64 key", "Zm9vYmFyQmF6UXV4MTIzNDU2Nzg5MEFCQ0RFRkdISUpLTE1O", true},
+		{"url-safe token", "kX9_vQ2-mZ7~pL4.nR8_wT1-yU6~bH3.cJ5", true},
+		{"too short", "aB3dE5fG7hJ9kL1m", false},
+		{"without digits", "aBcDeFgHiJkLmNoPqRsTuVwXyZaBcDeF", false},
+		{"without uppercase", "ab3de5fg7hj9kl1mn2pq4rs6tu8vw0xy", false},
+		{"hex id", "3f2a9c1e7b5d4a8f6e0c2b1d9a7f5e3c9b8a", false},
+		{"repetitive", "aaaaaaaaaaAAAAAAAAAA1111111111aaaa", false},
+		{"path", "/usr/local/lib/Python3/site-packages", false},
+		{"sentence characters", "Hello World 1234567890 Hello World", false},
+	}
+
+	for _, test := range tests {
+		if looksRandom := redactor.looksRandom(test.value); looksRandom != test.expected {
+			t.Errorf("%s: looksRandom('%s') = %t, expected %t", test.name, test.value, looksRandom, test.expected)
+		}
+	}
+
+	disabled := NewRedactor(&Config{KeyPatterns: DefaultKeyPatterns, EntropyThreshold: 0, MinSecretLength: 32})
+	if disabled.looksRandom(testSecret) {
+		t.Error("looksRandom() is true even though the entropy threshold is 0")
+	}
+}
@@ -18,7 +18,7 @@ type HostStatusReport struct {
 }
 
 func NewHostStatusReport(machineId string) (*HostStatusReport, error) {
-	hostStatusReport := &HostStatusReport{}
+	hostStatusReport := &HostStatusReport{Host: &models.Host{}}
 
 	hostStatusReport.MachineId = machineId
 
@@ -28,11 +28,11 @@ func NewHostStatusReport(machineId string) (*HostStatusReport, error) {
 	}
 
 	// todo: add a cache which self-updates every once in a while to save redundant outgoing traffic.
+	// Left empty when unresolvable (e.g, no outbound internet access), letting the backend decide what to do.
 	publicIpAddress, err := ipAddressResolver.ExternalIP()
-	if err != nil {
-		return nil, errors.WithMessage(err, "get external ip address")
+	if err == nil {
+		hostStatusReport.PublicIpAddress = publicIpAddress.String()
 	}
-	hostStatusReport.PublicIpAddress = publicIpAddress.String()
 
 	hostStatusReport.Hostname = hostInfo.Hostname
 	hostStatusReport.LastBootTime = types.JsonTimeFromTimestamp(int64(hostInfo.BootTime))
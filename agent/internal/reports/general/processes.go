@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"github.com/hashicorp/go-multierror"
 	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/containers"
+	"github.com/memlab/agent/internal/host"
 	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	psUtil "github.com/shirou/gopsutil/process"
@@ -66,6 +68,7 @@ func NewProcessListReport(machineId string) (*ProcessListReport, error) {
 			LastSeenAt:  now,
 			Status:      status,
 		}
+		addProcessOwnership(hostProcess, liveProcess)
 
 		hostProcesses = append(hostProcesses, hostProcess)
 	}
@@ -79,6 +82,28 @@ func NewProcessListReport(machineId string) (*ProcessListReport, error) {
 	return &ProcessListReport{MachineId: machineId, List: hostProcesses}, nil
 }
 
+// Ownership is best-effort, as processes are still worth reporting without it (they just won't match selectors
+// which rely on missing details).
+func addProcessOwnership(hostProcess *models.Process, liveProcess *psUtil.Process) {
+	if uids, err := liveProcess.Uids(); err == nil && len(uids) > 1 {
+		hostProcess.Uid = null.IntFrom(int64(uids[1]))
+	}
+
+	if cgroupPath, err := host.ProcessCgroup(hostProcess.Pid); err == nil {
+		hostProcess.CgroupPath = cgroupPath
+		hostProcess.SystemdUnit = host.SystemdUnitFromCgroup(cgroupPath)
+
+		if container, err := containers.CgroupContainer(cgroupPath); err == nil && container != nil {
+			hostProcess.Container = container
+			hostProcess.ContainerId = container.ID
+		}
+	}
+
+	if namespacedPid, err := containers.NamespacedPid(hostProcess.Pid); err == nil && namespacedPid != hostProcess.Pid {
+		hostProcess.NamespacedPid = namespacedPid
+	}
+}
+
 func (p *ProcessListReport) ReportName() string {
 	return "process-list-report"
 }
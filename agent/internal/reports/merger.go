@@ -7,19 +7,26 @@ import (
 
 func MergeReports(reports ...Report) (map[string]interface{}, error) {
 	merged := make(map[string]interface{}, 0)
+	if err := MergeReportsInto(merged, reports...); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
 
+// Merges reports into an already merged reports dump, overriding existing keys.
+func MergeReportsInto(merged map[string]interface{}, reports ...Report) error {
 	for _, report := range reports {
 		reportDump, err := report.DumpReport()
 		reportName := report.ReportName()
 
 		if err != nil {
-			return nil, errors.WithMessagef(err, "dump report '%s'", reportName)
+			return errors.WithMessagef(err, "dump report '%s'", reportName)
 		}
 
 		if err := json.Unmarshal(reportDump, &merged); err != nil {
-			return nil, errors.WithMessagef(err, "merge with report '%s'", reportName)
+			return errors.WithMessagef(err, "merge with report '%s'", reportName)
 		}
 	}
 
-	return merged, nil
+	return nil
 }
@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/customcommand"
+)
+
+// Results of user defined commands, run against the process.
+type CustomCommandsReport struct {
+	Results []*customcommand.Result `json:"custom_commands"`
+}
+
+func (c *CustomCommandsReport) ReportName() string {
+	return "custom-commands-report"
+}
+
+func (c *CustomCommandsReport) DumpReport() ([]byte, error) {
+	return json.Marshal(c)
+}
@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/procenv"
+)
+
+// Environment (redacted), resource limits, credentials and namespaces of the process.
+type EnvironmentReport struct {
+	*procenv.Snapshot
+}
+
+func (e *EnvironmentReport) ReportName() string {
+	return "environment-report"
+}
+
+func (e *EnvironmentReport) DumpReport() ([]byte, error) {
+	return json.Marshal(e)
+}
@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/fds"
+)
+
+// Inventory of the process' fds, with sockets resolved, and totals against its open files limit.
+type FdsReport struct {
+	*fds.Inventory
+}
+
+func (f *FdsReport) ReportName() string {
+	return "fds-report"
+}
+
+func (f *FdsReport) DumpReport() ([]byte, error) {
+	return json.Marshal(f)
+}
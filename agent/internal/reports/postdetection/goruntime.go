@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/goruntime"
+)
+
+// Go runtime of the process, left empty if it isn't a Go process.
+type GoRuntimeReport struct {
+	Runtime *goruntime.Runtime `json:"go_runtime,omitempty"`
+}
+
+func (g *GoRuntimeReport) ReportName() string {
+	return "go-runtime-report"
+}
+
+func (g *GoRuntimeReport) DumpReport() ([]byte, error) {
+	return json.Marshal(g)
+}
@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/hostsnapshot"
+)
+
+// Host wide usage at detection time, telling apart processes which failed on their own from ones starved by others.
+type HostSnapshotReport struct {
+	Snapshot *hostsnapshot.Snapshot `json:"host_snapshot"`
+}
+
+func (h *HostSnapshotReport) ReportName() string {
+	return "host-snapshot-report"
+}
+
+func (h *HostSnapshotReport) DumpReport() ([]byte, error) {
+	return json.Marshal(h)
+}
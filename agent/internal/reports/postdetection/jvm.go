@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/jvm"
+)
+
+// Diagnostics of the JVM, left empty if the process isn't a JVM.
+type JvmReport struct {
+	Diagnostics *jvm.Diagnostics `json:"jvm,omitempty"`
+}
+
+func (j *JvmReport) ReportName() string {
+	return "jvm-report"
+}
+
+func (j *JvmReport) DumpReport() ([]byte, error) {
+	return json.Marshal(j)
+}
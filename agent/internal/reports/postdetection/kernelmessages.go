@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/kmsg"
+)
+
+// Kernel messages about the process, e.g segfaults, OOM kills and hung task warnings.
+type KernelMessagesReport struct {
+	*kmsg.ProcessMessages
+}
+
+func (k *KernelMessagesReport) ReportName() string {
+	return "kernel-messages-report"
+}
+
+func (k *KernelMessagesReport) DumpReport() ([]byte, error) {
+	return json.Marshal(k)
+}
@@ -0,0 +1,19 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/logtail"
+)
+
+// Last lines of the process' logs, from the files it writes to, its journal and its container's log.
+type LogsReport struct {
+	*logtail.Tail
+}
+
+func (l *LogsReport) ReportName() string {
+	return "logs-report"
+}
+
+func (l *LogsReport) DumpReport() ([]byte, error) {
+	return json.Marshal(l)
+}
@@ -0,0 +1,97 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/memorymap"
+	"github.com/memlab/agent/internal/types"
+	"sort"
+)
+
+// Where the process' memory went, broken down by region and by backing file, along with its top consuming mappings.
+type MemoryMapReport struct {
+	Total       *memorymap.Usage                      `json:"memory_total"`
+	Regions     map[memorymap.Region]*memorymap.Usage `json:"memory_regions"`
+	TopFiles    []*FileMemoryUsage                    `json:"memory_top_files"`
+	TopMappings []*memorymap.Mapping                  `json:"memory_top_mappings"`
+	Mappings    int                                   `json:"memory_mappings_count"`
+}
+
+type FileMemoryUsage struct {
+	Path     string `json:"path"`
+	Mappings int    `json:"mappings_count"`
+	memorymap.Usage
+}
+
+// Top consumers are ranked by their footprint (see memorymap.Usage.Footprint), up to the max of each.
+func NewMemoryMapReport(pid types.Pid, config *memorymap.Config) (*MemoryMapReport, error) {
+	mappings, err := memorymap.ReadMappings(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := memorymap.ReadRollup(pid, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make(map[memorymap.Region]*memorymap.Usage, 0)
+	files := make(map[string]*FileMemoryUsage, 0)
+	for _, mapping := range mappings {
+		regionUsage, exists := regions[mapping.Region]
+		if !exists {
+			regionUsage = &memorymap.Usage{}
+			regions[mapping.Region] = regionUsage
+		}
+		regionUsage.Add(&mapping.Usage)
+
+		if mapping.Region != memorymap.RegionFile && mapping.Region != memorymap.RegionSharedMemory {
+			continue
+		}
+		fileUsage, exists := files[mapping.Path]
+		if !exists {
+			fileUsage = &FileMemoryUsage{Path: mapping.Path}
+			files[mapping.Path] = fileUsage
+		}
+		fileUsage.Mappings++
+		fileUsage.Add(&mapping.Usage)
+	}
+
+	topFiles := make([]*FileMemoryUsage, 0, len(files))
+	for _, fileUsage := range files {
+		topFiles = append(topFiles, fileUsage)
+	}
+	sort.Slice(topFiles, func(i, j int) bool {
+		if topFiles[i].Footprint() != topFiles[j].Footprint() {
+			return topFiles[i].Footprint() > topFiles[j].Footprint()
+		}
+		return topFiles[i].Path < topFiles[j].Path
+	})
+	if len(topFiles) > config.MaxTopConsumers {
+		topFiles = topFiles[:config.MaxTopConsumers]
+	}
+
+	topMappings := make([]*memorymap.Mapping, len(mappings))
+	copy(topMappings, mappings)
+	sort.SliceStable(topMappings, func(i, j int) bool {
+		return topMappings[i].Footprint() > topMappings[j].Footprint()
+	})
+	if len(topMappings) > config.MaxTopConsumers {
+		topMappings = topMappings[:config.MaxTopConsumers]
+	}
+
+	return &MemoryMapReport{
+		Total:       total,
+		Regions:     regions,
+		TopFiles:    topFiles,
+		TopMappings: topMappings,
+		Mappings:    len(mappings),
+	}, nil
+}
+
+func (m *MemoryMapReport) ReportName() string {
+	return "memory-map-report"
+}
+
+func (m *MemoryMapReport) DumpReport() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -3,34 +3,31 @@ package postdetection
 import (
 	"context"
 	"encoding/json"
-	"github.com/memlab/agent/internal/host"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/containers"
 	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	"github.com/shirou/gopsutil/process"
 )
 
-// todo: get host's top 10 consuming mem and cpu process, and general cpu and mem utilization
-
 const maxConnectionsLimit = 50
 
 type MetadataReport struct {
-	Pid            types.Pid `json:"pid"`
-	MachineId      string    `json:"machine_id"`
-	ExecutablePath string    `json:"executable_path"`
-	CmdLine        string    `json:"cmd_line"`
-	CpuPercent     float64   `json:"cpu_percent"`
-	MemPercent     float32   `json:"memory_percent"`
-	CreateTime     int64     `json:"create_time"`
-	Cwd            string    `json:"cwd"`
-	Connections    []string  `json:"connections"`
+	Pid            types.Pid         `json:"pid"`
+	MachineId      string            `json:"machine_id"`
+	ExecutablePath string            `json:"executable_path"`
+	CmdLine        string            `json:"cmd_line"`
+	CpuPercent     float64           `json:"cpu_percent"`
+	MemPercent     float32           `json:"memory_percent"`
+	CreateTime     int64             `json:"create_time"`
+	Cwd            string            `json:"cwd"`
+	Connections    []string          `json:"connections"`
+	Container      *models.Container `json:"container,omitempty"`
+	NamespacedPid  types.Pid         `json:"namespaced_pid,omitempty"`
 }
 
-func NewMetadataReport(ctx context.Context, pid types.Pid, ps *process.Process) (*MetadataReport, error) {
-	machineId, err := host.MachineId()
-	if err != nil {
-		return nil, err
-	}
-
+func NewMetadataReport(ctx context.Context, machineId string, pid types.Pid, ps *process.Process) (*MetadataReport,
+	error) {
 	executablePath, err := ps.ExeWithContext(ctx)
 	if err != nil {
 		return nil, errors.WithMessagef(err, "get process' executable (pid: '%d')", pid)
@@ -66,6 +63,13 @@ func NewMetadataReport(ctx context.Context, pid types.Pid, ps *process.Process)
 		return nil, errors.WithMessagef(err, "get process' connections (pid: '%d')", pid)
 	}
 
+	// Container details are best-effort, since they're not available for every runtime.
+	container, _ := containers.ProcessContainer(pid)
+	namespacedPid, err := containers.NamespacedPid(pid)
+	if err != nil || namespacedPid == pid {
+		namespacedPid = 0
+	}
+
 	return &MetadataReport{
 		MachineId:      machineId,
 		Pid:            pid,
@@ -76,6 +80,8 @@ func NewMetadataReport(ctx context.Context, pid types.Pid, ps *process.Process)
 		CreateTime:     createTime,
 		Cwd:            cwd,
 		Connections:    connections,
+		Container:      container,
+		NamespacedPid:  namespacedPid,
 	}, nil
 }
 
@@ -0,0 +1,21 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/kmsg"
+	"github.com/memlab/agent/internal/types"
+)
+
+// OOM kill of a monitored process, as reported by the kernel.
+type OomKillReport struct {
+	Pid     types.Pid     `json:"pid"`
+	OomKill *kmsg.OomKill `json:"oom_kill"`
+}
+
+func (o *OomKillReport) ReportName() string {
+	return "oom-kill-report"
+}
+
+func (o *OomKillReport) DumpReport() ([]byte, error) {
+	return json.Marshal(o)
+}
@@ -0,0 +1,28 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Describes the caught signal, and for how long the kernel module held it while operators ran.
+type CaughtSignalReport struct {
+	Signal            uint32    `json:"signal"`
+	SignalCode        int32     `json:"signal_code"`
+	Tid               uint32    `json:"signal_tid,omitempty"`
+	SenderPid         uint32    `json:"signal_sender_pid,omitempty"`
+	SenderUid         uint32    `json:"signal_sender_uid,omitempty"`
+	FaultAddress      uint64    `json:"signal_fault_address,omitempty"`
+	CaughtAt          null.Time `json:"signal_caught_at,omitempty"`
+	HoldBudget        int64     `json:"signal_hold_budget_ms"`
+	HeldFor           int64     `json:"signal_held_for_ms"`
+	HoldReleasedEarly bool      `json:"signal_hold_released_early"`
+}
+
+func (c *CaughtSignalReport) ReportName() string {
+	return "caught-signal-report"
+}
+
+func (c *CaughtSignalReport) DumpReport() ([]byte, error) {
+	return json.Marshal(c)
+}
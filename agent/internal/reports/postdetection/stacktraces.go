@@ -0,0 +1,20 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/stacktrace"
+)
+
+// Stacks of the process' threads, as they were while the caught signal was held.
+type StackTracesReport struct {
+	Threads        []*stacktrace.ThreadStack `json:"thread_stacks"`
+	OmittedThreads int                       `json:"omitted_thread_stacks,omitempty"` // Beyond the max threads.
+}
+
+func (s *StackTracesReport) ReportName() string {
+	return "stack-traces-report"
+}
+
+func (s *StackTracesReport) DumpReport() ([]byte, error) {
+	return json.Marshal(s)
+}
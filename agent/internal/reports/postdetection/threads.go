@@ -0,0 +1,21 @@
+package postdetection
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/threads"
+)
+
+// States and scheduler statistics of the process' threads.
+type ThreadsReport struct {
+	Threads        []*threads.Thread `json:"threads"`
+	OmittedThreads int               `json:"omitted_threads,omitempty"` // Beyond the max threads, yet summarized.
+	Summary        *threads.Summary  `json:"threads_summary"`
+}
+
+func (t *ThreadsReport) ReportName() string {
+	return "threads-report"
+}
+
+func (t *ThreadsReport) DumpReport() ([]byte, error) {
+	return json.Marshal(t)
+}
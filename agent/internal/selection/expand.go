@@ -0,0 +1,84 @@
+package selection
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Each match becomes a detector of its own, so a selector which matches too broadly is cut to the earliest started
+// processes it matches, which keeps the configured ones stable as more processes start matching.
+const MaxMatchesPerSelector = 16
+
+// Whether any of the configs targets processes by selector, hence requires a process list to be expanded.
+func RequiresProcessList(detectionConfigs []*models.DetectionConfiguration) bool {
+	for _, detectionConfig := range detectionConfigs {
+		if detectionConfig.SelectsProcesses() {
+			return true
+		}
+	}
+	return false
+}
+
+// Expands selector configs into a config per matching process, alongside configs which target a pid explicitly.
+// Explicit configs take precedence over selector ones, and selector configs are applied by creation order, so a
+// process matched by several selectors is always configured by the same one. Invalid selectors are skipped, and their
+// errors are returned along with the configs expanded from the rest, as are errors of selectors whose matches were cut
+// (see MaxMatchesPerSelector).
+func ExpandDetectionConfigs(detectionConfigs []*models.DetectionConfiguration, processes []*models.Process) (
+	map[types.Pid]*models.DetectionConfiguration, error) {
+	expandedConfigs := make(map[types.Pid]*models.DetectionConfiguration, len(detectionConfigs))
+	selectorConfigs := make([]*models.DetectionConfiguration, 0)
+
+	for _, detectionConfig := range detectionConfigs {
+		if detectionConfig.SelectsProcesses() {
+			selectorConfigs = append(selectorConfigs, detectionConfig)
+			continue
+		}
+		expandedConfigs[detectionConfig.Pid] = detectionConfig
+	}
+
+	sort.SliceStable(selectorConfigs, func(i, j int) bool {
+		return selectorConfigs[i].CreatedAt.Time.Before(selectorConfigs[j].CreatedAt.Time)
+	})
+
+	var errs error
+	for _, selectorConfig := range selectorConfigs {
+		if !selectorConfig.IsRelevant {
+			continue
+		}
+
+		matcher, err := NewMatcher(selectorConfig.Selector)
+		if err != nil {
+			errs = multierror.Append(errs, errors.WithMessagef(err, "detection config '%s'", selectorConfig.ID))
+			continue
+		}
+
+		matches := make([]*models.Process, 0)
+		for _, process := range processes {
+			if _, configured := expandedConfigs[process.Pid]; !configured && matcher.Matches(process) {
+				matches = append(matches, process)
+			}
+		}
+
+		if len(matches) > MaxMatchesPerSelector {
+			sort.SliceStable(matches, func(i, j int) bool {
+				return matches[i].CreateTime.Time.Before(matches[j].CreateTime.Time)
+			})
+			errs = multierror.Append(errs, errors.Errorf("detection config '%s' matches %d processes, dropped "+
+				"all but the earliest started %d", selectorConfig.ID, len(matches), MaxMatchesPerSelector))
+			matches = matches[:MaxMatchesPerSelector]
+		}
+
+		for _, process := range matches {
+			processConfig := *selectorConfig
+			processConfig.Pid = process.Pid
+			processConfig.ProcessCreateTime = process.CreateTime
+			expandedConfigs[process.Pid] = &processConfig
+		}
+	}
+
+	return expandedConfigs, errs
+}
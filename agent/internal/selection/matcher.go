@@ -0,0 +1,111 @@
+package selection
+
+import (
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Matcher is a compiled process selector.
+type Matcher struct {
+	selector         *models.ProcessSelector
+	cmdlineRegex     *regexp.Regexp
+	podLabelSelector *types.LabelSelector
+}
+
+func NewMatcher(selector *models.ProcessSelector) (*Matcher, error) {
+	if valid, err := selector.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate selector")
+	}
+
+	matcher := &Matcher{
+		selector: selector,
+	}
+
+	if selector.CmdlineRegex != "" {
+		matcher.cmdlineRegex = regexp.MustCompile(selector.CmdlineRegex) // Validated above.
+	}
+
+	if selector.PodLabelSelector != "" {
+		podLabelSelector, err := types.ParseLabelSelector(selector.PodLabelSelector)
+		if err != nil {
+			return nil, errors.WithMessage(err, "parse pod label selector")
+		}
+		matcher.podLabelSelector = podLabelSelector
+	}
+
+	return matcher, nil
+}
+
+func (m *Matcher) Matches(process *models.Process) bool {
+	selector := m.selector
+
+	if selector.ExecutableGlob != "" && !matchExecutable(selector.ExecutableGlob, process.Executable) {
+		return false
+	}
+
+	if m.cmdlineRegex != nil && !m.cmdlineRegex.MatchString(process.CommandLine) {
+		return false
+	}
+
+	if selector.Uid.Valid && (!process.Uid.Valid || process.Uid.Int64 != selector.Uid.Int64) {
+		return false
+	}
+
+	if selector.CgroupPath != "" && !matchCgroup(selector.CgroupPath, process.CgroupPath) {
+		return false
+	}
+
+	if selector.SystemdUnit != "" && selector.SystemdUnit != process.SystemdUnit {
+		return false
+	}
+
+	if selector.ContainerId != "" && (process.ContainerId == "" ||
+		!strings.HasPrefix(process.ContainerId, selector.ContainerId)) {
+		return false
+	}
+
+	if (selector.PodNamespace != "" || m.podLabelSelector != nil) && !m.matchPod(process.Container) {
+		return false
+	}
+
+	return true
+}
+
+// Processes outside of pods never match pod criteria, even negative label requirements (e.g "!canary").
+func (m *Matcher) matchPod(container *models.Container) bool {
+	if container == nil || container.PodUid == "" {
+		return false
+	}
+
+	if m.selector.PodNamespace != "" && m.selector.PodNamespace != container.PodNamespace {
+		return false
+	}
+
+	return m.podLabelSelector == nil || m.podLabelSelector.Matches(container.PodLabels)
+}
+
+func matchExecutable(glob string, executable string) bool {
+	if executable == "" {
+		return false
+	}
+
+	if !strings.Contains(glob, "/") {
+		executable = path.Base(executable)
+	}
+
+	matched, _ := path.Match(glob, executable) // Validated by NewMatcher().
+	return matched
+}
+
+func matchCgroup(selectedPath string, cgroupPath string) bool {
+	if cgroupPath == "" {
+		return false
+	}
+
+	selectedPath = strings.TrimSuffix(selectedPath, "/")
+	return cgroupPath == selectedPath || strings.HasPrefix(cgroupPath, selectedPath+"/")
+}
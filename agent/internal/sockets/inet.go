@@ -0,0 +1,157 @@
+package sockets
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Protocol string
+
+const (
+	ProtocolTcp  Protocol = "tcp"
+	ProtocolTcp6 Protocol = "tcp6"
+	ProtocolUdp  Protocol = "udp"
+	ProtocolUdp6 Protocol = "udp6"
+)
+
+var InetProtocols = []Protocol{ProtocolTcp, ProtocolTcp6, ProtocolUdp, ProtocolUdp6}
+
+// TCP states, as in include/net/tcp_states.h.
+var tcpStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0a: "LISTEN",
+	0x0b: "CLOSING",
+	0x0c: "NEW_SYN_RECV",
+}
+
+const StateListen = "LISTEN"
+
+// InetSocket is a line of /proc/<pid>/net/{tcp,tcp6,udp,udp6}.
+type InetSocket struct {
+	Protocol      Protocol `json:"protocol"`
+	LocalAddress  net.IP   `json:"local_address"`
+	LocalPort     int      `json:"local_port"`
+	RemoteAddress net.IP   `json:"remote_address"`
+	RemotePort    int      `json:"remote_port"`
+	State         string   `json:"state,omitempty"` // TCP only.
+	Uid           int      `json:"uid"`
+	Inode         uint64   `json:"inode"`
+}
+
+func (is *InetSocket) Listening() bool {
+	return is.State == StateListen
+}
+
+// Returns the sockets of the process' network namespace, which may be other processes'.
+func ReadInetSockets(pid types.Pid, protocol Protocol) ([]*InetSocket, error) {
+	path := fmt.Sprintf("/proc/%d/net/%s", pid, protocol)
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) { // E.g, IPv6 is disabled.
+			return nil, nil
+		}
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	inetSockets := make([]*InetSocket, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Header.
+	for scanner.Scan() {
+		inetSocket, err := parseInetSocket(protocol, scanner.Text())
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse '%s' line '%s'", path, scanner.Text())
+		}
+		inetSockets = append(inetSockets, inetSocket)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return inetSockets, nil
+}
+
+// e.g "0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000 1000 0 12345 ..."
+func parseInetSocket(protocol Protocol, line string) (*InetSocket, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return nil, errors.New("too few fields")
+	}
+
+	localAddress, localPort, err := parseInetAddress(fields[1])
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse local address")
+	}
+	remoteAddress, remotePort, err := parseInetAddress(fields[2])
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse remote address")
+	}
+
+	state, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse state")
+	}
+	uid, err := strconv.Atoi(fields[7])
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse uid")
+	}
+	inode, err := strconv.ParseUint(fields[9], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse inode")
+	}
+
+	inetSocket := &InetSocket{
+		Protocol:      protocol,
+		LocalAddress:  localAddress,
+		LocalPort:     localPort,
+		RemoteAddress: remoteAddress,
+		RemotePort:    remotePort,
+		Uid:           uid,
+		Inode:         inode,
+	}
+	if protocol == ProtocolTcp || protocol == ProtocolTcp6 {
+		inetSocket.State = tcpStates[state]
+	}
+	return inetSocket, nil
+}
+
+// Addresses are hex encoded 32-bit words in host byte order (little-endian on supported architectures), followed by
+// the hex encoded port.
+func parseInetAddress(address string) (net.IP, int, error) {
+	parts := strings.SplitN(address, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, errors.Errorf("invalid address '%s'", address)
+	}
+
+	encodedIp, err := hex.DecodeString(parts[0])
+	if err != nil || (len(encodedIp) != net.IPv4len && len(encodedIp) != net.IPv6len) {
+		return nil, 0, errors.Errorf("invalid ip '%s'", parts[0])
+	}
+
+	ip := make(net.IP, len(encodedIp))
+	for word := 0; word < len(encodedIp); word += 4 {
+		binary.BigEndian.PutUint32(ip[word:], binary.LittleEndian.Uint32(encodedIp[word:]))
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, errors.WithMessage(err, "parse port")
+	}
+	return ip, int(port), nil
+}
@@ -0,0 +1,75 @@
+package sockets
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Returns the inodes of the process' sockets, mapped to the fds referring to them.
+func SocketInodes(pid types.Pid) (map[uint64]int, error) {
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list fds")
+	}
+
+	inodes := make(map[uint64]int, 0)
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil { // Closed meanwhile.
+			continue
+		}
+
+		if inode, isSocket := ParseSocketLink(target); isSocket {
+			inodes[inode] = fd
+		}
+	}
+	return inodes, nil
+}
+
+// Parses an fd's link, e.g "socket:[12345]".
+func ParseSocketLink(target string) (uint64, bool) {
+	if !strings.HasPrefix(target, "socket:[") || !strings.HasSuffix(target, "]") {
+		return 0, false
+	}
+
+	inode, err := strconv.ParseUint(target[len("socket:["):len(target)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
+
+// Returns the process' own listening TCP sockets, as opposed to ones of other processes in its network namespace.
+func ListeningTcpSockets(pid types.Pid) ([]*InetSocket, error) {
+	inodes, err := SocketInodes(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	listening := make([]*InetSocket, 0)
+	for _, protocol := range []Protocol{ProtocolTcp, ProtocolTcp6} {
+		inetSockets, err := ReadInetSockets(pid, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, inetSocket := range inetSockets {
+			if _, owned := inodes[inetSocket.Inode]; owned && inetSocket.Listening() {
+				listening = append(listening, inetSocket)
+			}
+		}
+	}
+	return listening, nil
+}
@@ -0,0 +1,106 @@
+package sockets
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const ProtocolUnix Protocol = "unix"
+
+// __SO_ACCEPTCON, set on listening sockets.
+const unixFlagAcceptConnections = 1 << 16
+
+var unixTypes = map[uint64]string{
+	1: "stream",
+	2: "dgram",
+	5: "seqpacket",
+}
+
+// States, as in include/uapi/linux/net.h.
+var unixStates = map[uint64]string{
+	1: "UNCONNECTED",
+	2: "CONNECTING",
+	3: "CONNECTED",
+	4: "DISCONNECTING",
+}
+
+// UnixSocket is a line of /proc/<pid>/net/unix.
+type UnixSocket struct {
+	Type  string `json:"type"`
+	State string `json:"state"`          // LISTEN for listening sockets.
+	Path  string `json:"path,omitempty"` // Prefixed by '@' for abstract addresses, and empty for unbound sockets.
+	Inode uint64 `json:"inode"`
+}
+
+func (us *UnixSocket) Listening() bool {
+	return us.State == StateListen
+}
+
+// Returns the unix sockets of the process' network namespace, which may be other processes'.
+func ReadUnixSockets(pid types.Pid) ([]*UnixSocket, error) {
+	path := fmt.Sprintf("/proc/%d/net/unix", pid)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	unixSockets := make([]*UnixSocket, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Header.
+	for scanner.Scan() {
+		unixSocket, err := parseUnixSocket(scanner.Text())
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse '%s' line '%s'", path, scanner.Text())
+		}
+		unixSockets = append(unixSockets, unixSocket)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return unixSockets, nil
+}
+
+// e.g "0000000000000000: 00000002 00000000 00010000 0001 01 12345 /run/app.sock".
+func parseUnixSocket(line string) (*UnixSocket, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return nil, errors.New("too few fields")
+	}
+
+	flags, err := strconv.ParseUint(fields[3], 16, 32)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse flags")
+	}
+	socketType, err := strconv.ParseUint(fields[4], 16, 16)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse type")
+	}
+	state, err := strconv.ParseUint(fields[5], 16, 8)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse state")
+	}
+	inode, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse inode")
+	}
+
+	unixSocket := &UnixSocket{
+		Type:  unixTypes[socketType],
+		State: unixStates[state],
+		Inode: inode,
+	}
+	if flags&unixFlagAcceptConnections != 0 {
+		unixSocket.State = StateListen
+	}
+	if len(fields) > 7 {
+		unixSocket.Path = strings.Join(fields[7:], " ")
+	}
+	return unixSocket, nil
+}
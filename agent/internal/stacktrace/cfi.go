@@ -0,0 +1,573 @@
+package stacktrace
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Call frame information, as found in .eh_frame sections (see the DWARF standard's "Call Frame Information", and the
+// LSB's "Exception Frames" for .eh_frame's deviations from .debug_frame). Expressions aren't supported, in which
+// case unwinding falls back to frame records.
+
+// Pointer encodings (DW_EH_PE_*).
+const (
+	pointerEncodingOmit    = 0xff
+	pointerFormatMask      = 0x0f
+	pointerApplicationMask = 0x70
+	pointerIndirect        = 0x80
+
+	pointerFormatAbsolute = 0x00
+	pointerFormatUleb128  = 0x01
+	pointerFormatUdata2   = 0x02
+	pointerFormatUdata4   = 0x03
+	pointerFormatUdata8   = 0x04
+	pointerFormatSleb128  = 0x09
+	pointerFormatSdata2   = 0x0a
+	pointerFormatSdata4   = 0x0b
+	pointerFormatSdata8   = 0x0c
+
+	pointerApplicationAbsolute = 0x00
+	pointerApplicationPcRel    = 0x10
+)
+
+// Call frame instructions (DW_CFA_*), where the first three embed their operand in the opcode's low 6 bits.
+const (
+	cfaAdvanceLoc                 = 0x40
+	cfaOffset                     = 0x80
+	cfaRestore                    = 0xc0
+	cfaNop                        = 0x00
+	cfaSetLoc                     = 0x01
+	cfaAdvanceLoc1                = 0x02
+	cfaAdvanceLoc2                = 0x03
+	cfaAdvanceLoc4                = 0x04
+	cfaOffsetExtended             = 0x05
+	cfaRestoreExtended            = 0x06
+	cfaUndefined                  = 0x07
+	cfaSameValue                  = 0x08
+	cfaRegister                   = 0x09
+	cfaRememberState              = 0x0a
+	cfaRestoreState               = 0x0b
+	cfaDefCfa                     = 0x0c
+	cfaDefCfaRegister             = 0x0d
+	cfaDefCfaOffset               = 0x0e
+	cfaDefCfaExpression           = 0x0f
+	cfaExpression                 = 0x10
+	cfaOffsetExtendedSf           = 0x11
+	cfaDefCfaSf                   = 0x12
+	cfaDefCfaOffsetSf             = 0x13
+	cfaValOffset                  = 0x14
+	cfaValOffsetSf                = 0x15
+	cfaValExpression              = 0x16
+	cfaAarch64NegateRaState       = 0x2d // Pointer authentication, return addresses are stripped regardless.
+	cfaGnuArgsSize                = 0x2e
+	cfaGnuNegativeOffsetExtended  = 0x2f
+	cfaHighOpcodeMask             = 0xc0
+	cfaLowOperandMask             = 0x3f
+	extendedLengthEscape          = 0xffffffff
+	maxCfiInstructionsPerFdeCount = 1 << 16 // Guards against malformed instructions.
+)
+
+var errUnsupportedCfi = errors.New("unsupported call frame information")
+
+type ruleKind int
+
+// Registers without a rule keep their value ("same value").
+const (
+	ruleUndefined   ruleKind = iota
+	ruleSameValue            // Unchanged from the callee.
+	ruleOffset               // Saved at CFA + offset.
+	ruleValOffset            // Is CFA + offset.
+	ruleRegister             // Saved in another register.
+	ruleUnsupported          // Expressions.
+)
+
+type registerRule struct {
+	kind     ruleKind
+	offset   int64
+	register int
+}
+
+type cfaRule struct {
+	register    int
+	offset      int64
+	unsupported bool // Expressions.
+}
+
+// unwindRow describes how to recover the caller's registers at an instruction.
+type unwindRow struct {
+	cfa   cfaRule
+	rules map[int]registerRule
+}
+
+func newUnwindRow() *unwindRow {
+	return &unwindRow{rules: make(map[int]registerRule, 0)}
+}
+
+func (ur *unwindRow) clone() *unwindRow {
+	cloned := &unwindRow{cfa: ur.cfa, rules: make(map[int]registerRule, len(ur.rules))}
+	for register, rule := range ur.rules {
+		cloned.rules[register] = rule
+	}
+	return cloned
+}
+
+type cie struct {
+	codeAlignment         uint64
+	dataAlignment         int64
+	returnAddressRegister int
+	fdeEncoding           byte
+	hasAugmentationData   bool
+	initialInstructions   []byte
+}
+
+type fde struct {
+	cie          *cie
+	pcBegin      uint64
+	pcEnd        uint64
+	instructions []byte
+}
+
+type cfiTable struct {
+	fdes []*fde // Sorted by pcBegin.
+}
+
+// Parses an .eh_frame section, whose (virtual) address pc-relative pointers are relative to.
+func parseEhFrame(data []byte, sectionAddress uint64) (*cfiTable, error) {
+	table := &cfiTable{}
+	cies := make(map[int]*cie, 0)
+
+	for offset := 0; offset < len(data); {
+		reader := &cfiReader{data: data, offset: offset, sectionAddress: sectionAddress}
+		length := uint64(reader.u32())
+		if length == extendedLengthEscape {
+			length = reader.u64()
+		}
+		if reader.err != nil {
+			return nil, reader.err
+		} else if length == 0 { // Terminator.
+			break
+		}
+
+		entryEnd := uint64(reader.offset) + length
+		if entryEnd > uint64(len(data)) {
+			return nil, errors.Errorf("entry at '0x%x' overflows section", offset)
+		}
+		reader.data = data[:entryEnd]
+
+		idOffset := reader.offset
+		id := reader.u32()
+		if id != 0 { // FDE, whose id is the offset back to its CIE.
+			entryCie, err := parseCieAt(data, int(idOffset)-int(id), sectionAddress, cies)
+			if err == nil {
+				if entry := parseFde(reader, entryCie); entry != nil {
+					table.fdes = append(table.fdes, entry)
+				}
+			} else if errors.Cause(err) != errUnsupportedCfi { // FDEs of unsupported CIEs are skipped.
+				return nil, errors.WithMessagef(err, "parse cie of fde at '0x%x'", offset)
+			}
+		}
+
+		offset = int(entryEnd)
+	}
+
+	sort.Slice(table.fdes, func(i, j int) bool {
+		return table.fdes[i].pcBegin < table.fdes[j].pcBegin
+	})
+	return table, nil
+}
+
+func parseCieAt(data []byte, offset int, sectionAddress uint64, cies map[int]*cie) (*cie, error) {
+	if parsed, exists := cies[offset]; exists {
+		return parsed, nil
+	} else if offset < 0 || offset >= len(data) {
+		return nil, errors.Errorf("cie offset '%d' out of section", offset)
+	}
+
+	reader := &cfiReader{data: data, offset: offset, sectionAddress: sectionAddress}
+	length := uint64(reader.u32())
+	if length == extendedLengthEscape {
+		length = reader.u64()
+	}
+	entryEnd := uint64(reader.offset) + length
+	if reader.err != nil || entryEnd > uint64(len(data)) {
+		return nil, errors.Errorf("cie at '0x%x' overflows section", offset)
+	}
+	reader.data = data[:entryEnd]
+
+	if id := reader.u32(); id != 0 {
+		return nil, errors.Errorf("entry at '0x%x' isn't a cie", offset)
+	}
+
+	parsed := &cie{fdeEncoding: pointerFormatAbsolute}
+	version := reader.u8()
+	augmentation := reader.cstring()
+	if augmentation != "" && augmentation[0] != 'z' {
+		return nil, errors.Wrapf(errUnsupportedCfi, "augmentation '%s'", augmentation)
+	}
+
+	parsed.codeAlignment = reader.uleb128()
+	parsed.dataAlignment = reader.sleb128()
+	if version == 1 {
+		parsed.returnAddressRegister = int(reader.u8())
+	} else {
+		parsed.returnAddressRegister = int(reader.uleb128())
+	}
+
+	if augmentation != "" {
+		parsed.hasAugmentationData = true
+		augmentationLength := reader.uleb128()
+		augmentationEnd := reader.offset + int(augmentationLength)
+
+	augmentationLoop:
+		for _, char := range augmentation[1:] {
+			switch char {
+			case 'L': // LSDA encoding.
+				reader.u8()
+			case 'P': // Personality routine.
+				reader.skipEncodedValue(reader.u8())
+			case 'R':
+				parsed.fdeEncoding = reader.u8()
+			case 'S', 'B', 'G': // Signal frame, branch target identification and memory tagging.
+			default: // The rest of the augmentation data is skipped below.
+				break augmentationLoop
+			}
+		}
+		reader.offset = augmentationEnd
+	}
+
+	if reader.err != nil {
+		return nil, reader.err
+	} else if reader.offset > len(reader.data) {
+		return nil, errors.Errorf("cie at '0x%x' overflows its entry", offset)
+	}
+
+	parsed.initialInstructions = reader.data[reader.offset:]
+	cies[offset] = parsed
+	return parsed, nil
+}
+
+// Returns nil for FDEs which can't be used, such as ones of discarded functions.
+func parseFde(reader *cfiReader, entryCie *cie) *fde {
+	pcBegin := reader.encodedPointer(entryCie.fdeEncoding)
+	pcRange := reader.encodedValue(entryCie.fdeEncoding & pointerFormatMask)
+	if entryCie.hasAugmentationData {
+		augmentationLength := reader.uleb128()
+		reader.offset += int(augmentationLength)
+	}
+
+	if reader.err != nil || reader.offset > len(reader.data) || pcBegin == 0 || pcRange == 0 {
+		return nil
+	}
+
+	return &fde{
+		cie:          entryCie,
+		pcBegin:      pcBegin,
+		pcEnd:        pcBegin + pcRange,
+		instructions: reader.data[reader.offset:],
+	}
+}
+
+func (ct *cfiTable) find(pc uint64) *fde {
+	index := sort.Search(len(ct.fdes), func(i int) bool {
+		return ct.fdes[i].pcBegin > pc
+	}) - 1
+	if index < 0 || pc >= ct.fdes[index].pcEnd {
+		return nil
+	}
+	return ct.fdes[index]
+}
+
+// Returns the row of the FDE's unwind table which applies to pc.
+func (f *fde) row(pc uint64) (*unwindRow, error) {
+	initialRow := newUnwindRow()
+	if err := executeCfiInstructions(f.cie, f.cie.initialInstructions, initialRow, nil, 0, 0); err != nil {
+		return nil, errors.WithMessage(err, "execute cie's initial instructions")
+	}
+
+	row := initialRow.clone()
+	if err := executeCfiInstructions(f.cie, f.instructions, row, initialRow, f.pcBegin, pc); err != nil {
+		return nil, errors.WithMessage(err, "execute fde's instructions")
+	}
+	return row, nil
+}
+
+// Executes instructions until the location advances past targetPc. CIE's initial instructions (which have no
+// initial row) don't advance the location.
+func executeCfiInstructions(entryCie *cie, instructions []byte, row *unwindRow, initialRow *unwindRow,
+	location uint64, targetPc uint64) error {
+	reader := &cfiReader{data: instructions}
+	rememberedRows := make([]*unwindRow, 0)
+
+	advance := func(delta uint64) bool {
+		location += delta * entryCie.codeAlignment
+		return location > targetPc
+	}
+	restore := func(register int) { // Only called for FDEs' instructions, which have an initial row.
+		if rule, exists := initialRow.rules[register]; exists {
+			row.rules[register] = rule
+		} else {
+			delete(row.rules, register)
+		}
+	}
+
+	for count := 0; reader.offset < len(reader.data) && reader.err == nil; count++ {
+		if count == maxCfiInstructionsPerFdeCount {
+			return errors.New("too many instructions")
+		}
+
+		opcode := reader.u8()
+		operand := int(opcode & cfaLowOperandMask)
+
+		switch opcode & cfaHighOpcodeMask {
+		case cfaAdvanceLoc:
+			if initialRow != nil && advance(uint64(operand)) {
+				return reader.err
+			}
+			continue
+		case cfaOffset:
+			row.rules[operand] = registerRule{kind: ruleOffset, offset: int64(reader.uleb128()) * entryCie.dataAlignment}
+			continue
+		case cfaRestore:
+			if initialRow != nil {
+				restore(operand)
+			}
+			continue
+		}
+
+		switch opcode {
+		case cfaNop, cfaAarch64NegateRaState:
+		case cfaSetLoc:
+			return errors.Wrap(errUnsupportedCfi, "set_loc")
+		case cfaAdvanceLoc1, cfaAdvanceLoc2, cfaAdvanceLoc4:
+			var delta uint64
+			switch opcode {
+			case cfaAdvanceLoc1:
+				delta = uint64(reader.u8())
+			case cfaAdvanceLoc2:
+				delta = uint64(reader.u16())
+			default:
+				delta = uint64(reader.u32())
+			}
+			if initialRow != nil && advance(delta) {
+				return reader.err
+			}
+		case cfaOffsetExtended:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleOffset, offset: int64(reader.uleb128()) * entryCie.dataAlignment}
+		case cfaOffsetExtendedSf:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleOffset, offset: reader.sleb128() * entryCie.dataAlignment}
+		case cfaGnuNegativeOffsetExtended:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleOffset,
+				offset: -int64(reader.uleb128()) * entryCie.dataAlignment}
+		case cfaValOffset:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleValOffset,
+				offset: int64(reader.uleb128()) * entryCie.dataAlignment}
+		case cfaValOffsetSf:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleValOffset, offset: reader.sleb128() * entryCie.dataAlignment}
+		case cfaRestoreExtended:
+			register := int(reader.uleb128())
+			if initialRow != nil {
+				restore(register)
+			}
+		case cfaUndefined:
+			row.rules[int(reader.uleb128())] = registerRule{kind: ruleUndefined}
+		case cfaSameValue:
+			row.rules[int(reader.uleb128())] = registerRule{kind: ruleSameValue}
+		case cfaRegister:
+			register := int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleRegister, register: int(reader.uleb128())}
+		case cfaRememberState:
+			rememberedRows = append(rememberedRows, row.clone())
+		case cfaRestoreState:
+			if len(rememberedRows) == 0 {
+				return errors.New("restore state without a remembered state")
+			}
+			remembered := rememberedRows[len(rememberedRows)-1]
+			rememberedRows = rememberedRows[:len(rememberedRows)-1]
+			*row = *remembered
+		case cfaDefCfa:
+			row.cfa = cfaRule{register: int(reader.uleb128()), offset: int64(reader.uleb128())}
+		case cfaDefCfaSf:
+			row.cfa = cfaRule{register: int(reader.uleb128()), offset: reader.sleb128() * entryCie.dataAlignment}
+		case cfaDefCfaRegister:
+			row.cfa.register = int(reader.uleb128())
+			row.cfa.unsupported = false
+		case cfaDefCfaOffset:
+			row.cfa.offset = int64(reader.uleb128())
+		case cfaDefCfaOffsetSf:
+			row.cfa.offset = reader.sleb128() * entryCie.dataAlignment
+		case cfaDefCfaExpression:
+			reader.offset += int(reader.uleb128())
+			row.cfa = cfaRule{unsupported: true}
+		case cfaExpression, cfaValExpression:
+			register := int(reader.uleb128())
+			reader.offset += int(reader.uleb128())
+			row.rules[register] = registerRule{kind: ruleUnsupported}
+		case cfaGnuArgsSize:
+			reader.uleb128()
+		default:
+			return errors.Wrapf(errUnsupportedCfi, "opcode '0x%x'", opcode)
+		}
+	}
+
+	return reader.err
+}
+
+// cfiReader reads little-endian call frame information, where the first read beyond the data sticks as an error.
+type cfiReader struct {
+	data           []byte
+	offset         int
+	sectionAddress uint64
+	err            error
+}
+
+func (cr *cfiReader) next(size int) []byte {
+	if cr.err != nil {
+		return nil
+	} else if cr.offset < 0 || cr.offset+size > len(cr.data) {
+		cr.err = errors.New("unexpected end of call frame information")
+		return nil
+	}
+
+	bytes := cr.data[cr.offset : cr.offset+size]
+	cr.offset += size
+	return bytes
+}
+
+func (cr *cfiReader) u8() byte {
+	if bytes := cr.next(1); bytes != nil {
+		return bytes[0]
+	}
+	return 0
+}
+
+func (cr *cfiReader) u16() uint16 {
+	if bytes := cr.next(2); bytes != nil {
+		return binary.LittleEndian.Uint16(bytes)
+	}
+	return 0
+}
+
+func (cr *cfiReader) u32() uint32 {
+	if bytes := cr.next(4); bytes != nil {
+		return binary.LittleEndian.Uint32(bytes)
+	}
+	return 0
+}
+
+func (cr *cfiReader) u64() uint64 {
+	if bytes := cr.next(8); bytes != nil {
+		return binary.LittleEndian.Uint64(bytes)
+	}
+	return 0
+}
+
+func (cr *cfiReader) uleb128() uint64 {
+	var value uint64
+	for shift := uint(0); ; shift += 7 {
+		bytes := cr.next(1)
+		if bytes == nil {
+			return 0
+		}
+		if shift < 64 {
+			value |= uint64(bytes[0]&0x7f) << shift
+		}
+		if bytes[0]&0x80 == 0 {
+			return value
+		}
+	}
+}
+
+func (cr *cfiReader) sleb128() int64 {
+	var value int64
+	var shift uint
+	for {
+		bytes := cr.next(1)
+		if bytes == nil {
+			return 0
+		}
+		if shift < 64 {
+			value |= int64(bytes[0]&0x7f) << shift
+		}
+		shift += 7
+		if bytes[0]&0x80 == 0 {
+			if shift < 64 && bytes[0]&0x40 != 0 {
+				value |= -1 << shift
+			}
+			return value
+		}
+	}
+}
+
+func (cr *cfiReader) cstring() string {
+	for end := cr.offset; end < len(cr.data); end++ {
+		if cr.data[end] == 0 {
+			value := string(cr.data[cr.offset:end])
+			cr.offset = end + 1
+			return value
+		}
+	}
+
+	cr.err = errors.New("unterminated string in call frame information")
+	return ""
+}
+
+// Reads a value by its pointer encoding's format, without applying it.
+func (cr *cfiReader) encodedValue(format byte) uint64 {
+	switch format {
+	case pointerFormatAbsolute, pointerFormatUdata8, pointerFormatSdata8:
+		return cr.u64()
+	case pointerFormatUleb128:
+		return cr.uleb128()
+	case pointerFormatUdata2:
+		return uint64(cr.u16())
+	case pointerFormatUdata4:
+		return uint64(cr.u32())
+	case pointerFormatSleb128:
+		return uint64(cr.sleb128())
+	case pointerFormatSdata2:
+		return uint64(int64(int16(cr.u16())))
+	case pointerFormatSdata4:
+		return uint64(int64(int32(cr.u32())))
+	}
+
+	if cr.err == nil {
+		cr.err = errors.Wrapf(errUnsupportedCfi, "pointer format '0x%x'", format)
+	}
+	return 0
+}
+
+func (cr *cfiReader) skipEncodedValue(encoding byte) {
+	if encoding != pointerEncodingOmit {
+		cr.encodedValue(encoding & pointerFormatMask)
+	}
+}
+
+func (cr *cfiReader) encodedPointer(encoding byte) uint64 {
+	if encoding == pointerEncodingOmit {
+		return 0
+	}
+
+	fieldAddress := cr.sectionAddress + uint64(cr.offset)
+	value := cr.encodedValue(encoding & pointerFormatMask)
+
+	switch encoding & pointerApplicationMask {
+	case pointerApplicationAbsolute:
+	case pointerApplicationPcRel:
+		value += fieldAddress
+	default:
+		if cr.err == nil {
+			cr.err = errors.Wrapf(errUnsupportedCfi, "pointer application '0x%x'", encoding&pointerApplicationMask)
+		}
+	}
+
+	if encoding&pointerIndirect != 0 && cr.err == nil {
+		cr.err = errors.Wrap(errUnsupportedCfi, "indirect pointer")
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+package stacktrace
+
+import (
+	"debug/elf"
+	"testing"
+)
+
+// DWARF register numbers of x86-64, which testdata/cfi.elf is built for (regardless of the host running the tests).
+const (
+	amd64Rbp           = 6
+	amd64Rsp           = 7
+	amd64ReturnAddress = 16
+)
+
+// Parses the .eh_frame of testdata/cfi.elf (see testdata/cfi.c), and returns its functions' addresses by name.
+func loadTestCfi(t *testing.T) (*cfiTable, map[string]uint64) {
+	file, err := elf.Open("testdata/cfi.elf")
+	if err != nil {
+		t.Fatalf("open test elf: %v", err)
+	}
+	defer file.Close()
+
+	section := file.Section(".eh_frame")
+	if section == nil {
+		t.Fatal("test elf has no .eh_frame section")
+	}
+	data, err := section.Data()
+	if err != nil {
+		t.Fatalf("read .eh_frame: %v", err)
+	}
+
+	table, err := parseEhFrame(data, section.Addr)
+	if err != nil {
+		t.Fatalf("parse .eh_frame: %v", err)
+	}
+
+	symbols, err := file.Symbols()
+	if err != nil {
+		t.Fatalf("read symbols: %v", err)
+	}
+	functions := make(map[string]uint64, len(symbols))
+	for _, symbol := range symbols {
+		if elf.ST_TYPE(symbol.Info) == elf.STT_FUNC {
+			functions[symbol.Name] = symbol.Value
+		}
+	}
+	return table, functions
+}
+
+func TestCfiRows(t *testing.T) {
+	table, functions := loadTestCfi(t)
+
+	// Offsets are of the instructions listed by objdump -d testdata/cfi.elf.
+	tests := []struct {
+		name        string
+		function    string
+		offset      uint64
+		cfaRegister int
+		cfaOffset   int64
+		rbpRule     *registerRule // Nil if rbp has no rule.
+	}{
+		{"entry", "with_frame_pointer", 0x0, amd64Rsp, 8, nil},
+		{"after push rbp", "with_frame_pointer", 0x1, amd64Rsp, 16, &registerRule{kind: ruleOffset, offset: -16}},
+		{"after mov rsp to rbp", "with_frame_pointer", 0x4, amd64Rbp, 16, &registerRule{kind: ruleOffset, offset: -16}},
+		{"body", "with_frame_pointer", 0xa, amd64Rbp, 16, &registerRule{kind: ruleOffset, offset: -16}},
+		{"after pop rbp", "with_frame_pointer", 0x13, amd64Rsp, 8, &registerRule{kind: ruleOffset, offset: -16}},
+		{"entry", "without_frame_pointer", 0x0, amd64Rsp, 8, nil},
+		{"after sub rsp", "without_frame_pointer", 0x4, amd64Rsp, 96, nil},
+		{"call", "without_frame_pointer", 0x20, amd64Rsp, 96, nil},
+		{"after add rsp", "without_frame_pointer", 0x29, amd64Rsp, 8, nil},
+	}
+
+	for _, test := range tests {
+		address, found := functions[test.function]
+		if !found {
+			t.Fatalf("function '%s' not found in test elf", test.function)
+		}
+		pc := address + test.offset
+
+		entry := table.find(pc)
+		if entry == nil {
+			t.Errorf("%s %s: no fde found for '0x%x'", test.function, test.name, pc)
+			continue
+		}
+		row, err := entry.row(pc)
+		if err != nil {
+			t.Errorf("%s %s: row of '0x%x': %v", test.function, test.name, pc, err)
+			continue
+		}
+
+		if row.cfa != (cfaRule{register: test.cfaRegister, offset: test.cfaOffset}) {
+			t.Errorf("%s %s: cfa = %+v, expected register %d + %d", test.function, test.name, row.cfa,
+				test.cfaRegister, test.cfaOffset)
+		}
+		if rule := row.rules[amd64ReturnAddress]; rule != (registerRule{kind: ruleOffset, offset: -8}) {
+			t.Errorf("%s %s: return address rule = %+v, expected cfa - 8", test.function, test.name, rule)
+		}
+		if rule, exists := row.rules[amd64Rbp]; test.rbpRule == nil && exists {
+			t.Errorf("%s %s: unexpected rbp rule %+v", test.function, test.name, rule)
+		} else if test.rbpRule != nil && rule != *test.rbpRule {
+			t.Errorf("%s %s: rbp rule = %+v, expected %+v", test.function, test.name, rule, *test.rbpRule)
+		}
+	}
+}
+
+func TestCfiFindOutsideFunctions(t *testing.T) {
+	table, functions := loadTestCfi(t)
+
+	if entry := table.find(functions["with_frame_pointer"] - 1); entry != nil {
+		t.Errorf("fde found before the first function: %+v", entry)
+	}
+	if entry := table.find(functions["_start"] + 0x1000); entry != nil {
+		t.Errorf("fde found past the last function: %+v", entry)
+	}
+}
+
+// Instructions which compilers emit for other kinds of functions (e.g, with several epilogues), run against a CIE like
+// the test elf's.
+func TestCfiInstructions(t *testing.T) {
+	testCie := &cie{codeAlignment: 1, dataAlignment: -8, returnAddressRegister: amd64ReturnAddress}
+	initialInstructions := []byte{cfaDefCfa, amd64Rsp, 8, cfaOffset | amd64ReturnAddress, 1}
+
+	tests := []struct {
+		name         string
+		instructions []byte
+		pcOffset     uint64
+		expectedCfa  cfaRule
+		expectedRbp  *registerRule
+	}{
+		{
+			name: "remember and restore state",
+			instructions: []byte{
+				cfaAdvanceLoc | 1, cfaDefCfaOffset, 16, cfaOffset | amd64Rbp, 2,
+				cfaRememberState,
+				cfaAdvanceLoc | 1, cfaDefCfaOffset, 8, cfaRestore | amd64Rbp,
+				cfaAdvanceLoc | 1, cfaRestoreState,
+			},
+			pcOffset:    3,
+			expectedCfa: cfaRule{register: amd64Rsp, offset: 16},
+			expectedRbp: &registerRule{kind: ruleOffset, offset: -16},
+		},
+		{
+			name: "restore to initial rule",
+			instructions: []byte{
+				cfaAdvanceLoc | 1, cfaDefCfaOffset, 16, cfaOffset | amd64Rbp, 2,
+				cfaAdvanceLoc | 1, cfaRestore | amd64Rbp, cfaDefCfaOffset, 8,
+			},
+			pcOffset:    2,
+			expectedCfa: cfaRule{register: amd64Rsp, offset: 8},
+		},
+		{
+			name:         "instructions past pc are ignored",
+			instructions: []byte{cfaAdvanceLoc | 4, cfaDefCfaRegister, amd64Rbp},
+			pcOffset:     3,
+			expectedCfa:  cfaRule{register: amd64Rsp, offset: 8},
+		},
+		{
+			name:         "expression",
+			instructions: []byte{cfaDefCfaExpression, 2, 0x77, 0x08},
+			pcOffset:     0,
+			expectedCfa:  cfaRule{unsupported: true},
+		},
+	}
+
+	for _, test := range tests {
+		initialRow := newUnwindRow()
+		if err := executeCfiInstructions(testCie, initialInstructions, initialRow, nil, 0, 0); err != nil {
+			t.Fatalf("execute initial instructions: %v", err)
+		}
+
+		row := initialRow.clone()
+		if err := executeCfiInstructions(testCie, test.instructions, row, initialRow, 0, test.pcOffset); err != nil {
+			t.Errorf("%s: execute instructions: %v", test.name, err)
+			continue
+		}
+
+		if row.cfa != test.expectedCfa {
+			t.Errorf("%s: cfa = %+v, expected %+v", test.name, row.cfa, test.expectedCfa)
+		}
+		if rule, exists := row.rules[amd64Rbp]; test.expectedRbp == nil && exists {
+			t.Errorf("%s: unexpected rbp rule %+v", test.name, rule)
+		} else if test.expectedRbp != nil && rule != *test.expectedRbp {
+			t.Errorf("%s: rbp rule = %+v, expected %+v", test.name, rule, *test.expectedRbp)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package stacktrace
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type Config struct {
+	MaxThreads int // Threads beyond are left out, as each is stopped while unwinding.
+	MaxFrames  int // Per thread.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxThreads <= 0 {
+		return false, errors.New("max threads must be positive")
+	} else if c.MaxFrames <= 0 {
+		return false, errors.New("max frames must be positive")
+	}
+
+	return true, nil
+}
+
+// Collects the stacks of the process' threads (up to the max), and returns them along with the number of threads
+// left out. Userspace stacks are unwound while all threads are stopped, while threads which can't be stopped (e.g,
+// blocked in the kernel) are unwound from the registers they blocked with, where possible.
+func CollectThreadStacks(ctx context.Context, pid types.Pid, config *Config) ([]*ThreadStack, int, error) {
+	tids, err := listThreads(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var omittedThreads int
+	if len(tids) > config.MaxThreads {
+		omittedThreads = len(tids) - config.MaxThreads
+		tids = tids[:config.MaxThreads]
+	}
+
+	mappings, err := readMappings(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+	modules := newModuleCache(pid, mappings)
+	defer modules.close()
+
+	memory, err := openProcessMemory(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer memory.close()
+
+	// Kernel stacks are read before stopping threads, as they'd show ptrace's stop otherwise.
+	stacks := make(map[types.Pid]*ThreadStack, len(tids))
+	for _, tid := range tids {
+		stacks[tid] = &ThreadStack{
+			Tid:         tid,
+			Name:        readThreadName(pid, tid),
+			KernelStack: readKernelStack(pid, tid),
+		}
+	}
+
+	inspectStoppedThreads(ctx, tids, func(tid types.Pid, state *frameState, err error) {
+		if errors.Cause(err) == errThreadExited {
+			delete(stacks, tid)
+			return
+		}
+		stack := stacks[tid]
+
+		if errors.Cause(err) == errThreadNotStopped {
+			syscallState, syscallErr := readSyscallFrameState(pid, tid)
+			if syscallErr != nil {
+				stack.Error = errors.WithMessagef(err, "fall back to blocked registers: %v", syscallErr).Error()
+				return
+			}
+			// Only the stack and instruction pointers are known, so unwinding relies on call frame information.
+			state = syscallState
+			stack.Error = "thread didn't stop in time, unwound from its blocked registers"
+		} else if err != nil {
+			stack.Error = err.Error()
+			return
+		}
+
+		frames, err := unwind(state, modules, memory, config.MaxFrames)
+		stack.Frames = frames
+		if err != nil {
+			stack.Error = strings.TrimPrefix(stack.Error+"; unwind: "+err.Error(), "; ")
+		}
+	})
+
+	threadStacks := make([]*ThreadStack, 0, len(stacks))
+	for _, tid := range tids {
+		if stack, exists := stacks[tid]; exists {
+			threadStacks = append(threadStacks, stack)
+		}
+	}
+	return threadStacks, omittedThreads, nil
+}
@@ -0,0 +1,123 @@
+package stacktrace
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const deletedMappingSuffix = " (deleted)"
+
+// Mapping is a line of /proc/<pid>/maps.
+type Mapping struct {
+	Start  uint64
+	End    uint64
+	Perms  string
+	Offset uint64
+	Path   string // Empty for anonymous mappings, bracketed for special ones (e.g "[stack]").
+}
+
+func (m *Mapping) contains(address uint64) bool {
+	return address >= m.Start && address < m.End
+}
+
+// Whether mapping is backed by a file, which may have been deleted (e.g, an upgraded binary).
+func (m *Mapping) fileBacked() bool {
+	return strings.HasPrefix(m.Path, "/")
+}
+
+func (m *Mapping) deleted() bool {
+	return strings.HasSuffix(m.Path, deletedMappingSuffix)
+}
+
+func (m *Mapping) displayPath() string {
+	return strings.TrimSuffix(m.Path, deletedMappingSuffix)
+}
+
+// Returns the process' mappings, sorted by address.
+func readMappings(pid types.Pid) ([]*Mapping, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "open maps")
+	}
+	defer file.Close()
+
+	mappings := make([]*Mapping, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		mapping, err := parseMapping(scanner.Text())
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse mapping '%s'", scanner.Text())
+		}
+		mappings = append(mappings, mapping)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessage(err, "read maps")
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Start < mappings[j].Start
+	})
+	return mappings, nil
+}
+
+// e.g "7f1c2a000000-7f1c2a021000 r-xp 00002000 fd:01 1234 /usr/lib/libc.so.6"
+func parseMapping(line string) (*Mapping, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return nil, errors.New("too few fields")
+	}
+
+	addresses := strings.SplitN(fields[0], "-", 2)
+	if len(addresses) != 2 {
+		return nil, errors.Errorf("invalid address range '%s'", fields[0])
+	}
+
+	start, err := strconv.ParseUint(addresses[0], 16, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse start address")
+	}
+	end, err := strconv.ParseUint(addresses[1], 16, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse end address")
+	}
+	offset, err := strconv.ParseUint(fields[2], 16, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse offset")
+	}
+
+	// Paths may contain spaces, so the path is everything following the inode.
+	path := line
+	for i := 0; i < 5 && path != ""; i++ {
+		path = strings.TrimLeft(path, " ")
+		if separatorIndex := strings.IndexByte(path, ' '); separatorIndex != -1 {
+			path = path[separatorIndex:]
+		} else {
+			path = ""
+		}
+	}
+	path = strings.TrimSpace(path)
+
+	return &Mapping{
+		Start:  start,
+		End:    end,
+		Perms:  fields[1],
+		Offset: offset,
+		Path:   path,
+	}, nil
+}
+
+func findMapping(mappings []*Mapping, address uint64) *Mapping {
+	index := sort.Search(len(mappings), func(i int) bool {
+		return mappings[i].End > address
+	})
+	if index < len(mappings) && mappings[index].contains(address) {
+		return mappings[index]
+	}
+	return nil
+}
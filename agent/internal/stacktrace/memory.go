@@ -0,0 +1,34 @@
+package stacktrace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// processMemory reads a (stopped) process' memory. Supported architectures are all little-endian.
+type processMemory struct {
+	file *os.File
+}
+
+func openProcessMemory(pid types.Pid) (*processMemory, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "open process memory")
+	}
+	return &processMemory{file: file}, nil
+}
+
+func (pm *processMemory) readUint64(address uint64) (uint64, error) {
+	var buffer [8]byte
+	if _, err := pm.file.ReadAt(buffer[:], int64(address)); err != nil {
+		return 0, errors.WithMessagef(err, "read memory at '0x%x'", address)
+	}
+	return binary.LittleEndian.Uint64(buffer[:]), nil
+}
+
+func (pm *processMemory) close() error {
+	return pm.file.Close()
+}
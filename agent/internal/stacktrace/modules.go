@@ -0,0 +1,288 @@
+package stacktrace
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"sort"
+)
+
+// Separate debug files are looked up by build id and debug link, within the process' root (see gdb's "Separate
+// Debug Files").
+const (
+	debugFilesDir      = "/usr/lib/debug"
+	buildIdNoteName    = "GNU"
+	buildIdNoteType    = 3 // NT_GNU_BUILD_ID.
+	buildIdSection     = ".note.gnu.build-id"
+	debugLinkSection   = ".gnu_debuglink"
+	ehFrameSection     = ".eh_frame"
+	gnuIfuncSymbolType = 10 // STT_GNU_IFUNC.
+)
+
+// module is a mapped ELF file, whose addresses are virtual addresses as linked (rather than as mapped).
+type module struct {
+	file    *elf.File
+	loads   []*elf.Prog
+	symbols []elf.Symbol // Functions, sorted by address.
+	dwarf   *dwarf.Data  // Nil without debug info.
+	cfi     *cfiTable    // Nil without (supported) call frame information.
+	closers []*elf.File
+	pcLines map[uint64]*dwarf.LineEntry
+}
+
+// Opens a mapping's file through the process' root, so files of other mount namespaces (e.g, containers) are found.
+// Deleted files are still reachable through map_files.
+func openModule(pid types.Pid, mapping *Mapping) (*module, error) {
+	var paths []string
+	if !mapping.deleted() {
+		paths = append(paths, fmt.Sprintf("/proc/%d/root%s", pid, mapping.Path))
+	}
+	paths = append(paths, fmt.Sprintf("/proc/%d/map_files/%x-%x", pid, mapping.Start, mapping.End))
+
+	var (
+		file *elf.File
+		err  error
+	)
+	for _, path := range paths {
+		if file, err = elf.Open(path); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open '%s'", mapping.Path)
+	}
+
+	loadedModule := &module{
+		file:    file,
+		closers: []*elf.File{file},
+		pcLines: make(map[uint64]*dwarf.LineEntry, 0),
+	}
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_LOAD {
+			loadedModule.loads = append(loadedModule.loads, prog)
+		}
+	}
+
+	if section := file.Section(ehFrameSection); section != nil && section.Type != elf.SHT_NOBITS {
+		if data, err := section.Data(); err == nil {
+			loadedModule.cfi, _ = parseEhFrame(data, section.Addr) // Falls back to frame records.
+		}
+	}
+
+	loadedModule.symbols = functionSymbols(file)
+	loadedModule.dwarf, _ = file.DWARF()
+
+	// Stripped files' symbols and debug info may be found in separate debug files.
+	if loadedModule.dwarf == nil || len(loadedModule.symbols) == 0 {
+		if debugFile := openDebugFile(pid, mapping.displayPath(), file); debugFile != nil {
+			loadedModule.closers = append(loadedModule.closers, debugFile)
+			if loadedModule.dwarf == nil {
+				loadedModule.dwarf, _ = debugFile.DWARF()
+			}
+			if debugSymbols := functionSymbols(debugFile); len(debugSymbols) > len(loadedModule.symbols) {
+				loadedModule.symbols = debugSymbols
+			}
+		}
+	}
+
+	return loadedModule, nil
+}
+
+func functionSymbols(file *elf.File) []elf.Symbol {
+	symbols, _ := file.Symbols()
+	dynamicSymbols, _ := file.DynamicSymbols()
+
+	functions := make([]elf.Symbol, 0, len(symbols)+len(dynamicSymbols))
+	for _, symbol := range append(symbols, dynamicSymbols...) {
+		symbolType := elf.ST_TYPE(symbol.Info)
+		if (symbolType == elf.STT_FUNC || symbolType == gnuIfuncSymbolType) && symbol.Value != 0 {
+			functions = append(functions, symbol)
+		}
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Value < functions[j].Value
+	})
+	return functions
+}
+
+func openDebugFile(pid types.Pid, path string, file *elf.File) *elf.File {
+	root := fmt.Sprintf("/proc/%d/root", pid)
+	candidates := make([]string, 0)
+
+	if buildId := readBuildId(file); len(buildId) > 1 {
+		encodedId := hex.EncodeToString(buildId)
+		candidates = append(candidates,
+			filepath.Join(root, debugFilesDir, ".build-id", encodedId[:2], encodedId[2:]+".debug"))
+	}
+
+	if section := file.Section(debugLinkSection); section != nil {
+		if data, err := section.Data(); err == nil {
+			if nameEnd := bytes.IndexByte(data, 0); nameEnd > 0 {
+				name, dir := string(data[:nameEnd]), filepath.Dir(path)
+				candidates = append(candidates,
+					filepath.Join(root, debugFilesDir, dir, name),
+					filepath.Join(root, dir, ".debug", name))
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if debugFile, err := elf.Open(candidate); err == nil {
+			return debugFile
+		}
+	}
+	return nil
+}
+
+// Build ids are stored in a note: name size, description size and type, followed by the (4-byte aligned) name and
+// description, which is the id.
+func readBuildId(file *elf.File) []byte {
+	section := file.Section(buildIdSection)
+	if section == nil {
+		return nil
+	}
+	data, err := section.Data()
+	if err != nil || len(data) < 12 {
+		return nil
+	}
+
+	nameSize := uint64(file.ByteOrder.Uint32(data))
+	descriptionSize := uint64(file.ByteOrder.Uint32(data[4:]))
+	noteType := file.ByteOrder.Uint32(data[8:])
+
+	descriptionOffset := 12 + (nameSize+3)&^3
+	if noteType != buildIdNoteType || descriptionOffset+descriptionSize > uint64(len(data)) ||
+		string(bytes.TrimRight(data[12:12+nameSize], "\x00")) != buildIdNoteName {
+		return nil
+	}
+	return data[descriptionOffset : descriptionOffset+descriptionSize]
+}
+
+// Translates a mapped address to the module's virtual address, via the file offset it's mapped from.
+func (m *module) address(mapping *Mapping, mappedAddress uint64) uint64 {
+	fileOffset := mappedAddress - mapping.Start + mapping.Offset
+	for _, load := range m.loads {
+		if fileOffset >= load.Off && fileOffset < load.Off+load.Filesz {
+			return fileOffset - load.Off + load.Vaddr
+		}
+	}
+	return fileOffset
+}
+
+func (m *module) symbol(address uint64) *elf.Symbol {
+	index := sort.Search(len(m.symbols), func(i int) bool {
+		return m.symbols[i].Value > address
+	}) - 1
+	if index < 0 {
+		return nil
+	}
+
+	symbol := &m.symbols[index]
+	if symbol.Size != 0 && address >= symbol.Value+symbol.Size {
+		return nil
+	}
+	return symbol
+}
+
+func (m *module) line(address uint64) *dwarf.LineEntry {
+	if m.dwarf == nil {
+		return nil
+	} else if entry, cached := m.pcLines[address]; cached {
+		return entry
+	}
+
+	var lineEntry *dwarf.LineEntry
+	if unit, err := m.dwarf.Reader().SeekPC(address); err == nil {
+		if lineReader, err := m.dwarf.LineReader(unit); err == nil && lineReader != nil {
+			var entry dwarf.LineEntry
+			if err := lineReader.SeekPC(address, &entry); err == nil {
+				lineEntry = &entry
+			}
+		}
+	}
+
+	m.pcLines[address] = lineEntry
+	return lineEntry
+}
+
+func (m *module) close() {
+	for _, closer := range m.closers {
+		_ = closer.Close()
+	}
+}
+
+// moduleCache opens each mapped file once per collection.
+type moduleCache struct {
+	pid      types.Pid
+	mappings []*Mapping
+	modules  map[string]*module // By mapping path, nil for files which failed to open.
+}
+
+func newModuleCache(pid types.Pid, mappings []*Mapping) *moduleCache {
+	return &moduleCache{
+		pid:      pid,
+		mappings: mappings,
+		modules:  make(map[string]*module, 0),
+	}
+}
+
+// Returns the mapping an address belongs to, along with its module and the module's address for it (if the mapping
+// is of a readable ELF file).
+func (mc *moduleCache) resolve(mappedAddress uint64) (*Mapping, *module, uint64) {
+	mapping := findMapping(mc.mappings, mappedAddress)
+	if mapping == nil || !mapping.fileBacked() {
+		return mapping, nil, 0
+	}
+
+	cachedModule, cached := mc.modules[mapping.Path]
+	if !cached {
+		cachedModule, _ = openModule(mc.pid, mapping) // Still worth reporting the address and mapping.
+		mc.modules[mapping.Path] = cachedModule
+	}
+	if cachedModule == nil {
+		return mapping, nil, 0
+	}
+	return mapping, cachedModule, cachedModule.address(mapping, mappedAddress)
+}
+
+// Return addresses point after the call instruction, which may belong to the next function (or line).
+func (mc *moduleCache) symbolize(pc uint64, isReturnAddress bool) *Frame {
+	frame := &Frame{Address: fmt.Sprintf("0x%x", pc)}
+
+	lookupPc := pc
+	if isReturnAddress && lookupPc > 0 {
+		lookupPc--
+	}
+
+	mapping, frameModule, address := mc.resolve(lookupPc)
+	if mapping != nil {
+		frame.Module = mapping.displayPath()
+	}
+	if frameModule == nil {
+		return frame
+	}
+
+	if symbol := frameModule.symbol(address); symbol != nil {
+		frame.Function = symbol.Name
+		frame.Offset = address + (pc - lookupPc) - symbol.Value
+	}
+	if lineEntry := frameModule.line(address); lineEntry != nil && lineEntry.File != nil {
+		frame.File = lineEntry.File.Name
+		frame.Line = lineEntry.Line
+	}
+	return frame
+}
+
+func (mc *moduleCache) close() {
+	for _, cachedModule := range mc.modules {
+		if cachedModule != nil {
+			cachedModule.close()
+		}
+	}
+}
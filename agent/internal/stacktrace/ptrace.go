@@ -0,0 +1,126 @@
+package stacktrace
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+const (
+	// Threads blocked in the kernel (e.g, uninterruptible sleeps) don't stop until they return to userspace.
+	maxThreadsStopWait = time.Second
+	threadsStopPoll    = time.Millisecond
+)
+
+var (
+	errThreadNotStopped = errors.New("thread didn't stop in time")
+	errThreadExited     = errors.New("thread exited")
+)
+
+// Inspects threads while they're all stopped, by seizing and interrupting them (as opposed to SIGSTOP, which the
+// process could observe). Threads which couldn't be stopped are inspected with their error. Ptrace requests must
+// come from the thread which seized, so a dedicated OS thread is used, which exits along with the goroutine, so the
+// kernel detaches any thread which is left seized.
+func inspectStoppedThreads(ctx context.Context, tids []types.Pid, inspect func(tid types.Pid, state *frameState,
+	err error)) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		runtime.LockOSThread() // Never unlocked, see above.
+
+		seized := make(map[types.Pid]bool, len(tids))
+		for _, tid := range tids {
+			if err := unix.PtraceSeize(int(tid)); err != nil {
+				if err == unix.ESRCH {
+					err = errThreadExited
+				}
+				inspect(tid, nil, errors.WithMessage(err, "seize thread"))
+				continue
+			}
+			if err := unix.PtraceInterrupt(int(tid)); err != nil {
+				inspect(tid, nil, errors.WithMessage(err, "interrupt thread"))
+				continue
+			}
+			seized[tid] = true
+		}
+
+		// Signals reported while stopping are re-injected when detaching.
+		stopped, pendingSignals := waitForStops(ctx, seized)
+		for _, tid := range tids {
+			if !seized[tid] {
+				continue
+			}
+
+			if !stopped[tid] {
+				inspect(tid, nil, errThreadNotStopped)
+				continue
+			}
+
+			state, err := threadFrameState(int(tid))
+			inspect(tid, state, errors.WithMessage(err, "get registers"))
+		}
+
+		for tid := range stopped {
+			_ = detach(tid, pendingSignals[tid])
+		}
+	}()
+
+	<-done
+}
+
+// Returns the threads which stopped, and the signals which stopped some of them (rather than the interrupt). Threads
+// which exited meanwhile are left out.
+func waitForStops(ctx context.Context, seized map[types.Pid]bool) (map[types.Pid]bool, map[types.Pid]syscall.Signal) {
+	stopped := make(map[types.Pid]bool, len(seized))
+	pendingSignals := make(map[types.Pid]syscall.Signal, 0)
+	deadline := time.Now().Add(maxThreadsStopWait)
+
+	pending := make(map[types.Pid]bool, len(seized))
+	for tid := range seized {
+		pending[tid] = true
+	}
+
+	for len(pending) > 0 && time.Now().Before(deadline) && ctx.Err() == nil {
+		for tid := range pending {
+			var status unix.WaitStatus
+			waitedPid, err := unix.Wait4(int(tid), &status, unix.WALL|unix.WNOHANG, nil)
+			if err != nil { // E.g, ECHILD as the thread exited.
+				delete(pending, tid)
+				continue
+			} else if waitedPid != int(tid) {
+				continue
+			}
+
+			switch {
+			case status.Exited() || status.Signaled():
+				delete(pending, tid)
+			case status.Stopped():
+				// Interrupts (and group-stops) are reported as event stops, anything else is a signal delivery.
+				if (uint32(status)>>16)&0xff != unix.PTRACE_EVENT_STOP {
+					pendingSignals[tid] = status.StopSignal()
+				}
+				stopped[tid] = true
+				delete(pending, tid)
+			}
+		}
+
+		if len(pending) > 0 {
+			time.Sleep(threadsStopPoll)
+		}
+	}
+
+	return stopped, pendingSignals
+}
+
+func detach(tid types.Pid, signal syscall.Signal) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_DETACH, uintptr(tid), 0, uintptr(signal), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
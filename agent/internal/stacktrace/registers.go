@@ -0,0 +1,50 @@
+package stacktrace
+
+// Covers the general purpose registers of supported architectures, by their DWARF numbers.
+const maxDwarfRegisters = 33
+
+// registerSet holds a frame's registers by their DWARF numbers, along with which of them are known. Unwinding only
+// recovers some of the caller's registers (e.g, callee-saved ones), so the rest are unknown.
+type registerSet struct {
+	values [maxDwarfRegisters]uint64
+	known  [maxDwarfRegisters]bool
+}
+
+func (rs *registerSet) get(register int) (uint64, bool) {
+	if register < 0 || register >= maxDwarfRegisters || !rs.known[register] {
+		return 0, false
+	}
+	return rs.values[register], true
+}
+
+func (rs *registerSet) set(register int, value uint64) {
+	if register < 0 || register >= maxDwarfRegisters {
+		return
+	}
+	rs.values[register] = value
+	rs.known[register] = true
+}
+
+func (rs *registerSet) unset(register int) {
+	if register < 0 || register >= maxDwarfRegisters {
+		return
+	}
+	rs.known[register] = false
+}
+
+// frameState is the state of a frame while unwinding.
+type frameState struct {
+	pc        uint64
+	registers registerSet
+}
+
+func (fs *frameState) sp() (uint64, bool) {
+	return fs.registers.get(dwarfRegisterSp)
+}
+
+// Built from a thread's /proc/<pid>/task/<tid>/syscall, which only has its stack and instruction pointers.
+func newPartialFrameState(sp uint64, pc uint64) *frameState {
+	state := &frameState{pc: pc}
+	state.registers.set(dwarfRegisterSp, sp)
+	return state
+}
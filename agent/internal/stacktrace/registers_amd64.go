@@ -0,0 +1,51 @@
+package stacktrace
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// See the System V AMD64 psABI, "DWARF Register Number Mapping".
+const (
+	dwarfRegisterFp = 6
+	dwarfRegisterSp = 7
+)
+
+func threadFrameState(tid int) (*frameState, error) {
+	var regs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(tid, &regs); err != nil {
+		return nil, err
+	}
+
+	state := &frameState{pc: regs.Rip}
+	for register, value := range []uint64{regs.Rax, regs.Rdx, regs.Rcx, regs.Rbx, regs.Rsi, regs.Rdi, regs.Rbp,
+		regs.Rsp, regs.R8, regs.R9, regs.R10, regs.R11, regs.R12, regs.R13, regs.R14, regs.R15} {
+		state.registers.set(register, value)
+	}
+	return state, nil
+}
+
+// Frame records are pushed by function prologues: [fp] is the caller's fp, and [fp + 8] the return address.
+func frameRecordStep(state *frameState, memory *processMemory) (*frameState, error) {
+	fp, known := state.registers.get(dwarfRegisterFp)
+	if !known || fp == 0 {
+		return nil, errEndOfStack
+	}
+
+	callerFp, err := memory.readUint64(fp)
+	if err != nil {
+		return nil, err
+	}
+	returnAddress, err := memory.readUint64(fp + 8)
+	if err != nil {
+		return nil, err
+	}
+
+	caller := &frameState{pc: returnAddress}
+	caller.registers.set(dwarfRegisterFp, callerFp)
+	caller.registers.set(dwarfRegisterSp, fp+16)
+	return caller, nil
+}
+
+func stripReturnAddress(returnAddress uint64) uint64 {
+	return returnAddress
+}
@@ -0,0 +1,57 @@
+package stacktrace
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// See the DWARF for the Arm 64-bit Architecture ABI, "DWARF register names".
+const (
+	dwarfRegisterFp = 29
+	dwarfRegisterLr = 30
+	dwarfRegisterSp = 31
+)
+
+// Userspace addresses fit in 48 bits, so higher bits are pointer authentication codes.
+const userAddressMask = 1<<48 - 1
+
+func threadFrameState(tid int) (*frameState, error) {
+	var regs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(tid, &regs); err != nil {
+		return nil, err
+	}
+
+	state := &frameState{pc: regs.Pc}
+	for register, value := range regs.Regs {
+		state.registers.set(register, value)
+	}
+	state.registers.set(dwarfRegisterSp, regs.Sp)
+	return state, nil
+}
+
+// Frame records are stored by function prologues: [fp] is the caller's fp, and [fp + 8] the return address (lr).
+func frameRecordStep(state *frameState, memory *processMemory) (*frameState, error) {
+	fp, known := state.registers.get(dwarfRegisterFp)
+	if !known || fp == 0 {
+		return nil, errEndOfStack
+	}
+
+	callerFp, err := memory.readUint64(fp)
+	if err != nil {
+		return nil, err
+	}
+	returnAddress, err := memory.readUint64(fp + 8)
+	if err != nil {
+		return nil, err
+	}
+	returnAddress = stripReturnAddress(returnAddress)
+
+	caller := &frameState{pc: returnAddress}
+	caller.registers.set(dwarfRegisterFp, callerFp)
+	caller.registers.set(dwarfRegisterLr, returnAddress)
+	caller.registers.set(dwarfRegisterSp, fp+16)
+	return caller, nil
+}
+
+func stripReturnAddress(returnAddress uint64) uint64 {
+	return returnAddress & userAddressMask
+}
@@ -0,0 +1,27 @@
+//go:build !amd64 && !arm64
+// +build !amd64,!arm64
+
+package stacktrace
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	dwarfRegisterFp = -1
+	dwarfRegisterSp = -1
+)
+
+var errUnsupportedArchitecture = errors.New("userspace stacks are unsupported on this architecture")
+
+func threadFrameState(_ int) (*frameState, error) {
+	return nil, errUnsupportedArchitecture
+}
+
+func frameRecordStep(_ *frameState, _ *processMemory) (*frameState, error) {
+	return nil, errUnsupportedArchitecture
+}
+
+func stripReturnAddress(returnAddress uint64) uint64 {
+	return returnAddress
+}
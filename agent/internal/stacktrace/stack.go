@@ -0,0 +1,23 @@
+package stacktrace
+
+import (
+	"github.com/memlab/agent/internal/types"
+)
+
+// ThreadStack is a thread's kernel and userspace stacks, innermost frame first.
+type ThreadStack struct {
+	Tid         types.Pid `json:"tid"`
+	Name        string    `json:"name"`
+	KernelStack []string  `json:"kernel_stack,omitempty"`
+	Frames      []*Frame  `json:"frames,omitempty"`
+	Error       string    `json:"error,omitempty"` // Why userspace frames are missing (or partial).
+}
+
+type Frame struct {
+	Address  string `json:"address"` // Hex, as 64-bit addresses don't survive JSON numbers.
+	Function string `json:"function,omitempty"`
+	Offset   uint64 `json:"offset,omitempty"` // From the function's start.
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Module   string `json:"module,omitempty"` // Mapped file the address belongs to.
+}
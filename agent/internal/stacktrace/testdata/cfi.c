@@ -0,0 +1,21 @@
+// Source of cfi.elf, whose call frame information cfi_test.go checks. Built by:
+//   gcc -O0 -nostdlib -static -fasynchronous-unwind-tables -fcf-protection=none -Wl,--build-id=none -o cfi.elf cfi.c
+
+// Keeps a frame pointer: CFA moves from rsp to rbp once the frame is set up.
+__attribute__((noinline, optimize("no-omit-frame-pointer"))) int with_frame_pointer(int value) {
+    volatile int doubled = value * 2;
+    return doubled;
+}
+
+// Omits the frame pointer: CFA stays relative to rsp, past the locals.
+__attribute__((noinline, optimize("omit-frame-pointer"))) int without_frame_pointer(int value) {
+    volatile char buffer[64];
+    buffer[value & 63] = 1;
+    return with_frame_pointer(buffer[0]);
+}
+
+void _start(void) {
+    without_frame_pointer(1);
+    for (;;) {
+    }
+}
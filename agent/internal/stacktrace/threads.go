@@ -0,0 +1,84 @@
+package stacktrace
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kernel stack lines are prefixed by their address, which is zeroed unless the reader has CAP_SYSLOG.
+var kernelStackAddressPattern = regexp.MustCompile(`^\[<[0-9a-f]+>\]\s*`)
+
+// Returns the process' thread ids, sorted.
+func listThreads(pid types.Pid) ([]types.Pid, error) {
+	entries, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "list threads")
+	}
+
+	tids := make([]types.Pid, 0, len(entries))
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, types.Pid(tid))
+		}
+	}
+
+	sort.Slice(tids, func(i, j int) bool {
+		return tids[i] < tids[j]
+	})
+	return tids, nil
+}
+
+func readThreadName(pid types.Pid, tid types.Pid) string {
+	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/comm", pid, tid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// e.g "[<0>] do_sys_poll+0x3f4/0x5b0" -> "do_sys_poll+0x3f4/0x5b0". Requires root.
+func readKernelStack(pid types.Pid, tid types.Pid) []string {
+	stack, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stack", pid, tid))
+	if err != nil {
+		return nil
+	}
+
+	frames := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(stack)), "\n") {
+		if frame := kernelStackAddressPattern.ReplaceAllString(line, ""); frame != "" {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// Blocked threads' user stack and instruction pointers are exposed as the last two fields of their syscall file,
+// whether they're blocked in a syscall ("<nr> <args...> <sp> <pc>") or not ("-1 <sp> <pc>").
+func readSyscallFrameState(pid types.Pid, tid types.Pid) (*frameState, error) {
+	syscall, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/syscall", pid, tid))
+	if err != nil {
+		return nil, errors.WithMessage(err, "read syscall file")
+	}
+
+	fields := strings.Fields(string(syscall))
+	if len(fields) < 3 {
+		return nil, errors.Errorf("thread isn't blocked ('%s')", strings.TrimSpace(string(syscall)))
+	}
+
+	sp, err := strconv.ParseUint(strings.TrimPrefix(fields[len(fields)-2], "0x"), 16, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse stack pointer")
+	}
+	pc, err := strconv.ParseUint(strings.TrimPrefix(fields[len(fields)-1], "0x"), 16, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse instruction pointer")
+	}
+
+	return newPartialFrameState(sp, pc), nil
+}
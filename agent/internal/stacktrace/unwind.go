@@ -0,0 +1,111 @@
+package stacktrace
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	errEndOfStack      = errors.New("end of stack")
+	errUnknownCfa      = errors.New("cfa's register is unknown")
+	errStackNotGrowing = errors.New("stack pointer didn't increase, stopped unwinding")
+)
+
+// Unwinds a thread's stack from its innermost frame, by call frame information where available, and by frame
+// records otherwise. Frames unwound before a failure are returned along with it.
+func unwind(initial *frameState, modules *moduleCache, memory *processMemory, maxFrames int) ([]*Frame, error) {
+	frames := make([]*Frame, 0)
+	state := initial
+
+	for len(frames) < maxFrames {
+		isReturnAddress := len(frames) > 0
+		frames = append(frames, modules.symbolize(state.pc, isReturnAddress))
+
+		caller, err := step(state, isReturnAddress, modules, memory)
+		if err == errEndOfStack {
+			return frames, nil
+		} else if err != nil {
+			return frames, err
+		} else if caller.pc == 0 {
+			return frames, nil
+		}
+
+		sp, spKnown := state.sp()
+		callerSp, callerSpKnown := caller.sp()
+		if spKnown && callerSpKnown && callerSp <= sp {
+			return frames, errStackNotGrowing
+		}
+
+		state = caller
+	}
+
+	return frames, nil
+}
+
+func step(state *frameState, isReturnAddress bool, modules *moduleCache, memory *processMemory) (*frameState,
+	error) {
+	lookupPc := state.pc
+	if isReturnAddress && lookupPc > 0 {
+		lookupPc--
+	}
+
+	if _, stateModule, address := modules.resolve(lookupPc); stateModule != nil && stateModule.cfi != nil {
+		if entry := stateModule.cfi.find(address); entry != nil {
+			if row, err := entry.row(address); err == nil {
+				caller, err := cfiStep(state, row, entry.cie.returnAddressRegister, memory)
+				if err == nil || err == errEndOfStack {
+					return caller, err
+				}
+			}
+			// E.g, expressions, which frame records may still get past.
+		}
+	}
+
+	return frameRecordStep(state, memory)
+}
+
+// Recovers the caller's registers by the unwind table's row, where the caller's stack pointer is the CFA.
+func cfiStep(state *frameState, row *unwindRow, returnAddressRegister int, memory *processMemory) (*frameState,
+	error) {
+	if row.cfa.unsupported {
+		return nil, errUnsupportedCfi
+	}
+
+	cfaBase, known := state.registers.get(row.cfa.register)
+	if !known {
+		return nil, errUnknownCfa
+	}
+	cfa := uint64(int64(cfaBase) + row.cfa.offset)
+
+	caller := &frameState{registers: state.registers}
+	for register, rule := range row.rules {
+		switch rule.kind {
+		case ruleUndefined, ruleUnsupported:
+			caller.registers.unset(register)
+		case ruleSameValue:
+		case ruleOffset:
+			value, err := memory.readUint64(uint64(int64(cfa) + rule.offset))
+			if err != nil {
+				return nil, err
+			}
+			caller.registers.set(register, value)
+		case ruleValOffset:
+			caller.registers.set(register, uint64(int64(cfa)+rule.offset))
+		case ruleRegister:
+			if value, known := state.registers.get(rule.register); known {
+				caller.registers.set(register, value)
+			} else {
+				caller.registers.unset(register)
+			}
+		}
+	}
+
+	// Outermost frames (e.g, _start) mark their return address undefined.
+	returnAddress, known := caller.registers.get(returnAddressRegister)
+	if !known {
+		return nil, errEndOfStack
+	}
+
+	caller.pc = stripReturnAddress(returnAddress)
+	caller.registers.set(dwarfRegisterSp, cfa)
+	return caller, nil
+}
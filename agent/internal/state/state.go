@@ -1,22 +1,76 @@
 package state
 
 import (
+	"context"
+	"github.com/hashicorp/go-multierror"
 	"github.com/memlab/agent/internal/client/models"
 	"github.com/memlab/agent/internal/detection/requests"
 	"github.com/memlab/agent/internal/types"
 	"github.com/pkg/errors"
 	psUtil "github.com/shirou/gopsutil/process"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
 )
 
+// ProcessExitWatcher is told which processes have cached configs, so their exits can be reported (see
+// procwatch.ExitWatcher) and expired via ExpireDetectionConfig().
+type ProcessExitWatcher interface {
+	Watch(pid types.Pid) error
+	Unwatch(pid types.Pid)
+}
+
+// ProcessValidator returns ErrExpiredDetectionConfig if the process a detection config refers to is gone.
+type ProcessValidator func(detectionConfig *models.DetectionConfiguration) error
+
+// State caches the detection configs which are currently applied, and dispatches the detection requests needed to
+// move from one set of configs to the next. It's safe for concurrent use.
+//
+// Requests are queued while holding the lock, and sent once it's released (yet before the next change's requests), so
+// they're handled in the same order the state changed. Hence, consumers of DetectionRequestsChan() must never call into
+// State themselves. Once the context is done, requests are dropped rather than sent, as no one handles them anymore.
 type State struct {
+	logger                *zap.Logger
+	context               context.Context
+	lock                  sync.Mutex
+	sendLock              sync.Mutex
 	detectionConfigsCache map[types.Pid]*models.DetectionConfiguration
 	detectionRequestsChan chan requests.DetectionRequest
+	queuedRequests        []requests.DetectionRequest // Guarded by the lock.
+	validateProcess       ProcessValidator
+	exitWatcher           ProcessExitWatcher
+}
+
+// Outcome of syncing a full set of detection configs.
+type DetectionConfigsDiff struct {
+	Added   []*models.DetectionConfiguration
+	Changed []*models.DetectionConfiguration
+	Removed []*models.DetectionConfiguration // Previously cached configs, as they were before removal.
+
+	// Configs of processes which are gone (they're removed from the cache as well, if they were cached).
+	Expired []*models.DetectionConfiguration
 }
 
-func NewState() *State {
+func (d *DetectionConfigsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0 && len(d.Expired) == 0
+}
+
+// Exit watcher is optional (may be nil), in which case configs only expire once they're synced again.
+func NewState(ctx context.Context, rootLogger *zap.Logger, exitWatcher ProcessExitWatcher) *State {
+	return NewStateWithValidator(ctx, rootLogger, ValidateLiveProcess, exitWatcher)
+}
+
+// Replays validate detection configs against recorded outcomes rather than live processes.
+func NewStateWithValidator(ctx context.Context, rootLogger *zap.Logger, validateProcess ProcessValidator,
+	exitWatcher ProcessExitWatcher) *State {
 	return &State{
+		logger:                rootLogger.Named("state"),
+		context:               ctx,
 		detectionConfigsCache: make(map[types.Pid]*models.DetectionConfiguration, 0),
 		detectionRequestsChan: make(chan requests.DetectionRequest, 0),
+		queuedRequests:        make([]requests.DetectionRequest, 0),
+		validateProcess:       validateProcess,
+		exitWatcher:           exitWatcher,
 	}
 }
 
@@ -24,39 +78,162 @@ func (s *State) DetectionRequestsChan() <-chan requests.DetectionRequest {
 	return s.detectionRequestsChan
 }
 
-func (s *State) PutDetectionConfig(detectionConfig *models.DetectionConfiguration) error {
-	if !detectionConfig.IsRelevant {
-		return nil
+// Syncs the state with the full set of detection configs of this machine (e.g, as fetched from the backend): new and
+// modified configs are applied, while cached configs which are missing from the set, or became irrelevant, are
+// turned off. Invalid configs are skipped, and their errors are returned once all other configs were synced.
+func (s *State) SyncDetectionConfigs(detectionConfigs map[types.Pid]*models.DetectionConfiguration) (
+	*DetectionConfigsDiff, error) {
+	s.lock.Lock()
+	defer s.sendQueuedRequests()
+
+	diff := &DetectionConfigsDiff{}
+	var errs error
+
+	for pid := range s.detectionConfigsCache {
+		if detectionConfig, found := detectionConfigs[pid]; !found || !detectionConfig.IsRelevant {
+			diff.Removed = append(diff.Removed, s.removeDetectionConfig(pid))
+		}
+	}
+
+	for _, pid := range sortedPids(detectionConfigs) { // Sorted, to keep requests dispatching order deterministic.
+		detectionConfig := detectionConfigs[pid]
+		if !detectionConfig.IsRelevant {
+			continue
+		}
+
+		added, changed, err := s.putDetectionConfig(detectionConfig)
+		if err != nil {
+			if err == ErrExpiredDetectionConfig {
+				diff.Expired = append(diff.Expired, detectionConfig)
+			} else {
+				errs = multierror.Append(errs, err)
+			}
+			continue
+		}
+
+		if added {
+			diff.Added = append(diff.Added, detectionConfig)
+		} else if changed {
+			diff.Changed = append(diff.Changed, detectionConfig)
+		}
+	}
+
+	return diff, errs
+}
+
+// Turns off all detections of an exited process' cached config, and returns it (nil if none was cached).
+func (s *State) ExpireDetectionConfig(pid types.Pid) *models.DetectionConfiguration {
+	s.lock.Lock()
+	defer s.sendQueuedRequests()
+
+	return s.removeDetectionConfig(pid)
+}
+
+// Must be called while holding the lock, which it releases. The send lock is taken before the lock is released, so
+// requests of concurrent changes are sent in the order the changes were made.
+func (s *State) sendQueuedRequests() {
+	queuedRequests := s.queuedRequests
+	s.queuedRequests = make([]requests.DetectionRequest, 0)
+
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	s.lock.Unlock()
+
+	for i, request := range queuedRequests {
+		select {
+		case <-s.context.Done():
+			s.logger.Debug("Drop detection requests, as state is done", zap.Int("Dropped", len(queuedRequests)-i))
+			return
+		case s.detectionRequestsChan <- request:
+		}
 	}
+}
+
+// Must be called while holding the lock.
+func (s *State) queueRequest(request requests.DetectionRequest) {
+	s.queuedRequests = append(s.queuedRequests, request)
+}
 
+// Must be called while holding the lock. Expired configs are removed from the cache.
+func (s *State) putDetectionConfig(detectionConfig *models.DetectionConfiguration) (bool, bool, error) {
 	pid := detectionConfig.Pid
 
-	if err := s.validateDetectionConfig(detectionConfig, pid); err != nil {
-		return err
+	if err := s.validateProcess(detectionConfig); err != nil {
+		if err == ErrExpiredDetectionConfig {
+			s.removeDetectionConfig(pid)
+		}
+		return false, false, err
+	}
+
+	if _, err := detectionConfig.SignalMask(); err != nil {
+		return false, false, errors.WithMessagef(err, "validate signals for pid '%d'", pid)
+	} else if _, err := detectionConfig.SignalHoldBudgetDuration(); err != nil {
+		return false, false, errors.WithMessagef(err, "validate signal hold budget for pid '%d'", pid)
 	}
 
 	cachedConfig, configured := s.detectionConfigsCache[pid]
 	if !configured {
 		s.detectionConfigsCache[pid] = detectionConfig
 		s.dispatchDetectionRequests(detectionConfig, nil)
-		return nil
+		s.watchProcessExit(pid)
+		return true, false, nil
 	}
 
-	// Avoid redundant update if config didn't change
-	if !detectionConfig.ModifiedAt.Time.After(cachedConfig.ModifiedAt.Time) {
-		return nil
+	// Avoid redundant update if config didn't change (a process might move from a selector config to another config)
+	if detectionConfig.ID == cachedConfig.ID && !detectionConfig.ModifiedAt.Time.After(cachedConfig.ModifiedAt.Time) {
+		return false, false, nil
 	}
 
 	s.dispatchDetectionRequests(detectionConfig, cachedConfig)
 
 	// Only update cached config after new one was dispatched
 	s.detectionConfigsCache[pid] = detectionConfig
-	return nil
+	return false, true, nil
 }
 
-/// Validates detection config by comparing the given pid in the detection configuration,
-/// to the matching process information from the host.
-func (s *State) validateDetectionConfig(detectionConfig *models.DetectionConfiguration, pid types.Pid) error {
+// Must be called while holding the lock. Returns the removed config, or nil if none was cached.
+func (s *State) removeDetectionConfig(pid types.Pid) *models.DetectionConfiguration {
+	cachedConfig, configured := s.detectionConfigsCache[pid]
+	if !configured {
+		return nil
+	}
+
+	s.dispatchTurnOffRequests(cachedConfig)
+	delete(s.detectionConfigsCache, pid)
+
+	if s.exitWatcher != nil {
+		s.exitWatcher.Unwatch(pid)
+	}
+	return cachedConfig
+}
+
+// Best-effort, as configs of exited processes expire on the next sync anyway.
+func (s *State) watchProcessExit(pid types.Pid) {
+	if s.exitWatcher == nil {
+		return
+	}
+
+	if err := s.exitWatcher.Watch(pid); err != nil {
+		s.logger.Warn("Failed to watch process exit", zap.Error(err), zap.Int32("Pid", int32(pid)))
+	}
+}
+
+func sortedPids(detectionConfigs map[types.Pid]*models.DetectionConfiguration) []types.Pid {
+	pids := make([]types.Pid, 0, len(detectionConfigs))
+	for pid := range detectionConfigs {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool {
+		return pids[i] < pids[j]
+	})
+	return pids
+}
+
+// Validates detection config by comparing the given pid in the detection configuration,
+// to the matching process information from the host.
+func ValidateLiveProcess(detectionConfig *models.DetectionConfiguration) error {
+	pid := detectionConfig.Pid
+
 	process := &models.Process{Pid: pid}
 	liveProcess, err := process.LiveProcess()
 	if err != nil {
@@ -85,49 +262,123 @@ func (s *State) validateDetectionConfig(detectionConfig *models.DetectionConfigu
 
 func (s *State) dispatchDetectionRequests(newConfig, oldConfig *models.DetectionConfiguration) {
 	if oldConfig == nil { // Build initial detection configuration if it's not cached.
-		s.sendSignalDetectionRequest(newConfig)
-		s.sendThresholdsDetectionRequest(newConfig)
-		s.sendSuspectedHangsDetectionRequest(newConfig)
+		s.queueSignalDetectionRequest(newConfig)
+		s.queueThresholdsDetectionRequest(newConfig)
+		s.queueSuspectedHangsDetectionRequest(newConfig)
+		s.queueOomKillsDetectionRequest(newConfig)
 		return
 	}
 
 	if oldConfig.DetectSignals != newConfig.DetectSignals {
-		s.sendSignalDetectionRequest(newConfig)
+		s.queueSignalDetectionRequest(newConfig)
+	} else if newConfig.DetectSignals && !sameSignalDetection(oldConfig, newConfig) {
+		// Restart signal detection so the kernel module picks up the new signal mask, and the detector the new budget.
+		s.queueSignalDetectionTurnOffRequest(oldConfig)
+		s.queueSignalDetectionRequest(newConfig)
 	}
 
 	if oldConfig.DetectThresholds != newConfig.DetectThresholds {
-		s.sendThresholdsDetectionRequest(newConfig)
+		s.queueThresholdsDetectionRequest(newConfig)
 	}
 
 	if oldConfig.DetectSuspectedHangs != newConfig.DetectSuspectedHangs {
-		s.sendSuspectedHangsDetectionRequest(newConfig)
+		s.queueSuspectedHangsDetectionRequest(newConfig)
+	}
+
+	if oldConfig.DetectOomKills != newConfig.DetectOomKills {
+		s.queueOomKillsDetectionRequest(newConfig)
 	}
 }
 
-func (s *State) sendSignalDetectionRequest(newConfig *models.DetectionConfiguration) {
-	s.detectionRequestsChan <- &requests.DetectSignals{
-		Pid:      newConfig.Pid,
-		Restart:  newConfig.RestartOnSignal,
-		TurnedOn: newConfig.DetectSignals,
+// Only detections which are turned on are turned off, the rest have no detectors to stop.
+func (s *State) dispatchTurnOffRequests(oldConfig *models.DetectionConfiguration) {
+	if oldConfig.DetectSignals {
+		s.queueSignalDetectionTurnOffRequest(oldConfig)
+	}
+
+	if oldConfig.DetectThresholds {
+		request := thresholdsDetectionRequest(oldConfig)
+		request.TurnedOn = false
+		s.queueRequest(request)
+	}
+
+	if oldConfig.DetectSuspectedHangs {
+		request := suspectedHangsDetectionRequest(oldConfig)
+		request.TurnedOn = false
+		s.queueRequest(request)
 	}
+
+	if oldConfig.DetectOomKills {
+		request := oomKillsDetectionRequest(oldConfig)
+		request.TurnedOn = false
+		s.queueRequest(request)
+	}
+}
+
+func sameSignalDetection(oldConfig, newConfig *models.DetectionConfiguration) bool {
+	oldMask, _ := oldConfig.SignalMask()
+	newMask, _ := newConfig.SignalMask()
+	return oldMask == newMask && oldConfig.SignalHoldBudget == newConfig.SignalHoldBudget
 }
 
-func (s *State) sendThresholdsDetectionRequest(newConfig *models.DetectionConfiguration) {
-	s.detectionRequestsChan <- &requests.DetectThresholds{
-		Pid:                      newConfig.Pid,
-		CpuThreshold:             newConfig.CpuThreshold,
-		MemoryThreshold:          newConfig.MemoryThreshold,
-		RestartOnCpuThreshold:    newConfig.RestartOnCpuThreshold,
-		RestartOnMemoryThreshold: newConfig.RestartOnMemoryThreshold,
-		TurnedOn:                 newConfig.DetectThresholds,
+func signalDetectionRequest(config *models.DetectionConfiguration) *requests.DetectSignals {
+	signals, _ := config.SignalMask() // Validated when config was put.
+	holdBudget, _ := config.SignalHoldBudgetDuration()
+
+	return &requests.DetectSignals{
+		Pid:        config.Pid,
+		Signals:    signals,
+		HoldBudget: holdBudget,
+		Restart:    config.RestartOnSignal,
+		TurnedOn:   config.DetectSignals,
 	}
 }
 
-func (s *State) sendSuspectedHangsDetectionRequest(newConfig *models.DetectionConfiguration) {
-	s.detectionRequestsChan <- &requests.DetectSuspectedHangs{
-		Pid:      newConfig.Pid,
-		Duration: newConfig.SuspectedHangDuration,
-		Restart:  newConfig.RestartOnSuspectedHang,
-		TurnedOn: newConfig.DetectSuspectedHangs,
+func (s *State) queueSignalDetectionRequest(newConfig *models.DetectionConfiguration) {
+	s.queueRequest(signalDetectionRequest(newConfig))
+}
+
+func (s *State) queueSignalDetectionTurnOffRequest(oldConfig *models.DetectionConfiguration) {
+	request := signalDetectionRequest(oldConfig)
+	request.TurnedOn = false
+	s.queueRequest(request)
+}
+
+func thresholdsDetectionRequest(config *models.DetectionConfiguration) *requests.DetectThresholds {
+	return &requests.DetectThresholds{
+		Pid:                      config.Pid,
+		CpuThreshold:             config.CpuThreshold,
+		MemoryThreshold:          config.MemoryThreshold,
+		RestartOnCpuThreshold:    config.RestartOnCpuThreshold,
+		RestartOnMemoryThreshold: config.RestartOnMemoryThreshold,
+		TurnedOn:                 config.DetectThresholds,
 	}
 }
+
+func (s *State) queueThresholdsDetectionRequest(newConfig *models.DetectionConfiguration) {
+	s.queueRequest(thresholdsDetectionRequest(newConfig))
+}
+
+func suspectedHangsDetectionRequest(config *models.DetectionConfiguration) *requests.DetectSuspectedHangs {
+	return &requests.DetectSuspectedHangs{
+		Pid:      config.Pid,
+		Duration: config.SuspectedHangDuration,
+		Restart:  config.RestartOnSuspectedHang,
+		TurnedOn: config.DetectSuspectedHangs,
+	}
+}
+
+func (s *State) queueSuspectedHangsDetectionRequest(newConfig *models.DetectionConfiguration) {
+	s.queueRequest(suspectedHangsDetectionRequest(newConfig))
+}
+
+func oomKillsDetectionRequest(config *models.DetectionConfiguration) *requests.DetectOomKills {
+	return &requests.DetectOomKills{
+		Pid:      config.Pid,
+		TurnedOn: config.DetectOomKills,
+	}
+}
+
+func (s *State) queueOomKillsDetectionRequest(newConfig *models.DetectionConfiguration) {
+	s.queueRequest(oomKillsDetectionRequest(newConfig))
+}
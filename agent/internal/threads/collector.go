@@ -0,0 +1,71 @@
+package threads
+
+import (
+	"fmt"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Digits in thread names usually number the threads of a pool, e.g "pool-1-thread-12" -> "pool-*-thread-*".
+var threadNumberPattern = regexp.MustCompile(`[0-9]+`)
+
+type Summary struct {
+	Total  int                       `json:"total"`
+	States map[string]int            `json:"states"`
+	Pools  map[string]map[string]int `json:"pools"` // States of threads, by their names with numbers masked.
+}
+
+// Collects the process' threads (up to the max), along with the summary of all of them, and the number of threads left
+// out. Threads aren't stopped, so each is read at a slightly different time.
+func CollectThreads(pid types.Pid, config *Config) ([]*Thread, *Summary, int, error) {
+	entries, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, nil, 0, errors.WithMessage(err, "list threads")
+	}
+
+	tids := make([]types.Pid, 0, len(entries))
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, types.Pid(tid))
+		}
+	}
+	sort.Slice(tids, func(i, j int) bool {
+		return tids[i] < tids[j]
+	})
+
+	threads := make([]*Thread, 0, len(tids))
+	summary := &Summary{
+		States: make(map[string]int, 0),
+		Pools:  make(map[string]map[string]int, 0),
+	}
+	var omittedThreads int
+	for _, tid := range tids {
+		thread, err := readThread(pid, tid)
+		if err != nil { // Exited meanwhile.
+			continue
+		}
+
+		summary.Total++
+		summary.States[thread.State]++
+		pool := threadNumberPattern.ReplaceAllString(thread.Name, "*")
+		if summary.Pools[pool] == nil {
+			summary.Pools[pool] = make(map[string]int, 0)
+		}
+		summary.Pools[pool][thread.State]++
+
+		if len(threads) == config.MaxThreads {
+			omittedThreads++
+			continue
+		}
+		threads = append(threads, thread)
+	}
+
+	if summary.Total == 0 {
+		return nil, nil, 0, errors.Errorf("no threads of pid '%d' could be read", pid)
+	}
+	return threads, summary, omittedThreads, nil
+}
@@ -0,0 +1,17 @@
+package threads
+
+import (
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	MaxThreads int // Threads beyond are only summarized.
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.MaxThreads <= 0 {
+		return false, errors.New("max threads must be positive")
+	}
+
+	return true, nil
+}
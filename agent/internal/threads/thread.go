@@ -0,0 +1,142 @@
+package threads
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/memlab/agent/internal/procenv"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Scheduling policies, as in include/uapi/linux/sched.h.
+var schedulingPolicies = map[uint64]string{
+	0: "SCHED_OTHER",
+	1: "SCHED_FIFO",
+	2: "SCHED_RR",
+	3: "SCHED_BATCH",
+	5: "SCHED_IDLE",
+	6: "SCHED_DEADLINE",
+}
+
+type Thread struct {
+	Tid                        types.Pid `json:"tid"`
+	Name                       string    `json:"name"`
+	State                      string    `json:"state"`           // e.g "sleeping".
+	Wchan                      string    `json:"wchan,omitempty"` // Kernel function the thread is blocked in.
+	CpuAffinity                string    `json:"cpu_affinity"`    // e.g "0-3,8".
+	LastCpu                    int       `json:"last_cpu"`
+	SchedulingPolicy           string    `json:"scheduling_policy"`
+	Priority                   int       `json:"priority"`
+	Nice                       int       `json:"nice"`
+	RealtimePriority           int       `json:"realtime_priority,omitempty"`
+	VoluntaryContextSwitches   uint64    `json:"voluntary_context_switches"`
+	InvoluntaryContextSwitches uint64    `json:"involuntary_context_switches"`
+	UserTimeSeconds            float64   `json:"user_time_seconds"`
+	SystemTimeSeconds          float64   `json:"system_time_seconds"`
+}
+
+func readThread(pid types.Pid, tid types.Pid) (*Thread, error) {
+	thread := &Thread{Tid: tid}
+	if err := readThreadStat(pid, thread); err != nil {
+		return nil, err
+	}
+	if err := readThreadStatus(pid, thread); err != nil {
+		return nil, err
+	}
+
+	// Zeroed for running threads, and unless the reader may read kernel addresses.
+	if wchan, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/wchan", pid, tid)); err == nil &&
+		string(wchan) != "0" {
+		thread.Wchan = string(wchan)
+	}
+	return thread, nil
+}
+
+func readThreadStat(pid types.Pid, thread *Thread) error {
+	stat, err := procenv.ReadThreadStat(pid, thread.Tid)
+	if err != nil {
+		return err
+	}
+	thread.Name = stat.Name
+
+	userTime, err := stat.Field(14)
+	if err != nil {
+		return errors.WithMessage(err, "parse user time")
+	}
+	systemTime, err := stat.Field(15)
+	if err != nil {
+		return errors.WithMessage(err, "parse system time")
+	}
+	priority, err := stat.SignedField(18)
+	if err != nil {
+		return errors.WithMessage(err, "parse priority")
+	}
+	nice, err := stat.SignedField(19)
+	if err != nil {
+		return errors.WithMessage(err, "parse nice")
+	}
+	lastCpu, err := stat.SignedField(39)
+	if err != nil {
+		return errors.WithMessage(err, "parse last cpu")
+	}
+	realtimePriority, err := stat.SignedField(40)
+	if err != nil {
+		return errors.WithMessage(err, "parse realtime priority")
+	}
+	policy, err := stat.Field(41)
+	if err != nil {
+		return errors.WithMessage(err, "parse scheduling policy")
+	}
+
+	thread.Priority, thread.Nice = int(priority), int(nice)
+	thread.LastCpu, thread.RealtimePriority = int(lastCpu), int(realtimePriority)
+	thread.UserTimeSeconds = float64(userTime) / procenv.UserHz
+	thread.SystemTimeSeconds = float64(systemTime) / procenv.UserHz
+	thread.SchedulingPolicy = schedulingPolicies[policy]
+	if thread.SchedulingPolicy == "" {
+		thread.SchedulingPolicy = strconv.FormatUint(policy, 10)
+	}
+	return nil
+}
+
+// e.g "State:	S (sleeping)" and "voluntary_ctxt_switches:	150".
+func readThreadStatus(pid types.Pid, thread *Thread) error {
+	path := fmt.Sprintf("/proc/%d/task/%d/status", pid, thread.Tid)
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithMessagef(err, "open '%s'", path)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], strings.TrimSpace(parts[1])
+
+		switch key {
+		case "State": // e.g "S (sleeping)".
+			thread.State = strings.Trim(value[strings.IndexByte(value, ' ')+1:], "()")
+		case "Cpus_allowed_list":
+			thread.CpuAffinity = value
+		case "voluntary_ctxt_switches":
+			thread.VoluntaryContextSwitches, err = strconv.ParseUint(value, 10, 64)
+		case "nonvoluntary_ctxt_switches":
+			thread.InvoluntaryContextSwitches, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "parse '%s' line '%s'", path, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithMessagef(err, "read '%s'", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package trace
+
+import (
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"sync"
+)
+
+// RecordingChannel records every caught signal delivered to subscribers of the wrapped kernel channel.
+type RecordingChannel struct {
+	kernelComm.KernelChannel
+	recorder   *Recorder
+	lock       sync.Mutex
+	forwarders map[uint32]chan struct{} // Pid to forwarder's done channel.
+}
+
+var _ kernelComm.KernelChannel = (*RecordingChannel)(nil)
+
+func NewRecordingChannel(kernelChannel kernelComm.KernelChannel, recorder *Recorder) *RecordingChannel {
+	return &RecordingChannel{
+		KernelChannel: kernelChannel,
+		recorder:      recorder,
+		forwarders:    make(map[uint32]chan struct{}, 0),
+	}
+}
+
+func (rc *RecordingChannel) Subscribe(pid uint32) (<-chan *kernelComm.PayloadCaughtSignal, error) {
+	caughtSignalsChan, err := rc.KernelChannel.Subscribe(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	recordedSignalsChan := make(chan *kernelComm.PayloadCaughtSignal)
+
+	rc.lock.Lock()
+	rc.forwarders[pid] = done
+	rc.lock.Unlock()
+
+	go rc.forwardCaughtSignals(caughtSignalsChan, recordedSignalsChan, done)
+
+	return recordedSignalsChan, nil
+}
+
+func (rc *RecordingChannel) forwardCaughtSignals(caughtSignalsChan <-chan *kernelComm.PayloadCaughtSignal,
+	recordedSignalsChan chan<- *kernelComm.PayloadCaughtSignal, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case caughtSignal := <-caughtSignalsChan:
+			rc.recorder.RecordCaughtSignal(caughtSignal)
+
+			select {
+			case <-done:
+				return
+			case recordedSignalsChan <- caughtSignal:
+			}
+		}
+	}
+}
+
+func (rc *RecordingChannel) Unsubscribe(pid uint32) {
+	rc.KernelChannel.Unsubscribe(pid)
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	if done, exists := rc.forwarders[pid]; exists {
+		close(done)
+		delete(rc.forwarders, pid)
+	}
+}
@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/memlab/agent/internal/client/models"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Large enough for reports with long cmdlines, connection lists, etc.
+const maxEventSize = 16 * 1024 * 1024
+
+type EventType string
+
+const (
+	EventTypeDetectionConfigs EventType = "detection_configs"
+	EventTypeCaughtSignal     EventType = "caught_signal"
+	EventTypeReport           EventType = "report"
+	EventTypeProcessExit      EventType = "process_exit"
+)
+
+// Event is a single line of a trace file. Only the field matching the event's type is set.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Result of a successful detection configs fetch, along with the pids which failed validation against the host
+	// at the time, since replays can't validate them against live processes.
+	DetectionConfigs []*models.DetectionConfiguration `json:"detection_configs,omitempty"`
+	ExpiredPids      []types.Pid                      `json:"expired_pids,omitempty"`
+
+	CaughtSignal *kernelComm.PayloadCaughtSignal `json:"caught_signal,omitempty"`
+	ExitedPid    types.Pid                       `json:"exited_pid,omitempty"`
+	Report       map[string]interface{}          `json:"report,omitempty"`
+}
+
+func (e *Event) Valid() (bool, error) {
+	switch e.Type {
+	case EventTypeDetectionConfigs:
+		return true, nil
+	case EventTypeCaughtSignal:
+		if e.CaughtSignal == nil {
+			return false, errors.New("missing caught signal")
+		}
+	case EventTypeReport:
+		if e.Report == nil {
+			return false, errors.New("missing report")
+		}
+	case EventTypeProcessExit:
+		if e.ExitedPid == 0 {
+			return false, errors.New("missing exited pid")
+		}
+	default:
+		return false, errors.Errorf("invalid event type '%s'", e.Type)
+	}
+
+	return true, nil
+}
+
+// Reads a whole trace file, in recording order.
+func ReadEvents(path string) ([]*Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "open trace file")
+	}
+	defer file.Close()
+
+	return DecodeEvents(file)
+}
+
+func DecodeEvents(reader io.Reader) ([]*Event, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxEventSize)
+
+	events := make([]*Event, 0)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		event := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, errors.WithMessagef(err, "decode event at line %d", line)
+		} else if valid, err := event.Valid(); !valid {
+			return nil, errors.WithMessagef(err, "validate event at line %d", line)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessage(err, "read trace")
+	}
+	return events, nil
+}
@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"encoding/json"
+	"github.com/memlab/agent/internal/client/models"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder appends events to a trace file, one json object per line. A nil recorder records nothing, so callers
+// don't have to check whether recording is enabled.
+type Recorder struct {
+	logger  *zap.Logger
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewRecorder(rootLogger *zap.Logger, path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.WithMessage(err, "open trace file")
+	}
+
+	return &Recorder{
+		logger:  rootLogger.Named("trace-recorder"),
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Configs are recorded once validated, yet timed by when they were fetched, so replays apply them before any signal
+// caught in the meantime.
+func (r *Recorder) RecordDetectionConfigs(fetchedAt time.Time,
+	detectionConfigs map[types.Pid]*models.DetectionConfiguration, expiredPids []types.Pid) {
+	configList := make([]*models.DetectionConfiguration, 0, len(detectionConfigs))
+	for _, detectionConfig := range detectionConfigs {
+		configList = append(configList, detectionConfig)
+	}
+	sort.Slice(configList, func(i, j int) bool { // Keeps replays deterministic.
+		return configList[i].Pid < configList[j].Pid
+	})
+
+	r.Record(&Event{
+		Type:             EventTypeDetectionConfigs,
+		Time:             fetchedAt,
+		DetectionConfigs: configList,
+		ExpiredPids:      expiredPids,
+	})
+}
+
+func (r *Recorder) RecordCaughtSignal(caughtSignal *kernelComm.PayloadCaughtSignal) {
+	r.Record(&Event{
+		Type:         EventTypeCaughtSignal,
+		CaughtSignal: caughtSignal,
+	})
+}
+
+func (r *Recorder) RecordReport(report map[string]interface{}) {
+	r.Record(&Event{
+		Type:   EventTypeReport,
+		Report: report,
+	})
+}
+
+// Only exits which expired a cached detection config are recorded.
+func (r *Recorder) RecordProcessExit(exitedAt time.Time, pid types.Pid) {
+	r.Record(&Event{
+		Type:      EventTypeProcessExit,
+		Time:      exitedAt,
+		ExitedPid: pid,
+	})
+}
+
+// Recording is best-effort, failures are logged rather than failing the agent.
+func (r *Recorder) Record(event *Event) {
+	if r == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.encoder == nil {
+		r.logger.Warn("Recorder is closed, dropping event", zap.String("Type", string(event.Type)))
+		return
+	}
+
+	if err := r.encoder.Encode(event); err != nil {
+		r.logger.Error("Failed to record event", zap.Error(err), zap.String("Type", string(event.Type)))
+	}
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.encoder == nil {
+		return nil
+	}
+
+	r.encoder = nil
+	return r.file.Close()
+}
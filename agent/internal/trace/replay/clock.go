@@ -0,0 +1,136 @@
+package replay
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/detection/detectors"
+	"sync"
+	"time"
+)
+
+// Replays run on the trace's own timeline: the clock jumps from one recorded event time to the next, optionally
+// waiting a (scaled) fraction of the recorded gap in between. Detectors run on it as well, so their timers fire as the
+// clock passes their deadlines rather than on the wall-clock.
+type simulatedClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	speed  float64
+	timers []*simulatedTimer
+}
+
+type simulatedTimer struct {
+	clock    *simulatedClock
+	deadline time.Time
+	f        func()
+	done     bool // Either fired or stopped, guarded by the clock's lock.
+}
+
+func newSimulatedClock(speed float64) *simulatedClock {
+	return &simulatedClock{
+		speed:  speed,
+		timers: make([]*simulatedTimer, 0),
+	}
+}
+
+func (sc *simulatedClock) Now() time.Time {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.now
+}
+
+func (sc *simulatedClock) AfterFunc(d time.Duration, f func()) detectors.Timer {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	timer := &simulatedTimer{
+		clock:    sc,
+		deadline: sc.now.Add(d),
+		f:        f,
+	}
+	sc.timers = append(sc.timers, timer)
+	return timer
+}
+
+func (st *simulatedTimer) Stop() bool {
+	st.clock.lock.Lock()
+	defer st.clock.lock.Unlock()
+
+	if st.done {
+		return false
+	}
+	st.done = true
+	st.clock.removeTimer(st)
+	return true
+}
+
+// Never moves backwards, as events recorded concurrently might be slightly out of order.
+func (sc *simulatedClock) advanceTo(ctx context.Context, eventTime time.Time) {
+	sc.lock.Lock()
+	if sc.now.IsZero() {
+		sc.now = eventTime
+		sc.lock.Unlock()
+		return
+	}
+	gap := eventTime.Sub(sc.now)
+	sc.lock.Unlock()
+
+	if gap <= 0 {
+		return
+	}
+
+	if sc.speed > 0 {
+		timer := time.NewTimer(time.Duration(float64(gap) / sc.speed))
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	sc.fireTimersUntil(eventTime)
+}
+
+func (sc *simulatedClock) advanceBy(ctx context.Context, d time.Duration) {
+	sc.advanceTo(ctx, sc.Now().Add(d))
+}
+
+// Timers fire in order of their deadlines, each with the clock set to its deadline. They're called synchronously (yet
+// without holding the lock), so whatever they trigger happens before the clock moves on.
+func (sc *simulatedClock) fireTimersUntil(until time.Time) {
+	for {
+		sc.lock.Lock()
+		var next *simulatedTimer
+		for _, timer := range sc.timers {
+			if !timer.deadline.After(until) && (next == nil || timer.deadline.Before(next.deadline)) {
+				next = timer
+			}
+		}
+
+		if next == nil {
+			if until.After(sc.now) {
+				sc.now = until
+			}
+			sc.lock.Unlock()
+			return
+		}
+
+		if next.deadline.After(sc.now) {
+			sc.now = next.deadline
+		}
+		next.done = true
+		sc.removeTimer(next)
+		sc.lock.Unlock()
+
+		next.f()
+	}
+}
+
+// Must be called with the lock held.
+func (sc *simulatedClock) removeTimer(timer *simulatedTimer) {
+	for i, pending := range sc.timers {
+		if pending == timer {
+			sc.timers = append(sc.timers[:i], sc.timers[i+1:]...)
+			return
+		}
+	}
+}
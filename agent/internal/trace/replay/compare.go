@@ -0,0 +1,55 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Compares the fields of a replayed report to the recorded one. Replays only produce the fields of caught signals, which
+// don't depend on the replaying host (see replayedOperators), so recorded fields which the replay didn't produce are
+// ignored, since they come from the recording agent's operators.
+func compareReports(recorded, replayed map[string]interface{}) ([]string, error) {
+	recorded, err := normalizeReport(recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err = normalizeReport(replayed)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(replayed))
+	for field := range replayed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	differences := make([]string, 0)
+	for _, field := range fields {
+		recordedValue, found := recorded[field]
+		if !found {
+			differences = append(differences, fmt.Sprintf("'%s': not recorded, replayed %v", field, replayed[field]))
+		} else if !reflect.DeepEqual(recordedValue, replayed[field]) {
+			differences = append(differences, fmt.Sprintf("'%s': recorded %v, replayed %v", field, recordedValue,
+				replayed[field]))
+		}
+	}
+	return differences, nil
+}
+
+// Round-trips a report through json, so recorded and replayed values are of the same types.
+func normalizeReport(report map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make(map[string]interface{}, len(report))
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
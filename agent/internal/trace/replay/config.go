@@ -0,0 +1,26 @@
+package replay
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Config struct {
+	// Factor by which the simulated clock runs compared to the recording, where 0 skips the gaps between events.
+	Speed                  float64
+	MaxConcurrentDetectors int
+	// How long to wait for a detector to watch a process, or to report a caught signal.
+	EventTimeout time.Duration
+}
+
+func (c *Config) Valid() (bool, error) {
+	if c.Speed < 0 {
+		return false, errors.New("negative speed")
+	} else if c.MaxConcurrentDetectors <= 0 {
+		return false, errors.New("max concurrent detectors must be positive")
+	} else if c.EventTimeout <= 0 {
+		return false, errors.New("uninitialized event timeout")
+	}
+
+	return true, nil
+}
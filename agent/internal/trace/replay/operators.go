@@ -0,0 +1,81 @@
+package replay
+
+import (
+	"context"
+	"github.com/memlab/agent/internal/operations/operators"
+	"github.com/memlab/agent/internal/prochandle"
+	"github.com/memlab/agent/internal/redaction"
+	"github.com/memlab/agent/internal/reports"
+	"sync"
+	"time"
+)
+
+// Stands in for the recording agent's operators, which inspected live processes: nothing is read from the replaying
+// host, and a replayed signal is held as long as it was recorded to be held (on the simulated clock), so its hold
+// budget elapses (or not) just as it did when recorded.
+type replayedOperators struct {
+	clock   *simulatedClock
+	lock    sync.Mutex
+	heldFor time.Duration
+}
+
+func newReplayedOperators(clock *simulatedClock) *replayedOperators {
+	return &replayedOperators{
+		clock: clock,
+	}
+}
+
+// Signals are replayed one at a time, so the hold of the next one is set before it's injected.
+func (ro *replayedOperators) setHeldFor(heldFor time.Duration) {
+	ro.lock.Lock()
+	defer ro.lock.Unlock()
+
+	ro.heldFor = heldFor
+}
+
+func (ro *replayedOperators) recordedHeldFor() time.Duration {
+	ro.lock.Lock()
+	defer ro.lock.Unlock()
+
+	return ro.heldFor
+}
+
+func (ro *replayedOperators) SignalOperators(string, *redaction.Redactor) []operators.Operator {
+	return []operators.Operator{&replayedHold{operators: ro}}
+}
+
+// OOM kills aren't recorded, so they're never replayed.
+func (ro *replayedOperators) OomKillOperators(string, *redaction.Redactor) []operators.Operator {
+	return make([]operators.Operator, 0)
+}
+
+type replayedHold struct {
+	operators *replayedOperators
+}
+
+func (r *replayedHold) OperatorName() string {
+	return "replayed-hold-operator"
+}
+
+func (r *replayedHold) Operate(ctx context.Context, _ *prochandle.Handle) (reports.Report, error) {
+	r.operators.clock.advanceBy(ctx, r.operators.recordedHeldFor())
+	return &emptyReport{}, nil
+}
+
+func (r *replayedHold) FailPipelineOnError() bool {
+	return false
+}
+
+func (r *replayedHold) RunsAfterSignalRelease() bool {
+	return false
+}
+
+type emptyReport struct{}
+
+func (e *emptyReport) ReportName() string {
+	return "empty-report"
+}
+
+func (e *emptyReport) DumpReport() ([]byte, error) {
+	return []byte("{}"), nil
+}
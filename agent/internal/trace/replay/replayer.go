@@ -0,0 +1,337 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"github.com/memlab/agent/internal/client/models"
+	"github.com/memlab/agent/internal/control"
+	"github.com/memlab/agent/internal/detection"
+	"github.com/memlab/agent/internal/detection/detectors"
+	"github.com/memlab/agent/internal/detection/requests"
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/prochandle"
+	statePkg "github.com/memlab/agent/internal/state"
+	"github.com/memlab/agent/internal/trace"
+	"github.com/memlab/agent/internal/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+const watchPollingInterval = time.Millisecond * 10
+
+// Result of a replay. Reports are in the order their caught signals were replayed.
+type Result struct {
+	Reports    []map[string]interface{}
+	Mismatches []string
+}
+
+func (r *Result) Matches() bool {
+	return len(r.Mismatches) == 0
+}
+
+// Replayer feeds a recorded trace through the agent's state, detection requests handler and detectors, with the
+// kernel module simulated, processes validated against their recorded outcomes and detectors running on the trace's
+// timeline. Replays are hermetic: operators are replaced by replayed ones (see replayedOperators), and processes are
+// never looked up on the replaying host, whatever runs with their recorded pids.
+type Replayer struct {
+	logger                   *zap.Logger
+	context                  context.Context
+	cancel                   context.CancelFunc
+	waitGroup                sync.WaitGroup
+	config                   *Config
+	events                   []*trace.Event
+	clock                    *simulatedClock
+	operators                *replayedOperators
+	simulator                *kernelComm.Simulator
+	state                    *statePkg.State
+	detectionRequestsHandler *control.DetectionRequestsHandler
+	detectionConfigsSyncer   *control.DetectionConfigsSyncer
+	detectionController      *detection.Controller
+	expiredPids              map[types.Pid]bool
+	signalMasks              map[types.Pid]uint32 // Of processes configured for signal detection.
+}
+
+func NewReplayer(rootLogger *zap.Logger, config *Config, events []*trace.Event) (*Replayer, error) {
+	if valid, err := config.Valid(); !valid {
+		return nil, errors.WithMessage(err, "validate replay config")
+	}
+
+	logger := rootLogger.Named("replayer")
+
+	clock := newSimulatedClock(config.Speed)
+	environment := &detectors.Environment{
+		Clock: clock,
+		OpenProcess: func(pid types.Pid) (*prochandle.Handle, error) {
+			return prochandle.Detached(pid, 0), nil
+		},
+	}
+
+	simulator := kernelComm.NewSimulator(logger)
+	detectionController, err := detection.NewControllerWithEnvironment(logger, config.MaxConcurrentDetectors,
+		func(*zap.Logger) (kernelComm.KernelChannel, error) {
+			return simulator, nil
+		}, environment)
+	if err != nil {
+		return nil, errors.WithMessage(err, "new detection controller")
+	}
+
+	// Events are recorded by concurrent goroutines, so file order might slightly differ from time order.
+	sortedEvents := make([]*trace.Event, len(events))
+	copy(sortedEvents, events)
+	sort.SliceStable(sortedEvents, func(i, j int) bool {
+		return sortedEvents[i].Time.Before(sortedEvents[j].Time)
+	})
+
+	replayer := &Replayer{
+		logger:              logger,
+		config:              config,
+		events:              sortedEvents,
+		clock:               clock,
+		operators:           newReplayedOperators(clock),
+		simulator:           simulator,
+		detectionController: detectionController,
+		expiredPids:         make(map[types.Pid]bool, 0),
+		signalMasks:         make(map[types.Pid]uint32, 0),
+	}
+	replayer.context, replayer.cancel = context.WithCancel(context.Background())
+	replayer.state = statePkg.NewStateWithValidator(replayer.context, logger, replayer.validateProcess, nil)
+	// Replayed operators report nothing of their own, so there's no machine to attribute to, nor anything to redact.
+	replayer.detectionRequestsHandler = control.NewDetectionRequestsHandler(detectionController, replayer.operators,
+		"", nil)
+	replayer.detectionConfigsSyncer = control.NewDetectionConfigsSyncer(logger, replayer.state,
+		replayer.detectionRequestsHandler)
+
+	return replayer, nil
+}
+
+// Replays the whole trace, and compares the resulting reports to the recorded ones.
+func (r *Replayer) Run() (*Result, error) {
+	if err := r.detectionRequestsHandler.Start(); err != nil {
+		return nil, errors.WithMessage(err, "start detection requests handler")
+	}
+
+	r.waitGroup.Add(1)
+	go r.handleDetectionRequests()
+
+	result := &Result{
+		Reports:    make([]map[string]interface{}, 0),
+		Mismatches: make([]string, 0),
+	}
+	recordedReports := make([]map[string]interface{}, 0)
+
+	for i, event := range r.events {
+		r.clock.advanceTo(r.context, event.Time)
+		funcLogger := r.logger.With(zap.String("Type", string(event.Type)), zap.Time("TraceTime", r.clock.Now()))
+		funcLogger.Debug("Replay event")
+
+		switch event.Type {
+		case trace.EventTypeDetectionConfigs:
+			r.replayDetectionConfigs(event)
+		case trace.EventTypeCaughtSignal:
+			r.operators.setHeldFor(recordedHeldFor(r.events[i+1:]))
+			report, err := r.replayCaughtSignal(event.CaughtSignal)
+			if err != nil {
+				result.Mismatches = append(result.Mismatches, fmt.Sprintf("caught signal '%d' for pid '%d': %s",
+					event.CaughtSignal.Signal, event.CaughtSignal.Pid, err.Error()))
+				continue
+			}
+			result.Reports = append(result.Reports, report)
+		case trace.EventTypeReport:
+			if isOomKillReport(event.Report) {
+				funcLogger.Debug("Skip recorded OOM kill report, as OOM kills aren't replayed")
+				continue
+			}
+			recordedReports = append(recordedReports, event.Report)
+		case trace.EventTypeProcessExit:
+			if r.state.ExpireDetectionConfig(event.ExitedPid) == nil {
+				funcLogger.Debug("No detection config to expire", zap.Int32("Pid", int32(event.ExitedPid)))
+			}
+		}
+	}
+
+	if err := r.stop(); err != nil {
+		return nil, err
+	}
+
+	mismatches, err := r.compare(recordedReports, result.Reports)
+	if err != nil {
+		return nil, err
+	}
+	result.Mismatches = append(result.Mismatches, mismatches...)
+
+	return result, nil
+}
+
+func (r *Replayer) replayDetectionConfigs(event *trace.Event) {
+	r.expiredPids = make(map[types.Pid]bool, len(event.ExpiredPids))
+	for _, pid := range event.ExpiredPids {
+		r.expiredPids[pid] = true
+	}
+
+	detectionConfigs := make(map[types.Pid]*models.DetectionConfiguration, len(event.DetectionConfigs))
+	r.signalMasks = make(map[types.Pid]uint32, len(event.DetectionConfigs))
+	for _, detectionConfig := range event.DetectionConfigs {
+		detectionConfigs[detectionConfig.Pid] = detectionConfig
+		if detectionConfig.IsRelevant && detectionConfig.DetectSignals {
+			if signalMask, err := detectionConfig.SignalMask(); err == nil {
+				r.signalMasks[detectionConfig.Pid] = signalMask.Uint32()
+			}
+		}
+	}
+
+	// Recorded configs were already expanded against the recording host's processes, and are synced as they were.
+	r.detectionConfigsSyncer.Sync(detectionConfigs)
+}
+
+func (r *Replayer) validateProcess(detectionConfig *models.DetectionConfiguration) error {
+	if r.expiredPids[detectionConfig.Pid] {
+		return statePkg.ErrExpiredDetectionConfig
+	}
+	return nil
+}
+
+// Injects a recorded caught signal once its process is watched, and waits for the resulting report.
+//
+// Just like the kernel module, the simulator stops watching a process once its caught signal is released, whereas
+// recorded processes might catch several signals (e.g, when watched anew by a restarted agent), so processes still
+// configured for signal detection are watched again once reported.
+func (r *Replayer) replayCaughtSignal(recordedSignal *kernelComm.PayloadCaughtSignal) (map[string]interface{},
+	error) {
+	caughtSignal := *recordedSignal // Simulator might fill in missing fields.
+	if caughtSignal.Timestamp == 0 {
+		caughtSignal.Timestamp = uint64(r.clock.Now().UnixNano())
+	}
+
+	timeout := time.NewTimer(r.config.EventTimeout)
+	defer timeout.Stop()
+
+	if err := r.waitUntilWatched(caughtSignal.Pid, timeout.C); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.simulator.InjectCaughtSignal(&caughtSignal); err != nil {
+		return nil, errors.WithMessage(err, "inject caught signal")
+	}
+
+	select {
+	case <-r.context.Done():
+		return nil, errors.New("replay was stopped")
+	case <-timeout.C:
+		return nil, errors.New("timed out waiting for report")
+	case report, ok := <-r.detectionController.DetectionReportsChan():
+		if !ok {
+			return nil, errors.New("detection reports channel was closed unexpectedly")
+		}
+
+		if signalMask, configured := r.signalMasks[types.Pid(caughtSignal.Pid)]; configured {
+			if err := r.simulator.WatchProcess(caughtSignal.Pid, signalMask); err != nil &&
+				err != kernelComm.ErrProcessAlreadyWatched {
+				return nil, errors.WithMessage(err, "watch process again")
+			}
+		}
+		return report, nil
+	}
+}
+
+// Detectors are started asynchronously, so a replayed signal might otherwise be injected before its detector
+// watches the process.
+func (r *Replayer) waitUntilWatched(pid uint32, timeout <-chan time.Time) error {
+	ticker := time.NewTicker(watchPollingInterval)
+	defer ticker.Stop()
+
+	for {
+		watchedPids, err := r.simulator.ListWatchedProcesses()
+		if err != nil {
+			return errors.WithMessage(err, "list watched processes")
+		}
+
+		for _, watchedPid := range watchedPids {
+			if watchedPid == pid {
+				return nil
+			}
+		}
+
+		select {
+		case <-r.context.Done():
+			return errors.New("replay was stopped")
+		case <-timeout:
+			return errors.New("process was not watched by any detector")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replayer) handleDetectionRequests() {
+	defer r.waitGroup.Done()
+
+	for {
+		select {
+		case <-r.context.Done():
+			return
+		case detectionRequest := <-r.state.DetectionRequestsChan():
+			// OOM kill detectors follow the host's kernel log, and OOM kills aren't recorded anyway.
+			if detectionRequest.RequestType() == requests.RequestTypeDetectOomKills {
+				continue
+			}
+
+			if err := r.detectionRequestsHandler.Handle(r.context, r.logger, detectionRequest); err != nil {
+				r.logger.Error("Failed to handle detection request", zap.Error(err),
+					zap.Int("RequestType", detectionRequest.RequestType().Int()))
+			}
+		}
+	}
+}
+
+// Reports follow their caught signals, so a caught signal was held for as long as the next recorded signal report says.
+func recordedHeldFor(followingEvents []*trace.Event) time.Duration {
+	for _, event := range followingEvents {
+		if event.Type != trace.EventTypeReport || isOomKillReport(event.Report) {
+			continue
+		}
+
+		if heldFor, ok := event.Report["signal_held_for_ms"].(float64); ok {
+			return time.Duration(heldFor) * time.Millisecond
+		}
+		return 0
+	}
+	return 0
+}
+
+func isOomKillReport(report map[string]interface{}) bool {
+	_, found := report["oom_kill"]
+	return found
+}
+
+func (r *Replayer) compare(recordedReports, replayedReports []map[string]interface{}) ([]string, error) {
+	mismatches := make([]string, 0)
+	if len(recordedReports) != len(replayedReports) {
+		mismatches = append(mismatches, fmt.Sprintf("recorded %d reports, replayed %d", len(recordedReports),
+			len(replayedReports)))
+	}
+
+	for i := 0; i < len(recordedReports) && i < len(replayedReports); i++ {
+		differences, err := compareReports(recordedReports[i], replayedReports[i])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "compare report #%d", i+1)
+		}
+
+		for _, difference := range differences {
+			mismatches = append(mismatches, fmt.Sprintf("report #%d: %s", i+1, difference))
+		}
+	}
+	return mismatches, nil
+}
+
+func (r *Replayer) stop() error {
+	if err := r.detectionRequestsHandler.Stop(); err != nil {
+		return errors.WithMessage(err, "stop detection requests handler")
+	}
+
+	r.cancel()
+	r.waitGroup.Wait()
+	r.detectionRequestsHandler.WaitUntilCompletion()
+	return nil
+}
@@ -0,0 +1,99 @@
+package replay
+
+import (
+	kernelComm "github.com/memlab/agent/internal/kernel/communication"
+	"github.com/memlab/agent/internal/trace"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Recorded by an agent holding signals of a single process, whose second signal exhausted the hold budget. It also
+// holds a recorded OOM kill report and a config of a process which had exited by the time it was fetched.
+const testTrace = "testdata/signals.trace"
+
+func replayTestTrace(t *testing.T, modify func(events []*trace.Event) []*trace.Event) *Result {
+	events, err := trace.ReadEvents(testTrace)
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	if modify != nil {
+		events = modify(events)
+	}
+
+	config := &Config{
+		MaxConcurrentDetectors: 4,
+		EventTimeout:           time.Second,
+	}
+	replayer, err := NewReplayer(zap.NewNop(), config, events)
+	if err != nil {
+		t.Fatalf("new replayer: %v", err)
+	}
+
+	result, err := replayer.Run()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return result
+}
+
+func TestReplayMatchesRecording(t *testing.T) {
+	result := replayTestTrace(t, nil)
+
+	if !result.Matches() {
+		t.Errorf("mismatches = %v, expected none", result.Mismatches)
+	}
+	if len(result.Reports) != 2 {
+		t.Fatalf("replayed %d reports, expected 2", len(result.Reports))
+	}
+
+	expected := []struct {
+		signal        float64
+		heldFor       float64
+		releasedEarly bool
+	}{
+		{6, 40, false},
+		{11, 100, true},
+	}
+	for i, report := range result.Reports {
+		normalized, err := normalizeReport(report)
+		if err != nil {
+			t.Fatalf("normalize report #%d: %v", i+1, err)
+		}
+
+		if normalized["signal"] != expected[i].signal || normalized["signal_held_for_ms"] != expected[i].heldFor ||
+			normalized["signal_hold_released_early"] != expected[i].releasedEarly {
+			t.Errorf("report #%d = %v, expected signal %.0f held for %.0fms (released early: %t)", i+1, normalized,
+				expected[i].signal, expected[i].heldFor, expected[i].releasedEarly)
+		}
+	}
+}
+
+func TestReplayReportsMismatches(t *testing.T) {
+	result := replayTestTrace(t, func(events []*trace.Event) []*trace.Event {
+		for _, event := range events {
+			if event.Type == trace.EventTypeReport && event.Report["signal"] == 6.0 {
+				event.Report["signal_tid"] = 4251.0
+			}
+		}
+
+		// Signal of the process which had exited, thus was never watched.
+		return append(events, &trace.Event{
+			Type:         trace.EventTypeCaughtSignal,
+			Time:         events[len(events)-1].Time,
+			CaughtSignal: &kernelComm.PayloadCaughtSignal{Pid: 4343, Signal: 6},
+		})
+	})
+
+	expected := []string{
+		"caught signal '6' for pid '4343': process was not watched by any detector",
+		"report #1: 'signal_tid': recorded 4251, replayed 4250",
+	}
+	if !reflect.DeepEqual(result.Mismatches, expected) {
+		t.Errorf("mismatches = %v, expected %v", result.Mismatches, expected)
+	}
+	if result.Matches() {
+		t.Error("replay matches, even though reports differ")
+	}
+}
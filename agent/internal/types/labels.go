@@ -0,0 +1,163 @@
+package types
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type labelOperator string
+
+const (
+	labelEquals       labelOperator = "="
+	labelNotEquals    labelOperator = "!="
+	labelIn           labelOperator = "in"
+	labelNotIn        labelOperator = "notin"
+	labelExists       labelOperator = "exists"
+	labelDoesNotExist labelOperator = "!"
+)
+
+type labelRequirement struct {
+	key      string
+	operator labelOperator
+	values   []string
+}
+
+// LabelSelector is a parsed Kubernetes label selector, e.g "app=web,tier!=db,env in (prod,staging),!canary".
+// Requirements are ANDed, and an empty selector matches everything.
+type LabelSelector struct {
+	requirements []*labelRequirement
+}
+
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+	parts, err := splitLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	labelSelector := &LabelSelector{}
+	for _, part := range parts {
+		requirement, err := parseLabelRequirement(part)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse requirement '%s'", part)
+		}
+		labelSelector.requirements = append(labelSelector.requirements, requirement)
+	}
+
+	return labelSelector, nil
+}
+
+// Splits on commas, except for those within value sets.
+func splitLabelSelector(selector string) ([]string, error) {
+	var parts []string
+	var depth, start int
+
+	for i, char := range selector {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	parts = append(parts, selector[start:])
+
+	if len(parts) == 1 && strings.TrimSpace(parts[0]) == "" {
+		return nil, nil
+	}
+	return parts, nil
+}
+
+func parseLabelRequirement(requirement string) (*labelRequirement, error) {
+	requirement = strings.TrimSpace(requirement)
+
+	if strings.HasPrefix(requirement, "!") {
+		return newLabelRequirement(requirement[1:], labelDoesNotExist, nil)
+	}
+
+	for _, operator := range []string{"!=", "==", "="} {
+		if index := strings.Index(requirement, operator); index != -1 {
+			value := strings.TrimSpace(requirement[index+len(operator):])
+			if operator == "!=" {
+				return newLabelRequirement(requirement[:index], labelNotEquals, []string{value})
+			}
+			return newLabelRequirement(requirement[:index], labelEquals, []string{value})
+		}
+	}
+
+	if fields := strings.Fields(requirement); len(fields) > 1 {
+		key, operator := fields[0], labelOperator(fields[1])
+		if operator != labelIn && operator != labelNotIn {
+			return nil, errors.Errorf("unknown operator '%s'", operator)
+		}
+
+		valueSet := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(requirement[len(key):]), fields[1]))
+		if !strings.HasPrefix(valueSet, "(") || !strings.HasSuffix(valueSet, ")") {
+			return nil, errors.Errorf("value set '%s' isn't in parentheses", valueSet)
+		}
+
+		var values []string
+		for _, value := range strings.Split(valueSet[1:len(valueSet)-1], ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+		return newLabelRequirement(key, operator, values)
+	}
+
+	return newLabelRequirement(requirement, labelExists, nil)
+}
+
+func newLabelRequirement(key string, operator labelOperator, values []string) (*labelRequirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, errors.New("empty label key")
+	} else if strings.ContainsAny(key, " \t()!=") {
+		return nil, errors.Errorf("invalid label key '%s'", key)
+	}
+
+	return &labelRequirement{key: key, operator: operator, values: values}, nil
+}
+
+func (ls *LabelSelector) Matches(labels map[string]string) bool {
+	for _, requirement := range ls.requirements {
+		if !requirement.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (lr *labelRequirement) matches(labels map[string]string) bool {
+	value, exists := labels[lr.key]
+
+	switch lr.operator {
+	case labelExists:
+		return exists
+	case labelDoesNotExist:
+		return !exists
+	case labelEquals, labelIn:
+		return exists && lr.hasValue(value)
+	case labelNotEquals, labelNotIn:
+		return !exists || !lr.hasValue(value)
+	}
+
+	return false
+}
+
+func (lr *labelRequirement) hasValue(value string) bool {
+	for _, requirementValue := range lr.values {
+		if requirementValue == value {
+			return true
+		}
+	}
+	return false
+}
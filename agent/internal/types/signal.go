@@ -0,0 +1,35 @@
+package types
+
+import (
+	"github.com/pkg/errors"
+	"syscall"
+)
+
+// Highest signal the kernel module can intercept (see is_signal_relevant() in kernel/ml_crash_detector.c).
+const maxMaskableSignal = syscall.SIGSYS
+
+// SignalMask is a bitmask of signals, where bit (n - 1) stands for signal n. Zero means the kernel module's
+// default mask.
+type SignalMask uint32
+
+func NewSignalMask(signals ...int) (SignalMask, error) {
+	var mask SignalMask
+	for _, signal := range signals {
+		if signal <= 0 || signal > int(maxMaskableSignal) {
+			return 0, errors.Errorf("invalid signal '%d' (max: '%d')", signal, maxMaskableSignal)
+		}
+		mask |= 1 << uint(signal-1)
+	}
+	return mask, nil
+}
+
+func (m SignalMask) Contains(signal syscall.Signal) bool {
+	if signal <= 0 || signal > maxMaskableSignal {
+		return false
+	}
+	return m&(1<<uint(signal-1)) != 0
+}
+
+func (m SignalMask) Uint32() uint32 {
+	return uint32(m)
+}
@@ -0,0 +1,26 @@
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('hosts', '0005_detectionconfig_is_relevant'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='process_exit_code',
+            field=models.IntegerField(blank=True, null=True),
+        ),
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='process_exit_signal',
+            field=models.IntegerField(blank=True, null=True),
+        ),
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='process_exited_at',
+            field=models.DateTimeField(blank=True, null=True),
+        ),
+    ]
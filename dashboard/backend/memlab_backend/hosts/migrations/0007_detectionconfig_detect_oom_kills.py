@@ -0,0 +1,16 @@
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('hosts', '0006_detectionconfig_process_exit'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='detect_oom_kills',
+            field=models.BooleanField(default=False),
+        ),
+    ]
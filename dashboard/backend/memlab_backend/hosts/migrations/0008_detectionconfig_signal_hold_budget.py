@@ -0,0 +1,16 @@
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('hosts', '0007_detectionconfig_detect_oom_kills'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='signal_hold_budget',
+            field=models.PositiveIntegerField(blank=True, null=True),
+        ),
+    ]
@@ -0,0 +1,16 @@
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('hosts', '0008_detectionconfig_signal_hold_budget'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='detectionconfig',
+            name='signals',
+            field=models.JSONField(blank=True, default=list),
+        ),
+    ]
@@ -105,13 +105,19 @@ class DetectionConfig(models.Model):
     created_at = models.DateTimeField(auto_now_add=True)
     modified_at = models.DateTimeField(auto_now=True)
     detect_signals = models.BooleanField(default=False)
+    signals = models.JSONField(default=list, blank=True)  # Signal numbers, kernel module's defaults if empty.
     detect_thresholds = models.BooleanField(default=False)
     detect_suspected_hangs = models.BooleanField(default=False)
+    detect_oom_kills = models.BooleanField(default=False)
     cpu_threshold = models.IntegerField(null=True, blank=True)
     memory_threshold = models.IntegerField(null=True, blank=True)
     suspected_hang_duration = models.DurationField(null=True, blank=True)
+    signal_hold_budget = models.PositiveIntegerField(null=True, blank=True)  # Milliseconds, agent's default if null.
     restart_on_signal = models.BooleanField(default=True)
     restart_on_cpu_threshold = models.BooleanField(default=False)
     restart_on_memory_threshold = models.BooleanField(default=False)
     restart_on_suspected_hang = models.BooleanField(default=False)
     is_relevant = models.BooleanField(default=True)
+    process_exit_code = models.IntegerField(null=True, blank=True)
+    process_exit_signal = models.IntegerField(null=True, blank=True)
+    process_exited_at = models.DateTimeField(null=True, blank=True)
@@ -63,6 +63,12 @@ class DetectionConfigSerializer(serializers.ModelSerializer):
         read_only_fields = ["id"]
         exclude = ["user", "process"]
 
+    def validate_signals(self, value):
+        # Agents build a signal mask of them, see types.NewSignalMask().
+        if not isinstance(value, list) or any(type(signal) is not int or not 1 <= signal <= 31 for signal in value):
+            raise serializers.ValidationError("Must be a list of signal numbers between 1 and 31 (SIGSYS).")
+        return value
+
     def get_pid(self, obj):
         return obj.process.pid
 
@@ -122,11 +122,15 @@ class DetectionConfigViewSet(mixins.CreateModelMixin, mixins.RetrieveModelMixin,
 
     @decorators.action(detail=False, methods=['post'], url_path='mark_irrelevant')
     def mark_irrelevant(self, request, record_id):
-        instance = models.DetectionConfig.objects.get(uset__id=self.request.user.id, id=record_id)
+        instance = models.DetectionConfig.objects.get(user__id=self.request.user.id, id=record_id)
         if not instance.is_relevant:  # It's already set as irrelevant
             return Response(status=status.HTTP_200_OK)
 
         instance.is_relevant = False
+        # Only sent by the agent when the config expired due to its process' exit.
+        instance.process_exit_code = request.data.get('process_exit_code')
+        instance.process_exit_signal = request.data.get('process_exit_signal')
+        instance.process_exited_at = request.data.get('process_exited_at')
         instance.save()
 
         return Response(status=status.HTTP_200_OK)
@@ -54,6 +54,10 @@ static int utk_handle_monitor_process_command(struct sk_buff *skb, struct genl_i
 
     pid_t pid = (pid_t) nla_get_u32(info->attrs[ML_ATTRIBUTE_PID]);
     uint8_t do_watch = nla_get_u8(info->attrs[ML_ATTRIBUTE_MONITOR_DO_WATCH]);
+    uint32_t signals_mask = 0; // Default mask.
+    if (info->attrs[ML_ATTRIBUTE_SIGNAL_MASK]) {
+        signals_mask = nla_get_u32(info->attrs[ML_ATTRIBUTE_SIGNAL_MASK]);
+    }
 
     int err;
     if (do_watch) {
@@ -61,10 +65,13 @@ static int utk_handle_monitor_process_command(struct sk_buff *skb, struct genl_i
 
         if (is_process_watched(pid)) {
             pr_info("[ML Crash Detector] Process is already watched: %d.\n", pid);
-            return -EINVAL;
+
+            // Lets the agent re-adopt processes it watched before it restarted, with their current mask.
+            set_watched_process_signals_mask(pid, signals_mask);
+            return -EEXIST;
         }
 
-        if (!add_process_to_watched_processes(pid)) {
+        if (!add_process_to_watched_processes(pid, signals_mask)) {
             pr_err("[ML Crash Detector] Failed to add process to watched processes: (pid: %d, err: %d).\n", pid, err);
             return -EINVAL;
         }
@@ -103,12 +110,113 @@ static int utk_handle_handled_caught_signal_command(struct sk_buff *skb, struct
     return 0;
 }
 
+static int utk_handle_get_protocol_info_command(struct sk_buff *skb, struct genl_info *info) {
+    pr_info("[ML Crash Detector] utk_handle_get_protocol_info_command() start.\n");
+
+    struct sk_buff *reply;
+    void *msg_head;
+    int err;
+
+    reply = genlmsg_new(NLMSG_GOODSIZE, GFP_KERNEL);
+    if (!reply) {
+        pr_err("[ML Crash Detector] genlmsg_new() failed.\n");
+        return -ENOMEM;
+    }
+
+    msg_head = genlmsg_put_reply(reply, info, &ml_usr_to_kern_family, 0, ML_COMMAND_GET_PROTOCOL_INFO);
+    if (!msg_head) {
+        pr_err("[ML Crash Detector] genlmsg_put_reply() failed.\n");
+        kfree_skb(reply);
+        return -ENOMEM;
+    }
+
+    err = nla_put_u32(reply, ML_ATTRIBUTE_PROTOCOL_VERSION, ML_PROTOCOL_VERSION) ||
+          nla_put_string(reply, ML_ATTRIBUTE_MODULE_VERSION, ML_MODULE_VERSION) ||
+          nla_put_u32(reply, ML_ATTRIBUTE_SUPPORTED_COMMANDS, ML_SUPPORTED_COMMANDS);
+    if (err) {
+        pr_err("[ML Crash Detector] Protocol info nla_put() failed.\n");
+        kfree_skb(reply);
+        return -EMSGSIZE;
+    }
+
+    genlmsg_end(reply, msg_head);
+
+    pr_info("[ML Crash Detector] utk_handle_get_protocol_info_command() done.\n");
+    return genlmsg_reply(reply, info);
+}
+
+static int utk_handle_list_watched_processes_command(struct sk_buff *skb, struct genl_info *info) {
+    pr_info("[ML Crash Detector] utk_handle_list_watched_processes_command() start.\n");
+
+    struct sk_buff *reply;
+    void *msg_head;
+    pid_t *pids;
+    pid_t after = 0; // Optional, lists pids following the last one of a truncated reply.
+    bool truncated;
+    int count, i, err = 0;
+
+    if (info->attrs[ML_ATTRIBUTE_PID]) {
+        after = (pid_t) nla_get_u32(info->attrs[ML_ATTRIBUTE_PID]);
+    }
+
+    pids = kmalloc_array(ML_MAX_LISTED_PROCESSES, sizeof(pid_t), GFP_KERNEL);
+    if (!pids) {
+        return -ENOMEM;
+    }
+
+    count = list_watched_processes(pids, ML_MAX_LISTED_PROCESSES, after, &truncated);
+
+    reply = genlmsg_new(NLMSG_GOODSIZE, GFP_KERNEL);
+    if (!reply) {
+        pr_err("[ML Crash Detector] genlmsg_new() failed.\n");
+        err = -ENOMEM;
+        goto exit;
+    }
+
+    msg_head = genlmsg_put_reply(reply, info, &ml_usr_to_kern_family, 0, ML_COMMAND_LIST_WATCHED_PROCESSES);
+    if (!msg_head) {
+        pr_err("[ML Crash Detector] genlmsg_put_reply() failed.\n");
+        kfree_skb(reply);
+        err = -ENOMEM;
+        goto exit;
+    }
+
+    // Each watched process is sent as a separate pid attribute.
+    for (i = 0; i < count; i++) {
+        if (nla_put_u32(reply, ML_ATTRIBUTE_PID, pids[i])) {
+            pr_err("[ML Crash Detector] Pid nla_put_u32() failed.\n");
+            kfree_skb(reply);
+            err = -EMSGSIZE;
+            goto exit;
+        }
+    }
+
+    if (nla_put_u8(reply, ML_ATTRIBUTE_LIST_TRUNCATED, truncated)) {
+        pr_err("[ML Crash Detector] Truncated nla_put_u8() failed.\n");
+        kfree_skb(reply);
+        err = -EMSGSIZE;
+        goto exit;
+    }
+
+    genlmsg_end(reply, msg_head);
+    err = genlmsg_reply(reply, info);
+
+    exit:
+    kfree(pids);
+    pr_info("[ML Crash Detector] utk_handle_list_watched_processes_command() done (count: %d, truncated: %d).\n",
+            count, truncated);
+    return err;
+}
+
 static int ktu_handle_notify_caught_signal_command(struct sk_buff *skb, struct genl_info *info) {
     return 0;
 }
 
-int ktu_send_caught_signal_notification(pid_t pid, uint32_t signal) {
-    pr_info("[ML Crash Detector] ktu_send_caught_signal_notification(%d, %d, %s) start.\n", pid, signal);
+int ktu_send_caught_signal_notification(struct ml_caught_signal_t *caught_signal) {
+    pid_t pid = caught_signal->pid;
+    uint32_t signal = caught_signal->signal;
+
+    pr_info("[ML Crash Detector] ktu_send_caught_signal_notification(%d, %d) start.\n", pid, signal);
 
     struct sk_buff *skb;
     void *msg_head;
@@ -141,6 +249,19 @@ int ktu_send_caught_signal_notification(pid_t pid, uint32_t signal) {
         goto exit;
     }
 
+    // Siginfo details - older agents ignore attributes they don't know about.
+    err = nla_put_u32(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TID, caught_signal->tid) ||
+          nla_put_u32(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_PID, caught_signal->sender_pid) ||
+          nla_put_u32(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_UID, caught_signal->sender_uid) ||
+          nla_put_u32(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_CODE, (uint32_t) caught_signal->code) ||
+          nla_put_u64_64bit(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_FAULT_ADDRESS, caught_signal->fault_address, 0) ||
+          nla_put_u64_64bit(skb, ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TIMESTAMP, caught_signal->timestamp, 0);
+    if (err) {
+        pr_err("[ML Crash Detector] Siginfo nla_put() failed.\n");
+        kfree_skb(skb);
+        goto exit;
+    }
+
     genlmsg_end(skb, msg_head);
 
     err = genlmsg_multicast_allns(&ml_kern_to_usr_family, skb, 0, 0, GFP_KERNEL);
@@ -10,10 +10,16 @@
 #define MEMLAB_USR_TO_KERN_FAMILY "memlab-utk"
 #define MEMLAB_KERN_TO_USR_FAMILY "memlab-ktu"
 
+// Bump whenever commands or attributes are added (see ProtocolVersion in agent's communicator.go).
+#define ML_PROTOCOL_VERSION 2
+#define ML_MODULE_VERSION "0.3.0"
+
 enum ml_usr_to_kern_commands {
     // Do no change order of anything, this is ABI!
     ML_COMMAND_MONITOR_PROCESS,
     ML_COMMAND_HANDLED_CAUGHT_SIGNAL,
+    ML_COMMAND_GET_PROTOCOL_INFO,
+    ML_COMMAND_LIST_WATCHED_PROCESSES,
 };
 
 enum ml_kern_to_usr_commands {
@@ -27,6 +33,17 @@ enum ml_detector_attribute_ids {
     ML_ATTRIBUTE_PID = 1,
     ML_ATTRIBUTE_MONITOR_DO_WATCH,
     ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SIGNAL,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TID,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_PID,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_UID,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_CODE,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_FAULT_ADDRESS,
+    ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TIMESTAMP,
+    ML_ATTRIBUTE_PROTOCOL_VERSION,
+    ML_ATTRIBUTE_MODULE_VERSION,
+    ML_ATTRIBUTE_SUPPORTED_COMMANDS,
+    ML_ATTRIBUTE_SIGNAL_MASK,
+    ML_ATTRIBUTE_LIST_TRUNCATED,
 
     // This is a special one, don't list any more after this.
     ML_ATTRIBUTE_COUNT,
@@ -37,6 +54,41 @@ struct nla_policy const static ml_generic_nl_policy[ML_ATTRIBUTE_COUNT] = {
         [ML_ATTRIBUTE_PID] = {.type = NLA_U32},
         [ML_ATTRIBUTE_MONITOR_DO_WATCH] = {.type = NLA_U8}, // 1 - watch, 0 - unwatch
         [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SIGNAL] = {.type = NLA_U32},
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TID] = {.type = NLA_U32},
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_PID] = {.type = NLA_U32},
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_SENDER_UID] = {.type = NLA_U32},
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_CODE] = {.type = NLA_U32}, // si_code, signed on the receiving end
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_FAULT_ADDRESS] = {.type = NLA_U64},
+        [ML_ATTRIBUTE_SIGNAL_NOTIFICATION_TIMESTAMP] = {.type = NLA_U64}, // ns since epoch
+        [ML_ATTRIBUTE_PROTOCOL_VERSION] = {.type = NLA_U32},
+        [ML_ATTRIBUTE_MODULE_VERSION] = {.type = NLA_NUL_STRING},
+        [ML_ATTRIBUTE_SUPPORTED_COMMANDS] = {.type = NLA_U32}, // Bitmask of ml_usr_to_kern_commands
+        [ML_ATTRIBUTE_SIGNAL_MASK] = {.type = NLA_U32}, // Optional, bit (n - 1) for signal n
+        [ML_ATTRIBUTE_LIST_TRUNCATED] = {.type = NLA_U8}, // 1 - more pids follow the last listed one
+};
+
+#define ML_COMMAND_MASK(cmd) (1 << (cmd))
+
+#define ML_SUPPORTED_COMMANDS ( \
+        ML_COMMAND_MASK(ML_COMMAND_MONITOR_PROCESS) | \
+        ML_COMMAND_MASK(ML_COMMAND_HANDLED_CAUGHT_SIGNAL) | \
+        ML_COMMAND_MASK(ML_COMMAND_GET_PROTOCOL_INFO) | \
+        ML_COMMAND_MASK(ML_COMMAND_LIST_WATCHED_PROCESSES))
+
+// Upper bound of pids listed in a single reply, which must fit in NLMSG_GOODSIZE. Pids are listed in ascending order,
+// after the request's pid attribute (if any), so larger lists are fetched by requesting again after the last listed
+// pid for as long as replies are flagged as truncated.
+#define ML_MAX_LISTED_PROCESSES 256
+
+struct ml_caught_signal_t {
+    pid_t pid;
+    pid_t tid;
+    uint32_t signal;
+    pid_t sender_pid;
+    uid_t sender_uid;
+    int32_t code;
+    uint64_t fault_address;
+    uint64_t timestamp;
 };
 
 int setup_communication_sockets(void);
@@ -47,9 +99,13 @@ static int utk_handle_monitor_process_command(struct sk_buff *skb, struct genl_i
 
 static int utk_handle_handled_caught_signal_command(struct sk_buff *skb, struct genl_info *info);
 
+static int utk_handle_get_protocol_info_command(struct sk_buff *skb, struct genl_info *info);
+
+static int utk_handle_list_watched_processes_command(struct sk_buff *skb, struct genl_info *info);
+
 static int ktu_handle_notify_caught_signal_command(struct sk_buff *skb, struct genl_info *info);
 
-int ktu_send_caught_signal_notification(pid_t pid, uint32_t signal);
+int ktu_send_caught_signal_notification(struct ml_caught_signal_t *caught_signal);
 
 const static struct genl_ops usr_to_kern_ops[] = {
         {
@@ -66,6 +122,22 @@ const static struct genl_ops usr_to_kern_ops[] = {
 #if LINUX_VERSION_CODE < KERNEL_VERSION(5, 2, 0)
                 /* Before kernel 5.2, each op had its own policy. */
                 .policy = ml_generic_nl_policy,
+#endif
+        },
+        {
+                .cmd = ML_COMMAND_GET_PROTOCOL_INFO,
+                .doit = utk_handle_get_protocol_info_command,
+#if LINUX_VERSION_CODE < KERNEL_VERSION(5, 2, 0)
+                /* Before kernel 5.2, each op had its own policy. */
+                .policy = ml_generic_nl_policy,
+#endif
+        },
+        {
+                .cmd = ML_COMMAND_LIST_WATCHED_PROCESSES,
+                .doit = utk_handle_list_watched_processes_command,
+#if LINUX_VERSION_CODE < KERNEL_VERSION(5, 2, 0)
+                /* Before kernel 5.2, each op had its own policy. */
+                .policy = ml_generic_nl_policy,
 #endif
         },
 };
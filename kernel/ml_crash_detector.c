@@ -25,6 +25,7 @@
 #include <linux/mmu_notifier.h>
 #include <linux/elf.h>
 #include <linux/delay.h>
+#include <linux/timekeeping.h>
 #include <linux/fs.h>
 #include <linux/uaccess.h>
 #include <asm/siginfo.h>
@@ -39,6 +40,8 @@
 #include "state.h"
 #include "communication.h"
 
+MODULE_VERSION(ML_MODULE_VERSION);
+
 // todo: do not allow to add ml's agent pid
 
 // todo: move to some process.h (and also impl inside state.h)
@@ -59,16 +62,28 @@ struct task_struct *get_task_by_pid(pid_t pid) {
     return t;
 }
 
-bool is_signal_relevant(int sig) {
-    if (sig > SIGSYS || sig <= 0) { // SIGSYS is 31.
+bool is_signal_valid(int sig) {
+    return sig > 0 && sig <= SIGSYS; // SIGSYS is 31.
+}
+
+// Uses the process' own mask if the agent configured one, otherwise falls back to the default mask.
+bool is_signal_relevant(pid_t pid, int sig) {
+    u32 mask;
+
+    if (!is_signal_valid(sig)) {
         return false;
     }
 
-    if (relevant_signals_mask & SIGNAL_MASK(sig)) {
-        return true;
+    mask = get_watched_process_signals_mask(pid);
+    if (!mask) {
+        mask = relevant_signals_mask;
     }
 
-    return false;
+    return (mask & SIGNAL_MASK(sig)) != 0;
+}
+
+bool is_fault_signal(int sig) {
+    return sig == SIGSEGV || sig == SIGBUS || sig == SIGILL || sig == SIGFPE || sig == SIGTRAP;
 }
 
 bool is_task_relevant(struct task_struct *dst) {
@@ -174,9 +189,10 @@ void teardown_hooks(struct ftrace_hook *hooks, size_t count) {
 
 static asmlinkage void internal_kill(pid_t pid, int sig) {
     struct task_struct *from, *to;
+    struct ml_caught_signal_t caught_signal = {0};
     int err;
 
-    if (!is_signal_relevant(sig)) {
+    if (!is_signal_valid(sig)) {
         return;
     }
 
@@ -187,7 +203,7 @@ static asmlinkage void internal_kill(pid_t pid, int sig) {
         return;
     }
 
-    if (!is_task_relevant(to)) {
+    if (!is_task_relevant(to) || !is_signal_relevant(to->pid, sig)) {
         put_task_struct(to);
         return;
     }
@@ -196,9 +212,17 @@ static asmlinkage void internal_kill(pid_t pid, int sig) {
             "===========sys_kill==========\n"
             "user:%d process:%d[%s] send SIG %d to %d[%s]\n",
             (int) from_kuid(&init_user_ns, current_uid()), from->pid, from->comm, sig, to->pid, to->comm);
+
+    caught_signal.pid = pid;
+    caught_signal.tid = to->pid;
+    caught_signal.signal = sig;
+    caught_signal.sender_pid = from->tgid;
+    caught_signal.sender_uid = from_kuid(&init_user_ns, current_uid());
+    caught_signal.code = SI_USER; // kill(2) always sends SI_USER.
+    caught_signal.timestamp = ktime_get_real_ns();
     put_task_struct(to);
 
-    if ((err = ktu_send_caught_signal_notification(pid, sig)) < 0) {
+    if ((err = ktu_send_caught_signal_notification(&caught_signal)) < 0) {
         pr_err("[ML Crash Detector] Failed to send caught-signal notification: (pid: %d, err: %d).\n", pid, err);
         return;
     }
@@ -235,8 +259,9 @@ static asmlinkage void ml_sys_kill(pid_t pid, int sig) {
 
 #endif
 
-static asmlinkage void internal_force_sig(int sig, struct task_struct *to) {
+static asmlinkage void internal_force_sig(int sig, ml_siginfo_t *info, struct task_struct *to) {
     struct task_struct *from;
+    struct ml_caught_signal_t caught_signal = {0};
     int err;
     pid_t pid;
 
@@ -251,13 +276,14 @@ static asmlinkage void internal_force_sig(int sig, struct task_struct *to) {
 
     pid = to->pid;
 
-    if (!is_signal_relevant(sig)) {
+    if (!is_signal_valid(sig)) {
+        put_task_struct(to);
         goto exit;
     }
 
     from = current;
 
-    if (!is_task_relevant(to)) {
+    if (!is_task_relevant(to) || !is_signal_relevant(pid, sig)) {
         put_task_struct(to);
         goto exit;
     }
@@ -266,9 +292,22 @@ static asmlinkage void internal_force_sig(int sig, struct task_struct *to) {
             "===========prepare_signal==========\n"
             "user:%d process:%d[%s] send SIG %d to %d[%s]\n",
             (int) from_kuid(&init_user_ns, current_uid()), from->pid, from->comm, sig, to->pid, to->comm);
+
+    caught_signal.pid = pid;
+    caught_signal.tid = to->pid;
+    caught_signal.signal = sig;
+    caught_signal.sender_pid = from->tgid;
+    caught_signal.sender_uid = from_kuid(&init_user_ns, current_uid());
+    caught_signal.timestamp = ktime_get_real_ns();
+    if (info) {
+        caught_signal.code = info->si_code;
+        if (is_fault_signal(sig)) {
+            caught_signal.fault_address = (uint64_t) (unsigned long) info->si_addr;
+        }
+    }
     put_task_struct(to);
 
-    if ((err = ktu_send_caught_signal_notification(pid, sig)) < 0) {
+    if ((err = ktu_send_caught_signal_notification(&caught_signal)) < 0) {
         pr_err("[ML Crash Detector] Failed to send caught-signal notification: (pid: %d, err: %d).\n", pid, err);
         goto exit;
     }
@@ -289,7 +328,7 @@ static asmlinkage void internal_force_sig(int sig, struct task_struct *to) {
 static asmlinkage void (*real_force_sig_info_to_task)(struct kernel_siginfo *info, struct task_struct *t);
 
 static asmlinkage void ml_force_sig_info_to_task(struct kernel_siginfo *info, struct task_struct *t) {
-    internal_force_sig(info->si_signo, t);
+    internal_force_sig(info->si_signo, info, t);
     real_force_sig_info_to_task(info, t);
 }
 
@@ -299,7 +338,7 @@ static asmlinkage void ml_force_sig_info_to_task(struct kernel_siginfo *info, st
 static asmlinkage void (*real_force_sig_info)(int sig, struct task_struct *p, int from_ancestor_ns);
 
 static asmlinkage void ml_force_sig_info(int sig, struct siginfo *info, struct task_struct *t) {
-    internal_force_sig(sig, t);
+    internal_force_sig(sig, info, t);
     real_force_sig_info(sig, t, from_ancestor_ns);
 }
 #endif
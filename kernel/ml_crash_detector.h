@@ -72,6 +72,12 @@ MODULE_LICENSE("GPL"); // todo: not GPL?
 
 #define SIGNAL_MASK(sig) (1 << (sig - 1))
 
+#if LINUX_VERSION_CODE > KERNEL_VERSION(5, 2, 0)
+typedef struct kernel_siginfo ml_siginfo_t;
+#else
+typedef struct siginfo ml_siginfo_t;
+#endif
+
 const int wait_timeout_seconds = 60;
 
 struct ftrace_hook {
@@ -118,10 +124,14 @@ static u32 relevant_signals_mask =
         SIGNAL_MASK(SIGIO) |
         SIGNAL_MASK(SIGPOLL);
 
-bool is_signal_relevant(int sig);
+bool is_signal_valid(int sig);
+
+bool is_signal_relevant(pid_t pid, int sig);
 
 bool is_task_relevant(struct task_struct *dst);
 
+bool is_fault_signal(int sig);
+
 static int resolve_hooked_func_address(struct ftrace_hook *hook);
 
 static void notrace
@@ -139,6 +149,6 @@ void teardown_hooks(struct ftrace_hook *hooks, size_t count);
 
 static asmlinkage void internal_kill(pid_t pid, int sig);
 
-static asmlinkage void internal_force_sig(int sig, struct task_struct *to);
+static asmlinkage void internal_force_sig(int sig, ml_siginfo_t *info, struct task_struct *to);
 
 #endif
\ No newline at end of file
@@ -107,7 +107,79 @@ void interrupt_watched_process_wait_queue(pid_t pid) {
     pr_info("[ML Crash Detector] interrupt_watched_process_wait_queue(%d) done.\n", pid);
 }
 
-bool add_process_to_watched_processes(pid_t pid) {
+u32 get_watched_process_signals_mask(pid_t pid) {
+    struct watched_process_t *watched_process;
+    u32 signals_mask = 0;
+
+    spin_lock(&state_lock);
+    watched_process = get_watched_process_unsafe(pid);
+    if (watched_process) {
+        signals_mask = watched_process->signals_mask;
+    }
+    spin_unlock(&state_lock);
+
+    return signals_mask;
+}
+
+void set_watched_process_signals_mask(pid_t pid, u32 signals_mask) {
+    struct watched_process_t *watched_process;
+
+    spin_lock(&state_lock);
+    watched_process = get_watched_process_unsafe(pid);
+    if (watched_process) {
+        watched_process->signals_mask = signals_mask;
+    }
+    spin_unlock(&state_lock);
+}
+
+// Lists the lowest watched pids which are greater than the given one, in ascending order. Since the table isn't
+// ordered, it's walked in full, keeping the listed pids sorted by insertion.
+int list_watched_processes(pid_t *pids, int max_pids, pid_t after, bool *truncated) {
+    struct rhashtable_iter iter;
+    struct watched_process_t *watched_process;
+    pid_t pid;
+    int count = 0, i;
+
+    *truncated = false;
+
+    rhashtable_walk_enter(&watched_processes, &iter);
+    rhashtable_walk_start(&iter);
+
+    while ((watched_process = rhashtable_walk_next(&iter)) != NULL) {
+        if (IS_ERR(watched_process)) {
+            if (PTR_ERR(watched_process) == -EAGAIN) { // Table was resized, keep walking.
+                continue;
+            }
+            break;
+        }
+
+        pid = watched_process->pid;
+        if (pid <= after) {
+            continue;
+        }
+
+        if (count == max_pids) {
+            *truncated = true;
+            if (pid > pids[count - 1]) {
+                continue;
+            }
+            count--; // Evict the highest listed pid in favor of a lower one.
+        }
+
+        for (i = count; i > 0 && pids[i - 1] > pid; i--) {
+            pids[i] = pids[i - 1];
+        }
+        pids[i] = pid;
+        count++;
+    }
+
+    rhashtable_walk_stop(&iter);
+    rhashtable_walk_exit(&iter);
+
+    return count;
+}
+
+bool add_process_to_watched_processes(pid_t pid, u32 signals_mask) {
     pr_info("[ML Crash Detector] add_process_to_watched_processes(%d) start.\n", pid);
 
     int success = false;
@@ -124,6 +196,7 @@ bool add_process_to_watched_processes(pid_t pid) {
     struct watched_process_t *watched_process;
     watched_process = (struct watched_process_t *) kmalloc(sizeof(struct watched_process_t), GFP_KERNEL);
     watched_process->pid = pid;
+    watched_process->signals_mask = signals_mask;
     atomic_set(&watched_process->handled, 0);
     init_waitqueue_head(&watched_process->wait_queue);
     refcount_set(&watched_process->ref, 0);
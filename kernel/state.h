@@ -8,6 +8,7 @@
 
 struct watched_process_t {
     pid_t pid;
+    u32 signals_mask; // 0 - use module's default mask (the agent un-watches processes rather than masking all signals).
     atomic_t handled;
     wait_queue_head_t wait_queue;
     refcount_t ref;
@@ -40,7 +41,13 @@ void wait_on_watched_process_wait_queue(pid_t pid, unsigned long timeout);
 
 void interrupt_watched_process_wait_queue(pid_t pid);
 
-bool add_process_to_watched_processes(pid_t pid);
+u32 get_watched_process_signals_mask(pid_t pid);
+
+void set_watched_process_signals_mask(pid_t pid, u32 signals_mask);
+
+int list_watched_processes(pid_t *pids, int max_pids, pid_t after, bool *truncated);
+
+bool add_process_to_watched_processes(pid_t pid, u32 signals_mask);
 
 bool remove_process_from_watched_processes(pid_t pid);
 